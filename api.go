@@ -2,6 +2,7 @@ package cascache
 
 import (
 	"context"
+	"iter"
 	"time"
 
 	c "github.com/unkn0wn-root/cascache/v3/codec"
@@ -21,16 +22,50 @@ type CAS[V any] interface {
 
 	// Single
 	Get(ctx context.Context, key string) (v V, ok bool, err error)
+	GetWithVersion(ctx context.Context, key string) (v V, version Version, ok bool, err error)
+	GetAtLeast(ctx context.Context, key string, min Version) (v V, ok bool, err error)
 	SnapshotVersion(ctx context.Context, key string) (Version, error)
+	SnapshotVersionWithTags(ctx context.Context, key string, tags ...string) (Version, error)
+	AcquireFill(ctx context.Context, key string) (version Version, granted bool, err error)
 	SetIfVersion(ctx context.Context, key string, value V, version Version) (WriteResult, error)
 	SetIfVersionWithTTL(ctx context.Context, key string, value V, version Version, ttl time.Duration) (WriteResult, error)
+	SetIfVersionAtRevision(ctx context.Context, key string, value V, version Version, revision Revision) (WriteResult, error)
+	SetIfVersionAtRevisionWithTTL(ctx context.Context, key string, value V, version Version, revision Revision, ttl time.Duration) (WriteResult, error)
+	SetAbsentIfVersion(ctx context.Context, key string, version Version) (WriteResult, error)
 	Invalidate(ctx context.Context, key string) error
+	InvalidateWithDelay(ctx context.Context, key string, delays ...time.Duration) error
+	InvalidateWithVersion(ctx context.Context, key string) (Version, error)
+	InvalidateIfVersion(ctx context.Context, key string, v Version) (bool, error)
+	InvalidateAll(ctx context.Context) error
+	InvalidateTag(ctx context.Context, tag string) error
+	InvalidatePrefix(ctx context.Context, prefix string) error
+	BeginWrite(ctx context.Context, key string) (PendingWrite, error)
+	CommitWrite(ctx context.Context, w PendingWrite) error
+	AbortWrite(ctx context.Context, w PendingWrite) error
+	Update(ctx context.Context, key string, fn UpdateFunc[V]) (V, WriteResult, error)
 
-	// Batch (order-agnostic return. Use your own ordering by keys slice)
+	// Batch (maps are order-agnostic; GetManyOrdered aligns results to keys)
 	GetMany(ctx context.Context, keys []string) (values map[string]V, missing []string, err error)
+	GetManyWithVersions(ctx context.Context, keys []string) (values map[string]V, versions map[string]Version, missing []string, err error)
+	GetManyOrdered(ctx context.Context, keys []string) (values []V, found []bool, err error)
+	GetManyIter(ctx context.Context, keys []string) (hits iter.Seq2[string, V], err func() error)
 	SnapshotVersions(ctx context.Context, keys []string) (map[string]Version, error)
 	SetIfVersions(ctx context.Context, items []VersionedValue[V]) (BatchWriteResult, error)
 	SetIfVersionsWithTTL(ctx context.Context, items []VersionedValue[V], ttl time.Duration) (BatchWriteResult, error)
+	SetIfVersionsPartial(ctx context.Context, items []VersionedValue[V]) (BatchWriteResult, error)
+	SetIfVersionsPartialWithTTL(ctx context.Context, items []VersionedValue[V], ttl time.Duration) (BatchWriteResult, error)
+	InvalidateMany(ctx context.Context, keys []string) error
+
+	// Collections (ordered member keys validated against every member's fence)
+	SnapshotCollectionVersion(ctx context.Context, key string, members []string) (Version, error)
+	SetCollectionIfVersion(ctx context.Context, key string, members []string, version Version) (WriteResult, error)
+	SetCollectionIfVersionWithTTL(ctx context.Context, key string, members []string, version Version, ttl time.Duration) (WriteResult, error)
+	GetCollection(ctx context.Context, key string) (members []string, ok bool, err error)
+	GetCollectionPage(ctx context.Context, key string, cursor string, limit int) (page CollectionPage, ok bool, err error)
+
+	// Read-through
+	GetOrLoad(ctx context.Context, key string, load LoadFunc[V]) (V, LoadResult, error)
+	GetManyOrLoad(ctx context.Context, keys []string, load BatchLoadFunc[V]) (map[string]V, BatchLoadResult, error)
 }
 
 // WriteOutcome describes what happened during a versioned write attempt.
@@ -42,6 +77,9 @@ const (
 	WriteOutcomeSnapshotError    WriteOutcome = "snapshot_error"
 	WriteOutcomeProviderRejected WriteOutcome = "provider_rejected"
 	WriteOutcomeDisabled         WriteOutcome = "disabled"
+	WriteOutcomeLeaseHeld        WriteOutcome = "lease_held"
+	WriteOutcomeWritePending     WriteOutcome = "write_pending"
+	WriteOutcomeStaleRevision    WriteOutcome = "stale_revision"
 )
 
 type WriteResult struct {
@@ -58,6 +96,11 @@ func (r WriteResult) Stored() bool {
 type BatchWriteResult struct {
 	Outcome       WriteOutcome
 	SeededSingles bool
+	// Outcomes reports what happened to each item's key: WriteOutcomeStored
+	// for members of a stored batch entry, the single write's outcome for keys
+	// written through the fallback, and the skip reason for members
+	// SetIfVersionsPartial left out.
+	Outcomes map[string]WriteOutcome
 }
 
 // Stored reports whether the batch entry landed in the provider.
@@ -65,6 +108,63 @@ func (r BatchWriteResult) Stored() bool {
 	return r.Outcome == WriteOutcomeStored
 }
 
+// LoadFunc reads the authoritative value for one key from the source of truth.
+// It is called by GetOrLoad only after the key's version has been snapshotted.
+// Returning ErrNotFound (or an error wrapping it) caches the key as absent.
+type LoadFunc[V any] func(ctx context.Context) (V, error)
+
+// LoadResult describes how GetOrLoad produced its value.
+type LoadResult struct {
+	// Hit reports that the value was served from the cache and no load ran.
+	Hit bool
+	// Shared reports that the caller waited on a concurrent in-process load of
+	// the same key instead of running its own loader.
+	Shared bool
+	// Stale reports that the value was invalidated within Options.MaxStale
+	// and is served while a background refresh runs.
+	Stale bool
+	// EarlyRefresh reports that the hit was close enough to expiry to start
+	// a background refresh (see Options.EarlyRefreshBeta).
+	EarlyRefresh bool
+	// LeaseWaited reports that another caller held the key's fill lease
+	// (see Options.FillLeaseTTL), so this call waited for that fill before
+	// serving its value or, once the lease was released, loading itself.
+	LeaseWaited bool
+	// Write is the outcome of the post-load fill. It is zero on hits.
+	Write WriteResult
+	// FillErr is the error returned by the post-load fill, if any. Fill
+	// failures never hide a successfully loaded value.
+	FillErr error
+}
+
+// UpdateFunc computes the new value for Update from the currently cached one.
+// found is false when the key was not cached and old is the zero value. It may
+// be called several times if concurrent invalidations force retries, so it
+// must not have side effects beyond computing the result.
+//
+// fn must return a new value and must not modify old: a map, slice or
+// pointer in old may be shared with other readers. With a near cache, whose
+// hits all return one shared value, Update passes fn a copy made through the
+// codec, so patching it in place does not change what those readers see.
+type UpdateFunc[V any] func(old V, found bool) (V, error)
+
+// BatchLoadFunc reads the authoritative values for keys that missed the cache.
+// missing is sorted and deduplicated. Keys absent from the returned map are
+// treated as not found in the source and are not cached.
+type BatchLoadFunc[V any] func(ctx context.Context, missing []string) (map[string]V, error)
+
+// BatchLoadResult describes how GetManyOrLoad filled the keys that missed.
+type BatchLoadResult struct {
+	// Missing lists requested keys that were neither cached nor returned by the
+	// loader, preserving the caller's order and duplicates.
+	Missing []string
+	// Outcomes holds the fill outcome for every key that was loaded, including
+	// keys loaded by a concurrent in-process caller.
+	Outcomes map[string]WriteOutcome
+	// FillErr is the error returned by the post-load fill, if any.
+	FillErr error
+}
+
 // VersionedValue is the caller-facing unit for versioned multi-key writes.
 type VersionedValue[V any] struct {
 	Key     string
@@ -114,6 +214,43 @@ type KeyWriter interface {
 	SetIfVersion(ctx context.Context, versionKey version.CacheKey, valueKey string, expected version.Snapshot, payload []byte, ttl time.Duration) (stored bool, err error)
 }
 
+// KeyFrameWriter is an optional KeyWriter extension for entries whose wire
+// frame records more than the key's own fence, such as the namespace epoch.
+// encode builds the final single-entry frame for the fence that wins the
+// compare/init step; implementations must store exactly those bytes under
+// the same compare contract as KeyWriter.SetIfVersion.
+//
+// When the configured KeyWriter does not implement it, such entries are
+// written through the generic compare-then-write path instead.
+type KeyFrameWriter interface {
+	SetFrameIfVersion(ctx context.Context, versionKey version.CacheKey, valueKey string, expected version.Snapshot, encode func(fence version.Fence) ([]byte, error), ttl time.Duration) (stored bool, err error)
+}
+
+// KeyRevisionWriter is an optional KeyFrameWriter extension for entries that
+// record a source revision. It stores the frame under the same compare
+// contract as SetFrameIfVersion and, in the same atomic step, returns
+// ErrStaleRevision instead of storing when the entry currently held under
+// valueKey records a higher revision. Entries without a revision never block
+// the write.
+//
+// When the configured KeyWriter does not implement it, revisioned writes use
+// the generic path, which orders them only within one process.
+type KeyRevisionWriter interface {
+	SetFrameIfRevision(ctx context.Context, versionKey version.CacheKey, valueKey string, expected version.Snapshot, revision uint64, encode func(fence version.Fence) ([]byte, error), ttl time.Duration) (stored bool, err error)
+}
+
+// KeyAdvanceWriter is an optional KeyFrameWriter extension for Update. It
+// stores the frame under the same compare contract as SetFrameIfVersion and,
+// in the same atomic step, moves the key to a fresh fence; encode receives
+// that fence. A second write with the same expected snapshot then fails, so
+// only one read-modify-write per observed version can win.
+//
+// When the configured KeyWriter does not implement it, Update writes through
+// the generic path, which compares and advances with the VersionStore.
+type KeyAdvanceWriter interface {
+	SetFrameAndAdvance(ctx context.Context, versionKey version.CacheKey, valueKey string, expected version.Snapshot, encode func(fence version.Fence) ([]byte, error), ttl time.Duration) (stored bool, err error)
+}
+
 // KeyReadResult is the combined value and version state returned by
 // KeyReader.ReadKey for a single key.
 type KeyReadResult struct {
@@ -154,6 +291,28 @@ type KeyInvalidator interface {
 	Invalidate(ctx context.Context, versionKey version.CacheKey, valueKey string) error
 }
 
+// BatchKeyInvalidator is an optional KeyInvalidator extension for
+// invalidating many keys in one round trip. versionKeys and valueKeys are
+// index-aligned, and the returned slice must be index-aligned with them: a nil
+// entry means that key was invalidated with the same contract as
+// KeyInvalidator.Invalidate.
+type BatchKeyInvalidator interface {
+	InvalidateMany(ctx context.Context, versionKeys []version.CacheKey, valueKeys []string) []error
+}
+
+// ConditionalKeyInvalidator is an optional KeyInvalidator extension for
+// InvalidateIfVersion. It invalidates the key with the same contract as
+// KeyInvalidator.Invalidate only while the key's authoritative fence equals
+// expected.Fence (or the key is missing when expected.Exists is false), and
+// must compare and advance in one atomic step. invalidated=false reports a
+// mismatch and leaves both keys untouched.
+//
+// When the configured KeyInvalidator does not implement it,
+// InvalidateIfVersion uses the VersionStore instead.
+type ConditionalKeyInvalidator interface {
+	InvalidateIfVersion(ctx context.Context, versionKey version.CacheKey, valueKey string, expected version.Snapshot) (invalidated bool, err error)
+}
+
 // KeyMutator combines KeyWriter and KeyInvalidator for backends that support
 // both native compare-and-write and single-key invalidation in a single path.
 type KeyMutator interface {
@@ -189,6 +348,17 @@ type BatchReadGuardFunc[V any] func(ctx context.Context, values map[string]V) (r
 // single writes and the number of logical keys contained in a batch entry.
 type SetCostFunc func(key string, raw []byte, isBatch bool, memberCount int) int64
 
+// KeyHierarchy configures hierarchical key mode. Separator splits keys into
+// segments, and the prefix made of a key's first n segments is its ancestor
+// of depth n: "tenant:9:user:42" with Separator ":" has ancestors "tenant",
+// "tenant:9" and "tenant:9:user". Only the depths listed in Depths carry a
+// fence, or every depth when Depths is empty; list only the levels you
+// invalidate, since each is read on every cache read.
+type KeyHierarchy struct {
+	Separator string
+	Depths    []int
+}
+
 // Options configures the CAS cache.
 // Namespace, Provider, and Codec are required.
 type Options[V any] struct {
@@ -198,10 +368,17 @@ type Options[V any] struct {
 
 	DefaultTTL     time.Duration // singles; 0 => 10m
 	BatchTTL       time.Duration // batches; 0 => 10m
+	NegativeTTL    time.Duration // absence tombstones; 0 => 1m
 	Disabled       bool          // default false (enabled)
 	ComputeSetCost SetCostFunc   // default 1
 	VersionStore   version.Store // nil => LocalStore (in-process)
 	KeyReader      KeyReader
+
+	// KeyWriter compares and writes single entries in one backend step.
+	// SetIfVersionAtRevision is atomic across processes only when it also
+	// implements KeyRevisionWriter. Otherwise the revision check and the
+	// write are serialized within this process, so a writer in another
+	// process can interleave with them and replace a newer revision.
 	KeyWriter      KeyWriter
 	KeyInvalidator KeyInvalidator
 	DisableBatch   bool // default false => batch enabled
@@ -210,6 +387,130 @@ type Options[V any] struct {
 	BatchReadSeed  BatchReadSeedMode
 	BatchWriteSeed BatchWriteSeedMode
 	Hooks          Hooks
+
+	// BatchSupersetIndex lets GetMany serve a key set from a stored batch
+	// entry of a larger set, remembering the key sets of up to this many
+	// recent batch writes. Default 0 (exact key sets only).
+	//
+	// The index is one provider entry per namespace, kept for BatchTTL, so
+	// processes sharing the Provider share it. Each batch write updates it
+	// with a read and a write, and a GetMany whose exact batch entry misses
+	// reads it once, then tries the smallest stored superset of the request.
+	// Only the requested members are validated and served. Updates from
+	// concurrent writers may overwrite each other; a lost record only costs
+	// that entry's reuse. The index is also capped at 64 KiB encoded, and key
+	// sets too large to fit are not listed. Reads drop listed entries that
+	// have gone at most once a second per cache.
+	BatchSupersetIndex int
+
+	// NamespaceEpoch makes every entry depend on a namespace-wide epoch held
+	// in the VersionStore, enabling InvalidateAll. Default false.
+	//
+	// Every read also checks the epoch fence (one extra version-store round
+	// trip when KeyReader is configured), and entries written before it was
+	// enabled are invalidated once. Versions must then come
+	// from SnapshotVersion or SnapshotVersions; writes with a zero Version
+	// report WriteOutcomeVersionMismatch because they record no epoch.
+	NamespaceEpoch bool
+
+	// KeyHierarchy makes every entry depend on the fences of its key's
+	// ancestor prefixes, enabling InvalidatePrefix. Default off.
+	//
+	// Reads check one extra fence per ancestor, batched with the epoch.
+	// Entries written before it was enabled are invalidated once, and writes
+	// must use versions from SnapshotVersion or SnapshotVersions, as with
+	// NamespaceEpoch.
+	KeyHierarchy KeyHierarchy
+
+	// MaxStale enables stale-while-revalidate for single keys. Default 0
+	// (strict).
+	//
+	// When set, Invalidate and InvalidateMany keep the last valid value of
+	// each key for up to MaxStale. GetOrLoad may then answer a miss with that
+	// value, flagged by LoadResult.Stale, while one background refresh per key
+	// runs the loader and SetIfVersion. All other reads stay strict. A kept
+	// value is refused once the key is invalidated or updated again, or once
+	// one of its dependencies moves.
+	MaxStale time.Duration
+
+	// InvalidateDelays makes every Invalidate and InvalidateMany invalidate
+	// each key again after each delay, as InvalidateWithDelay does, to catch
+	// fills that read a replica lagging behind the source write. Default nil
+	// (no follow-ups).
+	InvalidateDelays []time.Duration
+
+	// EarlyRefreshBeta enables probabilistic early refresh (XFetch) for
+	// GetOrLoad. Default 0 (disabled); 1 is the usual starting point, and
+	// larger values refresh earlier.
+	//
+	// When set, GetOrLoad fills, and the single entries GetManyOrLoad fills
+	// write, record the write time, the TTL, and how long the loader took. A
+	// GetOrLoad hit then refreshes in the background once
+	// now - delta*beta*ln(rand()) reaches the entry's expiry, so hot keys are
+	// recomputed by one caller shortly before they expire instead of by every
+	// replica after. Batch entries carry no timing, and GetManyOrLoad hits
+	// never start a refresh.
+	EarlyRefreshBeta float64
+
+	// L1 adds an in-process provider (e.g. Ristretto or BigCache) in front of
+	// Provider for single keys. Default nil (one tier).
+	//
+	// L1 holds the frames of validated L2 reads for L1TTL (0 => 1m) and its
+	// hits pass the same fence and dependency checks as L2 hits. With a
+	// VersionStore that implements version.Watcher (version.LocalStore, and
+	// redis.VersionStore through client-side tracking) those checks use
+	// locally cached fences, dropped as soon as the store reports a change;
+	// otherwise each L1 hit reads the fences from the store. Writes and
+	// Invalidate clear the local copy. Batch entries are not cached in L1.
+	L1    pr.Provider
+	L1TTL time.Duration
+
+	// NearCacheSize keeps up to this many decoded single-key reads in process
+	// memory, for NearCacheTTL (0 => 1m; tombstones at most NegativeTTL).
+	// Default 0 (disabled).
+	//
+	// A near hit skips the provider and the codec. It is still checked against
+	// the key's fence and dependency fences and the ReadGuard, with fences
+	// served from a local copy that the watch drops on every change, so the
+	// VersionStore must implement version.Watcher (New returns
+	// ErrNearCacheNeedsWatcher otherwise). Keep NearCacheTTL at or below the
+	// write TTLs: near entries do not see provider expiry.
+	//
+	// Every near hit on a key returns the same decoded V. Treat values read
+	// from a cache with a near cache as read-only: mutating one (a map, a
+	// slice, a pointed-to struct) changes what later reads of the key see.
+	NearCacheSize int
+	NearCacheTTL  time.Duration
+
+	// FillLeaseTTL enables fill leases for GetOrLoad. Default 0 (disabled).
+	//
+	// When set, a miss asks the VersionStore for a lease on the key (see
+	// AcquireFill) before loading, so only one caller across all processes
+	// loads it at a time; the others poll the cache until the value appears,
+	// the lease is released, or it expires after FillLeaseTTL. Single-key
+	// writes carrying no lease or another caller's lease report
+	// WriteOutcomeLeaseHeld while it is held. The VersionStore must implement
+	// version.Leaser (New returns ErrFillLeaseNeedsLeaser otherwise). Keep it
+	// above the usual load time.
+	//
+	// Batch fills bypass leases: GetManyOrLoad loads every miss it owns
+	// without asking for one, and SetIfVersions stores its batch entry even
+	// while another caller holds a member's lease; only the single entries it
+	// seeds report WriteOutcomeLeaseHeld.
+	FillLeaseTTL time.Duration
+
+	// PendingWriteTTL bounds how long a BeginWrite keeps its key pending when
+	// neither CommitWrite nor AbortWrite follows, e.g. because the writer
+	// crashed. Default 0 => 30s.
+	PendingWriteTTL time.Duration
+
+	// Outbox, when set, records every key whose Invalidate or
+	// InvalidateMany failed and retries it in the background until it
+	// succeeds; see InvalidationOutbox. Ignored when Disabled.
+	Outbox *InvalidationOutbox
+
+	UpdateMaxAttempts int           // total Update attempts; 0 => 4
+	UpdateBackoff     time.Duration // base Update retry backoff, doubled per retry; 0 => 5ms
 }
 
 func New[V any](opts Options[V]) (CAS[V], error) {
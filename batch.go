@@ -53,7 +53,7 @@ type batchReadGuardResult struct {
 }
 
 // singleSeedFunc writes one validated batch member as a single entry.
-type singleSeedFunc func(ctx context.Context, key string, fence version.Fence, payload []byte, ttl time.Duration) error
+type singleSeedFunc func(ctx context.Context, key string, e wire.SingleEntry, ttl time.Duration) error
 
 // GetMany retrieves multiple keys in one call, trying the most efficient
 // path first and falling back as needed:
@@ -67,6 +67,10 @@ type singleSeedFunc func(ctx context.Context, key string, fence version.Fence, p
 //     individual single entries depending on BatchReadSeed. This warming is
 //     optional and best-effort.
 //
+//     With BatchSupersetIndex set, a miss on that entry tries the indexed
+//     batch entries whose key sets contain the requested one, smallest first,
+//     validating and decoding only the requested members.
+//
 //  2. If the batch entry is missing, corrupt, stale, or contains items that
 //     fail to decode, delete it from the provider to prevent
 //     repeated failures on subsequent reads.
@@ -82,41 +86,118 @@ type singleSeedFunc func(ctx context.Context, key string, fence version.Fence, p
 // entirely and we go straight to per-key reads.
 func (c *cache[V]) GetMany(ctx context.Context, keys []string) (map[string]V, []string, error) {
 	out := make(map[string]V, len(keys))
+	missing, err := c.getMany(ctx, keys, out, nil)
+	return out, c.missOutboxPending(keys, missing, out, nil), err
+}
+
+// GetManyWithVersions is GetMany that also returns, for every served key, the
+// version its value was validated against, exactly like GetWithVersion. Keys
+// served from a batch entry carry the fences recorded for them in that entry.
+func (c *cache[V]) GetManyWithVersions(
+	ctx context.Context,
+	keys []string,
+) (map[string]V, map[string]Version, []string, error) {
+	out := make(map[string]V, len(keys))
+	vers := make(map[string]Version, len(keys))
+	missing, err := c.getMany(ctx, keys, out, vers)
+	return out, vers, c.missOutboxPending(keys, missing, out, vers), err
+}
+
+// getMany implements GetMany, writing hits into out and, when vers is not
+// nil, their validated versions into vers.
+func (c *cache[V]) getMany(
+	ctx context.Context,
+	keys []string,
+	out map[string]V,
+	vers map[string]Version,
+) ([]string, error) {
 	missing := make([]string, 0, len(keys))
 
 	if !c.enabled {
 		missing = append(missing, keys...)
-		return out, missing, nil
+		return missing, nil
 	}
 
 	if len(keys) == 0 {
-		return out, nil, nil
+		return nil, nil
 	}
 
+	missing, fallback, err := c.readBatchEntry(ctx, keys, out, vers)
+	if err != nil || len(fallback) == 0 {
+		return missing, err
+	}
+	m, err := c.readSingles(ctx, fallback, out, vers)
+	return append(missing, m...), err
+}
+
+// readBatchEntry is the batch step of getMany: it serves what it can of keys
+// from a batch entry into out and vers, and splits the rest into keys that
+// are misses for this call and keys left to per-key reads.
+func (c *cache[V]) readBatchEntry(
+	ctx context.Context,
+	keys []string,
+	out map[string]V,
+	vers map[string]Version,
+) (missing, fallback []string, err error) {
 	if !c.batchEnabled {
-		m, err := c.readSingles(ctx, keys, out)
-		return out, m, err
+		return nil, keys, nil
 	}
 
 	us := sortedUnique(keys)
 	hit, ok, err := c.loadBatchHit(ctx, us)
 	if err != nil {
-		return out, missing, opError(OpGetMany, "", err)
+		return []string{}, nil, opError(OpGetMany, "", err)
+	}
+	if !ok && c.batchIndexSize > 0 {
+		hit, ok = c.loadSupersetHit(ctx, us)
 	}
 	if !ok {
-		missing, err = c.readSingles(ctx, keys, out)
-		return out, missing, err
+		return nil, keys, nil
 	}
 
 	plan := c.buildBatchReadPlan(ctx, hit.values)
 	if plan.action != batchReadServeAll {
 		c.rejectBatch(ctx, hit.storageKey, len(us), plan.reason)
 	}
-	missing, err = c.applyBatchReadPlan(ctx, keys, us, hit, plan, out)
-	return out, missing, err
+	missing, fallback = c.applyBatchReadPlan(ctx, keys, us, hit, plan, out, vers)
+	return missing, fallback, nil
+}
+
+// missOutboxPending moves keys waiting in the outbox from out and vers to
+// missing when OutboxOptions.MissWhilePending is set. Batch entries are read
+// whole, so this filters their members after the fact.
+func (c *cache[V]) missOutboxPending(
+	keys []string,
+	missing []string,
+	out map[string]V,
+	vers map[string]Version,
+) []string {
+	if c.outbox == nil || !c.outbox.missPending {
+		return missing
+	}
+	dropped := false
+	for k := range out {
+		if c.outbox.Pending(k) {
+			delete(out, k)
+			delete(vers, k)
+			dropped = true
+		}
+	}
+	if !dropped {
+		return missing
+	}
+	m := make([]string, 0, len(missing)+1)
+	for _, k := range keys { // preserve caller order and duplicates
+		if _, ok := out[k]; !ok {
+			m = append(m, k)
+		}
+	}
+	return m
 }
 
 // SnapshotVersions returns the current version for each unique logical key.
+// With NamespaceEpoch every version also records the current epoch, and with
+// KeyHierarchy the current fences of the key's ancestor prefixes.
 func (c *cache[V]) SnapshotVersions(ctx context.Context, keys []string) (map[string]Version, error) {
 	keys = sortedUnique(keys)
 	ss, err := c.loadSnapshots(ctx, keys)
@@ -124,9 +205,37 @@ func (c *cache[V]) SnapshotVersions(ctx context.Context, keys []string) (map[str
 		return nil, err
 	}
 
+	// Keys share most dependencies, so every distinct one is read once.
+	kd := make([][]version.CacheKey, len(keys))
+	var all []version.CacheKey
+	for i, key := range keys {
+		kd[i] = c.keyDeps(key)
+		all = append(all, kd[i]...)
+	}
+	observed := make(map[version.CacheKey]wire.Dep)
+	if len(all) != 0 {
+		sortCacheKeys(all)
+		all = slices.Compact(all)
+		snaps, err := c.loadBatch(ctx, all)
+		if err != nil {
+			return nil, opError(OpSnapshot, "", err)
+		}
+		deps, err := c.snapshotDeps(ctx, all, snaps)
+		if err != nil {
+			return nil, opError(OpSnapshot, "", err)
+		}
+		for i, d := range deps {
+			observed[all[i]] = d
+		}
+	}
+
 	out := make(map[string]Version, len(keys))
 	for i, key := range keys {
-		out[key] = versionFromSnapshot(ss[i])
+		var deps []wire.Dep
+		for _, k := range kd[i] {
+			deps = append(deps, observed[k])
+		}
+		out[key] = versionFromSnapshot(ss[i]).withDeps(deps)
 	}
 	return out, nil
 }
@@ -148,49 +257,160 @@ func (c *cache[V]) SetIfVersionsWithTTL(
 	items []VersionedValue[V],
 	ttl time.Duration,
 ) (BatchWriteResult, error) {
+	res, outcomes, err := c.setIfVersions(ctx, items, ttl, false, 0)
+	res.Outcomes = outcomes
+	return res, err
+}
+
+// SetIfVersionsPartial is SetIfVersions that does not give up on the batch
+// entry when some members are stale, using the cache's default TTLs.
+func (c *cache[V]) SetIfVersionsPartial(
+	ctx context.Context,
+	items []VersionedValue[V],
+) (BatchWriteResult, error) {
+	return c.SetIfVersionsPartialWithTTL(ctx, items, 0)
+}
+
+// SetIfVersionsPartialWithTTL writes one batch entry holding only the members
+// whose versions still match and skips the rest, so one stale key does not
+// cost the whole batch. The entry is keyed by the accepted members, so it
+// serves a GetMany of exactly those keys, and singles are seeded for them
+// according to BatchWriteSeed. Outcomes reports WriteOutcomeStored for each
+// accepted member and the reason for each skipped one; Outcome is
+// WriteOutcomeStored when the entry landed, or the first skipped member's
+// outcome (in key order) when no member was accepted. A rejected or failed
+// batch write falls back to checked single writes of the accepted members,
+// like SetIfVersionsWithTTL.
+func (c *cache[V]) SetIfVersionsPartialWithTTL(
+	ctx context.Context,
+	items []VersionedValue[V],
+	ttl time.Duration,
+) (BatchWriteResult, error) {
+	res, outcomes, err := c.setIfVersions(ctx, items, ttl, true, 0)
+	res.Outcomes = outcomes
+	return res, err
+}
+
+// setIfVersions implements the SetIfVersions family and additionally reports
+// the outcome for each written key. A stored batch entry counts as stored for
+// every member it holds; fallback single writes report their own outcome per
+// key. With partial set, members that fail validation are dropped from the
+// entry with their own outcome instead of sending the whole batch to the
+// fallback. delta is how long a loader took to produce the values, as for
+// setValue; it is recorded in the single entries the call writes.
+func (c *cache[V]) setIfVersions(
+	ctx context.Context,
+	items []VersionedValue[V],
+	ttl time.Duration,
+	partial bool,
+	delta time.Duration,
+) (BatchWriteResult, map[string]WriteOutcome, error) {
 	if !c.enabled {
-		return BatchWriteResult{Outcome: WriteOutcomeDisabled}, nil
+		return BatchWriteResult{Outcome: WriteOutcomeDisabled}, uniformOutcomes(items, WriteOutcomeDisabled), nil
 	}
 
 	if len(items) == 0 {
-		return BatchWriteResult{Outcome: WriteOutcomeStored}, nil
+		return BatchWriteResult{Outcome: WriteOutcomeStored}, map[string]WriteOutcome{}, nil
 	}
 
 	ws, ks, err := prepBatchWrite(items)
 	if err != nil {
-		return BatchWriteResult{}, err
+		return BatchWriteResult{}, nil, err
 	}
 
 	sttl := ttl
 	if sttl == 0 {
 		sttl = c.defaultTTL
 	}
+
+	// skipped holds the outcome of each member dropped in partial mode; the
+	// fallback reports them next to the outcomes of the members it wrote.
+	skipped := make(map[string]WriteOutcome)
+	fallback := func(outcome WriteOutcome) (BatchWriteResult, map[string]WriteOutcome, error) {
+		res, outcomes, err := c.fallbackSet(ctx, outcome, ws, sttl, delta)
+		maps.Copy(outcomes, skipped)
+		return res, outcomes, err
+	}
+	// keep filters ws down to the members for which ok(i) returns an empty
+	// outcome. Outside partial mode the first failure aborts with its outcome.
+	keep := func(ok func(i int) WriteOutcome) (WriteOutcome, bool) {
+		kept := make([]batchWriteItem[V], 0, len(ws))
+		for i := range ws {
+			outcome := ok(i)
+			if outcome == "" {
+				kept = append(kept, ws[i])
+				continue
+			}
+			if !partial {
+				return outcome, false
+			}
+			skipped[ws[i].key] = outcome
+		}
+		ws = kept
+		return "", true
+	}
+
 	if !c.batchEnabled {
-		return c.fallbackSet(ctx, WriteOutcomeDisabled, ws, sttl)
+		return fallback(WriteOutcomeDisabled)
 	}
 
 	ss, err := c.loadSnapshots(ctx, ks)
 	if err != nil {
-		return c.fallbackSet(ctx, WriteOutcomeSnapshotError, ws, sttl)
+		return fallback(WriteOutcomeSnapshotError)
+	}
+	if outcome, ok := keep(func(i int) WriteOutcome {
+		switch {
+		case ws[i].obs.pending || ss[i].Pending:
+			return WriteOutcomeWritePending
+		case !snapshotMatchesVersion(ss[i], ws[i].obs):
+			return WriteOutcomeVersionMismatch
+		}
+		return ""
+	}); !ok {
+		return fallback(outcome)
 	}
+
+	keys := make([]string, len(ws))
+	recorded := make([][]wire.Dep, len(ws))
 	for i := range ws {
-		if !snapshotMatchesVersion(ss[i], ws[i].obs) {
-			return c.fallbackSet(ctx, WriteOutcomeVersionMismatch, ws, sttl)
+		keys[i], recorded[i] = ws[i].key, ws[i].obs.deps.list()
+	}
+	current, err := c.currentDeps(ctx, keys, recorded)
+	if err != nil {
+		return fallback(WriteOutcomeSnapshotError)
+	}
+	if outcome, ok := keep(func(i int) WriteOutcome {
+		if !current[i] {
+			return WriteOutcomeVersionMismatch
 		}
+		return ""
+	}); !ok {
+		return fallback(outcome)
 	}
-	for i := range ws {
+
+	if outcome, ok := keep(func(i int) WriteOutcome {
 		if !ws[i].obs.IsMissing() {
-			continue
+			return ""
 		}
-
 		snap, created, createErr := c.createSnapshot(ctx, c.versionKey(ws[i].key))
 		if createErr != nil {
-			return c.fallbackSet(ctx, WriteOutcomeSnapshotError, ws, sttl)
+			return WriteOutcomeSnapshotError
 		}
 		if !created {
-			return c.fallbackSet(ctx, WriteOutcomeVersionMismatch, ws, sttl)
+			return WriteOutcomeVersionMismatch
 		}
-		ws[i].obs = versionFromSnapshot(snap)
+		ws[i].obs = versionFromSnapshot(snap).withDeps(ws[i].obs.deps.list())
+		return ""
+	}); !ok {
+		return fallback(outcome)
+	}
+
+	if len(ws) == 0 {
+		return BatchWriteResult{Outcome: skipped[ks[0]]}, skipped, nil
+	}
+	ks = make([]string, len(ws))
+	for i := range ws {
+		ks[i] = ws[i].key
 	}
 
 	bttl := ttl
@@ -202,23 +422,24 @@ func (c *cache[V]) SetIfVersionsWithTTL(
 	for _, w := range ws {
 		payload, eErr := c.codec.Encode(w.val)
 		if eErr != nil {
-			return BatchWriteResult{}, opError(OpSetIfVersions, w.key, eErr)
+			return BatchWriteResult{}, nil, opError(OpSetIfVersions, w.key, eErr)
 		}
 		wires = append(wires, wire.BatchItem{
 			Key:     w.key,
 			Fence:   w.obs.fence,
+			Deps:    w.obs.deps.list(),
 			Payload: payload,
 		})
 	}
 
 	wireb, err := wire.EncodeBatch(wires)
 	if err != nil {
-		return BatchWriteResult{}, opError(OpSetIfVersions, "", err)
+		return BatchWriteResult{}, nil, opError(OpSetIfVersions, "", err)
 	}
 
 	bk, err := c.batchKeySorted(ks)
 	if err != nil {
-		return BatchWriteResult{}, opError(OpSetIfVersions, "", err)
+		return BatchWriteResult{}, nil, opError(OpSetIfVersions, "", err)
 	}
 
 	ok, err := c.provider.Set(
@@ -229,18 +450,141 @@ func (c *cache[V]) SetIfVersionsWithTTL(
 		bttl,
 	)
 	if err != nil {
-		return BatchWriteResult{}, opError(OpSetIfVersions, "", err)
+		return BatchWriteResult{}, nil, opError(OpSetIfVersions, "", err)
 	}
 	if !ok {
 		c.hooks.ProviderSetRejected(bk.String(), true)
-		return c.fallbackSet(ctx, WriteOutcomeProviderRejected, ws, sttl)
+		return fallback(WriteOutcomeProviderRejected)
+	}
+	if c.batchIndexSize > 0 {
+		c.recordBatchSet(ctx, ks)
 	}
 
-	if err := c.seedAfterBatch(ctx, ws, wires, sttl); err != nil {
-		return BatchWriteResult{Outcome: WriteOutcomeStored}, err
+	stored := make(map[string]WriteOutcome, len(items))
+	for _, w := range ws {
+		stored[w.key] = WriteOutcomeStored
+	}
+	maps.Copy(stored, skipped)
+	if err := c.seedAfterBatch(ctx, ws, wires, sttl, delta); err != nil {
+		return BatchWriteResult{Outcome: WriteOutcomeStored}, stored, err
 	}
 
-	return BatchWriteResult{Outcome: WriteOutcomeStored}, nil
+	return BatchWriteResult{Outcome: WriteOutcomeStored}, stored, nil
+}
+
+// InvalidateMany invalidates every unique key with the same contract as
+// Invalidate, batching the work when the backend supports it:
+//
+//   - A KeyInvalidator that also implements BatchKeyInvalidator handles all
+//     keys in one call.
+//   - Otherwise, a version store implementing version.BatchAdvancer advances
+//     all fences in one call before the provider deletes run.
+//   - Otherwise, keys are invalidated one at a time.
+//
+// Failures are returned as *InvalidateManyError with one *InvalidateError per
+// failed key, so callers can retry only those keys. With Options.Outbox they
+// are queued for retry first. Options.InvalidateDelays applies per key.
+func (c *cache[V]) InvalidateMany(ctx context.Context, keys []string) error {
+	if !c.enabled {
+		return nil
+	}
+
+	us := sortedUnique(keys)
+	if len(us) == 0 {
+		return nil
+	}
+	if c.l1 != nil || c.near != nil {
+		defer func() {
+			for _, k := range us {
+				c.dropLocal(ctx, c.singleKeys(k))
+			}
+		}()
+	}
+
+	var failed []*InvalidateError
+	switch ki := c.keyInvalidator.(type) {
+	case BatchKeyInvalidator:
+		copies := c.captureStaleMany(ctx, us)
+		failed = c.invalidateManyNative(ctx, ki, us)
+		c.retainStale(ctx, invalidatedCopies(copies, failed), nil)
+	case nil:
+		copies := c.captureStaleMany(ctx, us)
+		failed = c.invalidateManyGeneric(ctx, us)
+		c.retainStale(ctx, invalidatedCopies(copies, failed), nil)
+	default:
+		for _, k := range us {
+			var ie *InvalidateError
+			if err := c.invalidate(ctx, k); errors.As(err, &ie) {
+				failed = append(failed, ie)
+			}
+		}
+	}
+
+	for _, k := range us {
+		c.reinvalidateLater(k, c.invalidateDelays)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	c.queueInvalidations(ctx, failed...)
+	return &InvalidateManyError{Errors: failed}
+}
+
+func (c *cache[V]) invalidateManyNative(
+	ctx context.Context,
+	ki BatchKeyInvalidator,
+	keys []string,
+) []*InvalidateError {
+	cks := make([]version.CacheKey, len(keys))
+	vks := make([]string, len(keys))
+	for i, k := range keys {
+		sk := c.singleKeys(k)
+		cks[i] = toVersionCacheKey(sk.Cache)
+		vks[i] = sk.Value.String()
+	}
+
+	errs := ki.InvalidateMany(ctx, cks, vks)
+	var failed []*InvalidateError
+	for i, k := range keys {
+		var err error
+		if i < len(errs) {
+			err = errs[i]
+		} else {
+			err = fmt.Errorf("key invalidator returned no result for %q", k)
+		}
+		if err == nil {
+			continue
+		}
+		c.hooks.InvalidateOutage(k, err, nil)
+		failed = append(failed, &InvalidateError{
+			Key:        k,
+			AdvanceErr: opError(OpInvalidate, k, err),
+		})
+	}
+	return failed
+}
+
+// invalidateManyGeneric keeps Invalidate's ordering: every fence is advanced
+// before any provider delete runs.
+func (c *cache[V]) invalidateManyGeneric(ctx context.Context, keys []string) []*InvalidateError {
+	cks := c.versionKeys(keys)
+	advErrs := c.advanceVersions(ctx, cks)
+
+	var failed []*InvalidateError
+	for i, k := range keys {
+		delErr := c.provider.Del(ctx, c.singleKeys(k).Value.String())
+		bErr, ok := advErrs[cks[i]]
+		if !ok {
+			continue
+		}
+		c.hooks.InvalidateOutage(k, bErr, delErr)
+		failed = append(failed, &InvalidateError{
+			Key:        k,
+			AdvanceErr: opError(OpInvalidate, k, bErr),
+			DelErr:     opError(OpInvalidate, k, delErr),
+		})
+	}
+	return failed
 }
 
 // fallbackSet records that the batch path did not land and retries the write
@@ -250,11 +594,13 @@ func (c *cache[V]) fallbackSet(
 	outcome WriteOutcome,
 	items []batchWriteItem[V],
 	ttl time.Duration,
-) (BatchWriteResult, error) {
+	delta time.Duration,
+) (BatchWriteResult, map[string]WriteOutcome, error) {
+	outcomes, err := c.writeSingles(ctx, items, ttl, delta)
 	return BatchWriteResult{
 		Outcome:       outcome,
 		SeededSingles: true,
-	}, c.seedSingles(ctx, items, ttl)
+	}, outcomes, err
 }
 
 // loadBatch reads authoritative state for multiple canonical keys in one batch call.
@@ -320,8 +666,13 @@ func (c *cache[V]) loadBatchHit(ctx context.Context, sortedRequested []string) (
 	if err != nil {
 		return batchHit[V]{}, false, err
 	}
-	sk := bk.String()
+	return c.loadBatchHitAt(ctx, bk.String(), sortedRequested)
+}
 
+// loadBatchHitAt is loadBatchHit for the batch entry stored at sk, which may
+// hold more members than sortedRequested; only the requested ones are
+// validated and decoded.
+func (c *cache[V]) loadBatchHitAt(ctx context.Context, sk string, sortedRequested []string) (batchHit[V], bool, error) {
 	raw, ok, err := c.provider.Get(ctx, sk)
 	if err != nil {
 		return batchHit[V]{}, false, err
@@ -394,6 +745,7 @@ func (c *cache[V]) batchRejectByKey(
 		return "", err
 	}
 
+	recorded := make([][]wire.Dep, 0, len(sortedRequested))
 	for i, k := range sortedRequested {
 		it, ok := items[k]
 		if !ok {
@@ -406,6 +758,21 @@ func (c *cache[V]) batchRejectByKey(
 		if !it.Fence.Equal(snap.Fence) {
 			return BatchRejectReasonVersionMismatch, nil
 		}
+		recorded = append(recorded, it.Deps)
+	}
+
+	dk := c.depsToLoad(recorded...)
+	if len(dk) == 0 {
+		return "", nil
+	}
+	deps, err := c.loadBatch(ctx, dk)
+	if err != nil {
+		return "", err
+	}
+	for _, k := range sortedRequested {
+		if !c.depsCurrent(k, items[k].Deps, deps) {
+			return BatchRejectReasonVersionMismatch, nil
+		}
 	}
 	return "", nil
 }
@@ -436,32 +803,56 @@ func (c *cache[V]) buildBatchReadPlan(ctx context.Context, values map[string]V)
 }
 
 // applyBatchReadPlan materializes a previously chosen batch-read action back
-// onto the caller's requested key order, including warming or single-key
-// fallback when the plan requires it.
+// onto the caller's requested key order, including warming when the plan
+// allows it. It returns the keys that miss for this call and, separately, the
+// keys the plan sends to single-key fallback, both in caller order.
 func (c *cache[V]) applyBatchReadPlan(
 	ctx context.Context,
 	keys, sortedRequested []string,
 	hit batchHit[V],
 	plan batchReadPlan,
 	out map[string]V,
-) ([]string, error) {
+	vers map[string]Version,
+) (missing, fallback []string) {
 	switch plan.action {
 	case batchReadServeAll:
 		p := projectBatchValues(keys, hit.values, nil, out, false)
+		recordBatchVersions(sortedRequested, hit.items, out, vers)
 		c.seedBatchRead(ctx, sortedRequested, hit.items)
 		return p.missing, nil
 	case batchReadServeAcceptedMissRejected:
 		p := projectBatchValues(keys, hit.values, plan.rejected, out, false)
+		recordBatchVersions(sortedRequested, hit.items, out, vers)
 		return p.missing, nil
 	case batchReadServeAcceptedRefetchRejected:
 		p := projectBatchValues(keys, hit.values, plan.rejected, out, true)
-		m, err := c.readSingles(ctx, p.fallbackKeys, out)
-		return append(p.missing, m...), err
+		recordBatchVersions(sortedRequested, hit.items, out, vers)
+		return p.missing, p.fallbackKeys
 	case batchReadMissAll:
 		return slices.Clone(keys), nil
 	case batchReadFallbackSingles:
 	}
-	return c.readSingles(ctx, keys, out)
+	return nil, keys
+}
+
+// recordBatchVersions stores the recorded version of every requested key that
+// was served from a batch entry. It must run before any single-key fallback
+// adds further hits to out. vers may be nil.
+func recordBatchVersions[V any](
+	sortedRequested []string,
+	items map[string]wire.BatchItem,
+	out map[string]V,
+	vers map[string]Version,
+) {
+	if vers == nil {
+		return
+	}
+	for _, k := range sortedRequested {
+		if _, ok := out[k]; ok {
+			it := items[k]
+			vers[k] = entryVersion(it.Fence, it.Deps)
+		}
+	}
 }
 
 // projectBatchValues maps decoded batch members back to the caller's original
@@ -532,13 +923,20 @@ func (c *cache[V]) seedBatchRead(
 // results back onto the caller's original key list. This avoids redundant
 // provider and version-store round-trips when the input has duplicates.
 //
-// Hits are written into out. Keys that were not found (including entries
+// Hits are written into out, and their versions into vers when it is not
+// nil. Keys that were not found (including entries
 // that were self-healed during Get) appear in the returned missing slice,
 // preserving the caller's original order and duplicates.
 // self-heal events inside Get produce misses, not errors.
-func (c *cache[V]) readSingles(ctx context.Context, keys []string, out map[string]V) ([]string, error) {
+func (c *cache[V]) readSingles(
+	ctx context.Context,
+	keys []string,
+	out map[string]V,
+	vers map[string]Version,
+) ([]string, error) {
 	type res struct {
 		v   V
+		ver Version
 		ok  bool
 		err error
 	}
@@ -546,8 +944,11 @@ func (c *cache[V]) readSingles(ctx context.Context, keys []string, out map[strin
 	us := sortedUnique(keys)
 	tmp := make(map[string]res, len(us))
 	for _, k := range us {
-		v, ok, err := c.Get(ctx, k)
-		tmp[k] = res{v: v, ok: ok, err: err}
+		v, ver, ok, err := c.GetWithVersion(ctx, k)
+		if errors.Is(err, ErrNotFound) {
+			err = nil // tombstones are misses in batch reads
+		}
+		tmp[k] = res{v: v, ver: ver, ok: ok, err: err}
 	}
 
 	m := make([]string, 0, len(keys))
@@ -555,6 +956,9 @@ func (c *cache[V]) readSingles(ctx context.Context, keys []string, out map[strin
 		r := tmp[k]
 		if r.ok {
 			out[k] = r.v
+			if vers != nil {
+				vers[k] = r.ver
+			}
 		} else {
 			m = append(m, k)
 		}
@@ -670,7 +1074,7 @@ func (c *cache[V]) seedFromItems(
 		if !ok {
 			continue
 		}
-		if err := write(ctx, k, it.Fence, it.Payload, ttl); err != nil {
+		if err := write(ctx, k, singleEntry(it), ttl); err != nil {
 			errs = append(errs, &OpError{Op: op, Key: k, Err: err})
 		}
 	}
@@ -697,16 +1101,17 @@ func (c *cache[V]) seedAfterBatch(
 	items []batchWriteItem[V],
 	wireItems []wire.BatchItem,
 	ttl time.Duration,
+	delta time.Duration,
 ) error {
 	switch c.batchWriteSeed {
 	case BatchWriteSeedOff:
 		return nil
 	case BatchWriteSeedFast:
-		return c.seedFromBatch(ctx, wireItems, ttl)
+		return c.seedFromBatch(ctx, wireItems, ttl, delta)
 	case BatchWriteSeedStrict:
 		fallthrough
 	default:
-		return c.seedSingles(ctx, items, ttl)
+		return c.seedSingles(ctx, items, ttl, delta)
 	}
 }
 
@@ -725,6 +1130,7 @@ func (c *cache[V]) seedFromBatch(
 	ctx context.Context,
 	items []wire.BatchItem,
 	ttl time.Duration,
+	delta time.Duration,
 ) error {
 	if len(items) == 0 {
 		return nil
@@ -732,7 +1138,9 @@ func (c *cache[V]) seedFromBatch(
 
 	var errs []error
 	for _, it := range items {
-		if err := c.writeSingle(ctx, it.Key, it.Fence, it.Payload, ttl); err != nil {
+		e := singleEntry(it)
+		e.Timing = c.fillTiming(ttl, delta)
+		if err := c.writeSingle(ctx, it.Key, e, ttl); err != nil {
 			errs = append(errs, &OpError{Op: OpSet, Key: it.Key, Err: err})
 		}
 	}
@@ -752,14 +1160,47 @@ func (c *cache[V]) seedSingles(
 	ctx context.Context,
 	items []batchWriteItem[V],
 	ttl time.Duration,
+	delta time.Duration,
 ) error {
+	_, err := c.writeSingles(ctx, items, ttl, delta)
+	return err
+}
+
+// writeSingles is seedSingles that also reports each key's write outcome.
+func (c *cache[V]) writeSingles(
+	ctx context.Context,
+	items []batchWriteItem[V],
+	ttl time.Duration,
+	delta time.Duration,
+) (map[string]WriteOutcome, error) {
+	outcomes := make(map[string]WriteOutcome, len(items))
 	var errs []error
 	for _, it := range items {
-		if _, err := c.SetIfVersionWithTTL(ctx, it.key, it.val, it.obs, ttl); err != nil {
+		res, err := c.setValue(ctx, it.key, it.val, it.obs, ttl, delta)
+		if err != nil {
 			errs = append(errs, err)
 		}
+		outcomes[it.key] = res.Outcome
+	}
+	return outcomes, errors.Join(errs...)
+}
+
+// uniformOutcomes reports the same outcome for every item key.
+func uniformOutcomes[V any](items []VersionedValue[V], outcome WriteOutcome) map[string]WriteOutcome {
+	out := make(map[string]WriteOutcome, len(items))
+	for _, it := range items {
+		out[it.Key] = outcome
+	}
+	return out
+}
+
+// singleEntry converts a validated batch member into its single-entry frame.
+func singleEntry(it wire.BatchItem) wire.SingleEntry {
+	return wire.SingleEntry{
+		Fence:   it.Fence,
+		Deps:    it.Deps,
+		Payload: it.Payload,
 	}
-	return errors.Join(errs...)
 }
 
 // this builds a lookup map from a slice of stored batch items keyed by
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	c "github.com/unkn0wn-root/cascache/v3/codec"
@@ -23,8 +25,12 @@ type cache[V any] struct {
 	hooks   Hooks
 	enabled bool // When false, reads miss and writes are dropped.
 
-	defaultTTL time.Duration
-	batchTTL   time.Duration
+	defaultTTL  time.Duration
+	batchTTL    time.Duration
+	negativeTTL time.Duration
+
+	updateAttempts int
+	updateBase     time.Duration
 
 	computeSetCost SetCostFunc
 	versionStore   version.Store
@@ -39,6 +45,62 @@ type cache[V any] struct {
 	batchEnabled   bool
 	batchSeed      BatchReadSeedMode
 	batchWriteSeed BatchWriteSeedMode
+
+	// batchIndexSize bounds the batch superset index; zero disables it.
+	// batchIndexPruned is when a read last pruned it, in Unix nanoseconds.
+	batchIndexSize   int
+	batchIndexPruned atomic.Int64
+
+	// epochKey identifies the namespace epoch every entry depends on when
+	// epochEnabled is set.
+	epochKey     version.CacheKey
+	epochEnabled bool
+
+	// prefixSep and prefixDepths split keys into the ancestor prefixes every
+	// entry depends on; an empty prefixSep disables hierarchical key mode.
+	prefixSep    string
+	prefixDepths []int
+
+	// fills coalesces concurrent in-process read-through loads per key.
+	fills flightGroup[V]
+
+	// maxStale bounds how long invalidated single values stay servable by
+	// GetOrLoad. Zero keeps reads strict.
+	maxStale   time.Duration
+	background *background
+
+	// earlyBeta is the XFetch beta for early refresh; zero disables it.
+	earlyBeta float64
+
+	// l1 is the optional in-process tier in front of provider. fences caches
+	// authoritative state for L1 validation while the version store's watch
+	// is running; nil means every L1 hit reads the store.
+	l1        pr.Provider
+	l1TTL     time.Duration
+	fences    *fenceCache
+	stopWatch func()
+
+	// near keeps decoded reads validated against fences; nil when disabled.
+	near *nearCache[V]
+
+	// leaser grants fill leases for leaseTTL; nil when leases are disabled.
+	leaser   version.Leaser
+	leaseTTL time.Duration
+
+	// pendingTTL bounds the pending state set by BeginWrite.
+	pendingTTL time.Duration
+
+	// outbox retries failed invalidations; nil when disabled.
+	outbox *InvalidationOutbox
+
+	// followUps holds the delayed invalidations scheduled by
+	// InvalidateWithDelay and invalidateDelays.
+	followUps        delayQueue
+	invalidateDelays []time.Duration
+
+	// revLocks orders generic revisioned writes and conditional
+	// invalidations in-process.
+	revLocks *revisionLocks
 }
 
 func newCache[V any](opts Options[V]) (*cache[V], error) {
@@ -58,11 +120,22 @@ func newCache[V any](opts Options[V]) (*cache[V], error) {
 		provider: opts.Provider,
 		codec:    opts.Codec,
 		enabled:  !opts.Disabled,
+
+		maxStale:   opts.MaxStale,
+		background: newBackground(),
+		earlyBeta:  opts.EarlyRefreshBeta,
+
+		invalidateDelays: opts.InvalidateDelays,
+		revLocks:         newRevisionLocks(),
 	}
 
 	c.hooks = coalesce[Hooks](opts.Hooks, NopHooks{})
 	c.defaultTTL = coalesce(opts.DefaultTTL, 10*time.Minute)
 	c.batchTTL = coalesce(opts.BatchTTL, 10*time.Minute)
+	c.negativeTTL = coalesce(opts.NegativeTTL, time.Minute)
+	c.updateAttempts = max(coalesce(opts.UpdateMaxAttempts, 4), 1)
+	c.updateBase = coalesce(opts.UpdateBackoff, 5*time.Millisecond)
+	c.pendingTTL = coalesce(opts.PendingWriteTTL, 30*time.Second)
 
 	if opts.ComputeSetCost != nil {
 		c.computeSetCost = opts.ComputeSetCost
@@ -91,6 +164,7 @@ func newCache[V any](opts Options[V]) (*cache[V], error) {
 
 	c.batchSeed = opts.BatchReadSeed
 	c.batchWriteSeed = opts.BatchWriteSeed
+	c.batchIndexSize = max(opts.BatchSupersetIndex, 0)
 	if c.batchEnabled && isLocalVersionStore(c.versionStore) {
 		c.hooks.LocalVersionStoreWithBatch()
 	}
@@ -99,19 +173,95 @@ func newCache[V any](opts Options[V]) (*cache[V], error) {
 	c.keyWriter = opts.KeyWriter
 	c.keyInvalidator = opts.KeyInvalidator
 
+	if opts.FillLeaseTTL > 0 {
+		l, ok := c.versionStore.(version.Leaser)
+		if !ok {
+			return nil, ErrFillLeaseNeedsLeaser
+		}
+		c.leaser = l
+		c.leaseTTL = opts.FillLeaseTTL
+	}
+
+	c.epochEnabled = opts.NamespaceEpoch
+	c.epochKey = toVersionCacheKey(c.space.EpochCacheKey())
+
+	if opts.KeyHierarchy.Separator != "" {
+		ds := slices.Clone(opts.KeyHierarchy.Depths)
+		slices.Sort(ds)
+		if len(ds) != 0 && ds[0] < 1 {
+			return nil, ErrKeyHierarchyDepth
+		}
+		c.prefixSep = opts.KeyHierarchy.Separator
+		c.prefixDepths = slices.Compact(ds)
+	}
+
+	if opts.L1 != nil {
+		c.l1 = opts.L1
+		c.l1TTL = coalesce(opts.L1TTL, time.Minute)
+	}
+	if opts.NearCacheSize > 0 {
+		c.near = newNearCache[V](opts.NearCacheSize, coalesce(opts.NearCacheTTL, time.Minute), c.negativeTTL)
+	}
+	if c.l1 != nil || c.near != nil {
+		c.watchFences()
+	}
+	if c.near != nil && c.fences == nil {
+		c.discard()
+		return nil, ErrNearCacheNeedsWatcher
+	}
+
+	if opts.Outbox != nil && c.enabled {
+		if err := opts.Outbox.bind(context.Background(), c.hooks, c.invalidate); err != nil {
+			c.discard()
+			return nil, err
+		}
+		c.outbox = opts.Outbox
+		if err := c.resumeFollowUps(context.Background()); err != nil {
+			c.outbox.unbind()
+			c.discard()
+			return nil, err
+		}
+		c.background.goCtx(context.Background(), c.outbox.run)
+	}
+
 	return c, nil
 }
 
+// discard stops the fence watch and background group of a cache that
+// newCache does not return.
+func (c *cache[V]) discard() {
+	if c.stopWatch != nil {
+		c.stopWatch()
+	}
+	c.background.close()
+}
+
 // Enabled reports whether the cache is active.
 // When disabled, every Get returns a miss and every write is silently dropped.
 func (c *cache[V]) Enabled() bool { return c.enabled }
 
-// Close shuts down the version store then the provider.
+// Close hands the delayed invalidations still waiting to the outbox (or runs
+// them), cancels and waits for background refreshes and outbox retries, then
+// shuts down the outbox store, the version store, the L1 tier, and the
+// provider.
 func (c *cache[V]) Close(ctx context.Context) error {
-	var errs []error
+	errs := []error{c.closeFollowUps(ctx)}
+	if c.background != nil {
+		c.background.close()
+	}
+	if c.stopWatch != nil {
+		c.stopWatch()
+	}
+
+	if c.outbox != nil {
+		errs = append(errs, c.outbox.close(ctx))
+	}
 	if c.versionStore != nil {
 		errs = append(errs, c.versionStore.Close(ctx))
 	}
+	if c.l1 != nil {
+		errs = append(errs, c.l1.Close(ctx))
+	}
 	if c.provider != nil {
 		errs = append(errs, c.provider.Close(ctx))
 	}
@@ -171,6 +321,7 @@ func (c *cache[V]) versionKey(key string) version.CacheKey {
 // counterpart of loadSnapshot.
 func (c *cache[V]) advanceVersion(ctx context.Context, cacheKey version.CacheKey) (version.Snapshot, error) {
 	s, err := c.versionStore.Advance(ctx, cacheKey)
+	c.forgetFences(cacheKey)
 	if err != nil {
 		c.hooks.VersionAdvanceError(cacheKey, err)
 		return version.Snapshot{}, err
@@ -178,6 +329,37 @@ func (c *cache[V]) advanceVersion(ctx context.Context, cacheKey version.CacheKey
 	return s, nil
 }
 
+// advanceVersions advances many canonical keys, using the store's
+// BatchAdvancer capability when available. It returns the failure for each
+// key that was not advanced and reports those through hooks.
+func (c *cache[V]) advanceVersions(ctx context.Context, cacheKeys []version.CacheKey) map[version.CacheKey]error {
+	failed := make(map[version.CacheKey]error)
+	ba, ok := c.versionStore.(version.BatchAdvancer)
+	if !ok {
+		for _, k := range cacheKeys {
+			if _, err := c.advanceVersion(ctx, k); err != nil {
+				failed[k] = err
+			}
+		}
+		return failed
+	}
+
+	advanced, err := ba.AdvanceMany(ctx, cacheKeys)
+	c.forgetFences(cacheKeys...)
+	for _, k := range cacheKeys {
+		if _, ok := advanced[k]; ok {
+			continue
+		}
+		kerr := err
+		if kerr == nil {
+			kerr = fmt.Errorf("version store did not advance %s", k)
+		}
+		c.hooks.VersionAdvanceError(k, kerr)
+		failed[k] = kerr
+	}
+	return failed
+}
+
 // refreshVersion keeps an already matched non-missing version record alive
 // before writing its value. Stores without expiring authoritative metadata do
 // not need this step and are treated as successfully refreshed.
@@ -6,14 +6,21 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	c "github.com/unkn0wn-root/cascache/v3/codec"
 	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	"github.com/unkn0wn-root/cascache/v3/outbox"
 	pr "github.com/unkn0wn-root/cascache/v3/provider"
 	"github.com/unkn0wn-root/cascache/v3/version"
 )
@@ -26,7 +33,8 @@ type memEntry struct {
 const batchValueRoot = "cas:v3:val:b:"
 
 type memProvider struct {
-	m map[string]memEntry
+	mu sync.Mutex
+	m  map[string]memEntry
 }
 
 var (
@@ -37,6 +45,8 @@ var (
 func newMemProvider() *memProvider { return &memProvider{m: make(map[string]memEntry)} }
 
 func (p *memProvider) Get(_ context.Context, key string) ([]byte, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	e, ok := p.m[key]
 	if !ok {
 		return nil, false, nil
@@ -55,6 +65,8 @@ func (p *memProvider) Set(
 	_ int64,
 	ttl time.Duration,
 ) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	var exp time.Time
 	if ttl > 0 {
 		exp = time.Now().Add(ttl)
@@ -70,6 +82,8 @@ func (p *memProvider) Add(
 	_ int64,
 	ttl time.Duration,
 ) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if _, ok := p.m[key]; ok {
 		return false, nil
 	}
@@ -82,8 +96,14 @@ func (p *memProvider) Add(
 	return true, nil
 }
 
-func (p *memProvider) Del(_ context.Context, key string) error { delete(p.m, key); return nil }
-func (p *memProvider) Close(_ context.Context) error           { return nil }
+func (p *memProvider) Del(_ context.Context, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.m, key)
+	return nil
+}
+
+func (p *memProvider) Close(_ context.Context) error { return nil }
 
 type getErrProvider struct {
 	*memProvider
@@ -392,6 +412,11 @@ type recordingHooks struct {
 	NopHooks
 	versionSnapshotErrors int
 	selfHeals             []SelfHealReason
+	selfHealsL1           []SelfHealReason
+}
+
+func (h *recordingHooks) SelfHealL1(_ string, r SelfHealReason) {
+	h.selfHealsL1 = append(h.selfHealsL1, r)
 }
 
 func (h *recordingHooks) VersionSnapshotError(int, error) {
@@ -2569,6 +2594,109 @@ func TestSetIfVersionsOffSkipsSinglesAfterSuccessfulBatchWrite(t *testing.T) {
 	}
 }
 
+func TestSetIfVersionsPartialStoresMatchingMembers(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+	defer closeTest(t, ctx, cc)
+
+	impl := mustImpl(t, cc)
+	keys := []string{"a", "b", "c"}
+	observed := mustSnapshotVersions(t, ctx, cc, keys)
+	if err := cc.Invalidate(ctx, "b"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	res, err := setIfVersionsPartialMap(ctx, cc, keys, observed)
+	if err != nil || !res.Stored() || res.SeededSingles {
+		t.Fatalf("SetIfVersionsPartial: res=%+v err=%v", res, err)
+	}
+	want := map[string]WriteOutcome{
+		"a": WriteOutcomeStored,
+		"b": WriteOutcomeVersionMismatch,
+		"c": WriteOutcomeStored,
+	}
+	if !maps.Equal(res.Outcomes, want) {
+		t.Fatalf("Outcomes=%v want %v", res.Outcomes, want)
+	}
+
+	if _, ok, _ := mp.Get(ctx, impl.singleKeys("b").Value.String()); ok {
+		t.Fatal("skipped member was written as a single")
+	}
+	got, missing, err := cc.GetMany(ctx, []string{"a", "c"})
+	if err != nil || len(missing) != 0 || len(got) != 2 {
+		t.Fatalf("GetMany(accepted): got=%v missing=%v err=%v", got, missing, err)
+	}
+	if _, ok, _ := cc.Get(ctx, "b"); ok {
+		t.Fatal("skipped member was served")
+	}
+}
+
+func TestSetIfVersionsPartialAllStaleWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "user", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"a", "b"}
+	observed := mustSnapshotVersions(t, ctx, cc, keys)
+	if err := cc.InvalidateMany(ctx, keys); err != nil {
+		t.Fatalf("InvalidateMany: %v", err)
+	}
+
+	res, err := setIfVersionsPartialMap(ctx, cc, keys, observed)
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch || res.SeededSingles {
+		t.Fatalf("SetIfVersionsPartial: res=%+v err=%v", res, err)
+	}
+	if len(res.Outcomes) != 2 {
+		t.Fatalf("Outcomes=%v want both keys", res.Outcomes)
+	}
+	if n := len(mp.m); n != 0 {
+		t.Fatalf("nothing should be written, found %d entries", n)
+	}
+}
+
+func TestSetIfVersionsReportsOutcomesPerKey(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"a", "b"}
+	observed := mustSnapshotVersions(t, ctx, cc, keys)
+	if err := cc.Invalidate(ctx, "b"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	// The all-or-nothing path falls back to singles and reports each one.
+	items := []VersionedValue[user]{
+		{Key: "a", Value: user{ID: "a"}, Version: observed["a"]},
+		{Key: "b", Value: user{ID: "b"}, Version: observed["b"]},
+	}
+	res, err := cc.SetIfVersions(ctx, items)
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch || !res.SeededSingles {
+		t.Fatalf("SetIfVersions: res=%+v err=%v", res, err)
+	}
+	want := map[string]WriteOutcome{"a": WriteOutcomeStored, "b": WriteOutcomeVersionMismatch}
+	if !maps.Equal(res.Outcomes, want) {
+		t.Fatalf("Outcomes=%v want %v", res.Outcomes, want)
+	}
+}
+
+func setIfVersionsPartialMap(
+	ctx context.Context,
+	cc *testCache[user],
+	keys []string,
+	observed map[string]Version,
+) (BatchWriteResult, error) {
+	items := make([]VersionedValue[user], len(keys))
+	for i, k := range keys {
+		items[i] = VersionedValue[user]{Key: k, Value: user{ID: k}, Version: observed[k]}
+	}
+	return cc.SetIfVersionsPartial(ctx, items)
+}
+
 func TestSetIfVersionsStrictSkipsSingleAfterBatchValidationRace(t *testing.T) {
 	ctx := context.Background()
 	mp := newMemProvider()
@@ -3482,3 +3610,3376 @@ func TestInvalidateAdvanceOKDeleteFailNoError(t *testing.T) {
 		t.Fatalf("expected no error when delete fails but advance succeeds; got %v", err)
 	}
 }
+
+// ==============================
+// Read-through loader tests
+// ==============================
+
+func TestGetOrLoadFillsOnMissAndHitsAfter(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	want := user{ID: "1", Name: "Ada"}
+	var loads int
+	load := func(context.Context) (user, error) {
+		loads++
+		return want, nil
+	}
+
+	got, res, err := cc.GetOrLoad(ctx, "u:1", load)
+	if err != nil {
+		t.Fatalf("GetOrLoad miss: %v", err)
+	}
+	if got != want || res.Hit || res.Shared || !res.Write.Stored() || res.FillErr != nil {
+		t.Fatalf("GetOrLoad miss: got=%v res=%+v", got, res)
+	}
+
+	got, res, err = cc.GetOrLoad(ctx, "u:1", load)
+	if err != nil {
+		t.Fatalf("GetOrLoad hit: %v", err)
+	}
+	if got != want || !res.Hit || res.Write.Outcome != "" {
+		t.Fatalf("GetOrLoad hit: got=%v res=%+v", got, res)
+	}
+	if loads != 1 {
+		t.Fatalf("loader calls=%d want 1", loads)
+	}
+}
+
+func TestGetOrLoadSkipsFillWhenInvalidatedDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	stale := user{ID: "1", Name: "old"}
+	got, res, err := cc.GetOrLoad(ctx, "u:1", func(ctx context.Context) (user, error) {
+		if err := cc.Invalidate(ctx, "u:1"); err != nil {
+			t.Fatalf("Invalidate: %v", err)
+		}
+		return stale, nil
+	})
+	if err != nil {
+		t.Fatalf("GetOrLoad: %v", err)
+	}
+	if got != stale {
+		t.Fatalf("GetOrLoad should still return the loaded value, got %v", got)
+	}
+	if res.Write.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("fill outcome=%q want %q", res.Write.Outcome, WriteOutcomeVersionMismatch)
+	}
+	if _, ok, _ := cc.Get(ctx, "u:1"); ok {
+		t.Fatalf("value loaded across an invalidation must not be cached")
+	}
+}
+
+func TestGetOrLoadPassesThroughLoaderError(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	sentinel := errors.New("db down")
+	_, res, err := cc.GetOrLoad(ctx, "u:1", func(context.Context) (user, error) {
+		return user{}, sentinel
+	})
+	if err != sentinel {
+		t.Fatalf("GetOrLoad err=%v want %v", err, sentinel)
+	}
+	if res.Write.Outcome != "" {
+		t.Fatalf("failed load must not fill, got %+v", res)
+	}
+}
+
+func TestGetOrLoadSnapshotErrorSkipsLoader(t *testing.T) {
+	ctx := context.Background()
+	sentinel := errors.New("snapshot failed")
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.VersionStore = &failingVersionStore{snapshotErr: sentinel}
+	})
+	defer closeTest(t, ctx, cc)
+
+	_, _, err := cc.GetOrLoad(ctx, "u:1", func(context.Context) (user, error) {
+		t.Fatalf("loader must not run without a snapshotted version")
+		return user{}, nil
+	})
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("GetOrLoad err=%v want %v", err, sentinel)
+	}
+}
+
+func TestGetOrLoadCoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	want := user{ID: "1", Name: "Ada"}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(context.Context) (user, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return want, nil
+	}
+
+	const callers = 8
+	var wg sync.WaitGroup
+	results := make([]user, callers)
+	errs := make([]error, callers)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, errs[0] = cc.GetOrLoad(ctx, "u:1", load)
+	}()
+	<-started
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, errs[i] = cc.GetOrLoad(ctx, "u:1", load)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loader calls=%d want 1", n)
+	}
+	for i := range callers {
+		if errs[i] != nil || results[i] != want {
+			t.Fatalf("caller %d: got=%v err=%v", i, results[i], errs[i])
+		}
+	}
+}
+
+func TestGetOrLoadWaiterHonorsOwnContext(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = cc.GetOrLoad(ctx, "u:1", func(context.Context) (user, error) {
+			close(started)
+			<-release
+			return user{ID: "1"}, nil
+		})
+	}()
+	<-started
+
+	wctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err := cc.GetOrLoad(wctx, "u:1", func(context.Context) (user, error) {
+		t.Fatalf("waiter must not run its own loader")
+		return user{}, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("waiter err=%v want %v", err, context.Canceled)
+	}
+	close(release)
+	<-done
+}
+
+func TestGetOrLoadWaiterRefillsWhenLeaderCanceled(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	lctx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, _, err := cc.GetOrLoad(lctx, "u:1", func(ctx context.Context) (user, error) {
+			close(started)
+			<-ctx.Done()
+			return user{}, ctx.Err()
+		})
+		done <- err
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	got, res, err := cc.GetOrLoad(ctx, "u:1", func(context.Context) (user, error) {
+		return user{ID: "1"}, nil
+	})
+	if err != nil || got.ID != "1" || res.Shared {
+		t.Fatalf("waiter: got=%v res=%+v err=%v", got, res, err)
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader err=%v want %v", err, context.Canceled)
+	}
+}
+
+func TestGetManyOrLoadRefillsKeysOfCanceledLeader(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	lctx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = cc.GetOrLoad(lctx, "a", func(ctx context.Context) (user, error) {
+			close(started)
+			<-ctx.Done()
+			return user{}, ctx.Err()
+		})
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	got, res, err := cc.GetManyOrLoad(ctx, []string{"a", "b"}, func(_ context.Context, missing []string) (map[string]user, error) {
+		out := make(map[string]user, len(missing))
+		for _, k := range missing {
+			out[k] = user{ID: k}
+		}
+		return out, nil
+	})
+	<-done
+	if err != nil || got["a"].ID != "a" || got["b"].ID != "b" || len(res.Missing) != 0 {
+		t.Fatalf("GetManyOrLoad: got=%v res=%+v err=%v", got, res, err)
+	}
+}
+
+func TestGetManyOrLoadFillsMissingAndReportsOutcomes(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	cached := user{ID: "a", Name: "A"}
+	if _, err := cc.SetIfVersion(ctx, "a", cached, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+
+	var loaded [][]string
+	load := func(_ context.Context, missing []string) (map[string]user, error) {
+		loaded = append(loaded, missing)
+		return map[string]user{
+			"b": {ID: "b", Name: "B"},
+			"x": {ID: "x", Name: "not requested"},
+		}, nil
+	}
+
+	got, res, err := cc.GetManyOrLoad(ctx, []string{"c", "a", "b", "c"}, load)
+	if err != nil {
+		t.Fatalf("GetManyOrLoad: %v", err)
+	}
+	if len(loaded) != 1 || !reflect.DeepEqual(loaded[0], []string{"b", "c"}) {
+		t.Fatalf("loader calls=%v want one call with [b c]", loaded)
+	}
+	if len(got) != 2 || got["a"] != cached || got["b"].Name != "B" {
+		t.Fatalf("values=%v", got)
+	}
+	if !reflect.DeepEqual(res.Missing, []string{"c", "c"}) {
+		t.Fatalf("Missing=%v want [c c]", res.Missing)
+	}
+	if !reflect.DeepEqual(res.Outcomes, map[string]WriteOutcome{"b": WriteOutcomeStored}) {
+		t.Fatalf("Outcomes=%v", res.Outcomes)
+	}
+	if _, ok, _ := cc.Get(ctx, "b"); !ok {
+		t.Fatalf("loaded key should be cached")
+	}
+}
+
+func TestGetManyOrLoadReportsPerKeyMismatch(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	_, res, err := cc.GetManyOrLoad(ctx, []string{"a", "b"}, func(ctx context.Context, missing []string) (map[string]user, error) {
+		if err := cc.Invalidate(ctx, "a"); err != nil {
+			t.Fatalf("Invalidate: %v", err)
+		}
+		return map[string]user{"a": {ID: "a"}, "b": {ID: "b"}}, nil
+	})
+	if err != nil {
+		t.Fatalf("GetManyOrLoad: %v", err)
+	}
+	want := map[string]WriteOutcome{
+		"a": WriteOutcomeVersionMismatch,
+		"b": WriteOutcomeStored,
+	}
+	if !reflect.DeepEqual(res.Outcomes, want) {
+		t.Fatalf("Outcomes=%v want %v", res.Outcomes, want)
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("invalidated key must not be cached")
+	}
+	if _, ok, _ := cc.Get(ctx, "b"); !ok {
+		t.Fatalf("unaffected key should be cached by the single fallback")
+	}
+}
+
+func TestGetManyOrLoadPassesThroughLoaderError(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	sentinel := errors.New("db down")
+	got, res, err := cc.GetManyOrLoad(ctx, []string{"a"}, func(context.Context, []string) (map[string]user, error) {
+		return nil, sentinel
+	})
+	if err != sentinel {
+		t.Fatalf("err=%v want %v", err, sentinel)
+	}
+	if len(got) != 0 || !reflect.DeepEqual(res.Missing, []string{"a"}) {
+		t.Fatalf("got=%v missing=%v", got, res.Missing)
+	}
+}
+
+func TestGetManyOrLoadWaitsForOverlappingInFlightKeys(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+			close(started)
+			<-release
+			return user{ID: "a", Name: "A"}, nil
+		})
+	}()
+	<-started
+
+	var loaded []string
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	got, res, err := cc.GetManyOrLoad(ctx, []string{"a", "b"}, func(_ context.Context, missing []string) (map[string]user, error) {
+		loaded = append(loaded, missing...)
+		return map[string]user{"b": {ID: "b", Name: "B"}}, nil
+	})
+	<-done
+	if err != nil {
+		t.Fatalf("GetManyOrLoad: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"b"}) {
+		t.Fatalf("loader keys=%v want only [b]", loaded)
+	}
+	if got["a"].Name != "A" || got["b"].Name != "B" || len(res.Missing) != 0 {
+		t.Fatalf("got=%v missing=%v", got, res.Missing)
+	}
+}
+
+func TestGetManyOrLoadReportsOverlappingNotFoundAsMissing(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+			close(started)
+			<-release
+			return user{}, ErrNotFound
+		})
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	got, res, err := cc.GetManyOrLoad(ctx, []string{"a", "b"}, func(_ context.Context, missing []string) (map[string]user, error) {
+		return map[string]user{"b": {ID: "b", Name: "B"}}, nil
+	})
+	<-done
+	if err != nil {
+		t.Fatalf("GetManyOrLoad: %v", err)
+	}
+	if got["b"].Name != "B" || !reflect.DeepEqual(res.Missing, []string{"a"}) {
+		t.Fatalf("got=%v missing=%v want b loaded and a missing", got, res.Missing)
+	}
+}
+
+// ==============================
+// Bulk invalidation tests
+// ==============================
+
+type recordingBatchKeyInvalidator struct {
+	recordingKeyAdapter
+	manyCalls int
+	errs      map[string]error
+}
+
+var _ BatchKeyInvalidator = (*recordingBatchKeyInvalidator)(nil)
+
+func (s *recordingBatchKeyInvalidator) InvalidateMany(
+	_ context.Context,
+	versionKeys []version.CacheKey,
+	valueKeys []string,
+) []error {
+	s.manyCalls++
+	out := make([]error, len(valueKeys))
+	for i, vk := range valueKeys {
+		out[i] = s.errs[vk]
+	}
+	return out
+}
+
+func TestInvalidateManyAdvancesAndDeletesEveryKey(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "user", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"a", "b", "c"}
+	obs := mustSnapshotVersions(t, ctx, cc, keys)
+	for _, k := range keys {
+		if _, err := cc.SetIfVersion(ctx, k, user{ID: k}, obs[k]); err != nil {
+			t.Fatalf("SetIfVersion(%s): %v", k, err)
+		}
+	}
+
+	if err := cc.InvalidateMany(ctx, []string{"b", "a", "b"}); err != nil {
+		t.Fatalf("InvalidateMany: %v", err)
+	}
+	impl := mustImpl(t, cc)
+	for _, k := range []string{"a", "b"} {
+		if _, ok := mp.m[impl.singleKeys(k).Value.String()]; ok {
+			t.Fatalf("InvalidateMany should delete %q", k)
+		}
+		if res, _ := cc.SetIfVersion(ctx, k, user{ID: k}, obs[k]); res.Outcome != WriteOutcomeVersionMismatch {
+			t.Fatalf("old version for %q should be stale, outcome=%q", k, res.Outcome)
+		}
+	}
+	if _, ok, _ := cc.Get(ctx, "c"); !ok {
+		t.Fatalf("keys outside InvalidateMany must stay cached")
+	}
+}
+
+func TestInvalidateManyReportsPerKeyFailures(t *testing.T) {
+	ctx := context.Background()
+	sentinel := errors.New("advance failed")
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.VersionStore = &failingVersionStore{advanceErr: sentinel}
+	})
+	defer closeTest(t, ctx, cc)
+
+	err := cc.InvalidateMany(ctx, []string{"b", "a"})
+	var me *InvalidateManyError
+	if !errors.As(err, &me) {
+		t.Fatalf("expected *InvalidateManyError, got %T: %v", err, err)
+	}
+	if !reflect.DeepEqual(me.Keys(), []string{"a", "b"}) {
+		t.Fatalf("failed keys=%v want [a b]", me.Keys())
+	}
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("errors.Is(err, advanceErr) should be true")
+	}
+	var ie *InvalidateError
+	if !errors.As(err, &ie) || ie.Key != "a" {
+		t.Fatalf("expected per-key *InvalidateError, got %+v", ie)
+	}
+}
+
+func TestInvalidateManyUsesBatchKeyInvalidator(t *testing.T) {
+	ctx := context.Background()
+	sentinel := errors.New("slot down")
+	mp := newMemProvider()
+	ki := &recordingBatchKeyInvalidator{}
+	cc := newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.KeyInvalidator = ki
+	})
+	defer closeTest(t, ctx, cc)
+	ki.errs = map[string]error{mustImpl(t, cc).singleKeys("b").Value.String(): sentinel}
+
+	err := cc.InvalidateMany(ctx, []string{"a", "b"})
+	var me *InvalidateManyError
+	if !errors.As(err, &me) || !reflect.DeepEqual(me.Keys(), []string{"b"}) {
+		t.Fatalf("InvalidateMany err=%v want failure for b only", err)
+	}
+	if ki.manyCalls != 1 || ki.invalidateCalls != 0 {
+		t.Fatalf("batch calls=%d single calls=%d, want 1/0", ki.manyCalls, ki.invalidateCalls)
+	}
+}
+
+// ==============================
+// Namespace epoch tests
+// ==============================
+
+type recordingFrameWriter struct {
+	recordingKeyAdapter
+	frameCalls int
+	lastFrame  []byte
+}
+
+var _ KeyFrameWriter = (*recordingFrameWriter)(nil)
+
+func (s *recordingFrameWriter) SetFrameIfVersion(
+	_ context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+	encode func(fence version.Fence) ([]byte, error),
+	ttl time.Duration,
+) (bool, error) {
+	s.frameCalls++
+	s.lastVersionKey = versionKey
+	s.lastValueKey = valueKey
+	s.lastExpected = expected
+	s.lastTTL = ttl
+	fence := expected.Fence
+	if !expected.Exists {
+		fence = testFence(1)
+	}
+	frame, err := encode(fence)
+	if err != nil {
+		return false, err
+	}
+	s.lastFrame = frame
+	return s.setStored, s.setErr
+}
+
+func newEpochTestCache(t *testing.T, mp pr.Provider, optsOpt func(*Options[user])) *testCache[user] {
+	t.Helper()
+	return newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.NamespaceEpoch = true
+		if optsOpt != nil {
+			optsOpt(o)
+		}
+	})
+}
+
+func TestInvalidateAllRequiresNamespaceEpoch(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if err := cc.InvalidateAll(ctx); !errors.Is(err, ErrNamespaceEpochDisabled) {
+		t.Fatalf("InvalidateAll err=%v want ErrNamespaceEpochDisabled", err)
+	}
+}
+
+func TestInvalidateAllStalesSinglesAndBatches(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	hooks := &recordingHooks{}
+	cc := newEpochTestCache(t, mp, func(o *Options[user]) {
+		o.Hooks = hooks
+	})
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"a", "b"}
+	res, err := cc.SetIfVersions(ctx, versionedValues(map[string]user{
+		"a": {ID: "a", Name: "A"},
+		"b": {ID: "b", Name: "B"},
+	}, mustSnapshotVersions(t, ctx, cc, keys)))
+	if err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersions: res=%+v err=%v", res, err)
+	}
+	if got, missing, err := cc.GetMany(ctx, keys); err != nil || len(got) != 2 || len(missing) != 0 {
+		t.Fatalf("GetMany before InvalidateAll: got=%v missing=%v err=%v", got, missing, err)
+	}
+	if _, ok, err := cc.Get(ctx, "a"); err != nil || !ok {
+		t.Fatalf("Get before InvalidateAll: ok=%v err=%v", ok, err)
+	}
+
+	if err := cc.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+
+	impl := mustImpl(t, cc)
+	bk, err := impl.batchKeySorted(keys)
+	if err != nil {
+		t.Fatalf("batchKeySorted: %v", err)
+	}
+	got, missing, err := cc.GetMany(ctx, keys)
+	if err != nil || len(got) != 0 || !reflect.DeepEqual(missing, keys) {
+		t.Fatalf("GetMany after InvalidateAll: got=%v missing=%v err=%v", got, missing, err)
+	}
+	if _, ok, _ := mp.Get(ctx, bk.String()); ok {
+		t.Fatalf("stale batch entry should self-heal")
+	}
+	for _, k := range keys {
+		if _, ok, _ := mp.Get(ctx, impl.singleKeys(k).Value.String()); ok {
+			t.Fatalf("stale single %q should self-heal", k)
+		}
+	}
+	for _, r := range hooks.selfHeals {
+		if r != SelfHealReasonVersionMismatch {
+			t.Fatalf("self-heal reasons=%v want only version_mismatch", hooks.selfHeals)
+		}
+	}
+	if len(hooks.selfHeals) != 2 {
+		t.Fatalf("self-heals=%v want one per single", hooks.selfHeals)
+	}
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "A2"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion after InvalidateAll: %v", err)
+	}
+	if v, ok, err := cc.Get(ctx, "a"); err != nil || !ok || v.Name != "A2" {
+		t.Fatalf("fresh write after InvalidateAll should hit: v=%+v ok=%v err=%v", v, ok, err)
+	}
+}
+
+func TestNamespaceEpochRejectsWritesFromOlderEpochs(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newEpochTestCache(t, mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersion(t, ctx, cc, "a")
+	obsMany := mustSnapshotVersions(t, ctx, cc, []string{"a", "b"})
+	if err := cc.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+
+	if res, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, obs); err != nil ||
+		res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("pre-epoch version: res=%+v err=%v want version_mismatch", res, err)
+	}
+	if res, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, Version{}); err != nil ||
+		res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("zero version: res=%+v err=%v want version_mismatch", res, err)
+	}
+	res, err := cc.SetIfVersions(ctx, versionedValues(map[string]user{
+		"a": {ID: "a"},
+		"b": {ID: "b"},
+	}, obsMany))
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("pre-epoch batch: res=%+v err=%v want version_mismatch", res, err)
+	}
+	if len(mp.m) != 0 {
+		t.Fatalf("no entry should be written for an old epoch, provider has %d", len(mp.m))
+	}
+}
+
+func TestNamespaceEpochInvalidatesEntriesWrittenWithoutIt(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	vs := version.NewLocal()
+
+	plain := newTestCache(t, "user", mp, func(o *Options[user]) { o.VersionStore = vs })
+	if _, err := plain.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, plain, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+
+	cc := newEpochTestCache(t, mp, func(o *Options[user]) { o.VersionStore = vs })
+	defer closeTest(t, ctx, cc)
+	if _, ok, err := cc.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("entry without an epoch must not validate: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestNamespaceEpochIsPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	vs := version.NewLocal()
+	users := newEpochTestCache(t, mp, func(o *Options[user]) { o.VersionStore = vs })
+	orders := newTestCache(t, "order", mp, func(o *Options[user]) {
+		o.VersionStore = vs
+		o.NamespaceEpoch = true
+	})
+	defer closeTest(t, ctx, users)
+
+	if _, err := orders.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, orders, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := users.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+	if _, ok, err := orders.Get(ctx, "a"); err != nil || !ok {
+		t.Fatalf("InvalidateAll must not touch other namespaces: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestNamespaceEpochUsesKeyFrameWriter(t *testing.T) {
+	ctx := context.Background()
+	kw := &recordingFrameWriter{recordingKeyAdapter: recordingKeyAdapter{setStored: true}}
+	cc := newEpochTestCache(t, newMemProvider(), func(o *Options[user]) {
+		o.KeyWriter = kw
+	})
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersion(t, ctx, cc, "a")
+	res, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, obs)
+	if err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersion: res=%+v err=%v", res, err)
+	}
+	if kw.frameCalls != 1 || kw.setCalls != 0 {
+		t.Fatalf("frame calls=%d plain calls=%d, want 1/0", kw.frameCalls, kw.setCalls)
+	}
+
+	e, err := wire.DecodeSingleEntry(kw.lastFrame)
+	if err != nil {
+		t.Fatalf("DecodeSingleEntry: %v", err)
+	}
+	epoch := mustImpl(t, cc).epochKey.String()
+	if len(e.Deps) != 1 || e.Deps[0].Key != epoch {
+		t.Fatalf("frame deps=%+v want the namespace epoch %q", e.Deps, epoch)
+	}
+}
+
+// ==============================
+// Tag invalidation tests
+// ==============================
+
+func mustSnapshotVersionWithTags(
+	t *testing.T,
+	ctx context.Context,
+	c CAS[user],
+	key string,
+	tags ...string,
+) Version {
+	t.Helper()
+	v, err := c.SnapshotVersionWithTags(ctx, key, tags...)
+	if err != nil {
+		t.Fatalf("SnapshotVersionWithTags(%q): %v", key, err)
+	}
+	return v
+}
+
+func TestInvalidateTagStalesOnlyTaggedSingles(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "dash", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	for key, tags := range map[string][]string{
+		"u1": {"org:7", "plan:pro"},
+		"u2": {"org:8"},
+		"u3": nil,
+	} {
+		obs := mustSnapshotVersionWithTags(t, ctx, cc, key, tags...)
+		if res, err := cc.SetIfVersion(ctx, key, user{ID: key}, obs); err != nil || !res.Stored() {
+			t.Fatalf("SetIfVersion(%s): res=%+v err=%v", key, res, err)
+		}
+	}
+
+	if err := cc.InvalidateTag(ctx, "plan:pro"); err != nil {
+		t.Fatalf("InvalidateTag: %v", err)
+	}
+	if _, ok, _ := cc.Get(ctx, "u1"); ok {
+		t.Fatalf("entry tagged plan:pro must stop validating")
+	}
+	if _, ok, _ := mp.Get(ctx, mustImpl(t, cc).singleKeys("u1").Value.String()); ok {
+		t.Fatalf("stale tagged entry should self-heal")
+	}
+	for _, k := range []string{"u2", "u3"} {
+		if _, ok, err := cc.Get(ctx, k); err != nil || !ok {
+			t.Fatalf("untouched entry %q should still hit: ok=%v err=%v", k, ok, err)
+		}
+	}
+}
+
+func TestInvalidateTagStalesTaggedBatches(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "dash", mp, func(o *Options[user]) {
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"u1", "u2"}
+	res, err := cc.SetIfVersions(ctx, []VersionedValue[user]{
+		{Key: "u1", Value: user{ID: "u1"}, Version: mustSnapshotVersionWithTags(t, ctx, cc, "u1", "org:7")},
+		{Key: "u2", Value: user{ID: "u2"}, Version: mustSnapshotVersion(t, ctx, cc, "u2")},
+	})
+	if err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersions: res=%+v err=%v", res, err)
+	}
+	if got, _, _ := cc.GetMany(ctx, keys); len(got) != 2 {
+		t.Fatalf("GetMany before InvalidateTag: got=%v", got)
+	}
+
+	if err := cc.InvalidateTag(ctx, "org:7"); err != nil {
+		t.Fatalf("InvalidateTag: %v", err)
+	}
+	bk, err := mustImpl(t, cc).batchKeySorted(keys)
+	if err != nil {
+		t.Fatalf("batchKeySorted: %v", err)
+	}
+	if got, _, _ := cc.GetMany(ctx, keys); len(got) != 0 {
+		t.Fatalf("batch with a stale tagged member must not serve, got=%v", got)
+	}
+	if _, ok, _ := mp.Get(ctx, bk.String()); ok {
+		t.Fatalf("stale batch entry should be deleted")
+	}
+}
+
+func TestTaggedWriteRacingInvalidateTagIsMismatch(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "dash", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersionWithTags(t, ctx, cc, "u1", "org:7")
+	if err := cc.InvalidateTag(ctx, "org:7"); err != nil {
+		t.Fatalf("InvalidateTag: %v", err)
+	}
+	res, err := cc.SetIfVersion(ctx, "u1", user{ID: "u1"}, obs)
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("SetIfVersion: res=%+v err=%v want version_mismatch", res, err)
+	}
+	if len(mp.m) != 0 {
+		t.Fatalf("stale tagged value must not be written")
+	}
+}
+
+func TestTagsCombineWithNamespaceEpoch(t *testing.T) {
+	ctx := context.Background()
+	cc := newEpochTestCache(t, newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersionWithTags(t, ctx, cc, "u1", "org:7", "org:7")
+	impl := mustImpl(t, cc)
+	want := []string{impl.epochKey.String(), impl.tagKey("org:7").String()}
+	var got []string
+	for _, d := range obs.deps.list() {
+		got = append(got, d.Key)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("deps=%v want %v", got, want)
+	}
+
+	if _, err := cc.SetIfVersion(ctx, "u1", user{ID: "u1"}, obs); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := cc.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+	if _, ok, _ := cc.Get(ctx, "u1"); ok {
+		t.Fatalf("InvalidateAll must still stale tagged entries")
+	}
+}
+
+func TestEmptyTagIsRejected(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "dash", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SnapshotVersionWithTags(ctx, "u1", "org:7", ""); !errors.Is(err, ErrEmptyTag) {
+		t.Fatalf("SnapshotVersionWithTags err=%v want ErrEmptyTag", err)
+	}
+	if err := cc.InvalidateTag(ctx, ""); !errors.Is(err, ErrEmptyTag) {
+		t.Fatalf("InvalidateTag err=%v want ErrEmptyTag", err)
+	}
+}
+
+// ==============================
+// Versioned read tests
+// ==============================
+
+func TestGetWithVersionReturnsValidatedVersion(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersion(t, ctx, cc, "a")
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, obs); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+
+	v, ver, ok, err := cc.GetWithVersion(ctx, "a")
+	if err != nil || !ok || v.Name != "v1" {
+		t.Fatalf("GetWithVersion: v=%+v ok=%v err=%v", v, ok, err)
+	}
+	if !ver.Equal(mustSnapshotVersion(t, ctx, cc, "a")) {
+		t.Fatalf("returned version should equal the current snapshot")
+	}
+
+	v.Name = "v2"
+	if res, err := cc.SetIfVersion(ctx, "a", v, ver); err != nil || !res.Stored() {
+		t.Fatalf("read-modify-write: res=%+v err=%v", res, err)
+	}
+	if got, _, _ := cc.Get(ctx, "a"); got.Name != "v2" {
+		t.Fatalf("Get after read-modify-write = %+v", got)
+	}
+
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if res, _ := cc.SetIfVersion(ctx, "a", v, ver); res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("write with pre-invalidate version: outcome=%q want version_mismatch", res.Outcome)
+	}
+}
+
+func TestGetWithVersionMissReturnsZeroVersion(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	_, ver, ok, err := cc.GetWithVersion(ctx, "nope")
+	if err != nil || ok {
+		t.Fatalf("GetWithVersion: ok=%v err=%v", ok, err)
+	}
+	if !ver.Equal(Version{}) {
+		t.Fatalf("miss should return the zero version")
+	}
+}
+
+func TestGetWithVersionKeepsRecordedTags(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "dash", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersionWithTags(t, ctx, cc, "d1", "org:7")
+	if _, err := cc.SetIfVersion(ctx, "d1", user{ID: "d1"}, obs); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	v, ver, ok, err := cc.GetWithVersion(ctx, "d1")
+	if err != nil || !ok {
+		t.Fatalf("GetWithVersion: ok=%v err=%v", ok, err)
+	}
+	if !ver.Equal(mustSnapshotVersionWithTags(t, ctx, cc, "d1", "org:7")) {
+		t.Fatalf("returned version should record the tag fence")
+	}
+	if _, err := cc.SetIfVersion(ctx, "d1", v, ver); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+
+	if err := cc.InvalidateTag(ctx, "org:7"); err != nil {
+		t.Fatalf("InvalidateTag: %v", err)
+	}
+	if _, ok, _ := cc.Get(ctx, "d1"); ok {
+		t.Fatalf("rewritten entry must keep depending on its tag")
+	}
+}
+
+func TestGetManyWithVersionsFromBatchAndSingles(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"a", "b"}
+	obs := mustSnapshotVersions(t, ctx, cc, keys)
+	if res, err := cc.SetIfVersions(ctx, versionedValues(map[string]user{
+		"a": {ID: "a"},
+		"b": {ID: "b"},
+	}, obs)); err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersions: res=%+v err=%v", res, err)
+	}
+	if _, err := cc.SetIfVersion(ctx, "c", user{ID: "c"}, mustSnapshotVersion(t, ctx, cc, "c")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	cObs := mustSnapshotVersion(t, ctx, cc, "c")
+
+	// batch hit
+	got, vers, missing, err := cc.GetManyWithVersions(ctx, []string{"b", "a", "b"})
+	if err != nil || len(got) != 2 || len(missing) != 0 {
+		t.Fatalf("GetManyWithVersions batch: got=%v missing=%v err=%v", got, missing, err)
+	}
+	current := mustSnapshotVersions(t, ctx, cc, keys)
+	for _, k := range keys {
+		if !vers[k].Equal(current[k]) {
+			t.Fatalf("batch version for %q does not match its snapshot", k)
+		}
+	}
+
+	// no batch entry for {c, x}: per-key fallback
+	got, vers, missing, err = cc.GetManyWithVersions(ctx, []string{"c", "x"})
+	if err != nil || len(got) != 1 || !reflect.DeepEqual(missing, []string{"x"}) {
+		t.Fatalf("GetManyWithVersions singles: got=%v missing=%v err=%v", got, missing, err)
+	}
+	if len(vers) != 1 || !vers["c"].Equal(cObs) {
+		t.Fatalf("single fallback versions=%v", vers)
+	}
+}
+
+// ==============================
+// Update tests
+// ==============================
+
+func TestUpdateMissPassesNotFound(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	v, res, err := cc.Update(ctx, "a", func(old user, found bool) (user, error) {
+		if found {
+			t.Fatalf("fn called with found=true on a miss")
+		}
+		return user{ID: "a", Name: "created"}, nil
+	})
+	if err != nil || !res.Stored() || v.Name != "created" {
+		t.Fatalf("Update: v=%+v res=%+v err=%v", v, res, err)
+	}
+	if got, ok, _ := cc.Get(ctx, "a"); !ok || got.Name != "created" {
+		t.Fatalf("Get after Update = %+v ok=%v", got, ok)
+	}
+}
+
+func TestUpdateAppliesToCachedValue(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "x"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, res, err := cc.Update(ctx, "a", func(old user, found bool) (user, error) {
+		if !found || old.Name != "x" {
+			t.Fatalf("fn got old=%+v found=%v", old, found)
+		}
+		old.Name += "y"
+		return old, nil
+	})
+	if err != nil || !res.Stored() {
+		t.Fatalf("Update: res=%+v err=%v", res, err)
+	}
+	if got, _, _ := cc.Get(ctx, "a"); got.Name != "xy" {
+		t.Fatalf("Get after Update = %+v", got)
+	}
+}
+
+func TestUpdateRetriesAfterConflict(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.UpdateBackoff = time.Microsecond
+	})
+	defer closeTest(t, ctx, cc)
+
+	calls := 0
+	v, res, err := cc.Update(ctx, "a", func(old user, found bool) (user, error) {
+		calls++
+		if calls == 1 {
+			// a concurrent writer invalidates between our read and write
+			if err := cc.Invalidate(ctx, "a"); err != nil {
+				t.Fatalf("Invalidate: %v", err)
+			}
+		}
+		return user{ID: "a", Name: fmt.Sprint(calls)}, nil
+	})
+	if err != nil || !res.Stored() {
+		t.Fatalf("Update: res=%+v err=%v", res, err)
+	}
+	if calls != 2 || v.Name != "2" {
+		t.Fatalf("calls=%d v=%+v, want one retry", calls, v)
+	}
+}
+
+func TestUpdateGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.UpdateMaxAttempts = 3
+		o.UpdateBackoff = time.Microsecond
+	})
+	defer closeTest(t, ctx, cc)
+
+	calls := 0
+	_, res, err := cc.Update(ctx, "a", func(old user, found bool) (user, error) {
+		calls++
+		if err := cc.Invalidate(ctx, "a"); err != nil {
+			t.Fatalf("Invalidate: %v", err)
+		}
+		return user{ID: "a"}, nil
+	})
+	if !errors.Is(err, ErrUpdateConflict) {
+		t.Fatalf("err=%v want ErrUpdateConflict", err)
+	}
+	var oe *OpError
+	if !errors.As(err, &oe) || oe.Op != OpUpdate || oe.Key != "a" {
+		t.Fatalf("err=%#v want *OpError{Op: update, Key: a}", err)
+	}
+	if calls != 3 || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("calls=%d outcome=%q", calls, res.Outcome)
+	}
+}
+
+func TestUpdateConcurrentIncrementsAreNotLost(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.UpdateMaxAttempts = 1000
+		o.UpdateBackoff = time.Microsecond
+	})
+	defer closeTest(t, ctx, cc)
+
+	const workers, rounds = 8, 25
+	var stored atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				_, res, err := cc.Update(ctx, "a", func(old user, found bool) (user, error) {
+					n := 0
+					if found {
+						fmt.Sscan(old.Name, &n)
+					}
+					time.Sleep(50 * time.Microsecond) // let other workers read the same version
+					return user{ID: "a", Name: fmt.Sprint(n + 1)}, nil
+				})
+				if err != nil {
+					t.Errorf("Update: %v", err)
+					return
+				}
+				if res.Stored() {
+					stored.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, ok, err := cc.Get(ctx, "a")
+	if err != nil || !ok {
+		t.Fatalf("Get: ok=%v err=%v", ok, err)
+	}
+	if want := fmt.Sprint(stored.Load()); got.Name != want {
+		t.Fatalf("counter=%s after %s stored updates, want every increment kept", got.Name, want)
+	}
+	if stored.Load() != workers*rounds {
+		t.Fatalf("stored=%d, want %d", stored.Load(), workers*rounds)
+	}
+}
+
+func TestUpdatePassesThroughFnError(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	boom := errors.New("boom")
+	_, _, err := cc.Update(ctx, "a", func(user, bool) (user, error) { return user{}, boom })
+	if err != boom {
+		t.Fatalf("err=%v want fn error unchanged", err)
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("nothing should be written when fn fails")
+	}
+}
+
+func TestUpdateStopsOnContextCancelDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.UpdateBackoff = time.Hour
+	})
+	defer closeTest(t, context.Background(), cc)
+
+	_, _, err := cc.Update(ctx, "a", func(user, bool) (user, error) {
+		_ = cc.Invalidate(ctx, "a")
+		cancel()
+		return user{ID: "a"}, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want context.Canceled", err)
+	}
+}
+
+// ==============================
+// Negative caching tests
+// ==============================
+
+func TestSetAbsentIfVersionServesKnownAbsent(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersion(t, ctx, cc, "ghost")
+	if res, err := cc.SetAbsentIfVersion(ctx, "ghost", obs); err != nil || !res.Stored() {
+		t.Fatalf("SetAbsentIfVersion: res=%+v err=%v", res, err)
+	}
+
+	_, ver, ok, err := cc.GetWithVersion(ctx, "ghost")
+	if ok || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWithVersion: ok=%v err=%v want ErrNotFound", ok, err)
+	}
+	if !ver.Equal(mustSnapshotVersion(t, ctx, cc, "ghost")) {
+		t.Fatalf("tombstone should report the version it was validated against")
+	}
+
+	// the tombstone version allows replacing it with a value
+	if res, err := cc.SetIfVersion(ctx, "ghost", user{ID: "ghost"}, ver); err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersion over tombstone: res=%+v err=%v", res, err)
+	}
+	if v, ok, err := cc.Get(ctx, "ghost"); err != nil || !ok || v.ID != "ghost" {
+		t.Fatalf("Get after replacing tombstone: v=%+v ok=%v err=%v", v, ok, err)
+	}
+}
+
+func TestInvalidateClearsTombstone(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	obs := mustSnapshotVersion(t, ctx, cc, "ghost")
+	if _, err := cc.SetAbsentIfVersion(ctx, "ghost", obs); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "ghost"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok, err := cc.Get(ctx, "ghost"); ok || err != nil {
+		t.Fatalf("Get after Invalidate: ok=%v err=%v want plain miss", ok, err)
+	}
+
+	// a tombstone based on the pre-invalidate version is rejected
+	if res, _ := cc.SetAbsentIfVersion(ctx, "ghost", obs); res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("stale tombstone outcome=%q want version_mismatch", res.Outcome)
+	}
+}
+
+func TestTombstoneUsesNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	kw := &recordingFrameWriter{recordingKeyAdapter: recordingKeyAdapter{setStored: true}}
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.KeyWriter = kw
+		o.NegativeTTL = 7 * time.Second
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetAbsentIfVersion(ctx, "ghost", mustSnapshotVersion(t, ctx, cc, "ghost")); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	if kw.frameCalls != 1 || kw.lastTTL != 7*time.Second {
+		t.Fatalf("frameCalls=%d ttl=%v want one frame write with NegativeTTL", kw.frameCalls, kw.lastTTL)
+	}
+	e, err := wire.DecodeSingleEntry(kw.lastFrame)
+	if err != nil || !e.Absent {
+		t.Fatalf("frame should be a tombstone: %+v err=%v", e, err)
+	}
+}
+
+func TestTombstoneExpiresAfterNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.NegativeTTL = 10 * time.Millisecond
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetAbsentIfVersion(ctx, "ghost", mustSnapshotVersion(t, ctx, cc, "ghost")); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok, err := cc.Get(ctx, "ghost"); ok || err != nil {
+		t.Fatalf("Get after NegativeTTL: ok=%v err=%v want plain miss", ok, err)
+	}
+}
+
+func TestGetOrLoadCachesNotFound(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	loads := 0
+	load := func(context.Context) (user, error) {
+		loads++
+		return user{}, fmt.Errorf("lookup: %w", ErrNotFound)
+	}
+
+	_, res, err := cc.GetOrLoad(ctx, "ghost", load)
+	if !errors.Is(err, ErrNotFound) || res.Hit || !res.Write.Stored() {
+		t.Fatalf("first GetOrLoad: res=%+v err=%v", res, err)
+	}
+	_, res, err = cc.GetOrLoad(ctx, "ghost", load)
+	if !errors.Is(err, ErrNotFound) || !res.Hit {
+		t.Fatalf("second GetOrLoad: res=%+v err=%v want tombstone hit", res, err)
+	}
+	if loads != 1 {
+		t.Fatalf("loads=%d want 1", loads)
+	}
+}
+
+func TestGetManyTreatsTombstoneAsMissing(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetAbsentIfVersion(ctx, "ghost", mustSnapshotVersion(t, ctx, cc, "ghost")); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	got, missing, err := cc.GetMany(ctx, []string{"ghost"})
+	if err != nil || len(got) != 0 || !reflect.DeepEqual(missing, []string{"ghost"}) {
+		t.Fatalf("GetMany: got=%v missing=%v err=%v", got, missing, err)
+	}
+}
+
+func TestUpdateReplacesTombstone(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetAbsentIfVersion(ctx, "ghost", mustSnapshotVersion(t, ctx, cc, "ghost")); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	_, res, err := cc.Update(ctx, "ghost", func(_ user, found bool) (user, error) {
+		if found {
+			t.Fatalf("tombstone must be passed as found=false")
+		}
+		return user{ID: "ghost"}, nil
+	})
+	if err != nil || !res.Stored() {
+		t.Fatalf("Update: res=%+v err=%v", res, err)
+	}
+	if _, ok, err := cc.Get(ctx, "ghost"); !ok || err != nil {
+		t.Fatalf("Get after Update: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestUpdateWithNearCacheDoesNotPatchSharedValue(t *testing.T) {
+	ctx := context.Background()
+	cc, err := New[map[string]int](Options[map[string]int]{
+		Namespace:     "counters",
+		Provider:      newMemProvider(),
+		Codec:         c.JSON[map[string]int]{},
+		NearCacheSize: 16,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "k", map[string]int{"n": 1}, mustSnapshotVersion(t, ctx, cc, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if _, ok, err := cc.Get(ctx, "k"); !ok || err != nil {
+		t.Fatalf("Get: ok=%v err=%v", ok, err)
+	}
+
+	stop := errors.New("stop")
+	_, _, err = cc.Update(ctx, "k", func(old map[string]int, _ bool) (map[string]int, error) {
+		old["n"] = 99
+		return nil, stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Update err=%v want fn error", err)
+	}
+	if got, _, _ := cc.Get(ctx, "k"); got["n"] != 1 {
+		t.Fatalf("near value patched by fn: %v", got)
+	}
+}
+
+// ==============================
+// Stale-while-revalidate tests
+// ==============================
+
+func TestGetOrLoadServesStaleWhileRefreshing(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.MaxStale = time.Minute
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("Get must stay strict after Invalidate")
+	}
+
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(context.Context) (user, error) {
+		loads.Add(1)
+		<-release
+		return user{ID: "a", Name: "v2"}, nil
+	}
+
+	for range 2 {
+		v, res, err := cc.GetOrLoad(ctx, "a", load)
+		if err != nil || !res.Stale || v.Name != "v1" {
+			t.Fatalf("GetOrLoad during refresh: v=%+v res=%+v err=%v", v, res, err)
+		}
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		v, ok, err := cc.Get(ctx, "a")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if ok && v.Name == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh did not store the fresh value")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("loads=%d want one background refresh", n)
+	}
+
+	// the stored refresh dropped the stale copy
+	if err := mustImpl(t, cc).provider.Del(ctx, mustImpl(t, cc).singleKeys("a").Value.String()); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	if _, res, _ := cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+		return user{ID: "a", Name: "v3"}, nil
+	}); res.Stale {
+		t.Fatalf("stale copy should be dropped after a stored refresh")
+	}
+}
+
+func TestGetOrLoadStrictWithoutMaxStale(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	v, res, err := cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+		return user{ID: "a", Name: "v2"}, nil
+	})
+	if err != nil || res.Stale || v.Name != "v2" {
+		t.Fatalf("GetOrLoad: v=%+v res=%+v err=%v", v, res, err)
+	}
+}
+
+func TestStaleValueExpiresAfterMaxStale(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.MaxStale = 10 * time.Millisecond
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := cc.InvalidateMany(ctx, []string{"a"}); err != nil {
+		t.Fatalf("InvalidateMany: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	v, res, err := cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+		return user{ID: "a", Name: "v2"}, nil
+	})
+	if err != nil || res.Stale || v.Name != "v2" {
+		t.Fatalf("GetOrLoad after MaxStale: v=%+v res=%+v err=%v", v, res, err)
+	}
+}
+
+func TestInvalidateDoesNotRetainStaleEntry(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.MaxStale = time.Minute
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	// advance the fence without deleting the entry, as a lost delete would
+	impl := mustImpl(t, cc)
+	if _, err := impl.advanceVersion(ctx, impl.versionKey("a")); err != nil {
+		t.Fatalf("advanceVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok := impl.getStale(ctx, "a"); ok {
+		t.Fatalf("an already stale entry must not be retained")
+	}
+}
+
+func TestStaleEntryRefusedOnceKeyOrDependencyMoves(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.MaxStale = time.Minute
+		o.NamespaceEpoch = true
+	})
+	defer closeTest(t, ctx, cc)
+	impl := mustImpl(t, cc)
+
+	seed := func() {
+		t.Helper()
+		if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+			t.Fatalf("SetIfVersion: %v", err)
+		}
+		if err := cc.Invalidate(ctx, "a"); err != nil {
+			t.Fatalf("Invalidate: %v", err)
+		}
+		if v, ok := impl.getStale(ctx, "a"); !ok || v.Name != "v1" {
+			t.Fatalf("getStale after Invalidate: v=%+v ok=%v", v, ok)
+		}
+	}
+
+	// the key moves past the fence its invalidation stamped on the copy
+	seed()
+	if _, err := impl.advanceVersion(ctx, impl.versionKey("a")); err != nil {
+		t.Fatalf("advanceVersion: %v", err)
+	}
+	if _, ok := impl.getStale(ctx, "a"); ok {
+		t.Fatalf("stale copy served after the key moved again")
+	}
+
+	seed()
+	if err := cc.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+	if _, ok := impl.getStale(ctx, "a"); ok {
+		t.Fatalf("stale copy served after a dependency moved")
+	}
+}
+
+func TestCloseCancelsBackgroundRefresh(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.MaxStale = time.Minute
+	})
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	_, res, err := cc.GetOrLoad(ctx, "a", func(ctx context.Context) (user, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return user{}, ctx.Err()
+	})
+	if err != nil || !res.Stale {
+		t.Fatalf("GetOrLoad: res=%+v err=%v", res, err)
+	}
+	<-started
+
+	closeTest(t, ctx, cc)
+	select {
+	case <-canceled:
+	default:
+		t.Fatalf("Close returned before the background refresh exited")
+	}
+}
+
+// ==============================
+// Early refresh tests
+// ==============================
+
+func TestXFetchCurve(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+	tm := wire.Timing{WrittenAt: t0, TTL: 10 * time.Second, Delta: time.Second}
+
+	if xfetch(t0.Add(9*time.Second), tm, 1, 1) {
+		t.Fatalf("u=1 adds no gap, so a read before expiry must not refresh")
+	}
+	if !xfetch(t0.Add(9*time.Second), tm, 1, math.Exp(-2)) {
+		t.Fatalf("a 2s gap one second before expiry must refresh")
+	}
+	if xfetch(t0.Add(7*time.Second), tm, 1, math.Exp(-2)) {
+		t.Fatalf("a 2s gap three seconds before expiry must not refresh")
+	}
+	if !xfetch(t0.Add(7*time.Second), tm, 2, math.Exp(-2)) {
+		t.Fatalf("doubling beta doubles the gap")
+	}
+	if !xfetch(t0.Add(10*time.Second), tm, 1, 1) {
+		t.Fatalf("an expired entry always refreshes")
+	}
+}
+
+func TestGetOrLoadRecordsTimingOnlyWithEarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	load := func(context.Context) (user, error) {
+		time.Sleep(time.Millisecond)
+		return user{ID: "a"}, nil
+	}
+
+	for _, beta := range []float64{0, 1} {
+		mp := newMemProvider()
+		cc := newTestCache(t, "user", mp, func(o *Options[user]) {
+			o.EarlyRefreshBeta = beta
+		})
+
+		if _, _, err := cc.GetOrLoad(ctx, "a", load); err != nil {
+			t.Fatalf("GetOrLoad: %v", err)
+		}
+		raw, ok, _ := mp.Get(ctx, mustImpl(t, cc).singleKeys("a").Value.String())
+		if !ok {
+			t.Fatalf("beta=%v: fill not stored", beta)
+		}
+		e, err := wire.DecodeSingleEntry(raw)
+		if err != nil {
+			t.Fatalf("DecodeSingleEntry: %v", err)
+		}
+		if beta == 0 && !e.Plain() {
+			t.Fatalf("without early refresh the frame must keep the plain layout")
+		}
+		if beta > 0 && (e.Timing.TTL != 10*time.Minute || e.Timing.Delta < time.Millisecond) {
+			t.Fatalf("timing=%+v want default TTL and measured load duration", e.Timing)
+		}
+		closeTest(t, ctx, cc)
+	}
+}
+
+func TestGetManyOrLoadRecordsTimingInSingles(t *testing.T) {
+	ctx := context.Background()
+	load := func(_ context.Context, keys []string) (map[string]user, error) {
+		time.Sleep(time.Millisecond)
+		out := make(map[string]user, len(keys))
+		for _, k := range keys {
+			out[k] = user{ID: k}
+		}
+		return out, nil
+	}
+
+	for _, seed := range []BatchWriteSeedMode{BatchWriteSeedStrict, BatchWriteSeedFast} {
+		mp := newMemProvider()
+		cc := newTestCache(t, "user", mp, func(o *Options[user]) {
+			o.EarlyRefreshBeta = 1
+			o.BatchWriteSeed = seed
+		})
+
+		if _, _, err := cc.GetManyOrLoad(ctx, []string{"a", "b"}, load); err != nil {
+			t.Fatalf("GetManyOrLoad: %v", err)
+		}
+		for _, k := range []string{"a", "b"} {
+			raw, ok, _ := mp.Get(ctx, mustImpl(t, cc).singleKeys(k).Value.String())
+			if !ok {
+				t.Fatalf("seed=%v: single %s not seeded", seed, k)
+			}
+			e, err := wire.DecodeSingleEntry(raw)
+			if err != nil {
+				t.Fatalf("DecodeSingleEntry: %v", err)
+			}
+			if e.Timing.TTL != 10*time.Minute || e.Timing.Delta < time.Millisecond {
+				t.Fatalf("seed=%v key=%s timing=%+v want default TTL and measured load duration", seed, k, e.Timing)
+			}
+		}
+		closeTest(t, ctx, cc)
+	}
+}
+
+func TestGetOrLoadRefreshesEarly(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		// a huge beta makes every hit fall inside the refresh window
+		o.EarlyRefreshBeta = 1e9
+	})
+	defer closeTest(t, ctx, cc)
+
+	var loads atomic.Int32
+	load := func(context.Context) (user, error) {
+		n := loads.Add(1)
+		time.Sleep(time.Millisecond)
+		return user{ID: "a", Name: fmt.Sprint(n)}, nil
+	}
+
+	if _, res, err := cc.GetOrLoad(ctx, "a", load); err != nil || res.Hit {
+		t.Fatalf("first GetOrLoad: res=%+v err=%v", res, err)
+	}
+	v, res, err := cc.GetOrLoad(ctx, "a", load)
+	if err != nil || !res.Hit || !res.EarlyRefresh || v.Name != "1" {
+		t.Fatalf("second GetOrLoad: v=%+v res=%+v err=%v", v, res, err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if v, ok, _ := cc.Get(ctx, "a"); ok && v.Name == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("early refresh did not store the reloaded value")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEarlyRefreshIgnoresEntriesWithoutTiming(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.EarlyRefreshBeta = 1e9
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, res, err := cc.GetOrLoad(ctx, "a", func(context.Context) (user, error) {
+		t.Fatalf("load must not run")
+		return user{}, nil
+	})
+	if err != nil || !res.Hit || res.EarlyRefresh {
+		t.Fatalf("GetOrLoad: res=%+v err=%v", res, err)
+	}
+}
+
+// ==============================
+// L1 tier tests
+// ==============================
+
+type countingGetProvider struct {
+	*memProvider
+	gets atomic.Int32
+}
+
+func (p *countingGetProvider) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	p.gets.Add(1)
+	return p.memProvider.Get(ctx, key)
+}
+
+type watchingCountingStore struct {
+	*countingVersionStore
+	local *version.LocalStore
+}
+
+var _ version.Watcher = (*watchingCountingStore)(nil)
+
+func (s *watchingCountingStore) Watch(fn func(version.CacheKey, bool)) (func(), error) {
+	return s.local.Watch(fn)
+}
+
+func newWatchingCountingStore() *watchingCountingStore {
+	local := version.NewLocal()
+	return &watchingCountingStore{
+		countingVersionStore: &countingVersionStore{inner: local},
+		local:                local,
+	}
+}
+
+func TestL1HitSkipsL2(t *testing.T) {
+	ctx := context.Background()
+	l2 := &countingGetProvider{memProvider: newMemProvider()}
+	l1 := newMemProvider()
+	cc := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.L1 = l1
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	for i := range 3 {
+		if v, ok, err := cc.Get(ctx, "a"); err != nil || !ok || v.ID != "a" {
+			t.Fatalf("Get #%d: v=%+v ok=%v err=%v", i, v, ok, err)
+		}
+	}
+	if n := l2.gets.Load(); n != 1 {
+		t.Fatalf("L2 gets=%d want 1 (later hits served by L1)", n)
+	}
+
+	sk := mustImpl(t, cc).singleKeys("a").Value.String()
+	l1Raw, _, _ := l1.Get(ctx, sk)
+	l2Raw, _, _ := l2.memProvider.Get(ctx, sk)
+	if !bytes.Equal(l1Raw, l2Raw) {
+		t.Fatalf("L1 should hold the frame fetched from L2")
+	}
+}
+
+func TestL1HitUsesWatchedFences(t *testing.T) {
+	ctx := context.Background()
+	store := newWatchingCountingStore()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.L1 = newMemProvider()
+		o.VersionStore = store
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, _, _ = cc.Get(ctx, "a") // L2 hit fills L1
+	_, _, _ = cc.Get(ctx, "a") // L1 hit loads the fence once
+
+	before := store.snapshotCalls + store.snapshotManyCalls
+	for range 3 {
+		if _, ok, err := cc.Get(ctx, "a"); err != nil || !ok {
+			t.Fatalf("Get: ok=%v err=%v", ok, err)
+		}
+	}
+	if after := store.snapshotCalls + store.snapshotManyCalls; after != before {
+		t.Fatalf("L1 hits read the version store %d times, want 0", after-before)
+	}
+}
+
+func TestL1WithoutWatcherValidatesAgainstStore(t *testing.T) {
+	ctx := context.Background()
+	store := &countingVersionStore{inner: version.NewLocal()}
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.L1 = newMemProvider()
+		o.VersionStore = store
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, _, _ = cc.Get(ctx, "a")
+
+	before := store.snapshotCalls + store.snapshotManyCalls
+	if _, ok, err := cc.Get(ctx, "a"); err != nil || !ok {
+		t.Fatalf("Get: ok=%v err=%v", ok, err)
+	}
+	if after := store.snapshotCalls + store.snapshotManyCalls; after != before+1 {
+		t.Fatalf("L1 hit read the version store %d times, want 1", after-before)
+	}
+}
+
+func TestL1RejectsEntryInvalidatedByPeer(t *testing.T) {
+	ctx := context.Background()
+	l2 := newMemProvider()
+	store := version.NewLocal()
+	hooks := &recordingHooks{}
+	a := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.L1 = newMemProvider()
+		o.VersionStore = store
+		o.Hooks = hooks
+	})
+	b := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.L1 = newMemProvider()
+		o.VersionStore = store
+	})
+	defer closeTest(t, ctx, a)
+
+	if _, err := a.SetIfVersion(ctx, "k", user{ID: "k", Name: "v1"}, mustSnapshotVersion(t, ctx, a, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, _, _ = a.Get(ctx, "k")
+	_, _, _ = a.Get(ctx, "k") // cached fence in a
+
+	if err := b.Invalidate(ctx, "k"); err != nil {
+		t.Fatalf("peer Invalidate: %v", err)
+	}
+	if _, err := b.SetIfVersion(ctx, "k", user{ID: "k", Name: "v2"}, mustSnapshotVersion(t, ctx, b, "k")); err != nil {
+		t.Fatalf("peer SetIfVersion: %v", err)
+	}
+
+	v, ok, err := a.Get(ctx, "k")
+	if err != nil || !ok || v.Name != "v2" {
+		t.Fatalf("Get after peer invalidate: v=%+v ok=%v err=%v", v, ok, err)
+	}
+	if !reflect.DeepEqual(hooks.selfHealsL1, []SelfHealReason{SelfHealReasonVersionMismatch}) || len(hooks.selfHeals) != 0 {
+		t.Fatalf("L1 heals=%v L2 heals=%v, want one L1 version mismatch", hooks.selfHealsL1, hooks.selfHeals)
+	}
+}
+
+func TestMultiForwardsSelfHealL1ToL1Hooks(t *testing.T) {
+	rec := &recordingHooks{}
+	lh, ok := Multi(rec, nil).(L1Hooks)
+	if !ok {
+		t.Fatal("Multi should implement L1Hooks")
+	}
+	lh.SelfHealL1("k", SelfHealReasonCorrupt)
+	if !reflect.DeepEqual(rec.selfHealsL1, []SelfHealReason{SelfHealReasonCorrupt}) {
+		t.Fatalf("L1 heals=%v, want the forwarded event", rec.selfHealsL1)
+	}
+}
+
+func TestL1ClearedByWriteAndInvalidate(t *testing.T) {
+	ctx := context.Background()
+	l1 := newMemProvider()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.L1 = l1
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v1"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, ver, _, _ := cc.GetWithVersion(ctx, "a")
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a", Name: "v2"}, ver); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if v, _, _ := cc.Get(ctx, "a"); v.Name != "v2" {
+		t.Fatalf("Get after rewrite = %+v, L1 kept the old frame", v)
+	}
+
+	sk := mustImpl(t, cc).singleKeys("a").Value.String()
+	if _, ok, _ := l1.Get(ctx, sk); !ok {
+		t.Fatalf("Get should have refilled L1")
+	}
+	if err := cc.Invalidate(ctx, "a"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok, _ := l1.Get(ctx, sk); ok {
+		t.Fatalf("Invalidate must clear L1")
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("Get after Invalidate should miss")
+	}
+}
+
+// ==============================
+// Near cache tests
+// ==============================
+
+func TestNearCacheRequiresWatcher(t *testing.T) {
+	_, err := New(Options[user]{
+		Namespace:     "user",
+		Provider:      newMemProvider(),
+		Codec:         c.JSON[user]{},
+		VersionStore:  &countingVersionStore{inner: version.NewLocal()},
+		NearCacheSize: 8,
+	})
+	if !errors.Is(err, ErrNearCacheNeedsWatcher) {
+		t.Fatalf("New err=%v want ErrNearCacheNeedsWatcher", err)
+	}
+}
+
+func TestNearCacheHitSkipsProviderAndStore(t *testing.T) {
+	ctx := context.Background()
+	l2 := &countingGetProvider{memProvider: newMemProvider()}
+	store := newWatchingCountingStore()
+	cc := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.VersionStore = store
+		o.NearCacheSize = 8
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, _, _ = cc.Get(ctx, "a") // provider read fills the near cache
+	_, _, _ = cc.Get(ctx, "a") // near hit loads the fence once
+
+	gets := l2.gets.Load()
+	snaps := store.snapshotCalls + store.snapshotManyCalls
+	for range 3 {
+		if v, ok, err := cc.Get(ctx, "a"); err != nil || !ok || v.ID != "a" {
+			t.Fatalf("Get: v=%+v ok=%v err=%v", v, ok, err)
+		}
+	}
+	if n := l2.gets.Load() - gets; n != 0 {
+		t.Fatalf("near hits read the provider %d times", n)
+	}
+	if n := store.snapshotCalls + store.snapshotManyCalls - snaps; n != 0 {
+		t.Fatalf("near hits read the version store %d times", n)
+	}
+}
+
+func TestNearCacheDropsOnPeerInvalidateAndRewrite(t *testing.T) {
+	ctx := context.Background()
+	l2 := newMemProvider()
+	store := version.NewLocal()
+	a := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.VersionStore = store
+		o.NearCacheSize = 8
+	})
+	b := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.VersionStore = store
+	})
+	defer closeTest(t, ctx, a)
+
+	if _, err := a.SetIfVersion(ctx, "k", user{ID: "k", Name: "v1"}, mustSnapshotVersion(t, ctx, a, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, ver, _, _ := a.GetWithVersion(ctx, "k")
+
+	// A rewrite keeps the fence, so the near copy must be dropped explicitly.
+	if _, err := a.SetIfVersion(ctx, "k", user{ID: "k", Name: "v2"}, ver); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if v, _, _ := a.Get(ctx, "k"); v.Name != "v2" {
+		t.Fatalf("Get after rewrite = %+v", v)
+	}
+
+	if err := b.Invalidate(ctx, "k"); err != nil {
+		t.Fatalf("peer Invalidate: %v", err)
+	}
+	if _, err := b.SetIfVersion(ctx, "k", user{ID: "k", Name: "v3"}, mustSnapshotVersion(t, ctx, b, "k")); err != nil {
+		t.Fatalf("peer SetIfVersion: %v", err)
+	}
+	if v, ok, err := a.Get(ctx, "k"); err != nil || !ok || v.Name != "v3" {
+		t.Fatalf("Get after peer invalidate: v=%+v ok=%v err=%v", v, ok, err)
+	}
+}
+
+func TestNearCacheResetFallsBackToMisses(t *testing.T) {
+	ctx := context.Background()
+	store := version.NewLocal()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.VersionStore = store
+		o.NearCacheSize = 8
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetIfVersion(ctx, "a", user{ID: "a"}, mustSnapshotVersion(t, ctx, cc, "a")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	_, _, _ = cc.Get(ctx, "a")
+	if n := len(mustImpl(t, cc).near.entries); n != 1 {
+		t.Fatalf("near entries=%d want 1", n)
+	}
+
+	store.Reset()
+	if n := len(mustImpl(t, cc).near.entries); n != 0 {
+		t.Fatalf("reset left %d near entries", n)
+	}
+	if _, ok, err := cc.Get(ctx, "a"); ok || err != nil {
+		t.Fatalf("Get after reset: ok=%v err=%v, want miss", ok, err)
+	}
+}
+
+func TestNearCacheServesTombstones(t *testing.T) {
+	ctx := context.Background()
+	l2 := &countingGetProvider{memProvider: newMemProvider()}
+	cc := newTestCache(t, "user", l2, func(o *Options[user]) {
+		o.NearCacheSize = 8
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := cc.SetAbsentIfVersion(ctx, "gone", mustSnapshotVersion(t, ctx, cc, "gone")); err != nil {
+		t.Fatalf("SetAbsentIfVersion: %v", err)
+	}
+	for range 3 {
+		if _, _, err := cc.Get(ctx, "gone"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get err=%v want ErrNotFound", err)
+		}
+	}
+	if n := l2.gets.Load(); n != 1 {
+		t.Fatalf("provider gets=%d want 1", n)
+	}
+}
+
+// ==============================
+// Fill lease tests
+// ==============================
+
+func TestFillLeaseRequiresLeaser(t *testing.T) {
+	_, err := New(Options[user]{
+		Namespace:    "user",
+		Provider:     newMemProvider(),
+		Codec:        c.JSON[user]{},
+		VersionStore: &countingVersionStore{inner: version.NewLocal()},
+		FillLeaseTTL: time.Second,
+	})
+	if !errors.Is(err, ErrFillLeaseNeedsLeaser) {
+		t.Fatalf("New err=%v want ErrFillLeaseNeedsLeaser", err)
+	}
+}
+
+func TestFillLeaseOneLoadAcrossCaches(t *testing.T) {
+	ctx := context.Background()
+	l2 := newMemProvider()
+	store := version.NewLocal()
+	withLease := func(o *Options[user]) {
+		o.VersionStore = store
+		o.FillLeaseTTL = time.Minute
+	}
+	a := newTestCache(t, "user", l2, withLease)
+	b := newTestCache(t, "user", l2, withLease)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan LoadResult, 1)
+	go func() {
+		_, res, err := a.GetOrLoad(ctx, "k", func(context.Context) (user, error) {
+			close(started)
+			<-release
+			return user{ID: "k", Name: "a"}, nil
+		})
+		if err != nil {
+			t.Errorf("holder GetOrLoad: %v", err)
+		}
+		done <- res
+	}()
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+	v, res, err := b.GetOrLoad(ctx, "k", func(context.Context) (user, error) {
+		t.Error("waiter loaded despite the lease")
+		return user{}, nil
+	})
+	if err != nil || v.Name != "a" || !res.LeaseWaited || !res.Hit {
+		t.Fatalf("waiter: v=%+v res=%+v err=%v", v, res, err)
+	}
+	if res := <-done; !res.Write.Stored() || res.LeaseWaited {
+		t.Fatalf("holder result=%+v", res)
+	}
+}
+
+func TestFillLeaseRejectsOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.FillLeaseTTL = time.Minute
+	})
+
+	leased, granted, err := cc.AcquireFill(ctx, "k")
+	if err != nil || !granted {
+		t.Fatalf("AcquireFill: granted=%v err=%v", granted, err)
+	}
+	if _, granted, _ := cc.AcquireFill(ctx, "k"); granted {
+		t.Fatalf("second AcquireFill was granted")
+	}
+
+	res, err := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "other"}, mustSnapshotVersion(t, ctx, cc, "k"))
+	if err != nil || res.Outcome != WriteOutcomeLeaseHeld {
+		t.Fatalf("write without lease: res=%+v err=%v", res, err)
+	}
+	res, err = cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "holder"}, leased)
+	if err != nil || !res.Stored() {
+		t.Fatalf("holder write: res=%+v err=%v", res, err)
+	}
+
+	// The stored write ended the lease.
+	if _, granted, _ := cc.AcquireFill(ctx, "k"); !granted {
+		t.Fatalf("lease survived the holder's write")
+	}
+}
+
+func TestFillLeaseReleasedOnLoadError(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.FillLeaseTTL = time.Minute
+	})
+
+	boom := errors.New("boom")
+	_, _, err := cc.GetOrLoad(ctx, "k", func(context.Context) (user, error) {
+		return user{}, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("GetOrLoad err=%v want boom", err)
+	}
+	if _, granted, err := cc.AcquireFill(ctx, "k"); err != nil || !granted {
+		t.Fatalf("AcquireFill after failed load: granted=%v err=%v", granted, err)
+	}
+}
+
+// ==============================
+// Two-phase write tests
+// ==============================
+
+func TestBeginWriteRequiresPendingWriter(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.VersionStore = &countingVersionStore{inner: version.NewLocal()}
+	})
+	if _, err := cc.BeginWrite(ctx, "k"); !errors.Is(err, ErrPendingWriteUnsupported) {
+		t.Fatalf("BeginWrite err=%v want ErrPendingWriteUnsupported", err)
+	}
+}
+
+func TestTwoPhaseWriteRejectsFillsUntilCommit(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+
+	if _, err := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "old"}, mustSnapshotVersion(t, ctx, cc, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	w, err := cc.BeginWrite(ctx, "k")
+	if err != nil {
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	if _, ok, err := cc.Get(ctx, "k"); ok || err != nil {
+		t.Fatalf("Get while pending: ok=%v err=%v, want miss", ok, err)
+	}
+
+	v, res, err := cc.GetOrLoad(ctx, "k", func(context.Context) (user, error) {
+		return user{ID: "k", Name: "old"}, nil
+	})
+	if err != nil || v.Name != "old" || res.Write.Outcome != WriteOutcomeWritePending {
+		t.Fatalf("fill while pending: v=%+v res=%+v err=%v", v, res, err)
+	}
+	pendingVer := mustSnapshotVersion(t, ctx, cc, "k")
+
+	if err := cc.CommitWrite(ctx, w); err != nil {
+		t.Fatalf("CommitWrite: %v", err)
+	}
+	// A version observed while pending stays unusable after the commit.
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "old"}, pendingVer); res.Stored() {
+		t.Fatalf("write with a pending version was stored")
+	}
+	_, res, err = cc.GetOrLoad(ctx, "k", func(context.Context) (user, error) {
+		return user{ID: "k", Name: "new"}, nil
+	})
+	if err != nil || !res.Write.Stored() {
+		t.Fatalf("fill after commit: res=%+v err=%v", res, err)
+	}
+}
+
+func TestTwoPhaseWriteAbortAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.PendingWriteTTL = 10 * time.Millisecond
+	})
+
+	w, err := cc.BeginWrite(ctx, "k")
+	if err != nil {
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	if err := cc.AbortWrite(ctx, w); err != nil {
+		t.Fatalf("AbortWrite: %v", err)
+	}
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("write after abort: %+v", res)
+	}
+
+	if _, err := cc.BeginWrite(ctx, "k"); err != nil { // writer crashes
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("write after the mark expired: %+v", res)
+	}
+}
+
+// ==============================
+// Invalidation outbox tests
+// ==============================
+
+// flakyAdvanceStore fails every Advance while fail is set.
+type flakyAdvanceStore struct {
+	version.Store
+	fail atomic.Bool
+}
+
+func (s *flakyAdvanceStore) Advance(ctx context.Context, k version.CacheKey) (version.Snapshot, error) {
+	if s.fail.Load() {
+		return version.Snapshot{}, errors.New("advance down")
+	}
+	return s.Store.Advance(ctx, k)
+}
+
+type outboxDepthHooks struct {
+	NopHooks
+	depth atomic.Int64
+}
+
+func (h *outboxDepthHooks) OutboxDepth(n int) { h.depth.Store(int64(n)) }
+
+func waitOutboxDrained(t *testing.T, ob *InvalidationOutbox) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for ob.Depth() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox still holds %d keys", ob.Depth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutboxRetriesFailedInvalidate(t *testing.T) {
+	ctx := context.Background()
+	vs := &flakyAdvanceStore{Store: version.NewLocal()}
+	hooks := &outboxDepthHooks{}
+	ob := NewInvalidationOutbox(OutboxOptions{
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: 5 * time.Millisecond,
+		MissWhilePending: true,
+	})
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.VersionStore = vs
+		o.Hooks = hooks
+		o.Outbox = ob
+	})
+	defer closeTest(t, ctx, cc)
+
+	for _, k := range []string{"a", "b"} {
+		if _, err := cc.SetIfVersion(ctx, k, user{ID: k}, mustSnapshotVersion(t, ctx, cc, k)); err != nil {
+			t.Fatalf("SetIfVersion: %v", err)
+		}
+	}
+
+	vs.fail.Store(true)
+	err := cc.Invalidate(ctx, "a")
+	var ie *InvalidateError
+	if !errors.As(err, &ie) || !ie.Queued {
+		t.Fatalf("Invalidate err=%v, want a queued *InvalidateError", err)
+	}
+	if !ob.Pending("a") || hooks.depth.Load() != 1 {
+		t.Fatalf("pending=%v depth=%d, want a queued", ob.Pending("a"), hooks.depth.Load())
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("Get served a key waiting in the outbox")
+	}
+	got, missing, err := cc.GetMany(ctx, []string{"a", "b", "a"})
+	if err != nil || len(got) != 1 || !reflect.DeepEqual(missing, []string{"a", "a"}) {
+		t.Fatalf("GetMany got=%v missing=%v err=%v", got, missing, err)
+	}
+
+	vs.fail.Store(false)
+	waitOutboxDrained(t, ob)
+	if hooks.depth.Load() != 0 {
+		t.Fatalf("depth hook=%d after drain", hooks.depth.Load())
+	}
+	if _, ok, _ := cc.Get(ctx, "a"); ok {
+		t.Fatalf("Get served the value the retried invalidation removed")
+	}
+}
+
+func TestOutboxRetriesKeysLeftInStore(t *testing.T) {
+	ctx := context.Background()
+	st := outbox.NewMemory()
+	if err := st.Add(ctx, []string{"k"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	p := newMemProvider()
+	seed := newTestCache(t, "user", p, nil)
+	if _, err := seed.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, seed, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+
+	ob := NewInvalidationOutbox(OutboxOptions{Store: st})
+	cc := newTestCache(t, "user", p, func(o *Options[user]) { o.Outbox = ob })
+	defer closeTest(t, ctx, cc)
+
+	waitOutboxDrained(t, ob)
+	if keys, _ := st.Load(ctx); len(keys) != 0 {
+		t.Fatalf("store still holds %v", keys)
+	}
+	p.mu.Lock()
+	n := len(p.m)
+	p.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("retried invalidation left %d provider entries", n)
+	}
+}
+
+// blockingRemoveStore holds Remove until release is closed.
+type blockingRemoveStore struct {
+	outbox.Store
+	removing chan struct{}
+	release  chan struct{}
+}
+
+func (s *blockingRemoveStore) Remove(ctx context.Context, keys []string) error {
+	close(s.removing)
+	<-s.release
+	return s.Store.Remove(ctx, keys)
+}
+
+func TestOutboxKeepsKeyEnqueuedWhileRetryFinishes(t *testing.T) {
+	ctx := context.Background()
+	st := &blockingRemoveStore{
+		Store:    outbox.NewMemory(),
+		removing: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	ob := NewInvalidationOutbox(OutboxOptions{Store: st})
+	ob.retry = func(context.Context, string) error { return nil }
+	if err := ob.enqueue(ctx, []string{"k"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	ob.entries["k"].next = time.Time{} // due now
+
+	retried := make(chan struct{})
+	go func() {
+		ob.retryDue(ctx)
+		close(retried)
+	}()
+	<-st.removing
+
+	// A new failure for k arrives while its successful retry is being removed.
+	enqueued := make(chan error, 1)
+	go func() { enqueued <- ob.enqueue(ctx, []string{"k"}) }()
+	time.Sleep(20 * time.Millisecond)
+	close(st.release)
+	<-retried
+	if err := <-enqueued; err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	keys, _ := st.Load(ctx)
+	if !slices.Equal(keys, []string{"k"}) || !ob.Pending("k") {
+		t.Fatalf("store=%v pending=%v, want the re-enqueued key kept in both", keys, ob.Pending("k"))
+	}
+}
+
+func TestOutboxServesOneCache(t *testing.T) {
+	ob := NewInvalidationOutbox(OutboxOptions{})
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) { o.Outbox = ob })
+	defer closeTest(t, context.Background(), cc)
+
+	_, err := New[user](Options[user]{
+		Namespace: "user",
+		Provider:  newMemProvider(),
+		Codec:     c.JSON[user]{},
+		Outbox:    ob,
+	})
+	if !errors.Is(err, ErrOutboxInUse) {
+		t.Fatalf("New err=%v want ErrOutboxInUse", err)
+	}
+}
+
+// loadErrStore fails Load while err is set.
+type loadErrStore struct {
+	outbox.Store
+	err error
+}
+
+func (s *loadErrStore) Load(ctx context.Context) ([]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.Load(ctx)
+}
+
+func TestOutboxReusableAfterFailedNew(t *testing.T) {
+	boom := errors.New("load failed")
+	st := &loadErrStore{Store: outbox.NewMemory(), err: boom}
+	ob := NewInvalidationOutbox(OutboxOptions{Store: st})
+	opts := Options[user]{
+		Namespace: "user",
+		Provider:  newMemProvider(),
+		Codec:     c.JSON[user]{},
+		Outbox:    ob,
+	}
+	if _, err := New[user](opts); !errors.Is(err, boom) {
+		t.Fatalf("New err=%v want the Load error", err)
+	}
+
+	st.err = nil
+	cc, err := New[user](opts)
+	if err != nil {
+		t.Fatalf("New after failed New: %v", err)
+	}
+	defer closeTest(t, context.Background(), cc)
+}
+
+// countingWatchStore counts the watches that are still subscribed.
+type countingWatchStore struct {
+	*version.LocalStore
+	active atomic.Int32
+}
+
+func (s *countingWatchStore) Watch(fn func(version.CacheKey, bool)) (func(), error) {
+	stop, err := s.LocalStore.Watch(fn)
+	if err != nil {
+		return nil, err
+	}
+	s.active.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.active.Add(-1)
+			stop()
+		})
+	}, nil
+}
+
+func TestFailedNewStopsFenceWatch(t *testing.T) {
+	vs := &countingWatchStore{LocalStore: version.NewLocal()}
+	_, err := New[user](Options[user]{
+		Namespace:    "user",
+		Provider:     newMemProvider(),
+		Codec:        c.JSON[user]{},
+		VersionStore: vs,
+		L1:           newMemProvider(),
+		Outbox:       NewInvalidationOutbox(OutboxOptions{Store: &loadErrStore{Store: outbox.NewMemory(), err: errors.New("load failed")}}),
+	})
+	if err == nil {
+		t.Fatal("New should fail when the outbox cannot load")
+	}
+	if n := vs.active.Load(); n != 0 {
+		t.Fatalf("failed New left %d watches subscribed", n)
+	}
+}
+
+// ==============================
+// Delayed invalidation tests
+// ==============================
+
+func TestInvalidateWithDelayRemovesLaggingFill(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	if err := cc.InvalidateWithDelay(ctx, "k", 30*time.Millisecond); err != nil {
+		t.Fatalf("InvalidateWithDelay: %v", err)
+	}
+	// A fill that snapshots after the invalidation but reads a lagging replica.
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "stale"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("stale fill not stored: %+v", res)
+	}
+	if _, ok, _ := cc.Get(ctx, "k"); !ok {
+		t.Fatalf("Get missed before the follow-up")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok, _ := cc.Get(ctx, "k"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follow-up invalidation never removed the stale fill")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCloseRunsWaitingFollowUps(t *testing.T) {
+	ctx := context.Background()
+	p := newMemProvider()
+	cc := newTestCache(t, "user", p, func(o *Options[user]) {
+		o.InvalidateDelays = []time.Duration{time.Hour}
+	})
+
+	if err := cc.Invalidate(ctx, "k"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("fill not stored: %+v", res)
+	}
+	closeTest(t, ctx, cc)
+
+	p.mu.Lock()
+	n := len(p.m)
+	p.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("Close left %d provider entries; the follow-up did not run", n)
+	}
+}
+
+func TestCloseKeepsWaitingFollowUpsInOutbox(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	p := newMemProvider()
+
+	openCache := func() (*testCache[user], *outbox.File) {
+		t.Helper()
+		st, err := outbox.NewFile(path)
+		if err != nil {
+			t.Fatalf("NewFile: %v", err)
+		}
+		return newTestCache(t, "user", p, func(o *Options[user]) {
+			o.Outbox = NewInvalidationOutbox(OutboxOptions{Store: st})
+			o.InvalidateDelays = []time.Duration{100 * time.Millisecond}
+		}), st
+	}
+
+	cc, _ := openCache()
+	if err := cc.Invalidate(ctx, "k"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("fill not stored: %+v", res)
+	}
+	closeTest(t, ctx, cc)
+	p.mu.Lock()
+	n := len(p.m)
+	p.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("provider entries=%d after Close; the follow-up ran early", n)
+	}
+
+	cc, st := openCache()
+	defer closeTest(t, ctx, cc)
+	if ds, _ := st.LoadDue(ctx); len(ds) != 1 || ds[0].Key != "k" {
+		t.Fatalf("persisted follow-ups=%+v", ds)
+	}
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("fill not stored: %+v", res)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, ok, _ := cc.Get(ctx, "k")
+		ds, _ := st.LoadDue(ctx)
+		if !ok && len(ds) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resumed follow-up did not run: hit=%v due=%+v", ok, ds)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// ==============================
+// Source revision tests
+// ==============================
+
+func TestRevisionLocksArePerKey(t *testing.T) {
+	l := newRevisionLocks()
+	unlockA, err := l.lock(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("lock a: %v", err)
+	}
+
+	// another key never waits behind a
+	unlockB, err := l.lock(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("lock b: %v", err)
+	}
+	unlockB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.lock(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second lock of a err=%v, want the context's", err)
+	}
+	unlockA()
+
+	if n := len(l.locks); n != 0 {
+		t.Fatalf("idle locks kept: %d", n)
+	}
+}
+
+func TestSetIfVersionAtRevisionRejectsOlderRevision(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+
+	write := func(name string, rev Revision) WriteOutcome {
+		t.Helper()
+		res, err := cc.SetIfVersionAtRevision(ctx, "k", user{ID: "k", Name: name}, mustSnapshotVersion(t, ctx, cc, "k"), rev)
+		if err != nil {
+			t.Fatalf("SetIfVersionAtRevision(%d): %v", rev, err)
+		}
+		return res.Outcome
+	}
+
+	if got := write("r5", 5); got != WriteOutcomeStored {
+		t.Fatalf("rev 5 outcome=%s", got)
+	}
+	if got := write("r3", 3); got != WriteOutcomeStaleRevision {
+		t.Fatalf("rev 3 outcome=%s want %s", got, WriteOutcomeStaleRevision)
+	}
+	if got := write("r5b", 5); got != WriteOutcomeStored {
+		t.Fatalf("equal revision outcome=%s", got)
+	}
+	if got := write("r7", 7); got != WriteOutcomeStored {
+		t.Fatalf("rev 7 outcome=%s", got)
+	}
+	if v, ok, err := cc.Get(ctx, "k"); err != nil || !ok || v.Name != "r7" {
+		t.Fatalf("Get=%+v ok=%v err=%v, want r7", v, ok, err)
+	}
+
+	// A value without a revision is not ordered and never blocks.
+	if res, _ := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "plain"}, mustSnapshotVersion(t, ctx, cc, "k")); !res.Stored() {
+		t.Fatalf("plain write outcome=%s", res.Outcome)
+	}
+	if got := write("r1", 1); got != WriteOutcomeStored {
+		t.Fatalf("rev 1 over a plain entry outcome=%s", got)
+	}
+}
+
+func TestHLCRevisionOrdersByWallTimeThenCounter(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	a, b, c := HLCRevision(now, 1), HLCRevision(now, 2), HLCRevision(now.Add(time.Millisecond), 0)
+	if !(a < b && b < c) {
+		t.Fatalf("HLCRevision order: %d %d %d", a, b, c)
+	}
+}
+
+// ==============================
+// Read-your-writes tests
+// ==============================
+
+func TestGetAtLeastRefusesEntriesOlderThanSessionToken(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+
+	// replica shares the entries but its version store lags the primary's.
+	replica := newTestCache(t, "user", mp, func(o *Options[user]) { o.VersionStore = version.NewLocal() })
+	defer closeTest(t, ctx, replica)
+	primary := newTestCache(t, "user", mp, func(o *Options[user]) { o.VersionStore = version.NewLocal() })
+	defer closeTest(t, ctx, primary)
+
+	if _, err := replica.SetIfVersion(ctx, "k", user{ID: "k", Name: "old"}, mustSnapshotVersion(t, ctx, replica, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	mp.mu.Lock()
+	stale := maps.Clone(mp.m)
+	mp.mu.Unlock()
+
+	ver, err := primary.InvalidateWithVersion(ctx, "k")
+	if err != nil || ver.IsMissing() {
+		t.Fatalf("InvalidateWithVersion: ver=%v err=%v", ver, err)
+	}
+	text, err := ver.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText: %v", err)
+	}
+	var token Version
+	if err := token.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText: %v", err)
+	}
+	if !token.Equal(ver) {
+		t.Fatalf("token round trip: got %v want %v", token, ver)
+	}
+
+	// The primary's invalidation deleted the entry; put the replica's copy
+	// back as a lagging region would still hold it.
+	mp.mu.Lock()
+	mp.m = stale
+	mp.mu.Unlock()
+
+	if _, ok, err := replica.Get(ctx, "k"); err != nil || !ok {
+		t.Fatalf("plain Get should still serve the replica entry: ok=%v err=%v", ok, err)
+	}
+	if _, ok, err := replica.GetAtLeast(ctx, "k", token); err != nil || ok {
+		t.Fatalf("GetAtLeast served an entry older than the token: ok=%v err=%v", ok, err)
+	}
+
+	if err := replica.Invalidate(ctx, "k"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, err := replica.SetIfVersion(ctx, "k", user{ID: "k", Name: "new"}, mustSnapshotVersion(t, ctx, replica, "k")); err != nil {
+		t.Fatalf("SetIfVersion: %v", err)
+	}
+	if v, ok, err := replica.GetAtLeast(ctx, "k", token); err != nil || !ok || v.Name != "new" {
+		t.Fatalf("GetAtLeast after refill: v=%+v ok=%v err=%v", v, ok, err)
+	}
+	if _, ok, err := replica.GetAtLeast(ctx, "k", Version{}); err != nil || !ok {
+		t.Fatalf("GetAtLeast with zero token: ok=%v err=%v", ok, err)
+	}
+}
+
+// requireComparable fails to compile when T is not comparable.
+func requireComparable[T comparable]() {}
+
+func TestVersionStaysComparable(t *testing.T) {
+	requireComparable[Version]()
+
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.NamespaceEpoch = true
+	})
+	defer closeTest(t, ctx, cc)
+
+	a := mustSnapshotVersion(t, ctx, cc, "k")
+	b := mustSnapshotVersion(t, ctx, cc, "k")
+	if a != b || !a.Equal(b) {
+		t.Fatalf("same observed state compared unequal: %+v vs %+v", a, b)
+	}
+	if err := cc.InvalidateAll(ctx); err != nil {
+		t.Fatalf("InvalidateAll: %v", err)
+	}
+	if c := mustSnapshotVersion(t, ctx, cc, "k"); c == a || c.Equal(a) {
+		t.Fatal("a moved epoch must change the version")
+	}
+}
+
+func TestInvalidateWithVersionReturnsReadBackError(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("snapshot down")
+	ki := &recordingKeyAdapter{}
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.KeyInvalidator = ki
+		o.VersionStore = &failingVersionStore{snapshotErr: boom, snapshotManyErr: boom}
+	})
+	defer closeTest(t, ctx, cc)
+
+	ver, err := cc.InvalidateWithVersion(ctx, "k")
+	if !errors.Is(err, boom) || !ver.IsMissing() {
+		t.Fatalf("InvalidateWithVersion: ver=%v err=%v want read-back error", ver, err)
+	}
+	if ki.invalidateCalls != 1 {
+		t.Fatalf("KeyInvalidator calls=%d want 1", ki.invalidateCalls)
+	}
+}
+
+func TestVersionSupersedes(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	v1, err := cc.InvalidateWithVersion(ctx, "k")
+	if err != nil {
+		t.Fatalf("InvalidateWithVersion: %v", err)
+	}
+	v2, err := cc.InvalidateWithVersion(ctx, "k")
+	if err != nil {
+		t.Fatalf("InvalidateWithVersion: %v", err)
+	}
+	if !v2.Supersedes(v1) || v1.Supersedes(v2) || v2.Supersedes(v2) {
+		t.Fatalf("Supersedes: v2>v1=%v v1>v2=%v v2>v2=%v", v2.Supersedes(v1), v1.Supersedes(v2), v2.Supersedes(v2))
+	}
+	if !v1.Supersedes(Version{}) || (Version{}).Supersedes(v1) {
+		t.Fatal("missing version ordering")
+	}
+	if got := mustSnapshotVersion(t, ctx, cc, "k"); !got.Equal(v2) {
+		t.Fatalf("snapshot=%v want %v", got, v2)
+	}
+}
+
+// ==============================
+// Conditional invalidation tests
+// ==============================
+
+func TestInvalidateIfVersionOnlyAdvancesObservedFence(t *testing.T) {
+	for name, vs := range map[string]func() version.Store{
+		"conditional store": func() version.Store { return version.NewLocal() },
+		"generic store":     func() version.Store { return &countingVersionStore{inner: version.NewLocal()} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) { o.VersionStore = vs() })
+			defer closeTest(t, ctx, cc)
+
+			observed := mustSnapshotVersion(t, ctx, cc, "k")
+			if err := cc.Invalidate(ctx, "k"); err != nil {
+				t.Fatalf("Invalidate: %v", err)
+			}
+			current := mustSnapshotVersion(t, ctx, cc, "k")
+			if res, err := cc.SetIfVersion(ctx, "k", user{ID: "k", Name: "fresh"}, current); err != nil || !res.Stored() {
+				t.Fatalf("SetIfVersion: res=%+v err=%v", res, err)
+			}
+
+			if ok, err := cc.InvalidateIfVersion(ctx, "k", observed); err != nil || ok {
+				t.Fatalf("InvalidateIfVersion(superseded)=%v err=%v, want false", ok, err)
+			}
+			if _, ok, err := cc.Get(ctx, "k"); err != nil || !ok {
+				t.Fatalf("newer fill was clobbered: ok=%v err=%v", ok, err)
+			}
+
+			if ok, err := cc.InvalidateIfVersion(ctx, "k", current); err != nil || !ok {
+				t.Fatalf("InvalidateIfVersion(current)=%v err=%v, want true", ok, err)
+			}
+			if _, ok, err := cc.Get(ctx, "k"); err != nil || ok {
+				t.Fatalf("Get after InvalidateIfVersion: ok=%v err=%v", ok, err)
+			}
+			if got := mustSnapshotVersion(t, ctx, cc, "k"); got.Equal(current) {
+				t.Fatal("fence was not advanced")
+			}
+		})
+	}
+}
+
+type recordingConditionalInvalidator struct {
+	recordingKeyAdapter
+	invalidated bool
+	calls       int
+}
+
+var _ ConditionalKeyInvalidator = (*recordingConditionalInvalidator)(nil)
+
+func (s *recordingConditionalInvalidator) InvalidateIfVersion(
+	_ context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+) (bool, error) {
+	s.calls++
+	s.lastVersionKey = versionKey
+	s.lastValueKey = valueKey
+	s.lastExpected = expected
+	return s.invalidated, s.invalidateErr
+}
+
+func TestInvalidateIfVersionUsesConditionalKeyInvalidator(t *testing.T) {
+	ctx := context.Background()
+	ki := &recordingConditionalInvalidator{invalidated: true}
+	vs := &countingVersionStore{inner: version.NewLocal()}
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.KeyInvalidator = ki
+		o.VersionStore = vs
+	})
+	defer closeTest(t, ctx, cc)
+
+	if _, err := vs.Advance(ctx, mustImpl(t, cc).versionKey("k")); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	v := mustSnapshotVersion(t, ctx, cc, "k")
+	calls := vs.snapshotCalls
+	if ok, err := cc.InvalidateIfVersion(ctx, "k", v); err != nil || !ok {
+		t.Fatalf("InvalidateIfVersion=%v err=%v", ok, err)
+	}
+	if ki.calls != 1 || ki.invalidateCalls != 0 || vs.snapshotCalls != calls {
+		t.Fatalf("conditional=%d plain=%d snapshots=%d, want the native path only", ki.calls, ki.invalidateCalls, vs.snapshotCalls-calls)
+	}
+	if !ki.lastExpected.Exists || !ki.lastExpected.Fence.Equal(v.fence) {
+		t.Fatalf("expected=%+v want the observed fence", ki.lastExpected)
+	}
+
+	ki.invalidateErr = errors.New("redis down")
+	_, err := cc.InvalidateIfVersion(ctx, "k", v)
+	var ie *InvalidateError
+	if !errors.As(err, &ie) || ie.Queued {
+		t.Fatalf("err=%v want an unqueued *InvalidateError", err)
+	}
+}
+
+// ==============================
+// Prefix invalidation tests
+// ==============================
+
+func newHierarchyTestCache(t *testing.T, mp pr.Provider, depths ...int) *testCache[user] {
+	t.Helper()
+	return newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.KeyHierarchy = KeyHierarchy{Separator: ":", Depths: depths}
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+}
+
+func TestInvalidatePrefixStalesDescendantSingles(t *testing.T) {
+	ctx := context.Background()
+	cc := newHierarchyTestCache(t, newMemProvider(), 2)
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"tenant:9", "tenant:9:user:42", "tenant:9:user:43", "tenant:8:user:1"}
+	for _, k := range keys {
+		if res, err := cc.SetIfVersion(ctx, k, user{ID: k}, mustSnapshotVersion(t, ctx, cc, k)); err != nil || !res.Stored() {
+			t.Fatalf("SetIfVersion(%s): res=%+v err=%v", k, res, err)
+		}
+	}
+
+	if err := cc.InvalidatePrefix(ctx, "tenant:9"); err != nil {
+		t.Fatalf("InvalidatePrefix: %v", err)
+	}
+	for _, k := range keys {
+		_, ok, err := cc.Get(ctx, k)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", k, err)
+		}
+		if want := !strings.HasPrefix(k, "tenant:9:"); ok != want {
+			t.Fatalf("Get(%s) ok=%v want %v", k, ok, want)
+		}
+	}
+}
+
+func TestInvalidatePrefixStalesBatchesWithDescendants(t *testing.T) {
+	ctx := context.Background()
+	cc := newHierarchyTestCache(t, newMemProvider())
+	defer closeTest(t, ctx, cc)
+
+	keys := []string{"tenant:8:user:1", "tenant:9:user:42"}
+	vers, err := cc.SnapshotVersions(ctx, keys)
+	if err != nil {
+		t.Fatalf("SnapshotVersions: %v", err)
+	}
+	items := make([]VersionedValue[user], len(keys))
+	for i, k := range keys {
+		items[i] = VersionedValue[user]{Key: k, Value: user{ID: k}, Version: vers[k]}
+	}
+	if res, err := cc.SetIfVersions(ctx, items); err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersions: res=%+v err=%v", res, err)
+	}
+	if got, _, _ := cc.GetMany(ctx, keys); len(got) != 2 {
+		t.Fatalf("GetMany before InvalidatePrefix: got=%v", got)
+	}
+
+	// With every depth configured, a first-level prefix covers both tenants.
+	if err := cc.InvalidatePrefix(ctx, "tenant"); err != nil {
+		t.Fatalf("InvalidatePrefix: %v", err)
+	}
+	if got, _, _ := cc.GetMany(ctx, keys); len(got) != 0 {
+		t.Fatalf("batch with stale descendants must not serve, got=%v", got)
+	}
+}
+
+func TestKeyHierarchyRejectsUnusableInput(t *testing.T) {
+	ctx := context.Background()
+
+	plain := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, plain)
+	if err := plain.InvalidatePrefix(ctx, "tenant:9"); !errors.Is(err, ErrKeyHierarchyDisabled) {
+		t.Fatalf("InvalidatePrefix without KeyHierarchy err=%v", err)
+	}
+
+	cc := newHierarchyTestCache(t, newMemProvider(), 2)
+	defer closeTest(t, ctx, cc)
+	for _, p := range []string{"", "tenant", "tenant:9:user"} {
+		if err := cc.InvalidatePrefix(ctx, p); !errors.Is(err, ErrUnknownPrefix) {
+			t.Fatalf("InvalidatePrefix(%q) err=%v want ErrUnknownPrefix", p, err)
+		}
+	}
+
+	// A zero version records no ancestor fence, so it can never validate.
+	if res, err := cc.SetIfVersion(ctx, "tenant:9:user:1", user{}, Version{}); err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("zero-version write: res=%+v err=%v", res, err)
+	}
+
+	_, err := New[user](Options[user]{
+		Namespace:    "user",
+		Provider:     newMemProvider(),
+		Codec:        c.JSON[user]{},
+		KeyHierarchy: KeyHierarchy{Separator: ":", Depths: []int{0, 2}},
+	})
+	if !errors.Is(err, ErrKeyHierarchyDepth) {
+		t.Fatalf("New with depth 0 err=%v", err)
+	}
+}
+
+// ==============================
+// Collection tests
+// ==============================
+
+func mustSetCollection(t *testing.T, ctx context.Context, cc *testCache[user], key string, members []string) {
+	t.Helper()
+	res, err := cc.SetCollectionIfVersion(ctx, key, members, mustSnapshotVersion(t, ctx, cc, key))
+	if err != nil || !res.Stored() {
+		t.Fatalf("SetCollectionIfVersion(%s): res=%+v err=%v", key, res, err)
+	}
+}
+
+func TestCollectionRoundTripKeepsOrder(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	members := []string{"order:3", "order:1", "order:2"}
+	mustSetCollection(t, ctx, cc, "customer:7:orders", members)
+
+	got, ok, err := cc.GetCollection(ctx, "customer:7:orders")
+	if err != nil || !ok {
+		t.Fatalf("GetCollection: ok=%v err=%v", ok, err)
+	}
+	if !slices.Equal(got, members) {
+		t.Fatalf("GetCollection=%v want %v", got, members)
+	}
+}
+
+func TestCollectionDroppedByMemberInvalidate(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newTestCache(t, "user", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	mustSetCollection(t, ctx, cc, "customer:7:orders", []string{"order:1", "order:2"})
+	if err := cc.Invalidate(ctx, "order:2"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	if _, ok, err := cc.GetCollection(ctx, "customer:7:orders"); err != nil || ok {
+		t.Fatalf("GetCollection after member Invalidate: ok=%v err=%v", ok, err)
+	}
+	if n := len(mp.m); n != 0 {
+		t.Fatalf("stale collection not deleted: %d entries left", n)
+	}
+}
+
+func TestCollectionDroppedByCollectionInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	const key = "customer:7:orders"
+	mustSetCollection(t, ctx, cc, key, []string{"order:1"})
+	if res, err := cc.SetIfVersion(ctx, key, user{ID: "7"}, mustSnapshotVersion(t, ctx, cc, key)); err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersion: res=%+v err=%v", res, err)
+	}
+	if _, ok, _ := cc.GetCollection(ctx, key); !ok {
+		t.Fatal("a value under the same key must not replace the collection")
+	}
+
+	if err := cc.Invalidate(ctx, key); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if _, ok, err := cc.GetCollection(ctx, key); err != nil || ok {
+		t.Fatalf("GetCollection after Invalidate: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestSetCollectionRejectsMemberMovedSinceSnapshot(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	const key = "customer:7:orders"
+	members := []string{"order:1", "order:2"}
+	v, err := cc.SnapshotCollectionVersion(ctx, key, members)
+	if err != nil {
+		t.Fatalf("SnapshotCollectionVersion: %v", err)
+	}
+	if err := cc.Invalidate(ctx, "order:2"); err != nil { // while the query runs
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	res, err := cc.SetCollectionIfVersion(ctx, key, members, v)
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("SetCollectionIfVersion: res=%+v err=%v, want a version mismatch", res, err)
+	}
+
+	v, err = cc.SnapshotCollectionVersion(ctx, key, members)
+	if err != nil {
+		t.Fatalf("SnapshotCollectionVersion: %v", err)
+	}
+	if res, err := cc.SetCollectionIfVersion(ctx, key, members, v); err != nil || !res.Stored() {
+		t.Fatalf("SetCollectionIfVersion after resnapshot: res=%+v err=%v", res, err)
+	}
+	if got, ok, err := cc.GetCollection(ctx, key); err != nil || !ok || !slices.Equal(got, members) {
+		t.Fatalf("GetCollection=%v ok=%v err=%v", got, ok, err)
+	}
+}
+
+func TestSetCollectionRejectsStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	const key = "customer:7:orders"
+	v := mustSnapshotVersion(t, ctx, cc, key)
+	if err := cc.Invalidate(ctx, key); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	res, err := cc.SetCollectionIfVersion(ctx, key, []string{"order:1"}, v)
+	if err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+		t.Fatalf("SetCollectionIfVersion: res=%+v err=%v", res, err)
+	}
+	if _, ok, _ := cc.GetCollection(ctx, key); ok {
+		t.Fatal("rejected collection was served")
+	}
+}
+
+func TestGetCollectionPageWalksAndDetectsRewrite(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	const key = "customer:7:orders"
+	mustSetCollection(t, ctx, cc, key, []string{"a", "b", "c", "d", "e"})
+
+	var walked []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("too many pages: %v", walked)
+		}
+		page, ok, err := cc.GetCollectionPage(ctx, key, cursor, 2)
+		if err != nil || !ok {
+			t.Fatalf("GetCollectionPage(%q): ok=%v err=%v", cursor, ok, err)
+		}
+		walked = append(walked, page.Members...)
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !slices.Equal(walked, want) {
+		t.Fatalf("walked=%v want %v", walked, want)
+	}
+
+	page, _, _ := cc.GetCollectionPage(ctx, key, "", 2)
+	if err := cc.Invalidate(ctx, key); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	// The same list reloaded keeps the cursor valid; a different one does not.
+	mustSetCollection(t, ctx, cc, key, []string{"a", "b", "c", "d", "e"})
+	if got, ok, err := cc.GetCollectionPage(ctx, key, page.Next, 2); err != nil || !ok || !slices.Equal(got.Members, []string{"c", "d"}) {
+		t.Fatalf("GetCollectionPage after identical reload: page=%+v ok=%v err=%v", got, ok, err)
+	}
+	if err := cc.Invalidate(ctx, key); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	mustSetCollection(t, ctx, cc, key, []string{"z", "a", "b", "c", "d", "e"})
+	if _, _, err := cc.GetCollectionPage(ctx, key, page.Next, 2); !errors.Is(err, ErrStaleCursor) {
+		t.Fatalf("GetCollectionPage after rewrite: err=%v want ErrStaleCursor", err)
+	}
+}
+
+// ==============================
+// Batch superset tests
+// ==============================
+
+func newSupersetTestCache(t *testing.T, mp pr.Provider, size int) *testCache[user] {
+	t.Helper()
+	return newTestCache(t, "user", mp, func(o *Options[user]) {
+		o.BatchSupersetIndex = size
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+}
+
+func mustWriteBatch(t *testing.T, ctx context.Context, cc *testCache[user], keys ...string) {
+	t.Helper()
+	items := make(map[string]user, len(keys))
+	for _, k := range keys {
+		items[k] = user{ID: k}
+	}
+	if err := setIfVersionsMap(ctx, cc, items, mustSnapshotVersions(t, ctx, cc, keys), 0); err != nil {
+		t.Fatalf("SetIfVersions(%v): %v", keys, err)
+	}
+}
+
+func TestGetManyServesSubsetFromIndexedBatch(t *testing.T) {
+	ctx := context.Background()
+	cc := newSupersetTestCache(t, newMemProvider(), 4)
+	defer closeTest(t, ctx, cc)
+
+	mustWriteBatch(t, ctx, cc, "a", "b", "c", "d")
+
+	// No singles exist, so every hit comes from the four-key entry.
+	got, missing, err := cc.GetMany(ctx, []string{"c", "a", "a"})
+	if err != nil || len(missing) != 0 || len(got) != 2 || got["a"].ID != "a" || got["c"].ID != "c" {
+		t.Fatalf("GetMany(subset): got=%v missing=%v err=%v", got, missing, err)
+	}
+
+	// A non-requested member going stale does not matter; a requested one does.
+	if err := cc.Invalidate(ctx, "d"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	if got, _, _ := cc.GetMany(ctx, []string{"a", "b"}); len(got) != 2 {
+		t.Fatalf("GetMany after unrelated Invalidate: got=%v", got)
+	}
+	if err := cc.Invalidate(ctx, "b"); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+	got, missing, err = cc.GetMany(ctx, []string{"a", "b"})
+	if err != nil || len(got) != 0 || len(missing) != 2 {
+		t.Fatalf("GetMany with stale member: got=%v missing=%v err=%v", got, missing, err)
+	}
+}
+
+func TestGetManyWithoutSupersetIndexNeedsExactBatch(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newSupersetTestCache(t, mp, 0)
+	defer closeTest(t, ctx, cc)
+
+	mustWriteBatch(t, ctx, cc, "a", "b", "c")
+	if got, _, _ := cc.GetMany(ctx, []string{"a", "b"}); len(got) != 0 {
+		t.Fatalf("GetMany(subset) without index: got=%v", got)
+	}
+	if _, ok, _ := mp.Get(ctx, mustImpl(t, cc).space.BatchIndexValueKey().String()); ok {
+		t.Fatal("index written while disabled")
+	}
+}
+
+func TestBatchSupersetIndexKeepsNewestSets(t *testing.T) {
+	ctx := context.Background()
+	cc := newSupersetTestCache(t, newMemProvider(), 1)
+	defer closeTest(t, ctx, cc)
+
+	mustWriteBatch(t, ctx, cc, "a", "b", "c")
+	mustWriteBatch(t, ctx, cc, "x", "y", "z")
+
+	if got, _, _ := cc.GetMany(ctx, []string{"a", "b"}); len(got) != 0 {
+		t.Fatalf("evicted set still served: got=%v", got)
+	}
+	if got, _, _ := cc.GetMany(ctx, []string{"x", "z"}); len(got) != 2 {
+		t.Fatalf("newest set not served: got=%v", got)
+	}
+}
+
+func TestBatchSupersetIndexStaysWithinByteBound(t *testing.T) {
+	ctx := context.Background()
+	mp := newMemProvider()
+	cc := newSupersetTestCache(t, mp, 16)
+	defer closeTest(t, ctx, cc)
+
+	mustWriteBatch(t, ctx, cc, "a", "b", "c")
+	big := make([]string, 3)
+	for i := range big {
+		big[i] = strings.Repeat(string(rune('p'+i)), maxBatchIndexBytes/2)
+	}
+	mustWriteBatch(t, ctx, cc, big...)
+
+	raw, ok, err := mp.Get(ctx, mustImpl(t, cc).space.BatchIndexValueKey().String())
+	if err != nil || !ok {
+		t.Fatalf("index missing: ok=%v err=%v", ok, err)
+	}
+	if len(raw) > maxBatchIndexBytes {
+		t.Fatalf("index is %d bytes, bound %d", len(raw), maxBatchIndexBytes)
+	}
+	if got, _, _ := cc.GetMany(ctx, []string{"a", "b"}); len(got) != 2 {
+		t.Fatalf("an oversized set displaced the index: got=%v", got)
+	}
+}
+
+func TestBatchSupersetIndexPruneIsRateLimited(t *testing.T) {
+	cc := newSupersetTestCache(t, newMemProvider(), 4)
+	defer closeTest(t, context.Background(), cc)
+	impl := mustImpl(t, cc)
+	if !impl.mayPruneBatchIndex() {
+		t.Fatalf("first prune refused")
+	}
+	if impl.mayPruneBatchIndex() {
+		t.Fatalf("second prune within the interval allowed")
+	}
+}
+
+// ==============================
+// Ordered and streaming GetMany tests
+// ==============================
+
+func TestGetManyOrderedAlignsWithKeys(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), nil)
+	defer closeTest(t, ctx, cc)
+
+	for _, k := range []string{"a", "c"} {
+		if res, err := cc.SetIfVersion(ctx, k, user{ID: k}, mustSnapshotVersion(t, ctx, cc, k)); err != nil || !res.Stored() {
+			t.Fatalf("SetIfVersion(%s): res=%+v err=%v", k, res, err)
+		}
+	}
+
+	keys := []string{"c", "b", "a", "c"}
+	values, found, err := cc.GetManyOrdered(ctx, keys)
+	if err != nil {
+		t.Fatalf("GetManyOrdered: %v", err)
+	}
+	if want := []bool{true, false, true, true}; !slices.Equal(found, want) {
+		t.Fatalf("found=%v want %v", found, want)
+	}
+	for i, k := range keys {
+		if found[i] && values[i].ID != k {
+			t.Fatalf("values[%d]=%+v want ID %q", i, values[i], k)
+		}
+		if !found[i] && values[i] != (user{}) {
+			t.Fatalf("values[%d]=%+v want zero value for a miss", i, values[i])
+		}
+	}
+}
+
+func TestGetManyIterYieldsBatchThenFallbackHits(t *testing.T) {
+	ctx := context.Background()
+	cc := newTestCache(t, "user", newMemProvider(), func(o *Options[user]) {
+		o.BatchWriteSeed = BatchWriteSeedOff
+	})
+	defer closeTest(t, ctx, cc)
+
+	mustWriteBatch(t, ctx, cc, "a", "b")
+	seq, errf := cc.GetManyIter(ctx, []string{"b", "a", "b"})
+	var got []string
+	for k, v := range seq {
+		if v.ID != k {
+			t.Fatalf("yielded %q with %+v", k, v)
+		}
+		got = append(got, k)
+	}
+	if err := errf(); err != nil || !slices.Equal(got, []string{"b", "a"}) {
+		t.Fatalf("batch hits: got=%v err=%v", got, err)
+	}
+
+	// A different key set misses the batch entry and reads each key alone.
+	if res, err := cc.SetIfVersion(ctx, "c", user{ID: "c"}, mustSnapshotVersion(t, ctx, cc, "c")); err != nil || !res.Stored() {
+		t.Fatalf("SetIfVersion: res=%+v err=%v", res, err)
+	}
+	seq, errf = cc.GetManyIter(ctx, []string{"c", "x", "a"})
+	got = got[:0]
+	for k := range seq {
+		got = append(got, k)
+	}
+	if err := errf(); err != nil || !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("fallback hits: got=%v err=%v", got, err)
+	}
+
+	got = got[:0]
+	for k := range seq {
+		got = append(got, k)
+		break
+	}
+	if len(got) != 1 {
+		t.Fatalf("early stop: got=%v", got)
+	}
+}
+
+func TestGetManyIterReportsSingleErrors(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	mp := &singleGetErrProvider{memProvider: newMemProvider(), err: errBoom}
+	cc := newTestCache(t, "user", mp, nil)
+	defer closeTest(t, ctx, cc)
+
+	seq, errf := cc.GetManyIter(ctx, []string{"a", "b"})
+	for k := range seq {
+		t.Fatalf("unexpected hit %q", k)
+	}
+	if err := errf(); !errors.Is(err, errBoom) {
+		t.Fatalf("err=%v want %v", err, errBoom)
+	}
+	if mp.singleGetCalls != 2 {
+		t.Fatalf("single reads=%d want 2: a failed read must not stop the others", mp.singleGetCalls)
+	}
+}
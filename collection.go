@@ -0,0 +1,235 @@
+package cascache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// Collections cache an ordered list of member keys, such as the result of a
+// query, under a logical key of their own. The list lives in a separate
+// provider slot and shares the collection key's version state, so Invalidate
+// of the collection key drops it without touching a value cached under the
+// same key. The entry also records the fence of every member, so it stops
+// validating as soon as any member is invalidated.
+
+// CollectionPage is one page of a cached collection. Next is the cursor of
+// the following page and is empty after the last one.
+type CollectionPage struct {
+	Members []string
+	Next    string
+}
+
+// SnapshotCollectionVersion is SnapshotVersion for a collection: the returned
+// version also records the current fence of every key in members, creating
+// members that do not exist yet. Take it before running the query, passing
+// the members the query may return, such as the currently cached list or the
+// candidate keys it filters.
+func (c *cache[V]) SnapshotCollectionVersion(ctx context.Context, key string, members []string) (Version, error) {
+	deps := c.keyDeps(key)
+	for _, m := range members {
+		deps = append(deps, c.versionKey(m))
+		deps = append(deps, c.ancestorKeys(m)...)
+	}
+	sortCacheKeys(deps)
+	return c.snapshotVersion(ctx, key, slices.Compact(deps))
+}
+
+// SetCollectionIfVersion caches members, in order, as the collection stored
+// under key when v still matches key's version, using the cache's default
+// TTL. Snapshot v with SnapshotCollectionVersion, or SnapshotVersion, before
+// running the query.
+//
+// A member whose fence v recorded must still be at that fence, or the write
+// reports WriteOutcomeVersionMismatch, so a member invalidated while the
+// query ran is never cached as current. Any other member is recorded at its
+// fence when the collection is written; a change to it while the query ran is
+// only caught if the same write also invalidates the collection key, so
+// invalidate it whenever membership changes, for example when a new order is
+// added for the customer. A collection holds at most 65535 distinct
+// dependencies, members included.
+func (c *cache[V]) SetCollectionIfVersion(
+	ctx context.Context,
+	key string,
+	members []string,
+	v Version,
+) (WriteResult, error) {
+	return c.SetCollectionIfVersionWithTTL(ctx, key, members, v, c.defaultTTL)
+}
+
+// SetCollectionIfVersionWithTTL is SetCollectionIfVersion with an explicit
+// TTL.
+func (c *cache[V]) SetCollectionIfVersionWithTTL(
+	ctx context.Context,
+	key string,
+	members []string,
+	v Version,
+	ttl time.Duration,
+) (WriteResult, error) {
+	if !c.enabled {
+		return WriteResult{Outcome: WriteOutcomeDisabled}, nil
+	}
+	if ttl == 0 {
+		ttl = c.defaultTTL
+	}
+
+	payload, err := wire.EncodeKeys(members)
+	if err != nil {
+		return WriteResult{}, opError(OpSet, key, err)
+	}
+	deps, err := c.memberDeps(ctx, members)
+	if err != nil {
+		return WriteResult{Outcome: WriteOutcomeSnapshotError}, opError(OpSnapshot, key, err)
+	}
+	return c.writeEntryAt(ctx, key, c.collectionKeys(key), v, wire.SingleEntry{Payload: payload, Deps: deps}, ttl, false)
+}
+
+// GetCollection returns the members of the collection cached under key, in
+// the order they were written, if the collection and every member are still
+// current. A collection that fails validation is deleted and reported as a
+// miss; ReadGuard does not apply.
+func (c *cache[V]) GetCollection(ctx context.Context, key string) ([]string, bool, error) {
+	members, _, ok, err := c.readCollection(ctx, key)
+	return members, ok, err
+}
+
+// GetCollectionPage returns up to limit members of the collection cached
+// under key, starting at cursor; an empty cursor starts at the first member.
+// The cursor identifies the exact member list it was issued for, so paging
+// survives a reload that produces the same list but returns ErrStaleCursor
+// once the list changed. A miss reports ok=false without checking cursor.
+func (c *cache[V]) GetCollectionPage(
+	ctx context.Context,
+	key string,
+	cursor string,
+	limit int,
+) (CollectionPage, bool, error) {
+	members, payload, ok, err := c.readCollection(ctx, key)
+	if !ok || err != nil {
+		return CollectionPage{}, ok, err
+	}
+
+	sum := collectionDigest(payload)
+	start := 0
+	if cursor != "" {
+		if start, ok = parseCursor(cursor, sum); !ok || start > len(members) {
+			return CollectionPage{}, false, opError(OpGet, key, ErrStaleCursor)
+		}
+	}
+	end := len(members)
+	if limit > 0 {
+		end = min(start+limit, end)
+	}
+
+	page := CollectionPage{Members: members[start:end]}
+	if end < len(members) {
+		page.Next = formatCursor(sum, end)
+	}
+	return page, true, nil
+}
+
+// readCollection reads and validates the collection cached under key and
+// returns its members together with the encoded list.
+func (c *cache[V]) readCollection(ctx context.Context, key string) ([]string, []byte, bool, error) {
+	if !c.enabled || c.outbox.missing(key) {
+		return nil, nil, false, nil
+	}
+
+	sk := c.collectionKeys(key)
+	storageKey := sk.Value.String()
+	raw, ok, err := c.provider.Get(ctx, storageKey)
+	if err != nil {
+		return nil, nil, false, opError(OpGet, key, err)
+	}
+	if !ok {
+		return nil, nil, false, nil
+	}
+	e, ok := c.decodeSingleRaw(ctx, storageKey, raw)
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	ckey := toVersionCacheKey(sk.Cache)
+	snaps, err := c.loadBatch(ctx, append([]version.CacheKey{ckey}, c.depsToLoad(e.Deps)...))
+	if err != nil {
+		return nil, nil, false, nil
+	}
+	snap := snaps[ckey]
+	if !snap.Exists {
+		c.selfHealSingle(ctx, storageKey, SelfHealReasonVersionMissing)
+		return nil, nil, false, nil
+	}
+	if !e.Fence.Equal(snap.Fence) || !c.depsCurrent(key, e.Deps, snaps) {
+		c.selfHealSingle(ctx, storageKey, SelfHealReasonVersionMismatch)
+		return nil, nil, false, nil
+	}
+
+	members, err := wire.DecodeKeys(e.Payload)
+	if e.Absent || err != nil {
+		c.selfHealSingle(ctx, storageKey, SelfHealReasonCorrupt)
+		return nil, nil, false, nil
+	}
+	return members, e.Payload, true, nil
+}
+
+// memberDeps returns the current fences of every member and of the
+// dependencies each member requires, sorted by key, creating those that do
+// not exist yet.
+func (c *cache[V]) memberDeps(ctx context.Context, members []string) ([]wire.Dep, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	var ks []version.CacheKey
+	for _, m := range members {
+		ks = append(ks, c.versionKey(m))
+		ks = append(ks, c.ancestorKeys(m)...)
+	}
+	ks = append(ks, c.requiredDeps()...)
+	sortCacheKeys(ks)
+	ks = slices.Compact(ks)
+
+	snaps, err := c.loadBatch(ctx, ks)
+	if err != nil {
+		return nil, err
+	}
+	return c.snapshotDeps(ctx, ks, snaps)
+}
+
+// collectionKeys returns the version identity of key and the provider slot of
+// its collection.
+func (c *cache[V]) collectionKeys(key string) keyutil.Single {
+	ck := c.space.SingleCacheKey(key)
+	return keyutil.Single{Cache: ck, Value: keyutil.CollectionValueKey(ck)}
+}
+
+// A cursor is the first 8 bytes of the SHA-256 of the encoded member list
+// followed by the offset of the next member as a uvarint, base64url encoded.
+
+func collectionDigest(payload []byte) [8]byte {
+	s := sha256.Sum256(payload)
+	return [8]byte(s[:8])
+}
+
+func formatCursor(sum [8]byte, offset int) string {
+	b := binary.AppendUvarint(sum[:], uint64(offset))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(cursor string, sum [8]byte) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) <= len(sum) || [8]byte(b[:8]) != sum {
+		return 0, false
+	}
+	off, n := binary.Uvarint(b[8:])
+	if n != len(b)-8 || off > uint64(^uint32(0)) {
+		return 0, false
+	}
+	return int(off), true
+}
@@ -0,0 +1,163 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/outbox"
+)
+
+// InvalidateWithDelay is Invalidate followed by one more invalidation of key
+// after each of delays, for fills that read a lagging replica: a fill that
+// snapshots its version after the immediate Invalidate but reads the source
+// before the write reaches it stores a stale value that nothing else would
+// remove. Each follow-up advances the fence and deletes the entry again, so
+// such a value lives at most until the next one. Pick delays that cover the
+// replication lag plus the longest load.
+//
+// The returned error is the immediate Invalidate's; follow-ups are scheduled
+// either way. A failed follow-up is reported through Hooks.InvalidateOutage
+// and queued in Options.Outbox when set. Follow-ups still waiting at Close
+// are kept with their due time when the outbox Store implements
+// outbox.DueStore, and run on time by the next cache bound to it; without
+// one they run at Close, early, rather than being dropped.
+// Options.InvalidateDelays does not apply to this call; non-positive delays
+// are ignored.
+func (c *cache[V]) InvalidateWithDelay(ctx context.Context, key string, delays ...time.Duration) error {
+	_, err := c.invalidateAndFollowUp(ctx, key, delays)
+	return err
+}
+
+// reinvalidateLater schedules one follow-up invalidation of key per delay.
+func (c *cache[V]) reinvalidateLater(key string, delays []time.Duration) {
+	if !c.enabled {
+		return
+	}
+	now := time.Now()
+	for _, d := range delays {
+		if d > 0 {
+			c.followUps.at(outbox.Due{Key: key, At: now.Add(d)}, func(ctx context.Context) {
+				c.reinvalidate(ctx, key)
+			})
+		}
+	}
+}
+
+// resumeFollowUps schedules the follow-ups an earlier cache left in the
+// outbox when it closed. Each is removed from the Store once it ran.
+func (c *cache[V]) resumeFollowUps(ctx context.Context) error {
+	ds, err := c.outbox.loadDue(ctx)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		c.followUps.at(d, func(ctx context.Context) {
+			c.reinvalidate(ctx, d.Key)
+			// A failed removal only repeats the follow-up after a restart.
+			_ = c.outbox.removeDue(ctx, []outbox.Due{d})
+		})
+	}
+	return nil
+}
+
+// closeFollowUps stops the follow-up queue and hands the follow-ups still
+// waiting to the outbox. Those it cannot keep run now.
+func (c *cache[V]) closeFollowUps(ctx context.Context) error {
+	ws := c.followUps.stop()
+	if len(ws) == 0 {
+		return nil
+	}
+	var err error
+	if c.outbox != nil {
+		ds := make([]outbox.Due, len(ws))
+		for i, w := range ws {
+			ds[i] = w.due
+		}
+		if err = c.outbox.addDue(ctx, ds); err == nil {
+			return nil
+		}
+		if errors.Is(err, errors.ErrUnsupported) {
+			err = nil
+		}
+	}
+	for _, w := range ws {
+		w.fn(ctx)
+	}
+	return err
+}
+
+// reinvalidate is one follow-up. It keeps no stale copy: the entry it removes
+// may be the stale fill it exists to catch.
+func (c *cache[V]) reinvalidate(ctx context.Context, key string) {
+	var ie *InvalidateError
+	if _, err := c.invalidateKeys(ctx, key, c.singleKeys(key)); errors.As(err, &ie) {
+		c.queueInvalidations(ctx, ie)
+	}
+}
+
+// delayQueue runs follow-ups at their due time. stop refuses new work and
+// returns the ones still waiting, so Close does not lose them.
+type delayQueue struct {
+	mu      sync.Mutex
+	closed  bool
+	next    uint64
+	waiting map[uint64]delayedCall
+	running sync.WaitGroup
+}
+
+type delayedCall struct {
+	t   *time.Timer
+	due outbox.Due
+	fn  func(context.Context)
+}
+
+func (q *delayQueue) at(due outbox.Due, fn func(context.Context)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if q.waiting == nil {
+		q.waiting = make(map[uint64]delayedCall)
+	}
+	id := q.next
+	q.next++
+	t := time.AfterFunc(time.Until(due.At), func() {
+		q.mu.Lock()
+		w, ok := q.waiting[id]
+		if ok {
+			delete(q.waiting, id)
+			q.running.Add(1)
+		}
+		q.mu.Unlock()
+		if !ok {
+			return // taken by stop
+		}
+		defer q.running.Done()
+		w.fn(context.Background())
+	})
+	q.waiting[id] = delayedCall{t: t, due: due, fn: fn}
+}
+
+// stop closes the queue, waits for the calls already running, and returns
+// the ones still waiting without running them.
+func (q *delayQueue) stop() []delayedCall {
+	q.mu.Lock()
+	q.closed = true
+	ws := q.waiting
+	q.waiting = nil
+	q.mu.Unlock()
+
+	out := make([]delayedCall, 0, len(ws))
+	for _, w := range ws {
+		w.t.Stop()
+		out = append(out, w)
+	}
+	q.running.Wait()
+	return out
+}
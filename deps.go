@@ -0,0 +1,333 @@
+package cascache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// Dependencies are additional authoritative keys an entry is validated
+// against on top of its own per-key fence: the namespace epoch, which every
+// entry requires when enabled, the ancestor prefixes of its key in
+// hierarchical key mode, and any tags the caller snapshotted with the key.
+// Each dependency is recorded in the entry frame with the fence observed at
+// snapshot time, and the entry stops validating as soon as any recorded fence
+// differs from the current one.
+
+// InvalidateAll advances the namespace epoch so every single and batch entry
+// written before the call fails validation on its next read and self-heals.
+// Nothing is scanned or deleted up front; stale entries are removed as they
+// are read or expire.
+//
+// It requires Options.NamespaceEpoch and returns ErrNamespaceEpochDisabled
+// otherwise.
+func (c *cache[V]) InvalidateAll(ctx context.Context) error {
+	if !c.enabled {
+		return nil
+	}
+	if !c.epochEnabled {
+		return ErrNamespaceEpochDisabled
+	}
+	if _, err := c.advanceVersion(ctx, c.epochKey); err != nil {
+		return opError(OpInvalidateAll, "", err)
+	}
+	return nil
+}
+
+// InvalidateTag advances the fence of tag so every single and batch entry
+// whose version was snapshotted with that tag fails validation on its next
+// read. Tags are scoped to the cache namespace.
+func (c *cache[V]) InvalidateTag(ctx context.Context, tag string) error {
+	if !c.enabled {
+		return nil
+	}
+	if tag == "" {
+		return opError(OpInvalidateTag, tag, ErrEmptyTag)
+	}
+	if _, err := c.advanceVersion(ctx, c.tagKey(tag)); err != nil {
+		return opError(OpInvalidateTag, tag, err)
+	}
+	return nil
+}
+
+// InvalidatePrefix advances the fence of prefix so every single and batch
+// entry whose key descends from it fails validation on its next read. It
+// requires Options.KeyHierarchy, and prefix must sit at one of the configured
+// depths: InvalidatePrefix(ctx, "tenant:9") stales "tenant:9:user:42" but not
+// "tenant:9" itself, which Invalidate covers.
+func (c *cache[V]) InvalidatePrefix(ctx context.Context, prefix string) error {
+	if !c.enabled {
+		return nil
+	}
+	if c.prefixSep == "" {
+		return opError(OpInvalidatePrefix, prefix, ErrKeyHierarchyDisabled)
+	}
+	if prefix == "" || !c.prefixDepthConfigured(keyutil.PrefixDepth(prefix, c.prefixSep)) {
+		return opError(OpInvalidatePrefix, prefix, ErrUnknownPrefix)
+	}
+	if _, err := c.advanceVersion(ctx, c.prefixKey(prefix)); err != nil {
+		return opError(OpInvalidatePrefix, prefix, err)
+	}
+	return nil
+}
+
+// prefixKey maps one key prefix to its canonical version-store key.
+func (c *cache[V]) prefixKey(prefix string) version.CacheKey {
+	return toVersionCacheKey(c.space.PrefixCacheKey(prefix))
+}
+
+func (c *cache[V]) prefixDepthConfigured(depth int) bool {
+	return len(c.prefixDepths) == 0 || slices.Contains(c.prefixDepths, depth)
+}
+
+// ancestorKeys returns the prefix keys of key's configured ancestors.
+func (c *cache[V]) ancestorKeys(key string) []version.CacheKey {
+	anc := keyutil.Ancestors(key, c.prefixSep, c.prefixDepths)
+	if len(anc) == 0 {
+		return nil
+	}
+	out := make([]version.CacheKey, len(anc))
+	for i, p := range anc {
+		out[i] = c.prefixKey(p)
+	}
+	return out
+}
+
+// tagKey maps one tag to its canonical version-store key.
+func (c *cache[V]) tagKey(tag string) version.CacheKey {
+	return toVersionCacheKey(c.space.TagCacheKey(tag))
+}
+
+// tagDeps returns the dependency keys a version of key snapshotted with tags
+// must record: every key dependency plus one key per tag, deduplicated and
+// sorted.
+func (c *cache[V]) tagDeps(key string, tags []string) ([]version.CacheKey, error) {
+	out := c.keyDeps(key)
+	for _, t := range tags {
+		if t == "" {
+			return nil, ErrEmptyTag
+		}
+		out = append(out, c.tagKey(t))
+	}
+	sortCacheKeys(out)
+	return slices.Compact(out), nil
+}
+
+// requiredDeps returns the dependency keys every entry in the namespace must
+// record a current fence for, sorted by key.
+func (c *cache[V]) requiredDeps() []version.CacheKey {
+	if !c.epochEnabled {
+		return nil
+	}
+	return []version.CacheKey{c.epochKey}
+}
+
+// keyDeps returns the dependency keys an entry for key must record: every
+// required dependency plus its ancestor prefixes in hierarchical key mode,
+// sorted.
+func (c *cache[V]) keyDeps(key string) []version.CacheKey {
+	out := append(slices.Clone(c.requiredDeps()), c.ancestorKeys(key)...)
+	sortCacheKeys(out)
+	return out
+}
+
+// snapshotDeps returns the observed fences for keys from snaps, creating any
+// dependency that does not exist yet. A version never records a dependency as
+// missing: if that dependency later expired and came back missing, entries
+// written before an intervening advance would validate again (ABA).
+func (c *cache[V]) snapshotDeps(
+	ctx context.Context,
+	keys []version.CacheKey,
+	snaps map[version.CacheKey]version.Snapshot,
+) ([]wire.Dep, error) {
+	deps := make([]wire.Dep, 0, len(keys))
+	for _, k := range keys {
+		s := snaps[k]
+		if !s.Exists {
+			var err error
+			s, _, err = c.createSnapshot(ctx, k)
+			if err != nil {
+				return nil, err
+			}
+			if !s.Exists {
+				return nil, fmt.Errorf("dependency %s vanished while being created", k)
+			}
+		}
+		deps = append(deps, wire.Dep{Key: k.String(), Fence: s.Fence})
+	}
+	return deps, nil
+}
+
+// depsToLoad returns the keys whose current state is needed to validate
+// entries that recorded the given dependencies: every required dependency and
+// every recorded one, deduplicated and sorted.
+func (c *cache[V]) depsToLoad(recorded ...[]wire.Dep) []version.CacheKey {
+	req := c.requiredDeps()
+	n := len(req)
+	for _, deps := range recorded {
+		n += len(deps)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	out := make([]version.CacheKey, 0, n)
+	out = append(out, req...)
+	for _, deps := range recorded {
+		for _, d := range deps {
+			out = append(out, version.NewCacheKey(d.Key))
+		}
+	}
+	sortCacheKeys(out)
+	return slices.Compact(out)
+}
+
+// depsCurrent reports whether the recorded dependencies of an entry for key
+// still hold: every required dependency and ancestor prefix must be recorded,
+// and every recorded fence must match current state in snaps. A missing
+// dependency never matches.
+func (c *cache[V]) depsCurrent(key string, recorded []wire.Dep, snaps map[version.CacheKey]version.Snapshot) bool {
+	for _, k := range c.requiredDeps() {
+		if !hasDep(recorded, k) {
+			return false
+		}
+	}
+	for _, p := range keyutil.Ancestors(key, c.prefixSep, c.prefixDepths) {
+		if !hasDep(recorded, c.prefixKey(p)) {
+			return false
+		}
+	}
+	for _, d := range recorded {
+		s, ok := snaps[version.NewCacheKey(d.Key)]
+		if !ok || !s.Exists || !s.Fence.Equal(d.Fence) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDeps runs before a write: it verifies that the dependencies recorded
+// for each of keys (index-aligned) are still current and include every one
+// the key requires, then keeps them alive. ok=false means an entry could
+// never validate, so callers report a version mismatch instead of writing it.
+func (c *cache[V]) checkDeps(ctx context.Context, keys []string, recorded [][]wire.Dep) (bool, error) {
+	dk := c.depsToLoad(recorded...)
+	var snaps map[version.CacheKey]version.Snapshot
+	if len(dk) != 0 {
+		var err error
+		if snaps, err = c.loadBatch(ctx, dk); err != nil {
+			return false, err
+		}
+	}
+	for i, deps := range recorded {
+		if !c.depsCurrent(keys[i], deps, snaps) {
+			return false, nil
+		}
+	}
+
+	// Refresh so expiring stores keep the state the entry depends on alive.
+	for _, k := range dk {
+		ok, err := c.refreshVersion(ctx, k)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// currentDeps is checkDeps reporting each entry on its own, for writes that
+// keep the entries that can still validate: ok[i] reports whether the
+// dependencies recorded for keys[i] are current. Only the dependencies of
+// current entries are kept alive, and one that cannot be fails every entry
+// that recorded it.
+func (c *cache[V]) currentDeps(ctx context.Context, keys []string, recorded [][]wire.Dep) ([]bool, error) {
+	var snaps map[version.CacheKey]version.Snapshot
+	if dk := c.depsToLoad(recorded...); len(dk) != 0 {
+		var err error
+		if snaps, err = c.loadBatch(ctx, dk); err != nil {
+			return nil, err
+		}
+	}
+	ok := make([]bool, len(recorded))
+	var live [][]wire.Dep
+	for i, deps := range recorded {
+		if ok[i] = c.depsCurrent(keys[i], deps, snaps); ok[i] {
+			live = append(live, deps)
+		}
+	}
+	if len(live) == 0 {
+		return ok, nil
+	}
+
+	for _, k := range c.depsToLoad(live...) {
+		refreshed, err := c.refreshVersion(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if refreshed {
+			continue
+		}
+		for i, deps := range recorded {
+			if hasDep(deps, k) {
+				ok[i] = false
+			}
+		}
+	}
+	return ok, nil
+}
+
+// encodeEntry returns a KeyFrameWriter encoder that stamps e with the fence
+// chosen by the backend.
+func encodeEntry(e wire.SingleEntry) func(version.Fence) ([]byte, error) {
+	return func(fence version.Fence) ([]byte, error) {
+		e.Fence = fence
+		return wire.EncodeSingleEntry(e)
+	}
+}
+
+// mergeDeps merges two dependency lists sorted by key, keeping a's fence for
+// keys in both.
+func mergeDeps(a, b []wire.Dep) []wire.Dep {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+	out := make([]wire.Dep, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch strings.Compare(a[i].Key, b[j].Key) {
+		case -1:
+			out = append(out, a[i])
+			i++
+		case 1:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+func sortCacheKeys(keys []version.CacheKey) {
+	slices.SortFunc(keys, func(a, b version.CacheKey) int { return strings.Compare(a.String(), b.String()) })
+}
+
+func hasDep(deps []wire.Dep, key version.CacheKey) bool {
+	for _, d := range deps {
+		if d.Key == key.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -16,12 +16,17 @@
 //     subpackage for the built-in Redis implementation.
 //   - KeyReader: optional backend-native fast path for reading a single value
 //     and its authoritative version state together.
+//   - KeyFrameWriter: optional KeyWriter extension for entries that record
+//     dependency fences, such as the namespace epoch.
 //
 // Keys:
 //
 //	cas:v3:val:{<slot>}:s:<nsLen>:<ns>:<key>        - single entries
 //	cas:v3:val:b:<nsLen>:<ns>:<sha256-128>          - set-shaped entries (128-bit SHA-256 over sorted keys)
+//	cas:v3:stale:{<slot>}:s:<nsLen>:<ns>:<key>      - last valid single entry after Invalidate (MaxStale only)
 //	cas:v3:ver:{<slot>}:s:<nsLen>:<ns>:<key>        - authoritative version state
+//	cas:v3:ver:{<slot>}:e:<nsLen>:<ns>:             - namespace epoch (NamespaceEpoch only)
+//	cas:v3:ver:{<slot>}:t:<nsLen>:<ns>:<tag>        - invalidation tag state
 //
 // CAS pattern:
 //
@@ -0,0 +1,27 @@
+package cascache
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+)
+
+// refreshEarly reports whether a hit on an entry written with timing t should
+// start an early refresh now. Entries without timing never do.
+func (c *cache[V]) refreshEarly(t wire.Timing) bool {
+	if c.earlyBeta <= 0 || t.IsZero() {
+		return false
+	}
+	return xfetch(time.Now(), t, c.earlyBeta, 1-rand.Float64())
+}
+
+// xfetch applies the XFetch rule for one read: refresh once
+// now - delta*beta*ln(u) reaches the expiry, where u is uniform in (0, 1].
+// The gap grows with the load duration, so expensive values start refreshing
+// earlier, and the random draw spreads refreshes across callers.
+func xfetch(now time.Time, t wire.Timing, beta, u float64) bool {
+	gap := time.Duration(-float64(t.Delta) * beta * math.Log(u))
+	return !now.Add(gap).Before(t.ExpiresAt())
+}
@@ -10,10 +10,85 @@ import (
 // Adder.
 var ErrBatchReadSeedNeedsAdder = errors.New("BatchReadSeedIfMissing requires Adder")
 
+// ErrLoadAborted is returned to callers that were waiting on a coalesced load
+// whose leader exited without producing a result (for example, because its
+// loader panicked).
+var ErrLoadAborted = errors.New("cascache: coalesced load aborted")
+
+// ErrNamespaceEpochDisabled is returned by InvalidateAll when the cache was
+// constructed without Options.NamespaceEpoch.
+var ErrNamespaceEpochDisabled = errors.New("cascache: InvalidateAll requires NamespaceEpoch")
+
+// ErrKeyHierarchyDisabled is returned by InvalidatePrefix when the cache was
+// constructed without Options.KeyHierarchy.
+var ErrKeyHierarchyDisabled = errors.New("cascache: InvalidatePrefix requires KeyHierarchy")
+
+// ErrKeyHierarchyDepth identifies an invalid configuration where
+// KeyHierarchy.Depths lists a depth below 1.
+var ErrKeyHierarchyDepth = errors.New("cascache: KeyHierarchy depths must be at least 1")
+
+// ErrUnknownPrefix is returned by InvalidatePrefix for an empty prefix or one
+// whose depth is not listed in KeyHierarchy.Depths: no entry depends on it.
+var ErrUnknownPrefix = errors.New("cascache: prefix is not at a configured KeyHierarchy depth")
+
+// ErrStaleCursor is returned by GetCollectionPage for a cursor that was not
+// issued for the collection currently cached: the member list changed since.
+// Restart from an empty cursor.
+var ErrStaleCursor = errors.New("cascache: collection cursor is stale")
+
+// ErrEmptyTag is returned when a tag passed to SnapshotVersionWithTags or
+// InvalidateTag is empty.
+var ErrEmptyTag = errors.New("cascache: empty tag")
+
+// ErrNotFound reports that a key is known to be absent from the source of
+// truth. Get returns it instead of a plain miss when it serves a validated
+// tombstone written by SetAbsentIfVersion. A LoadFunc returns it to make
+// GetOrLoad cache the absence.
+var ErrNotFound = errors.New("cascache: key is known to be absent")
+
+// ErrUpdateConflict is returned by Update when every attempt lost its
+// compare-and-write to a concurrent invalidation.
+var ErrUpdateConflict = errors.New("cascache: update conflicted on every attempt")
+
+// ErrNearCacheNeedsWatcher identifies an invalid configuration where
+// Options.NearCacheSize is set but the version store cannot watch fences.
+var ErrNearCacheNeedsWatcher = errors.New("cascache: NearCacheSize requires a version.Watcher store")
+
+// ErrFillLeaseNeedsLeaser identifies an invalid configuration where
+// Options.FillLeaseTTL is set but the version store cannot grant leases.
+var ErrFillLeaseNeedsLeaser = errors.New("cascache: FillLeaseTTL requires a version.Leaser store")
+
+// ErrFillLeaseHeld is returned by KeyWriter implementations that reject a
+// write because another caller holds the key's fill lease. The cache reports
+// it as WriteOutcomeLeaseHeld.
+var ErrFillLeaseHeld = errors.New("cascache: fill lease held by another caller")
+
+// ErrWritePending is returned by KeyWriter implementations that reject a
+// write because a two-phase write started by BeginWrite is in progress on the
+// key. The cache reports it as WriteOutcomeWritePending.
+var ErrWritePending = errors.New("cascache: two-phase write pending")
+
+// ErrPendingWriteUnsupported is returned by BeginWrite when the version store
+// does not implement version.PendingWriter.
+var ErrPendingWriteUnsupported = errors.New("cascache: BeginWrite requires a version.PendingWriter store")
+
+// ErrStaleRevision is returned by KeyRevisionWriter implementations that
+// reject a write because the cached entry records a higher source revision.
+// The cache reports it as WriteOutcomeStaleRevision.
+var ErrStaleRevision = errors.New("cascache: cached entry has a newer source revision")
+
+// ErrOutboxInUse identifies an invalid configuration where one
+// InvalidationOutbox is passed to more than one cache.
+var ErrOutboxInUse = errors.New("cascache: InvalidationOutbox already serves another cache")
+
 type InvalidateError struct {
 	Key        string
 	AdvanceErr error
 	DelErr     error
+
+	// Queued reports that Options.Outbox accepted the key and will retry
+	// the invalidation.
+	Queued bool
 }
 
 func (e *InvalidateError) Error() string {
@@ -48,17 +123,59 @@ func (e *InvalidateError) Unwrap() []error {
 	}
 }
 
+// InvalidateManyError aggregates the per-key failures of InvalidateMany.
+// Keys that are not listed were invalidated successfully, so callers can retry
+// only Keys().
+type InvalidateManyError struct {
+	Errors []*InvalidateError
+}
+
+func (e *InvalidateManyError) Error() string {
+	switch len(e.Errors) {
+	case 0:
+		return "invalidate many: unknown error"
+	case 1:
+		return e.Errors[0].Error()
+	default:
+		return fmt.Sprintf("invalidate many: %d keys failed; first: %v", len(e.Errors), e.Errors[0])
+	}
+}
+
+func (e *InvalidateManyError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, ie := range e.Errors {
+		errs[i] = ie
+	}
+	return errs
+}
+
+// Keys returns the logical keys whose invalidation failed.
+func (e *InvalidateManyError) Keys() []string {
+	keys := make([]string, len(e.Errors))
+	for i, ie := range e.Errors {
+		keys[i] = ie.Key
+	}
+	return keys
+}
+
 // Op identifies the logical cache operation that failed.
 type Op string
 
 const (
-	OpGet           Op = "get"
-	OpSet           Op = "set"
-	OpAdd           Op = "add"
-	OpSnapshot      Op = "snapshot"
-	OpInvalidate    Op = "invalidate"
-	OpGetMany       Op = "get_many"
-	OpSetIfVersions Op = "set_if_versions"
+	OpGet              Op = "get"
+	OpSet              Op = "set"
+	OpAdd              Op = "add"
+	OpSnapshot         Op = "snapshot"
+	OpInvalidate       Op = "invalidate"
+	OpInvalidateAll    Op = "invalidate_all"
+	OpInvalidateTag    Op = "invalidate_tag"
+	OpInvalidatePrefix Op = "invalidate_prefix"
+	OpBeginWrite       Op = "begin_write"
+	OpCommitWrite      Op = "commit_write"
+	OpAbortWrite       Op = "abort_write"
+	OpUpdate           Op = "update"
+	OpGetMany          Op = "get_many"
+	OpSetIfVersions    Op = "set_if_versions"
 )
 
 // OpError reports an operation failure and, when applicable,
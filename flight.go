@@ -0,0 +1,87 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// flightCall is one in-process fill shared by every caller that missed the
+// same logical key while it was running.
+type flightCall[V any] struct {
+	done chan struct{}
+
+	val     V
+	found   bool
+	write   WriteResult
+	fillErr error
+	err     error
+
+	// hit and leaseWaited report that the leader waited on another caller's
+	// fill lease and, for hit, served the value that caller cached.
+	hit         bool
+	leaseWaited bool
+
+	// abandoned reports that the leader's own ctx ended the fill, so its
+	// error says nothing about the key; waiters fill it themselves instead.
+	abandoned bool
+}
+
+// flightGroup coalesces concurrent in-process fills per logical key. It only
+// deduplicates work inside one process; cross-process safety still comes from
+// the version fences checked by SetIfVersion.
+type flightGroup[V any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[V]
+}
+
+// join returns the in-flight call for key, creating it when none exists.
+// leader reports whether the caller created the call and therefore must run
+// the fill and finish it.
+func (g *flightGroup[V]) join(key string) (*flightCall[V], bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[V])
+	}
+
+	call := &flightCall[V]{
+		done: make(chan struct{}),
+		err:  ErrLoadAborted, // overwritten unless the leader exits early
+	}
+	g.calls[key] = call
+	return call, true
+}
+
+// finish publishes the call result to waiters and forgets key so the next
+// miss starts a fresh fill instead of reusing a finished one.
+func (g *flightGroup[V]) finish(key string, call *flightCall[V]) {
+	g.mu.Lock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(call.done)
+}
+
+// abandon marks the call abandoned when err only reflects the leader's ctx
+// being done.
+func (call *flightCall[V]) abandon(ctx context.Context, err error) {
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+		call.abandoned = true
+	}
+}
+
+// wait blocks until the call finishes or ctx is done.
+func (call *flightCall[V]) wait(ctx context.Context) error {
+	select {
+	case <-call.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -7,8 +7,14 @@ import "github.com/unkn0wn-root/cascache/v3/version"
 // If work may block, buffer it and drop on backpressure (best effort).
 //
 // Key-bearing callbacks intentionally expose different key kinds:
-//   - SelfHealSingle / ProviderSetRejected: provider storage keys.
+//   - SelfHealSingle / SelfHealL1 / ProviderSetRejected: provider storage keys.
 //   - VersionCreateError / VersionAdvanceError: canonical version.CacheKey identity.
+//
+// SelfHealSingle reports entries removed from the shared provider (L2).
+//
+// Events added after Hooks was published live in optional extension
+// interfaces, such as L1Hooks and OutboxHooks; the cache calls them only on
+// hooks that implement them.
 type Hooks interface {
 	SelfHealSingle(storageKey string, reason SelfHealReason)
 	BatchRejected(namespace string, requested int, reason BatchRejectReason)
@@ -20,10 +26,23 @@ type Hooks interface {
 	LocalVersionStoreWithBatch()
 }
 
+// L1Hooks is an optional Hooks extension for the in-process Options.L1 tier.
+// SelfHealL1 reports entries removed from it.
+type L1Hooks interface {
+	SelfHealL1(storageKey string, reason SelfHealReason)
+}
+
+// OutboxHooks is an optional Hooks extension for Options.Outbox. OutboxDepth
+// reports the number of keys waiting in the outbox whenever it changes.
+type OutboxHooks interface {
+	OutboxDepth(depth int)
+}
+
 // NopHooks is a default no-op.
 type NopHooks struct{}
 
 func (NopHooks) SelfHealSingle(string, SelfHealReason)        {}
+func (NopHooks) SelfHealL1(string, SelfHealReason)            {}
 func (NopHooks) BatchRejected(string, int, BatchRejectReason) {}
 func (NopHooks) ProviderSetRejected(string, bool)             {}
 func (NopHooks) VersionSnapshotError(int, error)              {}
@@ -31,6 +50,7 @@ func (NopHooks) VersionCreateError(version.CacheKey, error)   {}
 func (NopHooks) VersionAdvanceError(version.CacheKey, error)  {}
 func (NopHooks) InvalidateOutage(string, error, error)        {}
 func (NopHooks) LocalVersionStoreWithBatch()                  {}
+func (NopHooks) OutboxDepth(int)                              {}
 
 // Multi returns a Hooks implementation that fans out to all provided hooks
 // in order. Nil entries are silently skipped. Panics from any hook propagate
@@ -73,6 +93,14 @@ func (m multiHooks) SelfHealSingle(k string, r SelfHealReason) {
 	}
 }
 
+func (m multiHooks) SelfHealL1(k string, r SelfHealReason) {
+	for _, h := range m {
+		if lh, ok := h.(L1Hooks); ok {
+			lh.SelfHealL1(k, r)
+		}
+	}
+}
+
 func (m multiHooks) BatchRejected(ns string, n int, r BatchRejectReason) {
 	for _, h := range m {
 		h.BatchRejected(ns, n, r)
@@ -114,3 +142,11 @@ func (m multiHooks) LocalVersionStoreWithBatch() {
 		h.LocalVersionStoreWithBatch()
 	}
 }
+
+func (m multiHooks) OutboxDepth(n int) {
+	for _, h := range m {
+		if oh, ok := h.(OutboxHooks); ok {
+			oh.OutboxDepth(n)
+		}
+	}
+}
@@ -47,7 +47,11 @@ type Hooks struct {
 	closed bool
 }
 
-var _ cascache.Hooks = (*Hooks)(nil)
+var (
+	_ cascache.Hooks       = (*Hooks)(nil)
+	_ cascache.L1Hooks     = (*Hooks)(nil)
+	_ cascache.OutboxHooks = (*Hooks)(nil)
+)
 
 func New(inner cascache.Hooks, workers, qlen int) *Hooks {
 	if inner == nil {
@@ -100,6 +104,13 @@ func (h *Hooks) SelfHealSingle(k string, r cascache.SelfHealReason) {
 	h.try(func() { h.inner.SelfHealSingle(k, r) })
 }
 
+// SelfHealL1 implements cascache.L1Hooks when the wrapped hooks do.
+func (h *Hooks) SelfHealL1(k string, r cascache.SelfHealReason) {
+	if lh, ok := h.inner.(cascache.L1Hooks); ok {
+		h.try(func() { lh.SelfHealL1(k, r) })
+	}
+}
+
 func (h *Hooks) VersionAdvanceError(k version.CacheKey, err error) {
 	h.try(func() { h.inner.VersionAdvanceError(k, err) })
 }
@@ -127,3 +138,10 @@ func (h *Hooks) VersionCreateError(k version.CacheKey, err error) {
 func (h *Hooks) InvalidateOutage(k string, be, de error) {
 	h.try(func() { h.inner.InvalidateOutage(k, be, de) })
 }
+
+// OutboxDepth implements cascache.OutboxHooks when the wrapped hooks do.
+func (h *Hooks) OutboxDepth(n int) {
+	if oh, ok := h.inner.(cascache.OutboxHooks); ok {
+		h.try(func() { oh.OutboxDepth(n) })
+	}
+}
@@ -31,7 +31,11 @@ type Hooks struct {
 	batchRejectCtr atomic.Uint64
 }
 
-var _ cascache.Hooks = (*Hooks)(nil)
+var (
+	_ cascache.Hooks       = (*Hooks)(nil)
+	_ cascache.L1Hooks     = (*Hooks)(nil)
+	_ cascache.OutboxHooks = (*Hooks)(nil)
+)
 
 // New creates a slog-based Hooks.
 func New(l *slog.Logger, opts Options) *Hooks {
@@ -63,6 +67,15 @@ func (h *Hooks) SelfHealSingle(storageKey string, reason cascache.SelfHealReason
 		"reason", string(reason))
 }
 
+func (h *Hooks) SelfHealL1(storageKey string, reason cascache.SelfHealReason) {
+	if h.l == nil || !sample(h.opts.SelfHealEvery, &h.selfHealCtr) {
+		return
+	}
+	h.l.Debug("cascache.self_heal_l1",
+		"key", h.redact(storageKey),
+		"reason", string(reason))
+}
+
 func (h *Hooks) BatchRejected(ns string, requested int, reason cascache.BatchRejectReason) {
 	if h.l == nil || !sample(h.opts.BatchRejectEvery, &h.batchRejectCtr) {
 		return
@@ -126,3 +139,10 @@ func (h *Hooks) LocalVersionStoreWithBatch() {
 	h.l.Warn("cascache.local_version_store_with_batch",
 		"msg", "batch enabled with local version store; stale batches possible in multi-replica")
 }
+
+func (h *Hooks) OutboxDepth(depth int) {
+	if h.l == nil {
+		return
+	}
+	h.l.Debug("cascache.outbox_depth", "depth", depth)
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"math"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 var (
@@ -20,8 +22,15 @@ const (
 	rootPrefix         = "cas:v3:"
 	valueRoot          = rootPrefix + "val:"
 	versionRoot        = rootPrefix + "ver:"
+	staleRoot          = rootPrefix + "stale:"
+	leaseRoot          = rootPrefix + "lease:"
+	collectionRoot     = rootPrefix + "col:"
 	singleKind         = "s:"
 	batchKind          = "b:"
+	batchIndexKind     = "bi:"
+	epochKind          = "e:"
+	tagKind            = "t:"
+	prefixKind         = "p:"
 	maxBatchKeyPartLen = uint64(math.MaxUint32)
 )
 
@@ -49,6 +58,10 @@ type Single struct {
 type Keyspace struct {
 	singlePrefix string
 	batchPrefix  string
+	batchIndex   ValueKey
+	tagPrefix    string
+	prefixPrefix string
+	epoch        CacheKey
 }
 
 // NewKeyspace precomputes the stable prefixes for one logical namespace.
@@ -59,9 +72,19 @@ func NewKeyspace(namespace string) Keyspace {
 	return Keyspace{
 		singlePrefix: sp,
 		batchPrefix:  valueRoot + batchKind + fr,
+		batchIndex:   ValueKey(valueRoot + batchIndexKind + fr),
+		tagPrefix:    tagKind + fr,
+		prefixPrefix: prefixKind + fr,
+		epoch:        CacheKey(epochKind + fr),
 	}
 }
 
+// EpochCacheKey returns the version-store identity of the namespace epoch.
+// Its kind prefix keeps it disjoint from every single-key identity.
+func (s Keyspace) EpochCacheKey() CacheKey {
+	return s.epoch
+}
+
 // SingleCacheKey returns the canonical identity for one logical key.
 // This is the key seen by the version store and by slot-tag derivation.
 func (s Keyspace) SingleCacheKey(userKey string) CacheKey {
@@ -82,6 +105,54 @@ func (s Keyspace) Single(userKey string) Single {
 	}
 }
 
+// TagCacheKey returns the version-store identity of one invalidation tag.
+// Tags are scoped to the namespace like single keys.
+func (s Keyspace) TagCacheKey(tag string) CacheKey {
+	return CacheKey(s.tagPrefix + tag)
+}
+
+// PrefixCacheKey returns the version-store identity of one key prefix in
+// hierarchical key mode. Prefixes are scoped to the namespace like tags.
+func (s Keyspace) PrefixCacheKey(prefix string) CacheKey {
+	return CacheKey(s.prefixPrefix + prefix)
+}
+
+// Ancestors returns the proper ancestor prefixes of key, shortest first. A
+// key split by sep into n segments has ancestors of depth 1 through n-1, the
+// prefix ending before the depth-th separator; only the depths listed in
+// depths are returned, or all of them when depths is empty. depths must be
+// sorted. An empty sep yields no ancestors.
+//
+//	Ancestors("tenant:9:user:42", ":", nil) // "tenant", "tenant:9", "tenant:9:user"
+//	Ancestors("tenant:9:user:42", ":", []int{2}) // "tenant:9"
+func Ancestors(key, sep string, depths []int) []string {
+	if sep == "" {
+		return nil
+	}
+	var out []string
+	depth, off := 0, 0
+	for {
+		i := strings.Index(key[off:], sep)
+		if i < 0 {
+			return out
+		}
+		depth++
+		off += i
+		if len(depths) == 0 || slices.Contains(depths, depth) {
+			out = append(out, key[:off])
+		} else if depth > depths[len(depths)-1] {
+			return out
+		}
+		off += len(sep)
+	}
+}
+
+// PrefixDepth returns the depth of prefix as an ancestor: the number of
+// segments sep splits it into.
+func PrefixDepth(prefix, sep string) int {
+	return strings.Count(prefix, sep) + 1
+}
+
 // VersionStorageKey returns the backing storage key for authoritative version state.
 // Single value keys and version-state keys intentionally share the same Redis
 // hash tag so backend-native single-key scripts can target one cluster slot.
@@ -89,6 +160,43 @@ func VersionStorageKey(cacheKey CacheKey) string {
 	return versionRoot + slotPrefix(cacheKey) + string(cacheKey)
 }
 
+// VersionStoragePrefix is the prefix shared by every VersionStorageKey.
+const VersionStoragePrefix = versionRoot
+
+// ParseVersionStorageKey returns the canonical identity behind a storage key
+// built by VersionStorageKey. ok=false means s is not such a key.
+func ParseVersionStorageKey(s string) (CacheKey, bool) {
+	rest, ok := strings.CutPrefix(s, versionRoot)
+	if !ok || len(rest) < slotPrefixLen {
+		return "", false
+	}
+	ck := CacheKey(rest[slotPrefixLen:])
+	if rest[:slotPrefixLen] != slotPrefix(ck) {
+		return "", false
+	}
+	return ck, true
+}
+
+// LeaseStorageKey returns the backing storage key for the fill lease of
+// cacheKey. It shares the key's hash tag with the version state and value.
+func LeaseStorageKey(cacheKey CacheKey) string {
+	return leaseRoot + slotPrefix(cacheKey) + string(cacheKey)
+}
+
+// StaleValueKey returns the provider storage key holding the last valid frame
+// of an invalidated single key. It shares the key's hash tag so it lands in
+// the same cluster slot as the live value.
+func StaleValueKey(cacheKey CacheKey) ValueKey {
+	return ValueKey(staleRoot + slotPrefix(cacheKey) + string(cacheKey))
+}
+
+// CollectionValueKey returns the provider storage key holding the collection
+// cached under cacheKey. A collection shares its key's version state, and the
+// hash tag with it, but not the single value slot.
+func CollectionValueKey(cacheKey CacheKey) ValueKey {
+	return ValueKey(collectionRoot + slotPrefix(cacheKey) + string(cacheKey))
+}
+
 // BatchValueSorted returns the provider value key for a batch entry.
 // sortedKeys must already be sorted in ascending order and contain no duplicates.
 func (s Keyspace) BatchValueSorted(sortedKeys []string) (ValueKey, error) {
@@ -99,6 +207,12 @@ func (s Keyspace) BatchValueSorted(sortedKeys []string) (ValueKey, error) {
 	return ValueKey(s.batchPrefix + d), nil
 }
 
+// BatchIndexValueKey returns the provider storage key of the namespace's
+// batch superset index, which lists the key sets of recent batch entries.
+func (s Keyspace) BatchIndexValueKey() ValueKey {
+	return s.batchIndex
+}
+
 // digestSortedKeys hashes a canonical sorted, duplicate-free logical key set.
 // Length framing preserves boundaries so ["ab", "c"] and ["a", "bc"] do not
 // collide before hashing.
@@ -150,6 +264,9 @@ func storageKey(cacheKey CacheKey) ValueKey {
 }
 
 // slotPrefix wraps the stable hash tag used to colocate related Redis keys.
+// slotPrefixLen is the length of every slotPrefix: "{", 32 hex digits, "}:".
+const slotPrefixLen = 1 + 32 + 2
+
 func slotPrefix(cacheKey CacheKey) string {
 	return "{" + slotTag(cacheKey) + "}:"
 }
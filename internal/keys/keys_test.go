@@ -42,6 +42,21 @@ func TestBatchValueSortedUsesVersionedPrefixAndDigest(t *testing.T) {
 	}
 }
 
+func TestBatchIndexValueKeyIsDisjointFromBatchKeys(t *testing.T) {
+	ks := NewKeyspace("user")
+	idx := ks.BatchIndexValueKey().String()
+	if idx != "cas:v3:val:bi:4:user:" {
+		t.Fatalf("batch index key = %q", idx)
+	}
+	bk, err := ks.BatchValueSorted([]string{"a"})
+	if err != nil {
+		t.Fatalf("BatchValueSorted: %v", err)
+	}
+	if strings.HasPrefix(bk.String(), idx) || strings.HasPrefix(idx, bk.String()) {
+		t.Fatalf("batch index key %q overlaps batch key %q", idx, bk)
+	}
+}
+
 func TestBatchValueSortedIsDeterministic(t *testing.T) {
 	space := NewKeyspace("user")
 
@@ -142,3 +157,125 @@ func redisHashTag(key string) string {
 	}
 	return key[start+1 : start+1+end]
 }
+
+func TestEpochCacheKeyIsPerNamespaceAndDisjointFromSingles(t *testing.T) {
+	a := NewKeyspace("app")
+	b := NewKeyspace("app:prod")
+
+	if a.EpochCacheKey() == b.EpochCacheKey() {
+		t.Fatalf("epoch keys collided: %q", a.EpochCacheKey())
+	}
+	if got, want := a.EpochCacheKey(), CacheKey("e:3:app:"); got != want {
+		t.Fatalf("epoch key=%q want %q", got, want)
+	}
+	for _, k := range []string{"", "e", "e:3:app:"} {
+		if a.SingleCacheKey(k) == a.EpochCacheKey() {
+			t.Fatalf("single key %q collided with the epoch key", k)
+		}
+	}
+}
+
+func TestTagCacheKeyIsFramedAndDisjointFromSingles(t *testing.T) {
+	s := NewKeyspace("app")
+	if got, want := s.TagCacheKey("org:7"), CacheKey("t:3:app:org:7"); got != want {
+		t.Fatalf("tag key=%q want %q", got, want)
+	}
+	if s.TagCacheKey("x") == s.SingleCacheKey("x") {
+		t.Fatalf("tag and single keys collided")
+	}
+	if NewKeyspace("app:prod").TagCacheKey("x") == NewKeyspace("app").TagCacheKey("prod:x") {
+		t.Fatalf("tag keys collided across namespaces")
+	}
+}
+
+func TestCollectionValueKeySharesHashTagWithValueKey(t *testing.T) {
+	sk := NewKeyspace("orders").Single("customer:7")
+	col := CollectionValueKey(sk.Cache).String()
+	if col == sk.Value.String() {
+		t.Fatalf("collection and single value keys collided: %q", col)
+	}
+	if !strings.Contains(col, slotPrefix(sk.Cache)) {
+		t.Fatalf("collection key %q lacks the hash tag of %q", col, sk.Value)
+	}
+}
+
+func TestPrefixCacheKeyIsFramedAndDisjointFromTags(t *testing.T) {
+	s := NewKeyspace("app")
+	if got, want := s.PrefixCacheKey("tenant:9"), CacheKey("p:3:app:tenant:9"); got != want {
+		t.Fatalf("prefix key=%q want %q", got, want)
+	}
+	if s.PrefixCacheKey("x") == s.TagCacheKey("x") || s.PrefixCacheKey("x") == s.SingleCacheKey("x") {
+		t.Fatalf("prefix key collided with a tag or single key")
+	}
+}
+
+func TestAncestorsSplitsOnSeparator(t *testing.T) {
+	tests := []struct {
+		key    string
+		sep    string
+		depths []int
+		want   []string
+	}{
+		{"tenant:9:user:42", ":", nil, []string{"tenant", "tenant:9", "tenant:9:user"}},
+		{"tenant:9:user:42", ":", []int{2}, []string{"tenant:9"}},
+		{"tenant:9:user:42", ":", []int{1, 3, 4}, []string{"tenant", "tenant:9:user"}},
+		{"tenant:9", ":", []int{2}, nil},
+		{"a::b", "::", nil, []string{"a"}},
+		{"flat", ":", nil, nil},
+		{"a:b", "", nil, nil},
+	}
+	for _, tt := range tests {
+		got := Ancestors(tt.key, tt.sep, tt.depths)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Fatalf("Ancestors(%q, %q, %v)=%q want %q", tt.key, tt.sep, tt.depths, got, tt.want)
+		}
+	}
+	if got := PrefixDepth("tenant:9", ":"); got != 2 {
+		t.Fatalf("PrefixDepth=%d want 2", got)
+	}
+}
+
+func TestStaleValueKeySharesHashTagWithValueKey(t *testing.T) {
+	single := NewKeyspace("user").Single("a")
+	staleKey := StaleValueKey(single.Cache).String()
+
+	if !strings.HasPrefix(staleKey, "cas:v3:stale:{") {
+		t.Fatalf("stale key prefix mismatch: %q", staleKey)
+	}
+	if staleKey == single.Value.String() {
+		t.Fatalf("stale key must differ from the value key")
+	}
+	if redisHashTag(staleKey) != redisHashTag(single.Value.String()) {
+		t.Fatalf("stale and value keys must share a hash tag: %q vs %q", staleKey, single.Value)
+	}
+}
+
+func TestParseVersionStorageKeyRoundTrips(t *testing.T) {
+	space := NewKeyspace("user")
+	for _, ck := range []CacheKey{
+		space.SingleCacheKey("a"),
+		space.SingleCacheKey("{x}:y"),
+		space.EpochCacheKey(),
+		space.TagCacheKey("team"),
+	} {
+		sk := VersionStorageKey(ck)
+		if !strings.HasPrefix(sk, VersionStoragePrefix) {
+			t.Fatalf("%q lacks prefix %q", sk, VersionStoragePrefix)
+		}
+		got, ok := ParseVersionStorageKey(sk)
+		if !ok || got != ck {
+			t.Fatalf("ParseVersionStorageKey(%q) = %q, %v want %q", sk, got, ok, ck)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		space.SingleValueKey("a").String(),
+		VersionStoragePrefix + "{0000}:s:x",
+		VersionStoragePrefix + slotPrefix("other") + string(space.SingleCacheKey("a")),
+	} {
+		if _, ok := ParseVersionStorageKey(bad); ok {
+			t.Fatalf("ParseVersionStorageKey(%q) should fail", bad)
+		}
+	}
+}
@@ -6,8 +6,13 @@
 //   - All integers are big-endian (network byte order).
 //   - A 4-byte ASCII magic ("CASC") allows quick format discrimination.
 //   - A 1-byte version enables forward/backward compatibility in place.
-//   - "kind" distinguishes single vs batch payloads.
-//   - Each cached item carries one opaque per-key fence token.
+//   - "kind" distinguishes single vs batch payloads, plain vs extended
+//     frames, and absence tombstones. Extended frames and tombstones carry a
+//     flags byte announcing optional sections.
+//   - Each cached item carries one opaque per-key fence token, plus optional
+//     dependency fences for other authoritative keys (such as a namespace
+//     epoch) the item was written under. Single entries may also carry write
+//     timing used for early refresh and the caller's source revision.
 //   - The payload after the fixed header is codec-opaque ([]byte).
 //   - Decoders are written for bounds safety: every slice operation is preceded by
 //     length checks; on any mismatch they return ErrCorrupt.
@@ -29,19 +34,35 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/unkn0wn-root/cascache/v3/version"
 )
 
 const (
 	// wireVersion is the wire-format version. Increment only on incompatible layout changes.
+	// New kinds are added under the same version: releases that predate a kind
+	// decode it as ErrCorrupt and delete the entry, which the README's upgrade
+	// notes cover for rolling deploys.
 	wireVersion   byte = 3
 	kindSingle         = 1
 	kindBatch          = 2
-	fenceSize          = 16
+	kindSingleExt      = 3
+	kindBatchExt       = 4
+	kindAbsent         = 5
+	fenceSize          = version.FenceSize
 	maxKeyLen          = 0xFFFF
+	maxDeps            = 0xFFFF
 	maxUint32Wire      = uint64(^uint32(0))
 
+	// flagDeps marks an extended item that carries a dependency section.
+	// flagTiming marks a single entry that carries write timing.
+	// flagRevision marks a single entry that carries a source revision.
+	// Flag bits a frame kind does not support are rejected as corrupt.
+	flagDeps     byte = 1 << 0
+	flagTiming   byte = 1 << 1
+	flagRevision byte = 1 << 2
+
 	// fixed prefix of a single-entry frame.
 	// magic(4) | ver(1) | kind(1) | fence(16) | vlen(4)
 	sHdr = 4 + 1 + 1 + fenceSize + 4
@@ -53,11 +74,46 @@ const (
 	// smallest possible per-item footprint.
 	// keyLen(2) | minKey(1) | fence(16) | vlen(4)
 	minBatchSize = 2 + 1 + fenceSize + 4
+
+	// smallest possible dependency footprint.
+	// keyLen(2) | minKey(1) | fence(16)
+	minDepSize = 2 + 1 + fenceSize
+
+	// timing section.
+	// writtenAt(8) | ttl(8) | delta(8)
+	timingSize = 8 + 8 + 8
+
+	// revision section, which directly follows the flags byte so compare
+	// scripts can read it at a fixed offset.
+	// revision(8)
+	revisionSize = 8
+	revisionOff  = 6 + fenceSize + 1
+)
+
+// Where a revisioned single entry or tombstone keeps its revision, for
+// compare scripts that read it inside the backend instead of calling
+// PeekRevision. Offsets are 0-based; a frame carries a revision when it is at
+// least RevisionEnd bytes long, starts with "CASC", has version Version and
+// kind KindSingleExt or KindAbsent, and has FlagRevision set in the byte at
+// FlagsOffset. The revision is the big-endian u64 at RevisionOffset.
+const (
+	Version        = wireVersion
+	KindSingleExt  = kindSingleExt
+	KindAbsent     = kindAbsent
+	FlagRevision   = flagRevision
+	FlagsOffset    = revisionOff - 1
+	RevisionOffset = revisionOff
+	RevisionEnd    = revisionOff + revisionSize
 )
 
 var (
 	ErrCorrupt = errors.New("corrupt entry")
 
+	errTooManyDeps = errors.New("dependency count exceeds u16 wire limit")
+
+	errAbsentPayload = errors.New("absent entry must not carry a payload")
+	errAbsentTiming  = errors.New("absent entry must not carry timing")
+
 	// fixed 4-byte magic header ("CASC").
 	casc = [...]byte{'C', 'A', 'S', 'C'}
 )
@@ -122,10 +178,216 @@ func DecodeSingle(b []byte) (version.Fence, []byte, error) {
 	return f, b[off : off+vlen], nil
 }
 
+// Dep records the fence an entry observed for one additional authoritative
+// key when it was written. Dependencies that did not exist at write time are
+// never recorded.
+type Dep struct {
+	Key   string
+	Fence version.Fence
+}
+
+// Timing records when a single entry was written, the TTL it was written
+// with, and how long the value took to load. The zero value means the entry
+// carries no timing.
+type Timing struct {
+	WrittenAt time.Time
+	TTL       time.Duration
+	Delta     time.Duration
+}
+
+// IsZero reports whether t carries no timing.
+func (t Timing) IsZero() bool { return t.WrittenAt.IsZero() }
+
+// ExpiresAt returns when the entry's provider TTL runs out.
+func (t Timing) ExpiresAt() time.Time { return t.WrittenAt.Add(t.TTL) }
+
+// SingleEntry is the decoded form of a single-entry frame.
+//
+// Absent marks a tombstone: the key was confirmed missing from the source of
+// truth when the entry was written. Tombstones carry no payload.
+//
+// Revision is the caller's ordered source revision for the value; zero means
+// none was recorded.
+type SingleEntry struct {
+	Fence    version.Fence
+	Deps     []Dep
+	Timing   Timing
+	Revision uint64
+	Absent   bool
+	Payload  []byte
+}
+
+// Plain reports whether e encodes to the plain single-entry layout that
+// EncodeSingle produces.
+func (e SingleEntry) Plain() bool {
+	return !e.Absent && len(e.Deps) == 0 && e.Timing.IsZero() && e.Revision == 0
+}
+
+// PeekRevision returns the source revision recorded in an encoded single
+// entry or tombstone without decoding the rest of the frame, or zero when b
+// records none or is not a single-entry frame.
+func PeekRevision(b []byte) uint64 {
+	if len(b) < revisionOff+revisionSize || !hasMagic(b) || b[4] != wireVersion {
+		return 0
+	}
+	if b[5] != kindSingleExt && b[5] != kindAbsent {
+		return 0
+	}
+	if b[revisionOff-1]&flagRevision == 0 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b[revisionOff : revisionOff+revisionSize])
+}
+
+// EncodeSingleEntry encodes a single entry, choosing the plain layout when the
+// entry has no dependencies or timing so existing readers keep accepting it.
+//
+// Extended layout (big-endian):
+//
+//	magic(4) | ver(1) | kind(3=single ext) | fence(16) | flags(1)
+//	[flags&revision] revision(u64)
+//	[flags&deps] nDeps(u16) | nDeps × ( keyLen(u16) | key(keyLen) | fence(16) )
+//	[flags&timing] writtenAt(i64 unix ns) | ttl(i64 ns) | delta(i64 ns)
+//	vlen(u32) | payload(vlen)
+//
+// Tombstone layout (big-endian):
+//
+//	magic(4) | ver(1) | kind(5=absent) | fence(16) | flags(1)
+//	[flags&revision] revision(u64)
+//	[flags&deps] nDeps(u16) | nDeps × ( keyLen(u16) | key(keyLen) | fence(16) )
+//
+// The fence sits at the same offset in every layout, and so does the
+// revision when present.
+func EncodeSingleEntry(e SingleEntry) ([]byte, error) {
+	if e.Absent {
+		return encodeAbsent(e)
+	}
+	if e.Plain() {
+		return EncodeSingle(e.Fence, e.Payload)
+	}
+
+	vlen, err := checkedUint32(uint64(len(e.Payload)), "payload length")
+	if err != nil {
+		return nil, err
+	}
+	xsz, err := extSize(e.Deps, e.Timing, e.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, sHdr+xsz+len(e.Payload))
+	copy(out[:4], casc[:])
+	out[4] = wireVersion
+	out[5] = kindSingleExt
+
+	off := 6
+	off += len(e.Fence.AppendBinary(out[off:off]))
+	off = putExt(out, off, e.Deps, e.Timing, e.Revision)
+	binary.BigEndian.PutUint32(out[off:off+4], vlen)
+	off += 4
+	copy(out[off:], e.Payload)
+	return out, nil
+}
+
+// encodeAbsent encodes a tombstone frame.
+func encodeAbsent(e SingleEntry) ([]byte, error) {
+	if len(e.Payload) != 0 {
+		return nil, errAbsentPayload
+	}
+	if !e.Timing.IsZero() {
+		return nil, errAbsentTiming
+	}
+
+	xsz, err := extSize(e.Deps, Timing{}, e.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 6+fenceSize+xsz)
+	copy(out[:4], casc[:])
+	out[4] = wireVersion
+	out[5] = kindAbsent
+
+	off := 6
+	off += len(e.Fence.AppendBinary(out[off:off]))
+	putExt(out, off, e.Deps, Timing{}, e.Revision)
+	return out, nil
+}
+
+// DecodeSingleEntry parses a plain, extended, or tombstone single entry.
+// The returned payload is a zero-copy subslice of b and must be treated as read-only.
+func DecodeSingleEntry(b []byte) (SingleEntry, error) {
+	if len(b) >= 6 && hasMagic(b) && b[4] == wireVersion && b[5] == kindSingle {
+		f, p, err := DecodeSingle(b)
+		if err != nil {
+			return SingleEntry{}, err
+		}
+		return SingleEntry{Fence: f, Payload: p}, nil
+	}
+	if len(b) >= 6 && hasMagic(b) && b[4] == wireVersion && b[5] == kindAbsent {
+		return decodeAbsent(b)
+	}
+	if len(b) < sHdr+1 || !hasMagic(b) || b[4] != wireVersion || b[5] != kindSingleExt {
+		return SingleEntry{}, ErrCorrupt
+	}
+
+	off := 6
+	f, err := version.ParseFenceBinary(b[off : off+fenceSize])
+	if err != nil {
+		return SingleEntry{}, ErrCorrupt
+	}
+	off += fenceSize
+
+	x, off, err := decodeExt(b, off, flagDeps|flagTiming|flagRevision)
+	if err != nil {
+		return SingleEntry{}, err
+	}
+
+	if off+4 > len(b) {
+		return SingleEntry{}, ErrCorrupt
+	}
+	vlen := int(binary.BigEndian.Uint32(b[off : off+4]))
+	off += 4
+	if vlen < 0 || off+vlen != len(b) {
+		return SingleEntry{}, ErrCorrupt
+	}
+	return SingleEntry{
+		Fence:    f,
+		Deps:     x.deps,
+		Timing:   x.timing,
+		Revision: x.revision,
+		Payload:  b[off : off+vlen],
+	}, nil
+}
+
+// decodeAbsent parses a tombstone frame.
+func decodeAbsent(b []byte) (SingleEntry, error) {
+	if len(b) < 6+fenceSize+1 {
+		return SingleEntry{}, ErrCorrupt
+	}
+
+	off := 6
+	f, err := version.ParseFenceBinary(b[off : off+fenceSize])
+	if err != nil {
+		return SingleEntry{}, ErrCorrupt
+	}
+	off += fenceSize
+
+	x, off, err := decodeExt(b, off, flagDeps|flagRevision)
+	if err != nil {
+		return SingleEntry{}, err
+	}
+	if off != len(b) { // no trailing bytes allowed
+		return SingleEntry{}, ErrCorrupt
+	}
+	return SingleEntry{Fence: f, Deps: x.deps, Revision: x.revision, Absent: true}, nil
+}
+
 // BatchItem holds one member of a batch-encoded set.
 type BatchItem struct {
 	Key     string
 	Fence   version.Fence
+	Deps    []Dep
 	Payload []byte
 }
 
@@ -137,6 +399,10 @@ type BatchItem struct {
 //	repeated n times:
 //	  keyLen(u16) | key(keyLen) | fence(16) | vlen(u32) | payload(vlen)
 //
+// When any item carries dependencies the extended kind (4) is used instead,
+// and every item gains a flags byte and optional sections after its fence,
+// laid out exactly as in EncodeSingleEntry.
+//
 // Returns an error if item count or payload lengths exceed uint32, or if any
 // key length is 0 or > 65535 (u16).
 func EncodeBatch(items []BatchItem) ([]byte, error) {
@@ -145,6 +411,14 @@ func EncodeBatch(items []BatchItem) ([]byte, error) {
 		return nil, err
 	}
 
+	ext := false
+	for _, it := range items {
+		if len(it.Deps) != 0 {
+			ext = true
+			break
+		}
+	}
+
 	total := bHdr
 	for _, it := range items {
 		l := len(it.Key)
@@ -155,12 +429,25 @@ func EncodeBatch(items []BatchItem) ([]byte, error) {
 			return nil, err
 		}
 		total += 2 + l + fenceSize + 4 + len(it.Payload)
+		if ext {
+			total++ // flags
+		}
+		if len(it.Deps) != 0 {
+			dsz, err := depsSize(it.Deps)
+			if err != nil {
+				return nil, err
+			}
+			total += dsz
+		}
 	}
 
 	out := make([]byte, total)
 	copy(out[:4], casc[:])
 	out[4] = wireVersion
 	out[5] = kindBatch
+	if ext {
+		out[5] = kindBatchExt
+	}
 
 	off := 6
 	binary.BigEndian.PutUint32(out[off:off+4], n)
@@ -171,6 +458,15 @@ func EncodeBatch(items []BatchItem) ([]byte, error) {
 		off += 2
 		off += copy(out[off:], it.Key)
 		off += len(it.Fence.AppendBinary(out[off:off])) // append into pre-sized slack
+		if ext {
+			if len(it.Deps) != 0 {
+				out[off] = flagDeps
+				off++
+				off = putDeps(out, off, it.Deps)
+			} else {
+				off++ // flags=0
+			}
+		}
 		binary.BigEndian.PutUint32(out[off:off+4], uint32(len(it.Payload)))
 		off += 4
 		off += copy(out[off:], it.Payload)
@@ -186,9 +482,10 @@ func EncodeBatch(items []BatchItem) ([]byte, error) {
 // string (one allocation per item). Duplicate keys in the stored items are
 // allowed; the last occurrence wins.
 func DecodeBatch(b []byte) ([]BatchItem, error) {
-	if len(b) < bHdr || !hasMagic(b) || b[4] != wireVersion || b[5] != kindBatch {
+	if len(b) < bHdr || !hasMagic(b) || b[4] != wireVersion || (b[5] != kindBatch && b[5] != kindBatchExt) {
 		return nil, ErrCorrupt
 	}
+	ext := b[5] == kindBatchExt
 
 	off := 6
 	n := int(binary.BigEndian.Uint32(b[off : off+4]))
@@ -234,6 +531,16 @@ func DecodeBatch(b []byte) ([]BatchItem, error) {
 		}
 		off += fenceSize
 
+		var deps []Dep
+		if ext {
+			var x extSections
+			x, off, err = decodeExt(b, off, flagDeps)
+			if err != nil {
+				return nil, err
+			}
+			deps = x.deps
+		}
+
 		// vlen
 		if off+4 > len(b) {
 			return nil, ErrCorrupt
@@ -252,6 +559,7 @@ func DecodeBatch(b []byte) ([]BatchItem, error) {
 		items = append(items, BatchItem{
 			Key:     string(keyBytes), // one expected alloc per item
 			Fence:   f,
+			Deps:    deps,
 			Payload: payload,
 		})
 	}
@@ -264,6 +572,296 @@ func DecodeBatch(b []byte) ([]BatchItem, error) {
 	return items, nil
 }
 
+// depsSize returns the encoded size of a dependency section.
+func depsSize(deps []Dep) (int, error) {
+	if len(deps) > maxDeps {
+		return 0, errTooManyDeps
+	}
+	n := 2
+	for _, d := range deps {
+		l := len(d.Key)
+		if l == 0 || l > maxKeyLen {
+			return 0, fmt.Errorf("invalid dependency key length %d", l)
+		}
+		n += 2 + l + fenceSize
+	}
+	return n, nil
+}
+
+// putDeps writes a dependency section sized by depsSize at off and returns
+// the offset just past it.
+func putDeps(out []byte, off int, deps []Dep) int {
+	binary.BigEndian.PutUint16(out[off:off+2], uint16(len(deps)))
+	off += 2
+	for _, d := range deps {
+		binary.BigEndian.PutUint16(out[off:off+2], uint16(len(d.Key)))
+		off += 2
+		off += copy(out[off:], d.Key)
+		off += len(d.Fence.AppendBinary(out[off:off]))
+	}
+	return off
+}
+
+// extSize returns the encoded size of the flags byte and the optional
+// sections that follow it.
+func extSize(deps []Dep, t Timing, revision uint64) (int, error) {
+	n := 1
+	if revision != 0 {
+		n += revisionSize
+	}
+	if len(deps) != 0 {
+		dsz, err := depsSize(deps)
+		if err != nil {
+			return 0, err
+		}
+		n += dsz
+	}
+	if !t.IsZero() {
+		if t.TTL <= 0 || t.Delta <= 0 {
+			return 0, fmt.Errorf("invalid timing ttl=%v delta=%v", t.TTL, t.Delta)
+		}
+		n += timingSize
+	}
+	return n, nil
+}
+
+// putExt writes the flags byte and optional sections sized by extSize at off
+// and returns the offset just past them.
+func putExt(out []byte, off int, deps []Dep, t Timing, revision uint64) int {
+	flagsOff := off
+	off++
+	if revision != 0 {
+		out[flagsOff] |= flagRevision
+		binary.BigEndian.PutUint64(out[off:off+revisionSize], revision)
+		off += revisionSize
+	}
+	if len(deps) != 0 {
+		out[flagsOff] |= flagDeps
+		off = putDeps(out, off, deps)
+	}
+	if !t.IsZero() {
+		out[flagsOff] |= flagTiming
+		binary.BigEndian.PutUint64(out[off:off+8], uint64(t.WrittenAt.UnixNano()))
+		binary.BigEndian.PutUint64(out[off+8:off+16], uint64(t.TTL))
+		binary.BigEndian.PutUint64(out[off+16:off+24], uint64(t.Delta))
+		off += timingSize
+	}
+	return off
+}
+
+// extSections holds the optional sections of an extended item.
+type extSections struct {
+	deps     []Dep
+	timing   Timing
+	revision uint64
+}
+
+// decodeExt parses the flags byte and optional sections of an extended item
+// starting at off and returns the offset just past them. Flags outside
+// allowed are rejected.
+func decodeExt(b []byte, off int, allowed byte) (extSections, int, error) {
+	var x extSections
+	if off+1 > len(b) {
+		return x, 0, ErrCorrupt
+	}
+	flags := b[off]
+	off++
+	if flags&^allowed != 0 {
+		return x, 0, ErrCorrupt
+	}
+
+	if flags&flagRevision != 0 {
+		if off+revisionSize > len(b) {
+			return x, 0, ErrCorrupt
+		}
+		x.revision = binary.BigEndian.Uint64(b[off : off+revisionSize])
+		off += revisionSize
+		if x.revision == 0 {
+			return x, 0, ErrCorrupt
+		}
+	}
+
+	if flags&flagDeps != 0 {
+		var err error
+		if x.deps, off, err = decodeDeps(b, off); err != nil {
+			return x, 0, err
+		}
+	}
+	if flags&flagTiming != 0 {
+		if off+timingSize > len(b) {
+			return x, 0, ErrCorrupt
+		}
+		at := int64(binary.BigEndian.Uint64(b[off : off+8]))
+		ttl := time.Duration(binary.BigEndian.Uint64(b[off+8 : off+16]))
+		delta := time.Duration(binary.BigEndian.Uint64(b[off+16 : off+24]))
+		off += timingSize
+		if at == 0 || ttl <= 0 || delta <= 0 {
+			return x, 0, ErrCorrupt
+		}
+		x.timing = Timing{WrittenAt: time.Unix(0, at), TTL: ttl, Delta: delta}
+	}
+	return x, off, nil
+}
+
+// decodeDeps parses a dependency section starting at off and returns the
+// offset just past it.
+func decodeDeps(b []byte, off int) ([]Dep, int, error) {
+	if off+2 > len(b) {
+		return nil, 0, ErrCorrupt
+	}
+	n := int(binary.BigEndian.Uint16(b[off : off+2]))
+	off += 2
+	if n == 0 || n > (len(b)-off)/minDepSize {
+		return nil, 0, ErrCorrupt
+	}
+
+	deps := make([]Dep, 0, n)
+	for range n {
+		if off+2 > len(b) {
+			return nil, 0, ErrCorrupt
+		}
+		klen := int(binary.BigEndian.Uint16(b[off : off+2]))
+		off += 2
+		if klen <= 0 || klen > len(b)-off {
+			return nil, 0, ErrCorrupt
+		}
+		key := string(b[off : off+klen])
+		off += klen
+
+		if off+fenceSize > len(b) {
+			return nil, 0, ErrCorrupt
+		}
+		f, err := version.ParseFenceBinary(b[off : off+fenceSize])
+		if err != nil {
+			return nil, 0, ErrCorrupt
+		}
+		off += fenceSize
+		deps = append(deps, Dep{Key: key, Fence: f})
+	}
+	return deps, off, nil
+}
+
+// EncodeKeys encodes an ordered list of logical keys, the payload of a
+// collection entry.
+//
+// Layout (big-endian):
+//
+//	n(4) | [ klen(2) | key ]*n
+func EncodeKeys(keys []string) ([]byte, error) {
+	n, err := checkedUint32(uint64(len(keys)), "key count")
+	if err != nil {
+		return nil, err
+	}
+	size := 4
+	for _, k := range keys {
+		if len(k) > maxKeyLen {
+			return nil, fmt.Errorf("key length %d exceeds u16 wire limit", len(k))
+		}
+		size += 2 + len(k)
+	}
+
+	out := make([]byte, size)
+	binary.BigEndian.PutUint32(out[:4], n)
+	off := 4
+	for _, k := range keys {
+		binary.BigEndian.PutUint16(out[off:off+2], uint16(len(k)))
+		off += 2
+		off += copy(out[off:], k)
+	}
+	return out, nil
+}
+
+// DecodeKeys parses a list encoded by EncodeKeys.
+func DecodeKeys(b []byte) ([]string, error) {
+	if len(b) < 4 {
+		return nil, ErrCorrupt
+	}
+	n := int(binary.BigEndian.Uint32(b[:4]))
+	off := 4
+	if n > (len(b)-off)/2 {
+		return nil, ErrCorrupt
+	}
+
+	keys := make([]string, 0, n)
+	for range n {
+		if off+2 > len(b) {
+			return nil, ErrCorrupt
+		}
+		klen := int(binary.BigEndian.Uint16(b[off : off+2]))
+		off += 2
+		if klen > len(b)-off {
+			return nil, ErrCorrupt
+		}
+		keys = append(keys, string(b[off:off+klen]))
+		off += klen
+	}
+	if off != len(b) {
+		return nil, ErrCorrupt
+	}
+	return keys, nil
+}
+
+// EncodeKeySets encodes a list of key lists, each as EncodeKeys does; it is
+// the payload of the batch superset index.
+//
+// Layout (big-endian):
+//
+//	n(4) | [ len(4) | EncodeKeys(set) ]*n
+func EncodeKeySets(sets [][]string) ([]byte, error) {
+	n, err := checkedUint32(uint64(len(sets)), "set count")
+	if err != nil {
+		return nil, err
+	}
+	out := binary.BigEndian.AppendUint32(nil, n)
+	for _, set := range sets {
+		b, err := EncodeKeys(set)
+		if err != nil {
+			return nil, err
+		}
+		l, err := checkedUint32(uint64(len(b)), "set length")
+		if err != nil {
+			return nil, err
+		}
+		out = binary.BigEndian.AppendUint32(out, l)
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// DecodeKeySets parses a list encoded by EncodeKeySets.
+func DecodeKeySets(b []byte) ([][]string, error) {
+	if len(b) < 4 {
+		return nil, ErrCorrupt
+	}
+	n := int(binary.BigEndian.Uint32(b[:4]))
+	off := 4
+	if n > (len(b)-off)/8 {
+		return nil, ErrCorrupt
+	}
+
+	sets := make([][]string, 0, n)
+	for range n {
+		if off+4 > len(b) {
+			return nil, ErrCorrupt
+		}
+		l := int(binary.BigEndian.Uint32(b[off : off+4]))
+		off += 4
+		if l > len(b)-off {
+			return nil, ErrCorrupt
+		}
+		set, err := DecodeKeys(b[off : off+l])
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+		off += l
+	}
+	if off != len(b) {
+		return nil, ErrCorrupt
+	}
+	return sets, nil
+}
+
 func checkedUint32(n uint64, field string) (uint32, error) {
 	if n > maxUint32Wire {
 		return 0, fmt.Errorf("%s %d exceeds uint32 wire limit", field, n)
@@ -6,6 +6,7 @@ import (
 	"math"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/unkn0wn-root/cascache/v3/version"
 )
@@ -340,3 +341,403 @@ func TestBatchZeroCopyPayloadSlices(t *testing.T) {
 		t.Fatalf("expected zero-copy payload subslices into enc buffer")
 	}
 }
+
+func TestSingleEntryWithoutDepsUsesPlainLayout(t *testing.T) {
+	fence := fenceForVersionID(5)
+	enc, err := EncodeSingleEntry(SingleEntry{Fence: fence, Payload: []byte("v")})
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	if !bytes.Equal(enc, mustEncodeSingle(t, fence, []byte("v"))) {
+		t.Fatalf("entry without deps should encode exactly like EncodeSingle")
+	}
+
+	e, err := DecodeSingleEntry(enc)
+	if err != nil {
+		t.Fatalf("DecodeSingleEntry: %v", err)
+	}
+	if !e.Fence.Equal(fence) || len(e.Deps) != 0 || string(e.Payload) != "v" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
+
+func TestSingleEntryDepsRoundTrip(t *testing.T) {
+	in := SingleEntry{
+		Fence: fenceForVersionID(1),
+		Deps: []Dep{
+			{Key: "e:2:ns:", Fence: fenceForVersionID(2)},
+			{Key: "t:org:7", Fence: fenceForVersionID(3)},
+		},
+		Payload: []byte("hello"),
+	}
+	enc, err := EncodeSingleEntry(in)
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	if enc[5] != kindSingleExt {
+		t.Fatalf("kind=%d want %d", enc[5], kindSingleExt)
+	}
+
+	// the key fence stays at the plain-layout offset.
+	if f, err := version.ParseFenceBinary(enc[6 : 6+fenceSize]); err != nil || !f.Equal(in.Fence) {
+		t.Fatalf("fence not at fixed offset: %v", err)
+	}
+
+	got, err := DecodeSingleEntry(enc)
+	if err != nil {
+		t.Fatalf("DecodeSingleEntry: %v", err)
+	}
+	if !got.Fence.Equal(in.Fence) || !bytes.Equal(got.Payload, in.Payload) || len(got.Deps) != len(in.Deps) {
+		t.Fatalf("entry mismatch: got=%+v want=%+v", got, in)
+	}
+	for i := range in.Deps {
+		if got.Deps[i].Key != in.Deps[i].Key || !got.Deps[i].Fence.Equal(in.Deps[i].Fence) {
+			t.Fatalf("dep %d mismatch: got=%+v want=%+v", i, got.Deps[i], in.Deps[i])
+		}
+	}
+
+	if _, _, err := DecodeSingle(enc); err == nil {
+		t.Fatalf("DecodeSingle must not silently drop dependencies")
+	}
+}
+
+func TestSingleEntryRejectsCorruptExtensions(t *testing.T) {
+	enc, err := EncodeSingleEntry(SingleEntry{
+		Fence:   fenceForVersionID(1),
+		Deps:    []Dep{{Key: "e", Fence: fenceForVersionID(2)}},
+		Payload: []byte("x"),
+	})
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	flagsOff := 6 + fenceSize
+
+	unknown := append([]byte(nil), enc...)
+	unknown[flagsOff] |= 0x80
+	if _, err := DecodeSingleEntry(unknown); err == nil {
+		t.Fatalf("expected error on unknown flag bit")
+	}
+
+	zeroDeps := append([]byte(nil), enc...)
+	binary.BigEndian.PutUint16(zeroDeps[flagsOff+1:flagsOff+3], 0)
+	if _, err := DecodeSingleEntry(zeroDeps); err == nil {
+		t.Fatalf("expected error on empty dependency section")
+	}
+
+	manyDeps := append([]byte(nil), enc...)
+	binary.BigEndian.PutUint16(manyDeps[flagsOff+1:flagsOff+3], 9)
+	if _, err := DecodeSingleEntry(manyDeps); err == nil {
+		t.Fatalf("expected error on dependency count beyond buffer")
+	}
+
+	for i := len(enc) - 1; i > flagsOff; i-- {
+		if _, err := DecodeSingleEntry(enc[:i]); err == nil {
+			t.Fatalf("expected error on truncation at %d", i)
+		}
+	}
+}
+
+func TestEncodeSingleEntryRejectsBadDepKeys(t *testing.T) {
+	for _, key := range []string{"", strings.Repeat("k", 0x10000)} {
+		_, err := EncodeSingleEntry(SingleEntry{
+			Fence: fenceForVersionID(1),
+			Deps:  []Dep{{Key: key, Fence: fenceForVersionID(2)}},
+		})
+		if err == nil {
+			t.Fatalf("expected error for dependency key length %d", len(key))
+		}
+	}
+}
+
+func TestAbsentEntryRoundTrip(t *testing.T) {
+	for _, deps := range [][]Dep{nil, {{Key: "e:2:ns:", Fence: fenceForVersionID(2)}}} {
+		in := SingleEntry{Fence: fenceForVersionID(1), Deps: deps, Absent: true}
+		enc, err := EncodeSingleEntry(in)
+		if err != nil {
+			t.Fatalf("EncodeSingleEntry: %v", err)
+		}
+		if enc[5] != kindAbsent {
+			t.Fatalf("kind=%d want %d", enc[5], kindAbsent)
+		}
+		if f, err := version.ParseFenceBinary(enc[6 : 6+fenceSize]); err != nil || !f.Equal(in.Fence) {
+			t.Fatalf("fence not at fixed offset: %v", err)
+		}
+
+		got, err := DecodeSingleEntry(enc)
+		if err != nil {
+			t.Fatalf("DecodeSingleEntry: %v", err)
+		}
+		if !got.Absent || !got.Fence.Equal(in.Fence) || len(got.Payload) != 0 || len(got.Deps) != len(deps) {
+			t.Fatalf("entry mismatch: got=%+v want=%+v", got, in)
+		}
+
+		if _, _, err := DecodeSingle(enc); err == nil {
+			t.Fatalf("DecodeSingle must not read a tombstone as a value")
+		}
+		if _, err := DecodeSingleEntry(append(enc, 0)); err == nil {
+			t.Fatalf("expected error on trailing bytes")
+		}
+		for i := len(enc) - 1; i >= 0; i-- {
+			if _, err := DecodeSingleEntry(enc[:i]); err == nil {
+				t.Fatalf("expected error on truncation at %d", i)
+			}
+		}
+	}
+}
+
+func TestAbsentEntryRejectsPayload(t *testing.T) {
+	_, err := EncodeSingleEntry(SingleEntry{Fence: fenceForVersionID(1), Absent: true, Payload: []byte("x")})
+	if err == nil {
+		t.Fatalf("expected error for tombstone with payload")
+	}
+}
+
+func TestSingleEntryTimingRoundTrip(t *testing.T) {
+	tm := Timing{WrittenAt: time.Unix(1700000000, 123), TTL: time.Minute, Delta: 40 * time.Millisecond}
+	for _, deps := range [][]Dep{nil, {{Key: "e:2:ns:", Fence: fenceForVersionID(2)}}} {
+		in := SingleEntry{Fence: fenceForVersionID(1), Deps: deps, Timing: tm, Payload: []byte("v")}
+		if in.Plain() {
+			t.Fatalf("entry with timing must not use the plain layout")
+		}
+		enc, err := EncodeSingleEntry(in)
+		if err != nil {
+			t.Fatalf("EncodeSingleEntry: %v", err)
+		}
+		if enc[5] != kindSingleExt {
+			t.Fatalf("kind=%d want %d", enc[5], kindSingleExt)
+		}
+
+		got, err := DecodeSingleEntry(enc)
+		if err != nil {
+			t.Fatalf("DecodeSingleEntry: %v", err)
+		}
+		if !got.Timing.WrittenAt.Equal(tm.WrittenAt) || got.Timing.TTL != tm.TTL || got.Timing.Delta != tm.Delta {
+			t.Fatalf("timing mismatch: got=%+v want=%+v", got.Timing, tm)
+		}
+		if len(got.Deps) != len(deps) || string(got.Payload) != "v" {
+			t.Fatalf("entry mismatch: %+v", got)
+		}
+		if !got.Timing.ExpiresAt().Equal(tm.WrittenAt.Add(time.Minute)) {
+			t.Fatalf("ExpiresAt=%v", got.Timing.ExpiresAt())
+		}
+
+		for i := len(enc) - 1; i >= 0; i-- {
+			if _, err := DecodeSingleEntry(enc[:i]); err == nil {
+				t.Fatalf("expected error on truncation at %d", i)
+			}
+		}
+	}
+}
+
+func TestTimingRejectedWhereUnsupported(t *testing.T) {
+	tm := Timing{WrittenAt: time.Unix(1, 0), TTL: time.Second, Delta: time.Millisecond}
+
+	if _, err := EncodeSingleEntry(SingleEntry{Fence: fenceForVersionID(1), Timing: tm, Absent: true}); err == nil {
+		t.Fatalf("expected error for tombstone with timing")
+	}
+	if _, err := EncodeSingleEntry(SingleEntry{Fence: fenceForVersionID(1), Timing: Timing{WrittenAt: time.Unix(1, 0)}}); err == nil {
+		t.Fatalf("expected error for timing without ttl and delta")
+	}
+
+	absent, err := EncodeSingleEntry(SingleEntry{Fence: fenceForVersionID(1), Absent: true})
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	absent[6+fenceSize] = flagTiming
+	absent = append(absent, make([]byte, timingSize)...)
+	if _, err := DecodeSingleEntry(absent); err == nil {
+		t.Fatalf("tombstone must reject the timing flag")
+	}
+
+	batch, err := EncodeBatch([]BatchItem{{Key: "a", Fence: fenceForVersionID(1), Deps: []Dep{{Key: "e", Fence: fenceForVersionID(2)}}}})
+	if err != nil {
+		t.Fatalf("EncodeBatch: %v", err)
+	}
+	batch[bHdr+2+1+fenceSize] |= flagTiming
+	if _, err := DecodeBatch(batch); err == nil {
+		t.Fatalf("batch items must reject the timing flag")
+	}
+}
+
+func TestBatchDepsRoundTrip(t *testing.T) {
+	items := []BatchItem{
+		{Key: "a", Fence: fenceForVersionID(1), Payload: []byte("x")},
+		{
+			Key:     "b",
+			Fence:   fenceForVersionID(2),
+			Deps:    []Dep{{Key: "e", Fence: fenceForVersionID(9)}},
+			Payload: []byte("y"),
+		},
+	}
+	enc, err := EncodeBatch(items)
+	if err != nil {
+		t.Fatalf("EncodeBatch: %v", err)
+	}
+	if enc[5] != kindBatchExt {
+		t.Fatalf("kind=%d want %d", enc[5], kindBatchExt)
+	}
+
+	got := mustDecodeBatch(t, enc)
+	if len(got) != 2 {
+		t.Fatalf("len=%d want 2", len(got))
+	}
+	if len(got[0].Deps) != 0 || string(got[0].Payload) != "x" {
+		t.Fatalf("item a mismatch: %+v", got[0])
+	}
+	if len(got[1].Deps) != 1 || got[1].Deps[0].Key != "e" ||
+		!got[1].Deps[0].Fence.Equal(fenceForVersionID(9)) || string(got[1].Payload) != "y" {
+		t.Fatalf("item b mismatch: %+v", got[1])
+	}
+
+	for i := len(enc) - 1; i > bHdr; i-- {
+		if _, err := DecodeBatch(enc[:i]); err == nil {
+			t.Fatalf("expected error on truncation at %d", i)
+		}
+	}
+}
+
+func TestSingleEntryRevisionRoundTrip(t *testing.T) {
+	tm := Timing{WrittenAt: time.Unix(1700000000, 0), TTL: time.Minute, Delta: time.Millisecond}
+	deps := []Dep{{Key: "e:2:ns:", Fence: fenceForVersionID(2)}}
+	for _, in := range []SingleEntry{
+		{Fence: fenceForVersionID(1), Revision: 42, Payload: []byte("v")},
+		{Fence: fenceForVersionID(1), Revision: math.MaxUint64, Deps: deps, Timing: tm, Payload: []byte("v")},
+		{Fence: fenceForVersionID(1), Revision: 7, Deps: deps, Absent: true},
+	} {
+		if in.Plain() {
+			t.Fatalf("entry with a revision must not use the plain layout")
+		}
+		enc, err := EncodeSingleEntry(in)
+		if err != nil {
+			t.Fatalf("EncodeSingleEntry: %v", err)
+		}
+		if got := PeekRevision(enc); got != in.Revision {
+			t.Fatalf("PeekRevision=%d want %d", got, in.Revision)
+		}
+		got, err := DecodeSingleEntry(enc)
+		if err != nil {
+			t.Fatalf("DecodeSingleEntry: %v", err)
+		}
+		if got.Revision != in.Revision || got.Absent != in.Absent || len(got.Deps) != len(in.Deps) {
+			t.Fatalf("entry mismatch: got=%+v want=%+v", got, in)
+		}
+		if !got.Timing.WrittenAt.Equal(in.Timing.WrittenAt) {
+			t.Fatalf("timing mismatch: got=%+v want=%+v", got.Timing, in.Timing)
+		}
+	}
+
+	if got := PeekRevision(mustEncodeSingle(t, fenceForVersionID(1), []byte("v"))); got != 0 {
+		t.Fatalf("PeekRevision(plain)=%d want 0", got)
+	}
+
+	enc, err := EncodeSingleEntry(SingleEntry{Fence: fenceForVersionID(1), Revision: 1, Payload: []byte("v")})
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	binary.BigEndian.PutUint64(enc[revisionOff:], 0)
+	if _, err := DecodeSingleEntry(enc); err == nil {
+		t.Fatalf("expected error for a zero revision section")
+	}
+}
+
+// The Redis compare script reads revisions at these offsets; a layout change
+// must be a deliberate wire version bump that updates this test.
+func TestRevisionLayoutIsPinned(t *testing.T) {
+	if Version != 3 || KindSingleExt != 3 || KindAbsent != 5 || FlagRevision != 4 ||
+		FlagsOffset != 22 || RevisionOffset != 23 || RevisionEnd != 31 {
+		t.Fatalf("revision layout changed: version=%d kinds=%d,%d flag=%d offsets=%d,%d,%d",
+			Version, KindSingleExt, KindAbsent, FlagRevision, FlagsOffset, RevisionOffset, RevisionEnd)
+	}
+
+	const rev = 0x0102030405060708
+	for _, in := range []SingleEntry{
+		{Fence: fenceForVersionID(1), Revision: rev, Payload: []byte("v")},
+		{
+			Fence:    fenceForVersionID(1),
+			Revision: rev,
+			Deps:     []Dep{{Key: "e", Fence: fenceForVersionID(2)}},
+			Timing:   Timing{WrittenAt: time.Unix(1, 0), TTL: time.Second, Delta: time.Millisecond},
+			Payload:  []byte("v"),
+		},
+		{Fence: fenceForVersionID(1), Revision: rev, Absent: true},
+	} {
+		enc, err := EncodeSingleEntry(in)
+		if err != nil {
+			t.Fatalf("EncodeSingleEntry: %v", err)
+		}
+		kind := byte(KindSingleExt)
+		if in.Absent {
+			kind = KindAbsent
+		}
+		if len(enc) < RevisionEnd || string(enc[:4]) != "CASC" || enc[4] != Version || enc[5] != kind {
+			t.Fatalf("header of %+v moved: % x", in, enc)
+		}
+		if enc[FlagsOffset]&FlagRevision == 0 {
+			t.Fatalf("revision flag of %+v not at offset %d: % x", in, FlagsOffset, enc)
+		}
+		if got := binary.BigEndian.Uint64(enc[RevisionOffset:RevisionEnd]); got != rev {
+			t.Fatalf("revision of %+v at offset %d=%#x", in, RevisionOffset, got)
+		}
+	}
+}
+
+func TestRevisionRejectedInBatch(t *testing.T) {
+	batch, err := EncodeBatch([]BatchItem{{Key: "a", Fence: fenceForVersionID(1), Deps: []Dep{{Key: "e", Fence: fenceForVersionID(2)}}}})
+	if err != nil {
+		t.Fatalf("EncodeBatch: %v", err)
+	}
+	batch[bHdr+2+1+fenceSize] |= flagRevision
+	if _, err := DecodeBatch(batch); err == nil {
+		t.Fatalf("batch items must reject the revision flag")
+	}
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	for _, keys := range [][]string{{}, {"b", "a", "", "order:42"}} {
+		b, err := EncodeKeys(keys)
+		if err != nil {
+			t.Fatalf("EncodeKeys: %v", err)
+		}
+		got, err := DecodeKeys(b)
+		if err != nil {
+			t.Fatalf("DecodeKeys: %v", err)
+		}
+		if len(got) != len(keys) {
+			t.Fatalf("DecodeKeys=%q want %q", got, keys)
+		}
+		for i := range keys {
+			if got[i] != keys[i] {
+				t.Fatalf("DecodeKeys=%q want %q", got, keys)
+			}
+		}
+		if _, err := DecodeKeys(append(b, 0)); err != ErrCorrupt {
+			t.Fatalf("trailing byte err=%v want ErrCorrupt", err)
+		}
+	}
+	if _, err := DecodeKeys([]byte{0, 0, 0, 9, 0, 1}); err != ErrCorrupt {
+		t.Fatalf("short list err=%v want ErrCorrupt", err)
+	}
+}
+
+func TestKeySetsRoundTrip(t *testing.T) {
+	sets := [][]string{{"a", "b", "c"}, {}, {"order:42"}}
+	b, err := EncodeKeySets(sets)
+	if err != nil {
+		t.Fatalf("EncodeKeySets: %v", err)
+	}
+	got, err := DecodeKeySets(b)
+	if err != nil {
+		t.Fatalf("DecodeKeySets: %v", err)
+	}
+	if len(got) != len(sets) {
+		t.Fatalf("DecodeKeySets=%q want %q", got, sets)
+	}
+	for i := range sets {
+		if strings.Join(got[i], ",") != strings.Join(sets[i], ",") {
+			t.Fatalf("DecodeKeySets=%q want %q", got, sets)
+		}
+	}
+	if _, err := DecodeKeySets(b[:len(b)-1]); err != ErrCorrupt {
+		t.Fatalf("truncated err=%v want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,127 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+)
+
+// Fill leases keep a miss from reaching the source once per process. With
+// Options.FillLeaseTTL, GetOrLoad asks the version store for a short-lived
+// lease stored next to the key's fence. The holder loads and writes; other
+// callers, in this process or any other, poll the cache instead. Writes that
+// do not carry the current lease are rejected while it is held, and a stored
+// write, an Invalidate, or expiry ends it.
+
+const (
+	leasePollMin = 5 * time.Millisecond
+	leasePollMax = 100 * time.Millisecond
+)
+
+// AcquireFill is SnapshotVersion for callers about to load key from the
+// source. With Options.FillLeaseTTL it also asks for the key's fill lease:
+// granted=true means the returned version carries the lease and a
+// SetIfVersion with it is accepted; granted=false means another caller is
+// filling the key, so read the cache again shortly instead of loading. Writes
+// with a version that does not carry the lease report WriteOutcomeLeaseHeld
+// until the holder writes, the key is invalidated, or the lease expires.
+//
+// A backend-native KeyWriter checks the lease in the same atomic step as the
+// fence. The generic write path reads the lease holder and then the fence
+// before writing, so a lease granted between those reads and the write is not
+// seen and both writes may land; both carry the same fence, so neither is
+// stale.
+//
+// Without FillLeaseTTL it returns SnapshotVersion and granted=true.
+func (c *cache[V]) AcquireFill(ctx context.Context, key string) (Version, bool, error) {
+	if c.leaser == nil {
+		v, err := c.SnapshotVersion(ctx, key)
+		return v, err == nil, err
+	}
+
+	snap, granted, err := c.leaser.AcquireLease(ctx, c.versionKey(key), c.leaseTTL)
+	if err != nil {
+		c.hooks.VersionSnapshotError(1, err)
+		return Version{}, false, opError(OpSnapshot, key, err)
+	}
+	v := versionFromSnapshot(snap)
+
+	deps := c.keyDeps(key)
+	if len(deps) == 0 {
+		return v, granted, nil
+	}
+	snaps, err := c.loadBatch(ctx, deps)
+	if err == nil {
+		var observed []wire.Dep
+		observed, err = c.snapshotDeps(ctx, deps, snaps)
+		v = v.withDeps(observed)
+	}
+	if err != nil {
+		if granted {
+			c.releaseFill(ctx, key, v)
+		}
+		return Version{}, false, opError(OpSnapshot, key, err)
+	}
+	return v, granted, nil
+}
+
+// awaitFill acquires key's fill lease for fillSingle, polling the cache with
+// backoff while another caller holds it. served reports that the wait ended
+// with a cached value or tombstone, which has been published on call.
+func (c *cache[V]) awaitFill(ctx context.Context, key string, call *flightCall[V]) (Version, bool, error) {
+	wait := leasePollMin
+	for {
+		v, granted, err := c.AcquireFill(ctx, key)
+		if err != nil || granted {
+			return v, false, err
+		}
+		call.leaseWaited = true
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return Version{}, false, ctx.Err()
+		}
+		wait = min(2*wait, leasePollMax)
+
+		r, err := c.readSingle(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			call.hit, call.err = true, err
+			return Version{}, true, nil
+		}
+		if err != nil {
+			return Version{}, false, err
+		}
+		if r.ok {
+			call.val, call.found, call.hit, call.err = r.v, true, true, nil
+			return Version{}, true, nil
+		}
+	}
+}
+
+// leaseHeld reports whether another caller holds key's fill lease, for write
+// paths that cannot check it atomically with the write.
+func (c *cache[V]) leaseHeld(ctx context.Context, key string, v Version) (bool, error) {
+	if c.leaser == nil {
+		return false, nil
+	}
+	holder, err := c.leaser.LeaseHolder(ctx, c.versionKey(key))
+	if err != nil {
+		c.hooks.VersionSnapshotError(1, err)
+		return false, err
+	}
+	return holder != "" && holder != v.lease, nil
+}
+
+// releaseFill drops the lease v carries so waiting callers can load without
+// waiting for it to expire. Failures only delay them until expiry.
+func (c *cache[V]) releaseFill(ctx context.Context, key string, v Version) {
+	if c.leaser == nil || v.lease == "" {
+		return
+	}
+	_ = c.leaser.ReleaseLease(context.WithoutCancel(ctx), c.versionKey(key), v.lease)
+}
@@ -0,0 +1,332 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// GetOrLoad returns the cached value for key, or loads and fills it on a miss.
+//
+// The fill follows the same sequence callers would otherwise write by hand:
+//
+//  1. Get the key. A validated hit is returned immediately.
+//  2. SnapshotVersion before calling load, so a concurrent Invalidate is
+//     observed as a version change. With Options.FillLeaseTTL this is
+//     AcquireFill, and callers that do not get the lease wait for the
+//     holder's value instead (LoadResult.LeaseWaited).
+//  3. Call load to read the source of truth.
+//  4. SetIfVersion with the snapshotted version. A mismatch means the key was
+//     invalidated while loading; the loaded value is still returned but is not
+//     cached.
+//
+// Concurrent misses for the same key inside this process are coalesced onto
+// one load. Waiting callers receive the leader's value and errors with
+// LoadResult.Shared set, and return early if their own ctx is done. When the
+// leader's ctx is canceled or times out, waiters do not receive its ctx error
+// but fill the key themselves.
+//
+// Get and SnapshotVersion failures are returned as errors, exactly like the
+// manual sequence. Errors returned by load are passed through unchanged. Fill
+// failures are reported through LoadResult instead of the error.
+//
+// Stale-while-revalidate: with Options.MaxStale, a miss on a key invalidated
+// within MaxStale returns the previous value with LoadResult.Stale set and
+// starts one background fill instead. Errors from that fill are not reported;
+// Close cancels it and waits for it to exit.
+//
+// Early refresh: with Options.EarlyRefreshBeta, fills record the write time
+// and how long load took. A hit close to its TTL then starts one background
+// fill with a probability that rises towards expiry (XFetch), and reports
+// LoadResult.EarlyRefresh. The fill snapshots and writes with SetIfVersion
+// like any other, so it never overwrites a newer invalidation.
+//
+// Negative caching: when load returns ErrNotFound, the absence is recorded
+// with SetAbsentIfVersion and the error is returned. Later calls serve the
+// tombstone as a hit that returns ErrNotFound without calling load, until it
+// expires after Options.NegativeTTL or the key is invalidated.
+func (c *cache[V]) GetOrLoad(ctx context.Context, key string, load LoadFunc[V]) (V, LoadResult, error) {
+	var zero V
+
+	r, err := c.readSingle(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return zero, LoadResult{Hit: true}, err
+	}
+	if err != nil {
+		return zero, LoadResult{}, err
+	}
+	if r.ok {
+		res := LoadResult{Hit: true}
+		if c.refreshEarly(r.timing) {
+			res.EarlyRefresh = c.refreshAsync(ctx, key, load)
+		}
+		return r.v, res, nil
+	}
+	if c.maxStale > 0 {
+		if v, ok := c.getStale(ctx, key); ok {
+			c.refreshAsync(ctx, key, load)
+			return v, LoadResult{Stale: true}, nil
+		}
+	}
+
+	for {
+		call, leader := c.fills.join(key)
+		if leader {
+			c.fillSingle(ctx, key, load, call, false)
+			return call.val, LoadResult{
+				Hit:         call.hit,
+				LeaseWaited: call.leaseWaited,
+				Write:       call.write,
+				FillErr:     call.fillErr,
+			}, call.err
+		}
+
+		if err := call.wait(ctx); err != nil {
+			return zero, LoadResult{}, err
+		}
+		// A GetManyOrLoad leader whose loader did not return this key, or a
+		// leader whose ctx ended its fill, has nothing to share, so run our
+		// own load instead.
+		if call.abandoned || (call.err == nil && !call.found) {
+			continue
+		}
+		return call.val, LoadResult{
+			Shared:      true,
+			LeaseWaited: call.leaseWaited,
+			Write:       call.write,
+			FillErr:     call.fillErr,
+		}, call.err
+	}
+}
+
+// fillSingle runs one coalesced load for key and publishes its result on call.
+// The call starts out as ErrLoadAborted so waiters never observe a zero value
+// as a success if load panics. A fill lease it acquired is released unless
+// the write stored, which ends the lease by itself.
+func (c *cache[V]) fillSingle(
+	ctx context.Context,
+	key string,
+	load LoadFunc[V],
+	call *flightCall[V],
+	background bool,
+) {
+	defer c.fills.finish(key, call)
+	defer func() { call.abandon(ctx, call.err) }()
+
+	obs, done, err := c.fillVersion(ctx, key, call, background)
+	if err != nil {
+		call.err = err
+		return
+	}
+	if done {
+		return
+	}
+	defer func() {
+		if !call.write.Stored() {
+			c.releaseFill(ctx, key, obs)
+		}
+	}()
+
+	start := time.Now()
+	v, err := load(ctx)
+	delta := time.Since(start)
+	if errors.Is(err, ErrNotFound) {
+		call.err = err
+		call.write, call.fillErr = c.SetAbsentIfVersion(ctx, key, obs)
+		return
+	}
+	if err != nil {
+		call.err = err
+		return
+	}
+
+	call.val, call.found, call.err = v, true, nil
+	call.write, call.fillErr = c.setValue(ctx, key, v, obs, c.defaultTTL, delta)
+}
+
+// fillVersion snapshots key for fillSingle. With fill leases a foreground
+// fill waits for the lease, and a background fill gives up when another
+// caller holds it; done reports that the result is already on call.
+func (c *cache[V]) fillVersion(
+	ctx context.Context,
+	key string,
+	call *flightCall[V],
+	background bool,
+) (Version, bool, error) {
+	switch {
+	case c.leaser == nil:
+		v, err := c.SnapshotVersion(ctx, key)
+		return v, false, err
+	case background:
+		v, granted, err := c.AcquireFill(ctx, key)
+		if err == nil && !granted {
+			call.err = nil
+			return Version{}, true, nil
+		}
+		return v, false, err
+	default:
+		return c.awaitFill(ctx, key, call)
+	}
+}
+
+// GetManyOrLoad returns cached values for keys and loads the misses in one
+// loader call.
+//
+// The fill follows the same sequence as GetOrLoad in batch form: GetMany,
+// SnapshotVersions for the missing keys, load, then SetIfVersions with the
+// snapshotted versions. The write honors BatchWriteSeed exactly like a direct
+// SetIfVersions call, and per-key outcomes are reported in the result.
+//
+// Misses that are already being loaded by a concurrent GetOrLoad or
+// GetManyOrLoad call in this process are not passed to load again; this call
+// waits for those keys instead, and loads them itself when that caller's ctx
+// ended its fill. Keys the loader does not return, and keys such a caller
+// found absent, are reported in BatchLoadResult.Missing.
+//
+// Fill leases (Options.FillLeaseTTL) are not taken: misses are loaded by this
+// call even while another caller holds their lease.
+//
+// With Options.EarlyRefreshBeta, the single entries the fill writes record
+// how long load took, so later GetOrLoad hits on them refresh early. Hits
+// served by GetManyOrLoad itself never start a refresh.
+//
+// GetMany and SnapshotVersions failures, and errors returned by load, are
+// returned as the error alongside any values that were already resolved.
+func (c *cache[V]) GetManyOrLoad(
+	ctx context.Context,
+	keys []string,
+	load BatchLoadFunc[V],
+) (map[string]V, BatchLoadResult, error) {
+	out, missing, err := c.GetMany(ctx, keys)
+	if err != nil {
+		return out, BatchLoadResult{Missing: missing}, err
+	}
+	if len(missing) == 0 {
+		return out, BatchLoadResult{}, nil
+	}
+
+	us := sortedUnique(missing)
+	calls := make(map[string]*flightCall[V], len(us))
+	var firstErr error
+	for pending := us; len(pending) != 0; {
+		owned := make([]string, 0, len(pending))
+		var waits []string
+		for _, k := range pending {
+			call, leader := c.fills.join(k)
+			calls[k] = call
+			if leader {
+				owned = append(owned, k)
+			} else {
+				waits = append(waits, k)
+			}
+		}
+
+		// Fill owned keys before waiting on others so two overlapping
+		// callers can never wait on each other.
+		if len(owned) != 0 {
+			c.fillMany(ctx, owned, calls, load)
+		}
+
+		pending = nil
+		for _, k := range waits {
+			if err := calls[k].wait(ctx); err != nil {
+				delete(calls, k)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if calls[k].abandoned {
+				pending = append(pending, k)
+			}
+		}
+	}
+
+	res := BatchLoadResult{
+		Missing:  make([]string, 0, len(missing)),
+		Outcomes: make(map[string]WriteOutcome, len(calls)),
+	}
+	for _, k := range us {
+		call, ok := calls[k]
+		if !ok {
+			continue
+		}
+		if call.err != nil && !errors.Is(call.err, ErrNotFound) && firstErr == nil {
+			firstErr = call.err
+		}
+		if call.found {
+			res.Outcomes[k] = call.write.Outcome
+		}
+		if call.fillErr != nil && res.FillErr == nil {
+			res.FillErr = call.fillErr
+		}
+	}
+	for _, k := range missing { // preserve caller order and duplicates
+		if call, ok := calls[k]; ok && call.found {
+			out[k] = call.val
+			continue
+		}
+		res.Missing = append(res.Missing, k)
+	}
+	return out, res, firstErr
+}
+
+// fillMany runs one coalesced batch load for the sorted, unique keys this
+// caller owns and publishes each key's result on its call.
+func (c *cache[V]) fillMany(
+	ctx context.Context,
+	keys []string,
+	calls map[string]*flightCall[V],
+	load BatchLoadFunc[V],
+) {
+	defer func() {
+		for _, k := range keys {
+			calls[k].abandon(ctx, calls[k].err)
+			c.fills.finish(k, calls[k])
+		}
+	}()
+
+	fail := func(err error) {
+		for _, k := range keys {
+			calls[k].err = err
+		}
+	}
+
+	obs, err := c.SnapshotVersions(ctx, keys)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	start := time.Now()
+	vals, err := load(ctx, slices.Clone(keys))
+	if err != nil {
+		fail(err)
+		return
+	}
+	delta := time.Since(start)
+
+	items := make([]VersionedValue[V], 0, len(vals))
+	for _, k := range keys {
+		call := calls[k]
+		call.err = nil
+		v, ok := vals[k]
+		if !ok {
+			continue
+		}
+		call.val, call.found = v, true
+		items = append(items, VersionedValue[V]{
+			Key:     k,
+			Value:   v,
+			Version: obs[k],
+		})
+	}
+
+	_, outcomes, fillErr := c.setIfVersions(ctx, items, 0, false, delta)
+	for _, it := range items {
+		call := calls[it.Key]
+		call.write = WriteResult{Outcome: outcomes[it.Key]}
+		call.fillErr = fillErr
+	}
+}
@@ -0,0 +1,127 @@
+package cascache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// The near cache keeps decoded single-key reads in process memory. It needs a
+// version store that implements version.Watcher: a near hit is validated
+// against the locally cached fences of the key and its dependencies, so it
+// costs no round trip until the watch reports a change. Entries are dropped
+// when their key changes, on every watch reset, and when this process
+// rewrites or invalidates the key. Hits share the decoded value; callers are
+// told to treat it as read-only (see Options.NearCacheSize).
+
+// nearEntry is one validated read kept in memory.
+type nearEntry[V any] struct {
+	r       singleRead[V]
+	absent  bool
+	expires time.Time
+}
+
+// nearCache is a bounded map of validated reads keyed by the single key's
+// version-store identity, so watch callbacks can drop entries directly.
+type nearCache[V any] struct {
+	mu        sync.Mutex
+	max       int
+	ttl       time.Duration
+	absentTTL time.Duration
+	entries   map[version.CacheKey]*nearEntry[V]
+}
+
+func newNearCache[V any](size int, ttl, absentTTL time.Duration) *nearCache[V] {
+	return &nearCache[V]{
+		max:       size,
+		ttl:       ttl,
+		absentTTL: min(ttl, absentTTL),
+		entries:   make(map[version.CacheKey]*nearEntry[V]),
+	}
+}
+
+// get returns the unexpired entry for key.
+func (n *nearCache[V]) get(key version.CacheKey) (*nearEntry[V], bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(n.entries, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// put stores a validated read. A full cache evicts an arbitrary entry.
+func (n *nearCache[V]) put(key version.CacheKey, r singleRead[V], absent bool) {
+	ttl := n.ttl
+	if absent {
+		ttl = n.absentTTL
+	}
+	e := &nearEntry[V]{r: r, absent: absent, expires: time.Now().Add(ttl)}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.entries[key]; !ok && len(n.entries) >= n.max {
+		for k := range n.entries {
+			delete(n.entries, k)
+			break
+		}
+	}
+	n.entries[key] = e
+}
+
+// drop removes e if it is still the entry stored for key.
+func (n *nearCache[V]) drop(key version.CacheKey, e *nearEntry[V]) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.entries[key] == e {
+		delete(n.entries, key)
+	}
+}
+
+// changed drops the entry for key, or every entry on reset.
+func (n *nearCache[V]) changed(key version.CacheKey, reset bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if reset {
+		clear(n.entries)
+		return
+	}
+	delete(n.entries, key)
+}
+
+// readNear serves key from the near cache when its fence and dependency
+// fences are still current and the read guard accepts it. served=false means
+// the caller must read the stored tiers; an entry that failed validation has
+// already been dropped.
+func (c *cache[V]) readNear(ctx context.Context, key string, ckey version.CacheKey) (singleRead[V], bool, error) {
+	e, ok := c.near.get(ckey)
+	if !ok {
+		return singleRead[V]{}, false, nil
+	}
+
+	deps := e.r.ver.deps.list()
+	snaps, err := c.fenceSnapshots(ctx, append([]version.CacheKey{ckey}, c.depsToLoad(deps)...))
+	if err != nil {
+		return singleRead[V]{}, false, nil
+	}
+	snap := snaps[ckey]
+	if !snap.Exists || !snap.Fence.Equal(e.r.ver.fence) || !c.depsCurrent(key, deps, snaps) {
+		c.near.drop(ckey, e)
+		return singleRead[V]{}, false, nil
+	}
+	if e.absent {
+		return e.r, true, ErrNotFound
+	}
+	if c.guardSingleRead(ctx, key, e.r.v) != "" {
+		c.near.drop(ckey, e)
+		return singleRead[V]{}, false, nil
+	}
+	return e.r, true, nil
+}
@@ -0,0 +1,86 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// GetManyOrdered is GetMany with results aligned to keys: values[i] holds the
+// value of keys[i] when found[i] is set and the zero value otherwise, so
+// callers need not map hits back onto their input. Duplicate keys are read
+// once and reported at every position.
+func (c *cache[V]) GetManyOrdered(ctx context.Context, keys []string) ([]V, []bool, error) {
+	out, _, err := c.GetMany(ctx, keys)
+	values := make([]V, len(keys))
+	found := make([]bool, len(keys))
+	for i, k := range keys {
+		values[i], found[i] = out[k]
+	}
+	return values, found, err
+}
+
+// GetManyIter is GetMany that streams hits instead of collecting them. The
+// returned sequence first yields the keys served from the batch entry, as
+// soon as the entry is validated, then runs the per-key fallback reads one at
+// a time and yields each hit as soon as its read is validated, so a caller
+// can start answering before the slowest read completes. Keys are yielded in
+// caller order within each phase, each distinct key at most once; misses are
+// not yielded. Stopping the loop early skips the remaining reads.
+//
+// The sequence reads the cache each time it is ranged over. The returned
+// function reports the error of the last run once the loop is done: the
+// batch read's error, which ends the run, or the per-key read errors joined,
+// which do not.
+func (c *cache[V]) GetManyIter(ctx context.Context, keys []string) (iter.Seq2[string, V], func() error) {
+	var err error
+	seq := func(yield func(string, V) bool) {
+		err = nil
+		if !c.enabled || len(keys) == 0 {
+			return
+		}
+
+		out := make(map[string]V, len(keys))
+		_, fallback, berr := c.readBatchEntry(ctx, keys, out, nil)
+		if berr != nil {
+			err = berr
+			return
+		}
+
+		seen := make(map[string]struct{}, len(keys))
+		for _, k := range keys {
+			v, ok := out[k]
+			if _, dup := seen[k]; !ok || dup {
+				continue
+			}
+			seen[k] = struct{}{}
+			if c.outbox.missing(k) {
+				continue
+			}
+			if !yield(k, v) {
+				return
+			}
+		}
+
+		var errs []error
+		defer func() { err = errors.Join(errs...) }()
+		for _, k := range fallback {
+			if _, dup := seen[k]; dup {
+				continue
+			}
+			seen[k] = struct{}{}
+			v, ok, gerr := c.Get(ctx, k)
+			if errors.Is(gerr, ErrNotFound) {
+				gerr = nil // tombstones are misses in batch reads
+			}
+			if gerr != nil {
+				errs = append(errs, gerr)
+				continue
+			}
+			if ok && !yield(k, v) {
+				return
+			}
+		}
+	}
+	return seq, func() error { return err }
+}
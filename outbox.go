@@ -0,0 +1,321 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/outbox"
+)
+
+// OutboxOptions configures an InvalidationOutbox.
+type OutboxOptions struct {
+	// Store persists queued keys. Default outbox.NewMemory(), which loses
+	// them on restart; use outbox.NewFile or outbox.NewSQL to keep them.
+	Store outbox.Store
+
+	// RetryInterval is the delay before a key's first retry, doubled after
+	// every failed retry up to MaxRetryInterval. Defaults 100ms and 30s.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// MissWhilePending makes reads treat keys waiting in the outbox as
+	// misses, so a value that may have outlived its source write is not
+	// served until the retry succeeds. Only this process's queue is
+	// consulted.
+	MissWhilePending bool
+}
+
+// InvalidationOutbox keeps failed invalidations and retries them until they
+// succeed. Set it as Options.Outbox: every key whose Invalidate or
+// InvalidateMany fails is persisted to the Store before the error is
+// returned (InvalidateError.Queued reports it), and a background loop calls
+// Invalidate for it again with exponential backoff. Keys found in the Store
+// when the cache is constructed, left by an earlier process, are retried
+// right away. The queue depth is reported to hooks implementing OutboxHooks.
+// A Store implementing outbox.DueStore also keeps the delayed follow-up
+// invalidations still waiting when the cache closes.
+//
+// Retrying is always safe: an extra invalidation costs one miss. An outbox
+// serves one cache; the cache closes its Store on Close.
+type InvalidationOutbox struct {
+	store       outbox.Store
+	base        time.Duration
+	maxWait     time.Duration
+	missPending bool
+
+	// storeMu orders Store writes with the entry changes they record, so a
+	// key enqueued again while its retry finishes is never removed from the
+	// Store after being added back.
+	storeMu sync.Mutex
+
+	mu      sync.Mutex
+	entries map[string]*outboxEntry
+	bound   bool
+	hooks   OutboxHooks
+	retry   func(context.Context, string) error
+	wake    chan struct{}
+}
+
+// outboxEntry is a queued key's retry schedule. gen counts enqueues so a
+// retry that raced with a newer failure does not drop it.
+type outboxEntry struct {
+	next time.Time
+	wait time.Duration
+	gen  uint64
+}
+
+// NewInvalidationOutbox returns an outbox to pass as Options.Outbox.
+func NewInvalidationOutbox(opts OutboxOptions) *InvalidationOutbox {
+	o := &InvalidationOutbox{
+		store:       opts.Store,
+		base:        coalesce(opts.RetryInterval, 100*time.Millisecond),
+		maxWait:     coalesce(opts.MaxRetryInterval, 30*time.Second),
+		missPending: opts.MissWhilePending,
+		entries:     make(map[string]*outboxEntry),
+		hooks:       NopHooks{},
+		wake:        make(chan struct{}, 1),
+	}
+	if o.store == nil {
+		o.store = outbox.NewMemory()
+	}
+	return o
+}
+
+// Depth returns the number of keys waiting to be retried.
+func (o *InvalidationOutbox) Depth() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+// Pending reports whether key is waiting to be retried.
+func (o *InvalidationOutbox) Pending(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.entries[key]
+	return ok
+}
+
+// missing reports whether reads must treat key as a miss.
+func (o *InvalidationOutbox) missing(key string) bool {
+	return o != nil && o.missPending && o.Pending(key)
+}
+
+// bind attaches the outbox to the cache that retries its keys and loads the
+// keys an earlier process left in the Store. A failed Load leaves the outbox
+// unbound.
+func (o *InvalidationOutbox) bind(ctx context.Context, hooks Hooks, retry func(context.Context, string) error) error {
+	o.mu.Lock()
+	if o.bound {
+		o.mu.Unlock()
+		return ErrOutboxInUse
+	}
+	o.bound = true
+	if oh, ok := hooks.(OutboxHooks); ok {
+		o.hooks = oh
+	}
+	o.retry = retry
+	o.mu.Unlock()
+
+	keys, err := o.store.Load(ctx)
+	if err != nil {
+		o.unbind()
+		return err
+	}
+	o.schedule(keys, 0)
+	return nil
+}
+
+// unbind detaches the outbox from a cache that New did not return, so it can
+// be passed to New again. Loaded keys are dropped; the next bind loads them
+// from the Store.
+func (o *InvalidationOutbox) unbind() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bound = false
+	o.hooks = NopHooks{}
+	o.retry = nil
+	clear(o.entries)
+}
+
+// enqueue persists keys and schedules their first retry.
+func (o *InvalidationOutbox) enqueue(ctx context.Context, keys []string) error {
+	o.storeMu.Lock()
+	defer o.storeMu.Unlock()
+	if err := o.store.Add(ctx, keys); err != nil {
+		return err
+	}
+	o.schedule(keys, o.base)
+	return nil
+}
+
+func (o *InvalidationOutbox) schedule(keys []string, delay time.Duration) {
+	if len(keys) == 0 {
+		return
+	}
+	now := time.Now()
+	o.mu.Lock()
+	for _, k := range keys {
+		e, ok := o.entries[k]
+		if !ok {
+			e = &outboxEntry{wait: o.base}
+			o.entries[k] = e
+		}
+		e.gen++
+		e.next = now.Add(delay)
+	}
+	depth := len(o.entries)
+	o.mu.Unlock()
+
+	o.hooks.OutboxDepth(depth)
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run retries due keys until ctx is canceled.
+func (o *InvalidationOutbox) run(ctx context.Context) {
+	t := time.NewTimer(0)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-o.wake:
+		case <-ctx.Done():
+			return
+		}
+		next := o.retryDue(ctx)
+
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		if next > 0 {
+			t.Reset(next)
+		}
+	}
+}
+
+// retryDue invalidates every key whose retry is due and returns the delay
+// until the next one, or 0 when the queue is empty.
+func (o *InvalidationOutbox) retryDue(ctx context.Context) time.Duration {
+	type due struct {
+		key string
+		gen uint64
+	}
+
+	now := time.Now()
+	var ds []due
+	o.mu.Lock()
+	for k, e := range o.entries {
+		if !e.next.After(now) {
+			ds = append(ds, due{k, e.gen})
+		}
+	}
+	o.mu.Unlock()
+
+	var ok []due
+	for _, d := range ds {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := o.retry(ctx, d.key); err == nil {
+			ok = append(ok, d)
+			continue
+		}
+		o.mu.Lock()
+		if e, queued := o.entries[d.key]; queued {
+			e.wait = min(2*e.wait, o.maxWait)
+			e.next = time.Now().Add(e.wait)
+		}
+		o.mu.Unlock()
+	}
+
+	if len(ok) > 0 {
+		// Keys enqueued again since their retry started keep their entry;
+		// holding storeMu keeps an enqueue from landing in between.
+		o.storeMu.Lock()
+		var done []string
+		o.mu.Lock()
+		for _, d := range ok {
+			if e, queued := o.entries[d.key]; queued && e.gen == d.gen {
+				delete(o.entries, d.key)
+				done = append(done, d.key)
+			}
+		}
+		o.mu.Unlock()
+		if len(done) > 0 {
+			// A failed Remove only costs another invalidation after a restart.
+			_ = o.store.Remove(ctx, done)
+		}
+		o.storeMu.Unlock()
+		o.hooks.OutboxDepth(o.Depth())
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var next time.Time
+	for _, e := range o.entries {
+		if next.IsZero() || e.next.Before(next) {
+			next = e.next
+		}
+	}
+	if next.IsZero() {
+		return 0
+	}
+	return max(time.Until(next), time.Millisecond)
+}
+
+// addDue persists delayed invalidations in a Store implementing
+// outbox.DueStore, and returns errors.ErrUnsupported for any other Store.
+func (o *InvalidationOutbox) addDue(ctx context.Context, ds []outbox.Due) error {
+	s, ok := o.store.(outbox.DueStore)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return s.AddDue(ctx, ds)
+}
+
+func (o *InvalidationOutbox) removeDue(ctx context.Context, ds []outbox.Due) error {
+	s, ok := o.store.(outbox.DueStore)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return s.RemoveDue(ctx, ds)
+}
+
+func (o *InvalidationOutbox) loadDue(ctx context.Context) ([]outbox.Due, error) {
+	s, ok := o.store.(outbox.DueStore)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return s.LoadDue(ctx)
+}
+
+func (o *InvalidationOutbox) close(ctx context.Context) error {
+	return o.store.Close(ctx)
+}
+
+// queueInvalidations hands failed invalidations to the outbox, marking the
+// accepted ones Queued. The caller's cancellation does not stop the write:
+// it is often what made the invalidation fail.
+func (c *cache[V]) queueInvalidations(ctx context.Context, failed ...*InvalidateError) {
+	if c.outbox == nil || len(failed) == 0 {
+		return
+	}
+	keys := make([]string, len(failed))
+	for i, ie := range failed {
+		keys[i] = ie.Key
+	}
+	if err := c.outbox.enqueue(context.WithoutCancel(ctx), keys); err != nil {
+		return
+	}
+	for _, ie := range failed {
+		ie.Queued = true
+	}
+}
@@ -0,0 +1,335 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compactSlack is how many records beyond the live keys the log may hold
+// before Remove rewrites it.
+const compactSlack = 1024
+
+// File is a Store backed by an append-only log on local disk. Every Add and
+// Remove appends one line per key, "+" or "-" followed by the Go-quoted key,
+// and syncs the file before returning. Delayed invalidations use ">" and "<"
+// followed by the due time in Unix nanoseconds and the quoted key. The log is
+// replayed and compacted on open, and compacted again once removed records
+// dominate it.
+//
+// A File must not be opened by more than one process at a time.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	f       *os.File
+	keys    map[string]struct{}
+	due     map[dueRecord]struct{}
+	records int
+
+	// size is the length of the log up to the end of its last complete
+	// record.
+	size int64
+}
+
+var (
+	_ Store    = (*File)(nil)
+	_ DueStore = (*File)(nil)
+)
+
+// dueRecord is a Due with its time in Unix nanoseconds, usable as a map key.
+type dueRecord struct {
+	key string
+	at  int64
+}
+
+// NewFile opens or creates the log at path. A torn final record, left by a
+// crash during an append, is dropped.
+func NewFile(path string) (*File, error) {
+	s := &File{
+		path: path,
+		keys: make(map[string]struct{}),
+		due:  make(map[dueRecord]struct{}),
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *File) replay() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, raw := range lines {
+		if len(raw) == 0 {
+			continue
+		}
+		rec := string(raw)
+		d, err := parseRecord(rec)
+		if err != nil {
+			if i == len(lines)-1 {
+				break // torn final record: no trailing newline
+			}
+			return fmt.Errorf("outbox: %s:%d: %w", s.path, i+1, err)
+		}
+		switch rec[0] {
+		case '+':
+			s.keys[d.key] = struct{}{}
+		case '-':
+			delete(s.keys, d.key)
+		case '>':
+			s.due[d] = struct{}{}
+		case '<':
+			delete(s.due, d)
+		}
+	}
+	return nil
+}
+
+func parseRecord(rec string) (dueRecord, error) {
+	if len(rec) < 3 {
+		return dueRecord{}, errors.New("malformed record")
+	}
+	var d dueRecord
+	quoted := rec[1:]
+	switch rec[0] {
+	case '+', '-':
+	case '>', '<':
+		i := strings.IndexByte(quoted, '"')
+		if i < 1 {
+			return dueRecord{}, errors.New("malformed record")
+		}
+		at, err := strconv.ParseInt(quoted[:i], 10, 64)
+		if err != nil {
+			return dueRecord{}, err
+		}
+		d.at, quoted = at, quoted[i:]
+	default:
+		return dueRecord{}, errors.New("malformed record")
+	}
+	k, err := strconv.Unquote(quoted)
+	if err != nil {
+		return dueRecord{}, err
+	}
+	d.key = k
+	return d, nil
+}
+
+// compact rewrites the log with one record per live key and reopens it for
+// appending. The new log replaces the old one atomically.
+func (s *File) compact() error {
+	var buf []byte
+	for k := range s.keys {
+		buf = appendRecord(buf, '+', k)
+	}
+	for d := range s.due {
+		buf = appendDueRecord(buf, '>', d)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(s.path))
+
+	nf, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.f != nil {
+		_ = s.f.Close()
+	}
+	s.f = nf
+	s.records = len(s.keys) + len(s.due)
+	s.size = int64(len(buf))
+	return nil
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+func appendRecord(buf []byte, op byte, key string) []byte {
+	buf = append(buf, op)
+	buf = strconv.AppendQuote(buf, key)
+	return append(buf, '\n')
+}
+
+func appendDueRecord(buf []byte, op byte, d dueRecord) []byte {
+	buf = append(buf, op)
+	buf = strconv.AppendInt(buf, d.at, 10)
+	buf = strconv.AppendQuote(buf, d.key)
+	return append(buf, '\n')
+}
+
+func (s *File) append(op byte, keys []string) error {
+	var buf []byte
+	for _, k := range keys {
+		buf = appendRecord(buf, op, k)
+	}
+	return s.write(buf, len(keys))
+}
+
+// write appends n encoded records and syncs them.
+func (s *File) write(buf []byte, n int) error {
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	if _, err := s.f.Write(buf); err != nil {
+		return s.rollback(err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return s.rollback(err)
+	}
+	s.size += int64(len(buf))
+	s.records += n
+	return nil
+}
+
+// rollback cuts the log back to its last complete record after a failed
+// append, so later records never follow a partial one that replay would
+// reject as corrupt. If the log cannot be truncated it is rewritten from the
+// live keys instead. err is returned either way: the records are not stored.
+func (s *File) rollback(err error) error {
+	if terr := s.f.Truncate(s.size); terr == nil {
+		return err
+	}
+	if cerr := s.compact(); cerr != nil {
+		return errors.Join(err, cerr)
+	}
+	return err
+}
+
+func (s *File) Add(_ context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append('+', keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		s.keys[k] = struct{}{}
+	}
+	return nil
+}
+
+func (s *File) Remove(_ context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append('-', keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		delete(s.keys, k)
+	}
+	return s.maybeCompact()
+}
+
+// maybeCompact rewrites the log once removed records dominate it.
+func (s *File) maybeCompact() error {
+	if s.records > 2*(len(s.keys)+len(s.due))+compactSlack {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *File) Load(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.keys))
+	for k := range s.keys {
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func (s *File) AddDue(_ context.Context, ds []Due) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf []byte
+	for _, d := range ds {
+		buf = appendDueRecord(buf, '>', toDueRecord(d))
+	}
+	if err := s.write(buf, len(ds)); err != nil {
+		return err
+	}
+	for _, d := range ds {
+		s.due[toDueRecord(d)] = struct{}{}
+	}
+	return nil
+}
+
+func (s *File) RemoveDue(_ context.Context, ds []Due) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf []byte
+	for _, d := range ds {
+		buf = appendDueRecord(buf, '<', toDueRecord(d))
+	}
+	if err := s.write(buf, len(ds)); err != nil {
+		return err
+	}
+	for _, d := range ds {
+		delete(s.due, toDueRecord(d))
+	}
+	return s.maybeCompact()
+}
+
+func (s *File) LoadDue(context.Context) ([]Due, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Due, 0, len(s.due))
+	for d := range s.due {
+		out = append(out, Due{Key: d.key, At: time.Unix(0, d.at)})
+	}
+	return out, nil
+}
+
+func toDueRecord(d Due) dueRecord {
+	return dueRecord{key: d.Key, at: d.At.UnixNano()}
+}
+
+func (s *File) Close(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
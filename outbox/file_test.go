@@ -0,0 +1,155 @@
+package outbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadSorted(t *testing.T, s Store) []string {
+	t.Helper()
+	keys, err := s.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestFileSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	if err := s.Add(ctx, []string{"a", "b\nc", "d"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := s.Remove(ctx, []string{"d"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = NewFile(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close(ctx)
+	if got, want := loadSorted(t, s), []string{"a", "b\nc"}; !slices.Equal(got, want) {
+		t.Fatalf("keys=%q want %q", got, want)
+	}
+}
+
+func TestFileDropsTornRecord(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	if err := os.WriteFile(path, []byte("+\"a\"\n+\"b"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	defer s.Close(ctx)
+	if err := s.Add(ctx, []string{"c"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if got, want := loadSorted(t, s), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("keys=%q want %q", got, want)
+	}
+}
+
+func TestFileRejectsCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	if err := os.WriteFile(path, []byte("?\"a\"\n+\"b\"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := NewFile(path); err == nil {
+		t.Fatalf("NewFile accepted a corrupt log")
+	}
+}
+
+func TestFileRollbackDropsPartialAppend(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	if err := s.Add(ctx, []string{"a"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// An append that failed after writing part of its record.
+	if _, err := s.f.Write([]byte("+\"b")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.rollback(os.ErrDeadlineExceeded); err != os.ErrDeadlineExceeded {
+		t.Fatalf("rollback err=%v, want the append error", err)
+	}
+	if err := s.Add(ctx, []string{"c"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = NewFile(path)
+	if err != nil {
+		t.Fatalf("reopen after rollback: %v", err)
+	}
+	defer s.Close(ctx)
+	if got, want := loadSorted(t, s), []string{"a", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("keys=%q want %q", got, want)
+	}
+}
+
+func TestFileKeepsDueRecords(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	at := time.Unix(0, 1_700_000_000_123_456_789)
+
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	ds := []Due{{Key: "a", At: at}, {Key: "a", At: at.Add(time.Second)}, {Key: "b\"c", At: at}}
+	if err := s.AddDue(ctx, ds); err != nil {
+		t.Fatalf("AddDue: %v", err)
+	}
+	if err := s.RemoveDue(ctx, ds[1:2]); err != nil {
+		t.Fatalf("RemoveDue: %v", err)
+	}
+	if err := s.Add(ctx, []string{"a"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	s, err = NewFile(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close(ctx)
+	got, err := s.LoadDue(ctx)
+	if err != nil {
+		t.Fatalf("LoadDue: %v", err)
+	}
+	slices.SortFunc(got, func(x, y Due) int { return strings.Compare(x.Key, y.Key) })
+	if len(got) != 2 || got[0].Key != "a" || !got[0].At.Equal(at) || got[1].Key != "b\"c" {
+		t.Fatalf("due=%+v", got)
+	}
+	if keys := loadSorted(t, s); !slices.Equal(keys, []string{"a"}) {
+		t.Fatalf("keys=%q", keys)
+	}
+}
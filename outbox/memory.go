@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is an in-process Store. Keys do not survive a restart, so it only
+// covers version-store outages that end while the process is running.
+type Memory struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{keys: make(map[string]struct{})}
+}
+
+func (m *Memory) Add(_ context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		m.keys[k] = struct{}{}
+	}
+	return nil
+}
+
+func (m *Memory) Remove(_ context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.keys, k)
+	}
+	return nil
+}
+
+func (m *Memory) Load(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]string, 0, len(m.keys))
+	for k := range m.keys {
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func (m *Memory) Close(context.Context) error { return nil }
@@ -0,0 +1,56 @@
+// Package outbox defines where cascache.InvalidationOutbox persists the keys
+// of invalidations that failed and still have to be retried.
+//
+// A Store holds a set of logical keys. Implementations MUST be safe for
+// concurrent use and MUST treat Add of a key that is already stored, and
+// Remove of a key that is not, as no-ops. Keys are opaque strings and may
+// contain any bytes.
+//
+// Three stores are provided:
+//   - NewMemory keeps keys in-process; they are lost on restart.
+//   - NewFile appends to a local write-ahead log that survives restarts of
+//     the process, but not the loss of its disk.
+//   - NewSQL keeps keys in a table reached through database/sql, so they
+//     survive the host and can be shared by replicas.
+//
+// NewFile, and NewSQL with SQLOptions.DueTable set, also implement DueStore
+// and keep the delayed follow-up invalidations that were still waiting when
+// the cache closed.
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+type Store interface {
+	// Add durably records keys. It returns only after they would be
+	// returned by Load after a restart.
+	Add(ctx context.Context, keys []string) error
+	// Remove forgets keys once their invalidation succeeded.
+	Remove(ctx context.Context, keys []string) error
+	// Load returns every stored key, in no particular order.
+	Load(ctx context.Context) ([]string, error)
+	Close(ctx context.Context) error
+}
+
+// Due is a delayed invalidation of Key that must not run before At.
+type Due struct {
+	Key string
+	At  time.Time
+}
+
+// DueStore is an optional Store extension for delayed invalidations. The
+// cache persists its waiting follow-ups with AddDue on Close, and the next
+// cache bound to the store runs each one at its due time and then removes
+// it. A record is identified by its key and due time, compared to the
+// nanosecond. A store that cannot keep them returns an error matching
+// errors.ErrUnsupported, and the follow-ups run at Close instead.
+type DueStore interface {
+	// AddDue durably records ds, as Add does for keys.
+	AddDue(ctx context.Context, ds []Due) error
+	// RemoveDue forgets ds once they ran.
+	RemoveDue(ctx context.Context, ds []Due) error
+	// LoadDue returns every stored record, in no particular order.
+	LoadDue(ctx context.Context) ([]Due, error)
+}
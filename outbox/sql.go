@@ -0,0 +1,238 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLOptions configures an SQL store.
+type SQLOptions struct {
+	// Table holds one row per key in a text column named cache_key, which
+	// must be its primary key or carry a unique index:
+	//
+	//	CREATE TABLE cascache_outbox (cache_key TEXT PRIMARY KEY)
+	//
+	// The name is written into statements unquoted and may be schema
+	// qualified. Default "cascache_outbox".
+	Table string
+
+	// DueTable holds the delayed invalidations that were still waiting
+	// when a cache closed, one row per key and due time in Unix
+	// nanoseconds:
+	//
+	//	CREATE TABLE cascache_outbox_due (
+	//		cache_key TEXT NOT NULL,
+	//		due_at    BIGINT NOT NULL,
+	//		PRIMARY KEY (cache_key, due_at)
+	//	)
+	//
+	// Default "" (none): the DueStore methods then return
+	// errors.ErrUnsupported and the cache runs those invalidations at Close.
+	DueTable string
+
+	// Placeholder renders the n-th (1-based) bind parameter. Default "?",
+	// as MySQL and SQLite expect; use Dollar for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// Dollar renders PostgreSQL-style placeholders ($1, $2, ...).
+func Dollar(n int) string { return fmt.Sprintf("$%d", n) }
+
+// SQL is a Store backed by a table reached through database/sql. Every Add
+// and Remove runs in one transaction. Several processes may share the table;
+// each then also retries the keys the others recorded.
+type SQL struct {
+	db     *sql.DB
+	insert string
+	del    string
+	exists string
+	load   string
+
+	// Statements for SQLOptions.DueTable; empty when it is not set.
+	insertDue string
+	delDue    string
+	existsDue string
+	loadDue   string
+}
+
+var (
+	_ Store    = (*SQL)(nil)
+	_ DueStore = (*SQL)(nil)
+)
+
+// NewSQL returns a store using db. The table must already exist. The caller
+// keeps ownership of db; Close does not close it.
+func NewSQL(db *sql.DB, opts SQLOptions) (*SQL, error) {
+	if db == nil {
+		return nil, errors.New("outbox: nil *sql.DB")
+	}
+	table := opts.Table
+	if table == "" {
+		table = "cascache_outbox"
+	}
+	if err := checkTable(table); err != nil {
+		return nil, err
+	}
+	ph := opts.Placeholder
+	if ph == nil {
+		ph = func(int) string { return "?" }
+	}
+	s := &SQL{
+		db:     db,
+		insert: fmt.Sprintf("INSERT INTO %s (cache_key) VALUES (%s)", table, ph(1)),
+		del:    fmt.Sprintf("DELETE FROM %s WHERE cache_key = %s", table, ph(1)),
+		exists: fmt.Sprintf("SELECT 1 FROM %s WHERE cache_key = %s", table, ph(1)),
+		load:   fmt.Sprintf("SELECT cache_key FROM %s", table),
+	}
+	if due := opts.DueTable; due != "" {
+		if err := checkTable(due); err != nil {
+			return nil, err
+		}
+		s.insertDue = fmt.Sprintf("INSERT INTO %s (cache_key, due_at) VALUES (%s, %s)", due, ph(1), ph(2))
+		s.delDue = fmt.Sprintf("DELETE FROM %s WHERE cache_key = %s AND due_at = %s", due, ph(1), ph(2))
+		s.existsDue = fmt.Sprintf("SELECT 1 FROM %s WHERE cache_key = %s AND due_at = %s", due, ph(1), ph(2))
+		s.loadDue = fmt.Sprintf("SELECT cache_key, due_at FROM %s", due)
+	}
+	return s, nil
+}
+
+// Add inserts the keys that are not stored yet. Checking first keeps Add
+// portable: there is no dialect-neutral INSERT that ignores duplicates.
+// A concurrent Add of the same key from another process may still fail the
+// transaction on the unique constraint; the key is stored either way.
+func (s *SQL) Add(ctx context.Context, keys []string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, k := range keys {
+			var one int
+			err := tx.QueryRowContext(ctx, s.exists, k).Scan(&one)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, s.insert, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQL) Remove(ctx context.Context, keys []string) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, k := range keys {
+			if _, err := tx.ExecContext(ctx, s.del, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQL) Load(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.load)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// AddDue inserts the records that are not stored yet, as Add does.
+func (s *SQL) AddDue(ctx context.Context, ds []Due) error {
+	if s.insertDue == "" {
+		return errors.ErrUnsupported
+	}
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, d := range ds {
+			at := d.At.UnixNano()
+			var one int
+			err := tx.QueryRowContext(ctx, s.existsDue, d.Key, at).Scan(&one)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, s.insertDue, d.Key, at); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQL) RemoveDue(ctx context.Context, ds []Due) error {
+	if s.delDue == "" {
+		return errors.ErrUnsupported
+	}
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		for _, d := range ds {
+			if _, err := tx.ExecContext(ctx, s.delDue, d.Key, d.At.UnixNano()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQL) LoadDue(ctx context.Context) ([]Due, error) {
+	if s.loadDue == "" {
+		return nil, errors.ErrUnsupported
+	}
+	rows, err := s.db.QueryContext(ctx, s.loadDue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Due
+	for rows.Next() {
+		var (
+			k  string
+			at int64
+		)
+		if err := rows.Scan(&k, &at); err != nil {
+			return nil, err
+		}
+		out = append(out, Due{Key: k, At: time.Unix(0, at)})
+	}
+	return out, rows.Err()
+}
+
+func (s *SQL) Close(context.Context) error { return nil }
+
+func (s *SQL) tx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkTable rejects table names that could not be a plain or qualified
+// identifier, so a mistaken option cannot inject SQL.
+func checkTable(table string) error {
+	if strings.ContainsAny(table, " ;'\"\t\n()") {
+		return fmt.Errorf("outbox: invalid table name %q", table)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package cascache
+
+import (
+	"context"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// PendingWrite identifies one two-phase write started by BeginWrite. Pass it
+// to CommitWrite or AbortWrite unchanged.
+type PendingWrite struct {
+	Key   string
+	token string
+}
+
+// BeginWrite is the first phase of a two-phase invalidation. Call it before
+// writing key's source of truth, then CommitWrite after the source write
+// succeeds or AbortWrite if it did not happen:
+//
+//	w, err := cache.BeginWrite(ctx, id)
+//	if err != nil {
+//		return err
+//	}
+//	if err := store.Save(ctx, user); err != nil {
+//		_ = cache.AbortWrite(ctx, w)
+//		return err
+//	}
+//	return cache.CommitWrite(ctx, w)
+//
+// BeginWrite advances key's fence, exactly like Invalidate, and marks it
+// pending for Options.PendingWriteTTL. Until the mark is cleared or expires,
+// reads miss and every fill is rejected with WriteOutcomeWritePending: a
+// version snapshotted while the mark is set never becomes writable, so a
+// value loaded before the source write lands can never be cached. If
+// CommitWrite then fails, or the writer crashes, the key stays uncached until
+// the mark expires instead of serving the old value.
+//
+// A plain Invalidate of the key moves its fence but keeps the mark, so it
+// cannot end a write it does not hold. Only CommitWrite or AbortWrite with
+// the returned token clears the mark early; otherwise it lasts until it
+// expires, and a later BeginWrite replaces it. The version store must
+// implement version.PendingWriter; otherwise ErrPendingWriteUnsupported is
+// returned.
+func (c *cache[V]) BeginWrite(ctx context.Context, key string) (PendingWrite, error) {
+	if !c.enabled {
+		return PendingWrite{Key: key}, nil
+	}
+	pw, ok := c.versionStore.(version.PendingWriter)
+	if !ok {
+		return PendingWrite{}, opError(OpBeginWrite, key, ErrPendingWriteUnsupported)
+	}
+
+	sk := c.singleKeys(key)
+	copies := c.captureStaleMany(ctx, []string{key})
+	defer c.dropLocal(ctx, sk)
+
+	ckey := toVersionCacheKey(sk.Cache)
+	token, err := pw.BeginWrite(ctx, ckey, c.pendingTTL)
+	if err != nil {
+		c.hooks.VersionAdvanceError(ckey, err)
+		return PendingWrite{}, opError(OpBeginWrite, key, err)
+	}
+	_ = c.provider.Del(ctx, sk.Value.String())
+	c.retainStale(ctx, copies, nil)
+	return PendingWrite{Key: key, token: token}, nil
+}
+
+// CommitWrite is the second phase of a two-phase invalidation. It advances
+// the key's fence once more and clears the pending mark set by w, so the next
+// fill loads the committed source state. Failures are returned as
+// *InvalidateError; the mark then keeps the key uncached until it expires.
+func (c *cache[V]) CommitWrite(ctx context.Context, w PendingWrite) error {
+	if !c.enabled {
+		return nil
+	}
+	pw, ok := c.versionStore.(version.PendingWriter)
+	if !ok {
+		return opError(OpCommitWrite, w.Key, ErrPendingWriteUnsupported)
+	}
+
+	sk := c.singleKeys(w.Key)
+	defer c.dropLocal(ctx, sk)
+
+	ckey := toVersionCacheKey(sk.Cache)
+	_, err := pw.CommitWrite(ctx, ckey, w.token)
+	delErr := c.provider.Del(ctx, sk.Value.String())
+	if err != nil {
+		c.hooks.VersionAdvanceError(ckey, err)
+		c.hooks.InvalidateOutage(w.Key, err, delErr)
+		return &InvalidateError{
+			Key:        w.Key,
+			AdvanceErr: opError(OpCommitWrite, w.Key, err),
+			DelErr:     opError(OpCommitWrite, w.Key, delErr),
+		}
+	}
+	return nil
+}
+
+// AbortWrite clears the pending mark set by w without advancing the fence
+// again, for source writes that did not happen.
+func (c *cache[V]) AbortWrite(ctx context.Context, w PendingWrite) error {
+	if !c.enabled {
+		return nil
+	}
+	pw, ok := c.versionStore.(version.PendingWriter)
+	if !ok {
+		return opError(OpAbortWrite, w.Key, ErrPendingWriteUnsupported)
+	}
+	if err := pw.AbortWrite(ctx, c.versionKey(w.Key), w.token); err != nil {
+		return opError(OpAbortWrite, w.Key, err)
+	}
+	return nil
+}
@@ -8,7 +8,8 @@ const (
 	SelfHealReasonCorrupt SelfHealReason = "corrupt"
 	// no authoritative version state existed for the key.
 	SelfHealReasonVersionMissing SelfHealReason = "version_missing"
-	// stored version fence no longer matched the current authoritative fence.
+	// stored version fence, or a recorded dependency fence such as the
+	// namespace epoch, no longer matched the current authoritative fence.
 	SelfHealReasonVersionMismatch SelfHealReason = "version_mismatch"
 	// payload could not be decoded by the configured codec.
 	SelfHealReasonValueDecode SelfHealReason = "value_decode"
@@ -28,7 +29,8 @@ const (
 	BatchRejectReasonIncompleteBatch BatchRejectReason = "incomplete_batch"
 	// authoritative version state was missing for at least one requested member.
 	BatchRejectReasonVersionMissing BatchRejectReason = "version_missing"
-	// at least one requested member no longer matched authoritative version state.
+	// at least one requested member, or a dependency it recorded, no longer
+	// matched authoritative version state.
 	BatchRejectReasonVersionMismatch BatchRejectReason = "version_mismatch"
 	// batch wire envelope was invalid.
 	BatchRejectReasonDecodeError BatchRejectReason = "decode_error"
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/unkn0wn-root/cascache/v3"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+var (
+	_ version.ConditionalAdvancer        = (*VersionStore)(nil)
+	_ cascache.ConditionalKeyInvalidator = (*KeyMutator)(nil)
+)
+
+// advanceIfScript stores ARGV[3] as the fresh fence of KEYS[1] and deletes
+// the remaining KEYS (the lease, and the value for the key mutator) only
+// while the current fence equals ARGV[2], or while the key is missing when
+// ARGV[1] is "1". A pending mark compares as its bare fence and, while
+// unexpired, is kept like Advance keeps it. Returns 1 when advanced, 2 when
+// advanced with the mark kept, and 0 on a mismatch.
+var advanceIfScript = goredis.NewScript(`
+local expect_missing = ARGV[1] == "1"
+local expected_fence = ARGV[2]
+local state = ARGV[3]
+local version_ttl_ms = tonumber(ARGV[4])
+
+local current = redis.call("GET", KEYS[1])
+if current then
+	if expect_missing then
+		return 0
+	end
+	current = string.match(current, "^(%x+)|") or current
+	if current ~= expected_fence then
+		return 0
+	end
+elseif not expect_missing then
+	return 0
+end
+` + keepMarkLua + `
+if version_ttl_ms and version_ttl_ms > 0 then
+	redis.call("SET", KEYS[1], state, "PX", version_ttl_ms)
+else
+	redis.call("SET", KEYS[1], state)
+end
+redis.call("DEL", unpack(KEYS, 2))
+if kept then
+	return 2
+end
+return 1
+`)
+
+// AdvanceIf moves the key to a fresh fence and drops its fill lease, like
+// Advance, only while its fence still equals expected. The compare and the
+// advance run in one script.
+func (s *VersionStore) AdvanceIf(
+	ctx context.Context,
+	cacheKey version.CacheKey,
+	expected version.Snapshot,
+) (version.Snapshot, bool, error) {
+	rdb, err := s.client()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	f, err := version.NewFence()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	r, err := runAdvanceIf(ctx, rdb, []string{s.key(cacheKey), leaseStorageKey(cacheKey)}, expected, f, s.versionTTL)
+	if err != nil || r == 0 {
+		return version.Snapshot{}, false, err
+	}
+	return version.Snapshot{Fence: f, Exists: true, Pending: r == 2}, true, nil
+}
+
+// InvalidateIfVersion runs the invalidate script only while the key's fence
+// still equals expected, comparing in the same atomic step.
+func (s *KeyMutator) InvalidateIfVersion(
+	ctx context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+) (bool, error) {
+	if s == nil || s.client == nil {
+		return false, ErrNilClient
+	}
+	f, err := version.NewFence()
+	if err != nil {
+		return false, err
+	}
+	r, err := runAdvanceIf(
+		ctx,
+		s.client,
+		[]string{versionStorageKey(versionKey), leaseStorageKey(versionKey), valueKey},
+		expected,
+		f,
+		s.versionTTL,
+	)
+	return r != 0, err
+}
+
+func runAdvanceIf(
+	ctx context.Context,
+	rdb goredis.Scripter,
+	keys []string,
+	expected version.Snapshot,
+	fence version.Fence,
+	versionTTL time.Duration,
+) (int, error) {
+	expectMissing, expectedFence := "1", ""
+	if expected.Exists {
+		expectMissing, expectedFence = "0", expected.Fence.String()
+	}
+	r, err := advanceIfScript.Run(
+		ctx,
+		rdb,
+		keys,
+		expectMissing,
+		expectedFence,
+		fence.String(),
+		ttlMillis(versionTTL),
+	).Int()
+	if err != nil {
+		return 0, err
+	}
+	return r, nil
+}
@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+var _ version.Leaser = (*VersionStore)(nil)
+
+// acquireLeaseScript creates the version state when missing, exactly like
+// CreateIfMissing, and then takes the lease with SET NX. It returns the
+// current fence and 1 when the lease was granted.
+var acquireLeaseScript = goredis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+local init_fence = ARGV[1]
+local token = ARGV[2]
+local lease_ttl_ms = tonumber(ARGV[3])
+local version_ttl_ms = tonumber(ARGV[4])
+
+if not current then
+	if version_ttl_ms and version_ttl_ms > 0 then
+		redis.call("SET", KEYS[1], init_fence, "PX", version_ttl_ms)
+	else
+		redis.call("SET", KEYS[1], init_fence)
+	end
+	current = init_fence
+end
+
+if redis.call("SET", KEYS[2], token, "NX", "PX", lease_ttl_ms) then
+	return {current, 1}
+end
+return {current, 0}
+`)
+
+var releaseLeaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// AcquireLease implements version.Leaser. The lease is a separate key in the
+// version key's hash slot, so it is invisible to client tracking and the
+// KeyMutator scripts can check it in the same call as the fence.
+func (s *VersionStore) AcquireLease(
+	ctx context.Context,
+	cacheKey version.CacheKey,
+	ttl time.Duration,
+) (version.Snapshot, bool, error) {
+	rdb, err := s.client()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+
+	f, err := version.NewFence()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	token, err := version.NewFence()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+
+	r, err := acquireLeaseScript.Run(
+		ctx,
+		rdb,
+		[]string{s.key(cacheKey), leaseStorageKey(cacheKey)},
+		f.String(),
+		token.String(),
+		ttlMillis(ttl),
+		ttlMillis(s.versionTTL),
+	).Slice()
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	if len(r) != 2 {
+		return version.Snapshot{}, false, errors.New("cascache/redis: unexpected lease result length")
+	}
+
+	snap, err := parseSnapshotValue(cacheKey, r[0])
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	granted, ok := r[1].(int64)
+	if !ok {
+		return version.Snapshot{}, false, fmt.Errorf("cascache/redis: unexpected lease grant type %T", r[1])
+	}
+	if granted != 1 {
+		return snap, false, nil
+	}
+	snap.Lease = token.String()
+	return snap, true, nil
+}
+
+// LeaseHolder implements version.Leaser.
+func (s *VersionStore) LeaseHolder(ctx context.Context, cacheKey version.CacheKey) (string, error) {
+	rdb, err := s.client()
+	if err != nil {
+		return "", err
+	}
+	token, err := rdb.Get(ctx, leaseStorageKey(cacheKey)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", nil
+	}
+	return token, err
+}
+
+// ReleaseLease implements version.Leaser.
+func (s *VersionStore) ReleaseLease(ctx context.Context, cacheKey version.CacheKey, token string) error {
+	rdb, err := s.client()
+	if err != nil {
+		return err
+	}
+	return releaseLeaseScript.Run(ctx, rdb, []string{leaseStorageKey(cacheKey)}, token).Err()
+}
+
+func leaseStorageKey(cacheKey version.CacheKey) string {
+	return keyutil.LeaseStorageKey(keyutil.CacheKey(cacheKey.String()))
+}
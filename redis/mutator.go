@@ -2,7 +2,10 @@ package redis
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	goredis "github.com/redis/go-redis/v9"
@@ -23,11 +26,34 @@ type KeyMutator struct {
 }
 
 var (
-	_ cascache.KeyMutator = (*KeyMutator)(nil)
-	_ cascache.KeyReader  = (*KeyMutator)(nil)
+	_ cascache.KeyMutator          = (*KeyMutator)(nil)
+	_ cascache.KeyReader           = (*KeyMutator)(nil)
+	_ cascache.KeyFrameWriter      = (*KeyMutator)(nil)
+	_ cascache.KeyRevisionWriter   = (*KeyMutator)(nil)
+	_ cascache.KeyAdvanceWriter    = (*KeyMutator)(nil)
+	_ cascache.BatchKeyInvalidator = (*KeyMutator)(nil)
 )
 
-var setIfVersionScript = goredis.NewScript(`
+// setIfVersionScript returns 1 when stored, 0 on a version mismatch, 2 while
+// another caller holds the key's fill lease (KEYS[3]), 3 while a two-phase
+// write is pending, and 4 when ARGV[8], a big-endian source revision, is below
+// the revision recorded in the stored entry. An expired pending mark compares
+// as its bare fence and is replaced by it on a successful write. A non-empty
+// ARGV[9] is the fresh fence an existing key moves to when the write stores.
+var setIfVersionScript = goredis.NewScript(setIfVersionLua)
+
+// setIfVersionLua reads the stored entry's revision at the offsets
+// internal/wire publishes, substituted for the $-placeholders below. Lua
+// strings are 1-based, so each 0-based offset is shifted by one.
+var setIfVersionLua = strings.NewReplacer(
+	"$REVISION_END", strconv.Itoa(wire.RevisionEnd),
+	"$VERSION", strconv.Itoa(int(wire.Version)),
+	"$KIND_SINGLE_EXT", strconv.Itoa(wire.KindSingleExt),
+	"$KIND_ABSENT", strconv.Itoa(wire.KindAbsent),
+	"$FLAGS_POS", strconv.Itoa(wire.FlagsOffset+1),
+	"$FLAG_REVISION", strconv.Itoa(int(wire.FlagRevision)),
+	"$REVISION_POS", strconv.Itoa(wire.RevisionOffset),
+).Replace(`
 local current = redis.call("GET", KEYS[1])
 local expect_missing = ARGV[1] == "1"
 local expected_fence = ARGV[2]
@@ -35,6 +61,48 @@ local init_fence = ARGV[3]
 local wire_value = ARGV[4]
 local ttl_ms = tonumber(ARGV[5])
 local version_ttl_ms = tonumber(ARGV[6])
+local lease_token = ARGV[7]
+local revision = ARGV[8]
+local next_fence = ARGV[9]
+
+local lease = redis.call("GET", KEYS[3])
+if lease and lease ~= lease_token then
+	return 2
+end
+
+local marked = false
+if current then
+	local fence, deadline = string.match(current, "^(%x+)|(%d+)|")
+	if fence then
+		local t = redis.call("TIME")
+		if tonumber(deadline) > tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000) then
+			return 3
+		end
+		current = fence
+		marked = true
+	end
+end
+
+-- A revisioned single entry or tombstone keeps its revision right after the
+-- flags byte, where the revision flag marks it.
+if revision ~= "" then
+	local stored = redis.call("GET", KEYS[2])
+	if stored and #stored >= $REVISION_END and string.sub(stored, 1, 4) == "CASC" and string.byte(stored, 5) == $VERSION then
+		local kind = string.byte(stored, 6)
+		if (kind == $KIND_SINGLE_EXT or kind == $KIND_ABSENT) and bit.band(string.byte(stored, $FLAGS_POS), $FLAG_REVISION) ~= 0 then
+			for i = 1, 8 do
+				local a = string.byte(stored, $REVISION_POS + i)
+				local b = string.byte(revision, i)
+				if a ~= b then
+					if a > b then
+						return 4
+					end
+					break
+				end
+			end
+		end
+	end
+end
 
 if current then
 	if expect_missing then
@@ -43,7 +111,17 @@ if current then
 	if current ~= expected_fence then
 		return 0
 	end
-	if version_ttl_ms and version_ttl_ms > 0 then
+	if next_fence ~= "" then
+		current = next_fence
+		marked = true
+	end
+	if marked then
+		if version_ttl_ms and version_ttl_ms > 0 then
+			redis.call("SET", KEYS[1], current, "PX", version_ttl_ms)
+		else
+			redis.call("SET", KEYS[1], current)
+		end
+	elseif version_ttl_ms and version_ttl_ms > 0 then
 		redis.call("PEXPIRE", KEYS[1], version_ttl_ms)
 	else
 		redis.call("PERSIST", KEYS[1])
@@ -64,20 +142,29 @@ if ttl_ms and ttl_ms > 0 then
 else
 	redis.call("SET", KEYS[2], wire_value)
 end
+if lease then
+	redis.call("DEL", KEYS[3])
+end
 
 return 1
 `)
 
-var invalidateScript = goredis.NewScript(`
+// advanceScript stores ARGV[1] as the fresh fence of KEYS[1] and deletes the
+// remaining KEYS (the lease, and the value for the key mutator). An unexpired
+// pending mark is kept. Returns 2 when it was kept and 1 otherwise.
+var advanceScript = goredis.NewScript(`
 local state = ARGV[1]
 local version_ttl_ms = tonumber(ARGV[2])
-
+` + keepMarkLua + `
 if version_ttl_ms and version_ttl_ms > 0 then
 	redis.call("SET", KEYS[1], state, "PX", version_ttl_ms)
 else
 	redis.call("SET", KEYS[1], state)
 end
-redis.call("DEL", KEYS[2])
+redis.call("DEL", unpack(KEYS, 2))
+if kept then
+	return 2
+end
 return 1
 `)
 
@@ -111,6 +198,72 @@ func (s *KeyMutator) SetIfVersion(
 	expected version.Snapshot,
 	payload []byte,
 	ttl time.Duration,
+) (bool, error) {
+	return s.SetFrameIfVersion(
+		ctx,
+		versionKey,
+		valueKey,
+		expected,
+		func(fence version.Fence) ([]byte, error) { return wire.EncodeSingle(fence, payload) },
+		ttl,
+	)
+}
+
+// SetFrameIfVersion runs the same compare-and-write script as SetIfVersion
+// but stores the frame built by encode, so entries carrying dependency fences
+// keep the single round trip.
+func (s *KeyMutator) SetFrameIfVersion(
+	ctx context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+	encode func(fence version.Fence) ([]byte, error),
+	ttl time.Duration,
+) (bool, error) {
+	return s.setFrame(ctx, versionKey, valueKey, expected, "", false, encode, ttl)
+}
+
+// SetFrameAndAdvance runs the compare-and-write script and, when it stores,
+// moves an existing key to the fresh fence the frame is encoded with.
+func (s *KeyMutator) SetFrameAndAdvance(
+	ctx context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+	encode func(fence version.Fence) ([]byte, error),
+	ttl time.Duration,
+) (bool, error) {
+	return s.setFrame(ctx, versionKey, valueKey, expected, "", true, encode, ttl)
+}
+
+// SetFrameIfRevision runs the compare-and-write script with the revision
+// check enabled, so the stored entry's revision is compared in the same
+// atomic step as the fence.
+func (s *KeyMutator) SetFrameIfRevision(
+	ctx context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+	revision uint64,
+	encode func(fence version.Fence) ([]byte, error),
+	ttl time.Duration,
+) (bool, error) {
+	var rev string
+	if revision != 0 {
+		rev = string(binary.BigEndian.AppendUint64(nil, revision))
+	}
+	return s.setFrame(ctx, versionKey, valueKey, expected, rev, false, encode, ttl)
+}
+
+func (s *KeyMutator) setFrame(
+	ctx context.Context,
+	versionKey version.CacheKey,
+	valueKey string,
+	expected version.Snapshot,
+	revision string,
+	advance bool,
+	encode func(fence version.Fence) ([]byte, error),
+	ttl time.Duration,
 ) (bool, error) {
 	if s == nil || s.client == nil {
 		return false, ErrNilClient
@@ -120,15 +273,25 @@ func (s *KeyMutator) SetIfVersion(
 		expectMissing string
 		expectedFence string
 		initFence     string
+		nextFence     string
 		fence         version.Fence
 		err           error
 	)
 
-	if expected.Exists {
+	switch {
+	case expected.Exists && advance:
+		expectMissing = "0"
+		expectedFence = expected.Fence.String()
+		fence, err = version.NewFence()
+		if err != nil {
+			return false, err
+		}
+		nextFence = fence.String()
+	case expected.Exists:
 		expectMissing = "0"
 		expectedFence = expected.Fence.String()
 		fence = expected.Fence
-	} else {
+	default:
 		expectMissing = "1"
 		fence, err = version.NewFence()
 		if err != nil {
@@ -137,7 +300,7 @@ func (s *KeyMutator) SetIfVersion(
 		initFence = fence.String()
 	}
 
-	wv, err := wire.EncodeSingle(fence, payload)
+	wv, err := encode(fence)
 	if err != nil {
 		return false, err
 	}
@@ -145,17 +308,28 @@ func (s *KeyMutator) SetIfVersion(
 	r, err := setIfVersionScript.Run(
 		ctx,
 		s.client,
-		[]string{versionStorageKey(versionKey), valueKey},
+		[]string{versionStorageKey(versionKey), valueKey, leaseStorageKey(versionKey)},
 		expectMissing,
 		expectedFence,
 		initFence,
 		wv,
 		ttlMillis(ttl),
 		ttlMillis(s.versionTTL),
+		expected.Lease,
+		revision,
+		nextFence,
 	).Int()
 	if err != nil {
 		return false, err
 	}
+	switch r {
+	case 2:
+		return false, cascache.ErrFillLeaseHeld
+	case 3:
+		return false, cascache.ErrWritePending
+	case 4:
+		return false, cascache.ErrStaleRevision
+	}
 	return r == 1, nil
 }
 
@@ -206,15 +380,79 @@ func (s *KeyMutator) Invalidate(
 		return err
 	}
 
-	return invalidateScript.Run(
+	return advanceScript.Run(
 		ctx,
 		s.client,
-		[]string{versionStorageKey(versionKey), valueKey},
+		[]string{versionStorageKey(versionKey), valueKey, leaseStorageKey(versionKey)},
 		f.String(),
 		ttlMillis(s.versionTTL),
 	).Err()
 }
 
+// InvalidateMany runs the single-key invalidate script for every key in one
+// pipeline. Each script call still touches only one key's hash slot, and
+// cluster clients split the pipeline per node. Scripts missing from a node's
+// script cache are retried individually so the pipeline never needs a
+// preceding SCRIPT LOAD.
+func (s *KeyMutator) InvalidateMany(
+	ctx context.Context,
+	versionKeys []version.CacheKey,
+	valueKeys []string,
+) []error {
+	errs := make([]error, len(versionKeys))
+	if s == nil || s.client == nil {
+		return fillErrs(errs, ErrNilClient)
+	}
+	if len(valueKeys) != len(versionKeys) {
+		return fillErrs(errs, errors.New("cascache/redis: version and value key counts differ"))
+	}
+
+	keys := make([][]string, len(versionKeys))
+	args := make([][]any, len(versionKeys))
+	for i, vk := range versionKeys {
+		f, err := version.NewFence()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		keys[i] = []string{versionStorageKey(vk), valueKeys[i], leaseStorageKey(vk)}
+		args[i] = []any{f.String(), ttlMillis(s.versionTTL)}
+	}
+
+	cmds := make([]*goredis.Cmd, len(versionKeys))
+	_, _ = s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i := range cmds {
+			if errs[i] == nil {
+				cmds[i] = advanceScript.EvalSha(ctx, pipe, keys[i], args[i]...)
+			}
+		}
+		return nil
+	})
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		err := cmd.Err()
+		if isNoScript(err) {
+			err = advanceScript.Run(ctx, s.client, keys[i], args[i]...).Err()
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+func isNoScript(err error) bool {
+	return err != nil && goredis.HasErrorPrefix(err, "NOSCRIPT")
+}
+
+func fillErrs(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
 func versionStorageKey(cacheKey version.CacheKey) string {
 	return keyutil.VersionStorageKey(keyutil.CacheKey(cacheKey.String()))
 }
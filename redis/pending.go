@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+var _ version.PendingWriter = (*VersionStore)(nil)
+
+// While a two-phase write is pending the version key holds
+// "<fence>|<deadline ms>|<token>" instead of the bare fence. The deadline is
+// taken from the Redis clock; scripts treat an expired mark as the bare fence
+// and readers compare it with the local clock.
+
+// keepMarkLua is embedded by scripts that move KEYS[1] to the fresh fence in
+// a local state, after they define state and version_ttl_ms. It carries an
+// unexpired mark over to state, and stretches version_ttl_ms to outlive it, so
+// advancing a key never ends a two-phase write it does not hold. kept reports
+// that it did.
+const keepMarkLua = `
+local kept = false
+local marked_state = redis.call("GET", KEYS[1])
+if marked_state then
+	local deadline, holder = string.match(marked_state, "^%x+|(%d+)|(.+)$")
+	if holder then
+		local t = redis.call("TIME")
+		local left = tonumber(deadline) - (tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000))
+		if left > 0 then
+			state = state .. "|" .. deadline .. "|" .. holder
+			if version_ttl_ms and version_ttl_ms > 0 then
+				version_ttl_ms = math.max(version_ttl_ms, left)
+			end
+			kept = true
+		end
+	end
+end
+`
+
+// beginWriteScript stores a fresh fence marked pending and drops the lease.
+// The version key lives at least as long as the mark.
+var beginWriteScript = goredis.NewScript(`
+local fence = ARGV[1]
+local token = ARGV[2]
+local pending_ttl_ms = tonumber(ARGV[3])
+local version_ttl_ms = tonumber(ARGV[4])
+
+local t = redis.call("TIME")
+local deadline = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000) + pending_ttl_ms
+local state = fence .. "|" .. string.format("%d", deadline) .. "|" .. token
+
+if version_ttl_ms and version_ttl_ms > 0 then
+	redis.call("SET", KEYS[1], state, "PX", math.max(version_ttl_ms, pending_ttl_ms))
+else
+	redis.call("SET", KEYS[1], state)
+end
+redis.call("DEL", KEYS[2])
+return 1
+`)
+
+// commitWriteScript stores a fresh fence, keeping the mark only when another
+// write holds it and it has not expired.
+var commitWriteScript = goredis.NewScript(`
+local state = ARGV[1]
+local token = ARGV[2]
+local version_ttl_ms = tonumber(ARGV[3])
+
+local current = redis.call("GET", KEYS[1])
+if current then
+	local deadline, holder = string.match(current, "^%x+|(%d+)|(.+)$")
+	if holder and holder ~= token then
+		local t = redis.call("TIME")
+		if tonumber(deadline) > tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000) then
+			state = state .. "|" .. deadline .. "|" .. holder
+		end
+	end
+end
+
+if version_ttl_ms and version_ttl_ms > 0 then
+	redis.call("SET", KEYS[1], state, "PX", version_ttl_ms)
+else
+	redis.call("SET", KEYS[1], state)
+end
+redis.call("DEL", KEYS[2])
+return 1
+`)
+
+// abortWriteScript restores the bare fence when token holds the mark.
+var abortWriteScript = goredis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return 0
+end
+local fence, holder = string.match(current, "^(%x+)|%d+|(.+)$")
+if holder ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], fence, "KEEPTTL")
+return 1
+`)
+
+// BeginWrite implements version.PendingWriter.
+func (s *VersionStore) BeginWrite(ctx context.Context, cacheKey version.CacheKey, ttl time.Duration) (string, error) {
+	rdb, err := s.client()
+	if err != nil {
+		return "", err
+	}
+	f, err := version.NewFence()
+	if err != nil {
+		return "", err
+	}
+	token, err := version.NewFence()
+	if err != nil {
+		return "", err
+	}
+
+	err = beginWriteScript.Run(
+		ctx,
+		rdb,
+		[]string{s.key(cacheKey), leaseStorageKey(cacheKey)},
+		f.String(),
+		token.String(),
+		ttlMillis(ttl),
+		ttlMillis(s.versionTTL),
+	).Err()
+	if err != nil {
+		return "", err
+	}
+	return token.String(), nil
+}
+
+// CommitWrite implements version.PendingWriter.
+func (s *VersionStore) CommitWrite(ctx context.Context, cacheKey version.CacheKey, token string) (version.Snapshot, error) {
+	rdb, err := s.client()
+	if err != nil {
+		return version.Snapshot{}, err
+	}
+	f, err := version.NewFence()
+	if err != nil {
+		return version.Snapshot{}, err
+	}
+
+	err = commitWriteScript.Run(
+		ctx,
+		rdb,
+		[]string{s.key(cacheKey), leaseStorageKey(cacheKey)},
+		f.String(),
+		token,
+		ttlMillis(s.versionTTL),
+	).Err()
+	if err != nil {
+		return version.Snapshot{}, err
+	}
+	return version.Snapshot{Fence: f, Exists: true}, nil
+}
+
+// AbortWrite implements version.PendingWriter.
+func (s *VersionStore) AbortWrite(ctx context.Context, cacheKey version.CacheKey, token string) error {
+	rdb, err := s.client()
+	if err != nil {
+		return err
+	}
+	return abortWriteScript.Run(ctx, rdb, []string{s.key(cacheKey)}, token).Err()
+}
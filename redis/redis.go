@@ -8,6 +8,7 @@ import (
 
 	"github.com/unkn0wn-root/cascache/v3"
 	c "github.com/unkn0wn-root/cascache/v3/codec"
+	pr "github.com/unkn0wn-root/cascache/v3/provider"
 )
 
 // Options configures the full Redis-backed cache.
@@ -18,10 +19,12 @@ type Options[V any] struct {
 	Client    goredis.UniversalClient
 	Codec     c.Codec[V]
 
-	DefaultTTL time.Duration
-	BatchTTL   time.Duration
-	VersionTTL time.Duration
-	Disabled   bool
+	DefaultTTL  time.Duration
+	BatchTTL    time.Duration
+	NegativeTTL time.Duration
+	MaxStale    time.Duration
+	VersionTTL  time.Duration
+	Disabled    bool
 
 	ComputeSetCost cascache.SetCostFunc
 	DisableBatch   bool
@@ -30,7 +33,43 @@ type Options[V any] struct {
 	BatchReadSeed  cascache.BatchReadSeedMode
 	BatchWriteSeed cascache.BatchWriteSeedMode
 	Hooks          cascache.Hooks
+	NamespaceEpoch bool
 	CloseClient    bool
+
+	EarlyRefreshBeta float64
+
+	// L1 is an optional in-process provider in front of Redis for single keys.
+	// See cascache.Options.L1.
+	L1    pr.Provider
+	L1TTL time.Duration
+
+	// NearCacheSize keeps decoded values in process memory, dropped through
+	// Redis client tracking on the version keys as soon as a fence changes.
+	// Requires a *goredis.Client. See cascache.Options.NearCacheSize.
+	NearCacheSize int
+	NearCacheTTL  time.Duration
+
+	// FillLeaseTTL lets one caller across all processes load a missing key
+	// while the others wait, enforced by the KeyMutator scripts. See
+	// cascache.Options.FillLeaseTTL.
+	FillLeaseTTL time.Duration
+
+	// PendingWriteTTL bounds a BeginWrite that is never committed or aborted.
+	// See cascache.Options.PendingWriteTTL.
+	PendingWriteTTL time.Duration
+
+	// Outbox retries failed invalidations. See cascache.Options.Outbox.
+	Outbox *cascache.InvalidationOutbox
+
+	// InvalidateDelays schedules follow-up invalidations for replica lag.
+	// See cascache.Options.InvalidateDelays.
+	InvalidateDelays []time.Duration
+
+	// KeyHierarchy enables InvalidatePrefix. See cascache.Options.KeyHierarchy.
+	KeyHierarchy cascache.KeyHierarchy
+
+	UpdateMaxAttempts int
+	UpdateBackoff     time.Duration
 }
 
 // New constructs the preferred full Redis-backed cache from one shared client.
@@ -74,6 +113,8 @@ func New[V any](opts Options[V]) (cascache.CAS[V], error) {
 		Codec:          opts.Codec,
 		DefaultTTL:     opts.DefaultTTL,
 		BatchTTL:       opts.BatchTTL,
+		NegativeTTL:    opts.NegativeTTL,
+		MaxStale:       opts.MaxStale,
 		Disabled:       opts.Disabled,
 		ComputeSetCost: opts.ComputeSetCost,
 		VersionStore:   ver,
@@ -86,6 +127,20 @@ func New[V any](opts Options[V]) (cascache.CAS[V], error) {
 		BatchReadSeed:  opts.BatchReadSeed,
 		BatchWriteSeed: opts.BatchWriteSeed,
 		Hooks:          opts.Hooks,
+		NamespaceEpoch: opts.NamespaceEpoch,
+
+		EarlyRefreshBeta:  opts.EarlyRefreshBeta,
+		L1:                opts.L1,
+		L1TTL:             opts.L1TTL,
+		NearCacheSize:     opts.NearCacheSize,
+		NearCacheTTL:      opts.NearCacheTTL,
+		FillLeaseTTL:      opts.FillLeaseTTL,
+		PendingWriteTTL:   opts.PendingWriteTTL,
+		Outbox:            opts.Outbox,
+		InvalidateDelays:  opts.InvalidateDelays,
+		KeyHierarchy:      opts.KeyHierarchy,
+		UpdateMaxAttempts: opts.UpdateMaxAttempts,
+		UpdateBackoff:     opts.UpdateBackoff,
 	})
 	if err != nil {
 		_ = ver.Close(context.Background())
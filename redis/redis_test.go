@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -11,7 +13,9 @@ import (
 
 	goredis "github.com/redis/go-redis/v9"
 
+	"github.com/unkn0wn-root/cascache/v3"
 	"github.com/unkn0wn-root/cascache/v3/codec"
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
 	"github.com/unkn0wn-root/cascache/v3/version"
 )
 
@@ -259,8 +263,8 @@ func TestKeyMutatorSetVersionTTL(t *testing.T) {
 	if client.evalShaCalls != 1 || client.evalCalls != 1 {
 		t.Fatalf("script calls evalsha=%d eval=%d, want 1/1", client.evalShaCalls, client.evalCalls)
 	}
-	if len(client.args) != 6 {
-		t.Fatalf("script args len=%d, want 6", len(client.args))
+	if len(client.args) != 9 {
+		t.Fatalf("script args len=%d, want 9", len(client.args))
 	}
 	if got, want := client.args[5], int64(1500); got != want {
 		t.Fatalf("version ttl script arg=%v (%T), want %v", got, got, want)
@@ -294,14 +298,127 @@ func TestKeyMutatorSetZeroVersionTTL(t *testing.T) {
 	if err != nil || !stored {
 		t.Fatalf("SetIfVersion: stored=%v err=%v", stored, err)
 	}
-	if len(client.args) != 6 {
-		t.Fatalf("script args len=%d, want 6", len(client.args))
+	if len(client.args) != 9 {
+		t.Fatalf("script args len=%d, want 9", len(client.args))
 	}
 	if got, want := client.args[5], int64(0); got != want {
 		t.Fatalf("version ttl script arg=%v (%T), want %v", got, got, want)
 	}
 }
 
+func TestKeyMutatorSetFrameIfVersionStampsInitFence(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+
+	var encoded version.Fence
+	stored, err := mutator.SetFrameIfVersion(
+		context.Background(),
+		version.NewCacheKey("k"),
+		"value-key",
+		version.Snapshot{},
+		func(fence version.Fence) ([]byte, error) {
+			encoded = fence
+			return []byte("frame:" + fence.String()), nil
+		},
+		time.Minute,
+	)
+	if err != nil || !stored {
+		t.Fatalf("SetFrameIfVersion: stored=%v err=%v", stored, err)
+	}
+	if len(client.args) != 9 {
+		t.Fatalf("script args len=%d, want 9", len(client.args))
+	}
+	if got := client.args[2]; got != encoded.String() {
+		t.Fatalf("init fence arg=%v, want the fence passed to encode %s", got, encoded)
+	}
+	if got, ok := client.args[3].([]byte); !ok || string(got) != "frame:"+encoded.String() {
+		t.Fatalf("wire value arg=%v, want the encoded frame", client.args[3])
+	}
+}
+
+func TestSetIfVersionScriptReadsWireRevisionLayout(t *testing.T) {
+	if strings.Contains(setIfVersionLua, "$") {
+		t.Fatalf("unsubstituted placeholder in script:\n%s", setIfVersionLua)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("#stored >= %d ", wire.RevisionEnd),
+		fmt.Sprintf("string.byte(stored, 5) == %d ", wire.Version),
+		fmt.Sprintf("string.byte(stored, %d)", wire.FlagsOffset+1),
+		fmt.Sprintf("string.byte(stored, %d + i)", wire.RevisionOffset),
+	} {
+		if !strings.Contains(setIfVersionLua, want) {
+			t.Fatalf("script lacks %q:\n%s", want, setIfVersionLua)
+		}
+	}
+
+	// Read an encoded entry the way the script does, with 1-based positions.
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+	enc, err := wire.EncodeSingleEntry(wire.SingleEntry{
+		Fence:    fence,
+		Revision: 0x0102030405060708,
+		Payload:  []byte("v"),
+	})
+	if err != nil {
+		t.Fatalf("EncodeSingleEntry: %v", err)
+	}
+	luaByte := func(pos int) byte { return enc[pos-1] }
+	if luaByte(wire.FlagsOffset+1)&wire.FlagRevision == 0 {
+		t.Fatalf("script flags position misses the revision flag: % x", enc)
+	}
+	for i := 1; i <= 8; i++ {
+		if got := luaByte(wire.RevisionOffset + i); got != byte(i) {
+			t.Fatalf("script revision byte %d=%d want %d: % x", i, got, i, enc)
+		}
+	}
+}
+
+func TestKeyMutatorSetFrameAndAdvanceStampsNextFence(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+	expected, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+
+	var encoded version.Fence
+	stored, err := mutator.SetFrameAndAdvance(
+		context.Background(),
+		version.NewCacheKey("k"),
+		"value-key",
+		version.Snapshot{Fence: expected, Exists: true},
+		func(fence version.Fence) ([]byte, error) {
+			encoded = fence
+			return []byte("frame:" + fence.String()), nil
+		},
+		time.Minute,
+	)
+	if err != nil || !stored {
+		t.Fatalf("SetFrameAndAdvance: stored=%v err=%v", stored, err)
+	}
+	if encoded.Equal(expected) {
+		t.Fatalf("frame encoded with the expected fence, want a fresh one")
+	}
+	if got := client.args[1]; got != expected.String() {
+		t.Fatalf("expected fence arg=%v, want %s", got, expected)
+	}
+	if got := client.args[8]; got != encoded.String() {
+		t.Fatalf("next fence arg=%v, want the fence passed to encode %s", got, encoded)
+	}
+}
+
 func TestNewNilClient(t *testing.T) {
 	t.Parallel()
 
@@ -626,3 +743,474 @@ func TestUsesSlotRouting(t *testing.T) {
 		t.Fatal("single Client should keep MGET SnapshotMany path")
 	}
 }
+
+// pipelineCmdClient runs Pipelined callbacks against a fake pipeliner whose
+// commands resolve immediately. Script retries outside the pipeline fall
+// through to scriptCmdClient.
+type pipelineCmdClient struct {
+	scriptCmdClient
+	pipe *fakePipeliner
+}
+
+func (c *pipelineCmdClient) Pipelined(
+	ctx context.Context,
+	fn func(goredis.Pipeliner) error,
+) ([]goredis.Cmder, error) {
+	return nil, fn(c.pipe)
+}
+
+type fakePipeliner struct {
+	goredis.Pipeliner
+	evalShaErrs map[int]error
+	evalShaKeys [][]string
+	evalShaArgs [][]any
+}
+
+func (p *fakePipeliner) EvalSha(_ context.Context, _ string, keys []string, args ...any) *goredis.Cmd {
+	i := len(p.evalShaKeys)
+	p.evalShaKeys = append(p.evalShaKeys, append([]string(nil), keys...))
+	p.evalShaArgs = append(p.evalShaArgs, append([]any(nil), args...))
+	return goredis.NewCmdResult(int64(1), p.evalShaErrs[i])
+}
+
+func TestKeyMutatorInvalidateManyPipelinesPerKeyScripts(t *testing.T) {
+	t.Parallel()
+
+	sentinel := errors.New("node down")
+	client := &pipelineCmdClient{pipe: &fakePipeliner{
+		evalShaErrs: map[int]error{
+			1: fakeRedisError("NOSCRIPT no matching script"),
+			2: sentinel,
+		},
+	}}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+
+	vks := []version.CacheKey{
+		version.NewCacheKey("a"),
+		version.NewCacheKey("b"),
+		version.NewCacheKey("c"),
+	}
+	errs := mutator.InvalidateMany(context.Background(), vks, []string{"va", "vb", "vc"})
+	if len(errs) != 3 {
+		t.Fatalf("InvalidateMany returned %d errors, want 3", len(errs))
+	}
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("errs=%v, want first two keys invalidated", errs)
+	}
+	if !errors.Is(errs[2], sentinel) {
+		t.Fatalf("errs[2]=%v want %v", errs[2], sentinel)
+	}
+	if len(client.pipe.evalShaKeys) != 3 {
+		t.Fatalf("pipelined scripts=%d want 3", len(client.pipe.evalShaKeys))
+	}
+	for i, keys := range client.pipe.evalShaKeys {
+		if keys[0] != versionStorageKey(vks[i]) {
+			t.Fatalf("script %d keys=%v want version key first", i, keys)
+		}
+	}
+	if client.evalCalls != 1 || client.keys[1] != "vb" {
+		t.Fatalf("NOSCRIPT retry eval=%d keys=%v, want one retry for vb", client.evalCalls, client.keys)
+	}
+}
+
+func TestVersionStoreAdvanceManyOmitsFailedKeys(t *testing.T) {
+	t.Parallel()
+
+	sentinel := errors.New("node down")
+	client := &pipelineCmdClient{pipe: &fakePipeliner{evalShaErrs: map[int]error{1: sentinel}}}
+	store, err := NewVersionStoreWithOptions(VersionStoreOptions{
+		Client:     client,
+		VersionTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewVersionStoreWithOptions: %v", err)
+	}
+
+	keys := []version.CacheKey{version.NewCacheKey("a"), version.NewCacheKey("b")}
+	got, err := store.AdvanceMany(context.Background(), keys)
+	if !errors.Is(err, sentinel) {
+		t.Fatalf("AdvanceMany err=%v want %v", err, sentinel)
+	}
+	if len(got) != 1 || !got[keys[0]].Exists {
+		t.Fatalf("AdvanceMany=%v want only the successful key", got)
+	}
+	args := client.pipe.evalShaArgs[0]
+	if args[0] != got[keys[0]].Fence.String() {
+		t.Fatalf("stored fence=%v want %s", args[0], got[keys[0]].Fence)
+	}
+	if args[1] != int64(time.Minute.Milliseconds()) {
+		t.Fatalf("version ttl=%v want %v", args[1], time.Minute)
+	}
+	if want := []string{store.key(keys[0]), leaseStorageKey(keys[0])}; !reflect.DeepEqual(client.pipe.evalShaKeys[0], want) {
+		t.Fatalf("script keys=%v want %v", client.pipe.evalShaKeys[0], want)
+	}
+}
+
+func TestAdvanceScriptsKeepPendingMark(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{result: 2, resultSet: true}
+	store, err := NewVersionStore(client)
+	if err != nil {
+		t.Fatalf("NewVersionStore: %v", err)
+	}
+	key := version.NewCacheKey("k")
+
+	snap, err := store.Advance(context.Background(), key)
+	if err != nil || !snap.Pending {
+		t.Fatalf("Advance: snap=%+v err=%v, want the kept mark reported", snap, err)
+	}
+	if !strings.Contains(client.script, keepMarkLua) {
+		t.Fatalf("advance script does not keep pending marks:\n%s", client.script)
+	}
+
+	snap, ok, err := store.AdvanceIf(context.Background(), key, snap)
+	if err != nil || !ok || !snap.Pending {
+		t.Fatalf("AdvanceIf: snap=%+v ok=%v err=%v, want the kept mark reported", snap, ok, err)
+	}
+	if !strings.Contains(client.script, keepMarkLua) {
+		t.Fatalf("advanceIf script does not keep pending marks:\n%s", client.script)
+	}
+}
+
+func TestKeyMutatorSetIfVersionLeaseHeld(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{result: 2, resultSet: true}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+
+	key := version.NewCacheKey("k")
+	stored, err := mutator.SetIfVersion(
+		context.Background(),
+		key,
+		"value-key",
+		version.Snapshot{Fence: fence, Exists: true, Lease: "token"},
+		[]byte("payload"),
+		time.Minute,
+	)
+	if stored || !errors.Is(err, cascache.ErrFillLeaseHeld) {
+		t.Fatalf("SetIfVersion: stored=%v err=%v want ErrFillLeaseHeld", stored, err)
+	}
+	if len(client.keys) != 3 || client.keys[2] != leaseStorageKey(key) {
+		t.Fatalf("script keys=%v want the lease key third", client.keys)
+	}
+	if got := client.args[6]; got != "token" {
+		t.Fatalf("lease token arg=%v want token", got)
+	}
+}
+
+func TestKeyMutatorSetFrameIfRevisionStale(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{result: 4, resultSet: true}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+
+	stored, err := mutator.SetFrameIfRevision(
+		context.Background(),
+		version.NewCacheKey("k"),
+		"value-key",
+		version.Snapshot{Fence: fence, Exists: true},
+		0x0102,
+		func(fence version.Fence) ([]byte, error) { return []byte("frame"), nil },
+		time.Minute,
+	)
+	if stored || !errors.Is(err, cascache.ErrStaleRevision) {
+		t.Fatalf("SetFrameIfRevision: stored=%v err=%v want ErrStaleRevision", stored, err)
+	}
+	if got, want := client.args[7], "\x00\x00\x00\x00\x00\x00\x01\x02"; got != want {
+		t.Fatalf("revision arg=%q want %q", got, want)
+	}
+}
+
+// fakeTrackingSub is an in-process stand-in for the tracking connection.
+// Ping answers with a pong unless pingErr is set.
+type fakeTrackingSub struct {
+	msgs      chan any
+	pingErr   atomic.Pointer[error]
+	closed    chan struct{}
+	closeOnce atomic.Bool
+}
+
+func newFakeTrackingSub() *fakeTrackingSub {
+	return &fakeTrackingSub{msgs: make(chan any, 16), closed: make(chan struct{})}
+}
+
+func (f *fakeTrackingSub) ReceiveTimeout(ctx context.Context, _ time.Duration) (any, error) {
+	select {
+	case m := <-f.msgs:
+		if err, ok := m.(error); ok {
+			return nil, err
+		}
+		return m, nil
+	case <-f.closed:
+		return nil, goredis.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fakeTrackingSub) Ping(context.Context, ...string) error {
+	if err := f.pingErr.Load(); err != nil {
+		return *err
+	}
+	f.msgs <- &goredis.Pong{}
+	return nil
+}
+
+func (f *fakeTrackingSub) Close() error {
+	if f.closeOnce.CompareAndSwap(false, true) {
+		close(f.closed)
+	}
+	return nil
+}
+
+type watchEvent struct {
+	key   version.CacheKey
+	reset bool
+}
+
+func newTrackedStore(t *testing.T, sub *fakeTrackingSub) (*VersionStore, <-chan watchEvent, func()) {
+	t.Helper()
+	store, err := NewVersionStore(&fakeClient{})
+	if err != nil {
+		t.Fatalf("NewVersionStore: %v", err)
+	}
+	store.subscribe = func(context.Context) (trackingSub, error) { return sub, nil }
+
+	events := make(chan watchEvent, 64)
+	stop, err := store.Watch(func(k version.CacheKey, reset bool) {
+		events <- watchEvent{key: k, reset: reset}
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	return store, events, stop
+}
+
+func nextEvent(t *testing.T, events <-chan watchEvent) watchEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no watch event")
+		return watchEvent{}
+	}
+}
+
+func TestVersionStoreWatchReportsTrackedVersionKeys(t *testing.T) {
+	t.Parallel()
+
+	sub := newFakeTrackingSub()
+	store, events, stop := newTrackedStore(t, sub)
+	defer stop()
+
+	sub.msgs <- &goredis.Subscription{Kind: "subscribe", Channel: invalidateChannel, Count: 1}
+	if ev := nextEvent(t, events); !ev.reset {
+		t.Fatalf("confirmed subscription should reset once, got %+v", ev)
+	}
+
+	a := store.key(version.NewCacheKey("s:user:a"))
+	b := store.key(version.NewCacheKey("s:user:b"))
+	sub.msgs <- &goredis.Message{Channel: invalidateChannel, PayloadSlice: []string{a, b}}
+	for _, want := range []string{"s:user:a", "s:user:b"} {
+		if ev := nextEvent(t, events); ev.reset || ev.key.String() != want {
+			t.Fatalf("event=%+v want key %s", ev, want)
+		}
+	}
+
+	store.reportUntracked()
+	sub.msgs <- &goredis.Message{Channel: invalidateChannel, PayloadSlice: []string{"cas:v3:val:other"}}
+	if ev := nextEvent(t, events); !ev.reset {
+		t.Fatalf("live tracking must not report resets on reads; unknown keys must, got %+v", ev)
+	}
+
+	// FLUSHALL and FLUSHDB send an invalidation without keys.
+	sub.msgs <- &goredis.Message{Channel: invalidateChannel}
+	if ev := nextEvent(t, events); !ev.reset {
+		t.Fatalf("flush message should reset, got %+v", ev)
+	}
+}
+
+func TestVersionStoreWatchFailsClosedWhileTrackingIsDown(t *testing.T) {
+	t.Parallel()
+
+	sub := newFakeTrackingSub()
+	store, events, stop := newTrackedStore(t, sub)
+	defer stop()
+
+	sub.msgs <- &goredis.Subscription{Kind: "subscribe", Channel: invalidateChannel, Count: 1}
+	nextEvent(t, events)
+
+	pingErr := errors.New("connection refused")
+	sub.pingErr.Store(&pingErr)
+	sub.msgs <- errors.New("read: connection reset")
+	if ev := nextEvent(t, events); !ev.reset {
+		t.Fatalf("lost connection should reset, got %+v", ev)
+	}
+	for len(events) > 0 {
+		<-events
+	}
+	store.reportUntracked()
+	if ev := nextEvent(t, events); !ev.reset {
+		t.Fatalf("reads while tracking is down must reset, got %+v", ev)
+	}
+
+	sub.pingErr.Store(nil)
+	sub.msgs <- &goredis.Subscription{Kind: "subscribe", Channel: invalidateChannel, Count: 1}
+	deadline := time.After(time.Second)
+	for !store.tracker.Load().live.Load() {
+		select {
+		case <-events:
+		case <-deadline:
+			t.Fatal("tracking did not come back")
+		}
+	}
+	for len(events) > 0 {
+		<-events
+	}
+	store.reportUntracked()
+	select {
+	case ev := <-events:
+		t.Fatalf("live tracking reported %+v on read", ev)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestVersionStoreWatchLifecycle(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewVersionStore(&fakeClient{})
+	if err != nil {
+		t.Fatalf("NewVersionStore: %v", err)
+	}
+	if _, err := store.Watch(func(version.CacheKey, bool) {}); !errors.Is(err, ErrTrackingUnsupported) {
+		t.Fatalf("Watch on a non-*Client err=%v want ErrTrackingUnsupported", err)
+	}
+
+	sub := newFakeTrackingSub()
+	store.subscribe = func(context.Context) (trackingSub, error) { return sub, nil }
+	stop1, _ := store.Watch(func(version.CacheKey, bool) {})
+	stop2, _ := store.Watch(func(version.CacheKey, bool) {})
+	stop1()
+	if sub.closeOnce.Load() {
+		t.Fatalf("tracking closed while a watcher remains")
+	}
+	stop2()
+	if !sub.closeOnce.Load() || store.tracker.Load() != nil {
+		t.Fatalf("last stop should close the tracking connection")
+	}
+}
+
+func TestParseSnapshotFencePendingMark(t *testing.T) {
+	t.Parallel()
+
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+	key := version.NewCacheKey("k")
+	future := time.Now().Add(time.Minute).UnixMilli()
+	past := time.Now().Add(-time.Minute).UnixMilli()
+
+	snap, err := parseSnapshotFence(key, fmt.Sprintf("%s|%d|token", fence, future))
+	if err != nil || !snap.Pending || !snap.Fence.Equal(fence) {
+		t.Fatalf("live mark: snap=%+v err=%v", snap, err)
+	}
+	snap, err = parseSnapshotFence(key, fmt.Sprintf("%s|%d|token", fence, past))
+	if err != nil || snap.Pending || !snap.Fence.Equal(fence) {
+		t.Fatalf("expired mark: snap=%+v err=%v", snap, err)
+	}
+	if _, err := parseSnapshotFence(key, fence.String()+"|soon"); !errors.Is(err, ErrFenceParse) {
+		t.Fatalf("bad mark err=%v want ErrFenceParse", err)
+	}
+}
+
+func TestVersionStoreBeginWriteScript(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{}
+	store, err := NewVersionStoreWithOptions(VersionStoreOptions{Client: client, VersionTTL: time.Second})
+	if err != nil {
+		t.Fatalf("NewVersionStoreWithOptions: %v", err)
+	}
+
+	key := version.NewCacheKey("k")
+	token, err := store.BeginWrite(context.Background(), key, 30*time.Second)
+	if err != nil || token == "" {
+		t.Fatalf("BeginWrite: token=%q err=%v", token, err)
+	}
+	if len(client.keys) != 2 || client.keys[0] != versionStorageKey(key) || client.keys[1] != leaseStorageKey(key) {
+		t.Fatalf("script keys=%v", client.keys)
+	}
+	if client.args[1] != token || client.args[2] != int64(30000) || client.args[3] != int64(1000) {
+		t.Fatalf("script args=%v", client.args)
+	}
+}
+
+func TestKeyMutatorSetIfVersionWritePending(t *testing.T) {
+	t.Parallel()
+
+	mutator, err := NewKeyMutator(&scriptCmdClient{result: 3, resultSet: true})
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+	stored, err := mutator.SetIfVersion(
+		context.Background(),
+		version.NewCacheKey("k"),
+		"value-key",
+		version.Snapshot{Fence: fence, Exists: true},
+		[]byte("payload"),
+		time.Minute,
+	)
+	if stored || !errors.Is(err, cascache.ErrWritePending) {
+		t.Fatalf("SetIfVersion: stored=%v err=%v want ErrWritePending", stored, err)
+	}
+}
+
+func TestKeyMutatorInvalidateIfVersionMismatch(t *testing.T) {
+	t.Parallel()
+
+	client := &scriptCmdClient{result: 0, resultSet: true}
+	mutator, err := NewKeyMutator(client)
+	if err != nil {
+		t.Fatalf("NewKeyMutator: %v", err)
+	}
+	fence, err := version.NewFence()
+	if err != nil {
+		t.Fatalf("NewFence: %v", err)
+	}
+
+	key := version.NewCacheKey("k")
+	ok, err := mutator.InvalidateIfVersion(context.Background(), key, "value-key", version.Snapshot{Fence: fence, Exists: true})
+	if err != nil || ok {
+		t.Fatalf("InvalidateIfVersion=%v err=%v, want false", ok, err)
+	}
+	if want := []string{versionStorageKey(key), leaseStorageKey(key), "value-key"}; strings.Join(client.keys, " ") != strings.Join(want, " ") {
+		t.Fatalf("script keys=%v want %v", client.keys, want)
+	}
+	if client.args[0] != "0" || client.args[1] != fence.String() {
+		t.Fatalf("script args=%v want the expected fence", client.args)
+	}
+}
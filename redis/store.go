@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	goredis "github.com/redis/go-redis/v9"
@@ -20,11 +23,18 @@ type VersionStore struct {
 	versionTTL  time.Duration
 	closeOnce   sync.Once
 	closeErr    error
+
+	// subscribe opens the tracking connection behind Watch; tests replace it.
+	subscribe func(context.Context) (trackingSub, error)
+	trackMu   sync.Mutex
+	tracker   atomic.Pointer[tracker]
 }
 
 var (
-	_ version.Store     = (*VersionStore)(nil)
-	_ version.Refresher = (*VersionStore)(nil)
+	_ version.Store         = (*VersionStore)(nil)
+	_ version.Refresher     = (*VersionStore)(nil)
+	_ version.BatchAdvancer = (*VersionStore)(nil)
+	_ version.Watcher       = (*VersionStore)(nil)
 )
 
 var refreshScript = goredis.NewScript(`
@@ -68,11 +78,13 @@ func NewVersionStoreWithOptions(opts VersionStoreOptions) (*VersionStore, error)
 	if opts.Client == nil {
 		return nil, ErrNilClient
 	}
-	return &VersionStore{
+	s := &VersionStore{
 		rdb:         opts.Client,
 		closeClient: opts.CloseClient,
 		versionTTL:  opts.VersionTTL,
-	}, nil
+	}
+	s.subscribe = s.subscribeTracking
+	return s, nil
 }
 
 // Snapshot returns the current authoritative state.
@@ -82,6 +94,7 @@ func (s *VersionStore) Snapshot(ctx context.Context, cacheKey version.CacheKey)
 		return version.Snapshot{}, err
 	}
 
+	defer s.reportUntracked()
 	r, err := rdb.Get(ctx, s.key(cacheKey)).Result()
 	if err == goredis.Nil {
 		return version.Snapshot{}, nil
@@ -107,6 +120,7 @@ func (s *VersionStore) SnapshotMany(
 		return nil, err
 	}
 
+	defer s.reportUntracked()
 	if usesSlotRouting(rdb) {
 		return s.snapshotManyPipeline(ctx, rdb, cacheKeys)
 	}
@@ -221,7 +235,8 @@ func (s *VersionStore) CreateIfMissing(ctx context.Context, cacheKey version.Cac
 	return c, false, err
 }
 
-// Advance moves the authoritative fence to a fresh value.
+// Advance moves the authoritative fence to a fresh value and drops any fill
+// lease on the key. An unexpired pending mark is kept.
 func (s *VersionStore) Advance(ctx context.Context, cacheKey version.CacheKey) (version.Snapshot, error) {
 	rdb, err := s.client()
 	if err != nil {
@@ -233,11 +248,74 @@ func (s *VersionStore) Advance(ctx context.Context, cacheKey version.CacheKey) (
 		return version.Snapshot{}, err
 	}
 
-	st := f.String()
-	if err := rdb.Set(ctx, s.key(cacheKey), st, s.versionTTL).Err(); err != nil {
+	r, err := advanceScript.Run(
+		ctx,
+		rdb,
+		[]string{s.key(cacheKey), leaseStorageKey(cacheKey)},
+		f.String(),
+		ttlMillis(s.versionTTL),
+	).Int()
+	if err != nil {
 		return version.Snapshot{}, err
 	}
-	return version.Snapshot{Fence: f, Exists: true}, nil
+	return version.Snapshot{Fence: f, Exists: true, Pending: r == 2}, nil
+}
+
+// AdvanceMany runs the advance script for every key in one pipeline, like
+// KeyMutator.InvalidateMany. Cluster clients split the pipeline per node.
+// Keys whose script failed are omitted from the result and their errors are
+// joined into err.
+func (s *VersionStore) AdvanceMany(
+	ctx context.Context,
+	cacheKeys []version.CacheKey,
+) (map[version.CacheKey]version.Snapshot, error) {
+	if len(cacheKeys) == 0 {
+		return map[version.CacheKey]version.Snapshot{}, nil
+	}
+
+	rdb, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	fs := make([]version.Fence, len(cacheKeys))
+	for i := range cacheKeys {
+		f, err := version.NewFence()
+		if err != nil {
+			return map[version.CacheKey]version.Snapshot{}, err
+		}
+		fs[i] = f
+	}
+
+	keys := make([][]string, len(cacheKeys))
+	args := make([][]any, len(cacheKeys))
+	for i, k := range cacheKeys {
+		keys[i] = []string{s.key(k), leaseStorageKey(k)}
+		args[i] = []any{fs[i].String(), ttlMillis(s.versionTTL)}
+	}
+
+	cmds := make([]*goredis.Cmd, len(cacheKeys))
+	_, _ = rdb.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i := range cmds {
+			cmds[i] = advanceScript.EvalSha(ctx, pipe, keys[i], args[i]...)
+		}
+		return nil
+	})
+
+	out := make(map[version.CacheKey]version.Snapshot, len(cacheKeys))
+	var errs []error
+	for i, cmd := range cmds {
+		r, err := cmd.Int()
+		if isNoScript(err) {
+			r, err = advanceScript.Run(ctx, rdb, keys[i], args[i]...).Int()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("advance %s: %w", cacheKeys[i], err))
+			continue
+		}
+		out[cacheKeys[i]] = version.Snapshot{Fence: fs[i], Exists: true, Pending: r == 2}
+	}
+	return out, errors.Join(errs...)
 }
 
 // Refresh extends or removes expiry for existing authoritative version state
@@ -263,10 +341,14 @@ func (s *VersionStore) Refresh(ctx context.Context, cacheKey version.CacheKey) (
 // Cleanup is not applicable for Redis by default.
 func (s *VersionStore) Cleanup(time.Duration) {}
 
-// Close closes the underlying Redis client only when this version store owns it.
-// Shared clients are left open by default.
+// Close stops client tracking and closes the underlying Redis client only when
+// this version store owns it. Shared clients are left open by default.
 func (s *VersionStore) Close(context.Context) error {
-	if s == nil || !s.closeClient {
+	if s == nil {
+		return nil
+	}
+	s.stopTracking()
+	if !s.closeClient {
 		return nil
 	}
 
@@ -312,10 +394,22 @@ func parseSnapshotValue(cacheKey version.CacheKey, raw any) (version.Snapshot, e
 	}
 }
 
+// parseSnapshotFence parses a bare fence or a fence marked by a pending
+// two-phase write, which is reported as Pending until its deadline.
 func parseSnapshotFence(cacheKey version.CacheKey, raw string) (version.Snapshot, error) {
-	f, err := version.ParseFence(raw)
+	fence, mark, marked := strings.Cut(raw, "|")
+	f, err := version.ParseFence(fence)
 	if err != nil {
 		return version.Snapshot{}, fmt.Errorf("%w at %s: %w", ErrFenceParse, cacheKey, err)
 	}
-	return version.Snapshot{Fence: f, Exists: true}, nil
+	snap := version.Snapshot{Fence: f, Exists: true}
+	if marked {
+		deadline, _, ok := strings.Cut(mark, "|")
+		ms, err := strconv.ParseInt(deadline, 10, 64)
+		if !ok || err != nil {
+			return version.Snapshot{}, fmt.Errorf("%w at %s: bad pending mark %q", ErrFenceParse, cacheKey, mark)
+		}
+		snap.Pending = time.Now().UnixMilli() < ms
+	}
+	return snap, nil
 }
@@ -0,0 +1,272 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// ErrTrackingUnsupported is returned by VersionStore.Watch for clients other
+// than *goredis.Client. Cluster and ring clients would need one tracking
+// connection per node.
+var ErrTrackingUnsupported = errors.New("cascache/redis: client tracking needs a *redis.Client")
+
+const (
+	// invalidateChannel is where Redis delivers tracking invalidations to a
+	// RESP2 connection that redirects tracking to itself.
+	invalidateChannel = "__redis__:invalidate"
+
+	trackingPing    = 15 * time.Second
+	trackingBackoff = 100 * time.Millisecond
+)
+
+// trackingSub is the receive side of the tracking connection. It is
+// satisfied by *goredis.PubSub, which reconnects and resubscribes on its own.
+type trackingSub interface {
+	ReceiveTimeout(ctx context.Context, timeout time.Duration) (any, error)
+	Ping(ctx context.Context, payload ...string) error
+	Close() error
+}
+
+// tracker fans invalidations of version keys out to watchers. live is false
+// until the subscription is confirmed and after any receive error; while it
+// is false every snapshot read reports a reset, as version.Watcher requires.
+type tracker struct {
+	sub    trackingSub
+	cancel context.CancelFunc
+	done   chan struct{}
+	live   atomic.Bool
+
+	mu   sync.RWMutex
+	fns  map[int]func(version.CacheKey, bool)
+	next int
+}
+
+// Watch implements version.Watcher with Redis server-assisted client-side
+// caching. The first watcher opens a dedicated RESP2 connection that runs
+// CLIENT TRACKING in BCAST mode on the version-key prefix, redirected to
+// itself, and subscribes to the invalidation channel. Every write to a
+// version key, from any client, is then reported to fn. A lost connection
+// reports a reset and keeps reporting one on every snapshot read until the
+// subscription is confirmed again. The last stop closes the connection.
+func (s *VersionStore) Watch(fn func(version.CacheKey, bool)) (func(), error) {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+
+	t := s.tracker.Load()
+	if t == nil {
+		sub, err := s.subscribe(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		t = startTracker(sub)
+		s.tracker.Store(t)
+	}
+	id := t.add(fn)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.trackMu.Lock()
+			defer s.trackMu.Unlock()
+			if t.remove(id) == 0 && s.tracker.CompareAndSwap(t, nil) {
+				t.close()
+			}
+		})
+	}, nil
+}
+
+// reportUntracked tells watchers to drop their copies when the tracking
+// connection is down. Snapshot reads call it before returning.
+func (s *VersionStore) reportUntracked() {
+	if t := s.tracker.Load(); t != nil && !t.live.Load() {
+		t.reset()
+	}
+}
+
+// stopTracking closes the tracking connection, if any.
+func (s *VersionStore) stopTracking() {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+	if t := s.tracker.Swap(nil); t != nil {
+		t.close()
+	}
+}
+
+// subscribeTracking opens the tracking connection on a private client that
+// shares the store client's options. OnConnect enables tracking before the
+// pub/sub connection subscribes, including after every reconnect.
+func (s *VersionStore) subscribeTracking(ctx context.Context) (trackingSub, error) {
+	c, ok := s.rdb.(*goredis.Client)
+	if !ok {
+		return nil, ErrTrackingUnsupported
+	}
+
+	opt := *c.Options()
+	opt.Protocol = 2
+	onConnect := opt.OnConnect
+	opt.OnConnect = func(ctx context.Context, cn *goredis.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		cmd := goredis.NewCmd(ctx,
+			"CLIENT", "TRACKING", "ON",
+			"REDIRECT", id,
+			"BCAST", "PREFIX", keyutil.VersionStoragePrefix,
+		)
+		return cn.Process(ctx, cmd)
+	}
+
+	rdb := goredis.NewClient(&opt)
+	ps := rdb.Subscribe(ctx, invalidateChannel)
+	return &ownedPubSub{PubSub: ps, rdb: rdb}, nil
+}
+
+// ownedPubSub closes the private client together with its subscription.
+type ownedPubSub struct {
+	*goredis.PubSub
+	rdb *goredis.Client
+}
+
+func (p *ownedPubSub) Close() error {
+	return errors.Join(p.PubSub.Close(), p.rdb.Close())
+}
+
+func startTracker(sub trackingSub) *tracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &tracker{
+		sub:    sub,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		fns:    make(map[int]func(version.CacheKey, bool)),
+	}
+	go t.run(ctx)
+	return t
+}
+
+func (t *tracker) add(fn func(version.CacheKey, bool)) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.next
+	t.next++
+	t.fns[id] = fn
+	return id
+}
+
+// remove unregisters a watcher and returns how many remain.
+func (t *tracker) remove(id int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.fns, id)
+	return len(t.fns)
+}
+
+func (t *tracker) close() {
+	t.cancel()
+	_ = t.sub.Close()
+	<-t.done
+}
+
+// run receives invalidations until closed. A quiet connection is pinged so a
+// dead one is noticed; any receive error marks tracking down until a
+// subscription confirmation or pong shows the connection works again.
+func (t *tracker) run(ctx context.Context) {
+	defer close(t.done)
+	for {
+		msg, err := t.sub.ReceiveTimeout(ctx, trackingPing)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			var ne net.Error
+			if !errors.As(err, &ne) || !ne.Timeout() {
+				t.down()
+			}
+			if perr := t.sub.Ping(ctx); perr != nil {
+				t.down()
+				select {
+				case <-time.After(trackingBackoff):
+				case <-ctx.Done():
+					return
+				}
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *goredis.Subscription:
+			if m.Kind == "subscribe" && m.Channel == invalidateChannel {
+				t.up()
+			}
+		case *goredis.Pong:
+			t.up()
+		case *goredis.Message:
+			if m.Channel == invalidateChannel {
+				t.invalidate(m)
+			}
+		}
+	}
+}
+
+// invalidate reports the version keys of one invalidation message. Keys
+// outside the version keyspace cannot be mapped back and cause a reset, as
+// does a message without keys, which Redis sends on FLUSHALL and FLUSHDB.
+func (t *tracker) invalidate(m *goredis.Message) {
+	keys := m.PayloadSlice
+	if m.Payload != "" {
+		keys = append(keys, m.Payload)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(keys) == 0 {
+		for _, fn := range t.fns {
+			fn(version.CacheKey{}, true)
+		}
+		return
+	}
+	for _, raw := range keys {
+		ck, ok := keyutil.ParseVersionStorageKey(raw)
+		for _, fn := range t.fns {
+			if ok {
+				fn(version.NewCacheKey(ck.String()), false)
+			} else {
+				fn(version.CacheKey{}, true)
+			}
+		}
+	}
+}
+
+// up marks tracking live. Changes made while it was down were not reported,
+// so watchers drop everything once more.
+func (t *tracker) up() {
+	if !t.live.Swap(true) {
+		t.reset()
+	}
+}
+
+func (t *tracker) down() {
+	t.live.Store(false)
+	t.reset()
+}
+
+func (t *tracker) reset() {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, fn := range t.fns {
+		fn(version.CacheKey{}, true)
+	}
+}
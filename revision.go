@@ -0,0 +1,129 @@
+package cascache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+)
+
+// Revision is a caller-supplied, totally ordered source revision, such as a
+// row version column or an HLCRevision. Unlike a Version's opaque fence it is
+// compared by magnitude. Zero means no revision.
+type Revision uint64
+
+// HLCRevision packs a hybrid logical clock reading into a Revision: wall
+// time in milliseconds in the upper 48 bits and the logical counter in the
+// lower 16, so revisions order by wall time first.
+func HLCRevision(wall time.Time, logical uint16) Revision {
+	return Revision(uint64(wall.UnixMilli())<<16 | uint64(logical))
+}
+
+// SetIfVersionAtRevision is SetIfVersion for values that carry a source
+// revision. The revision is recorded in the entry, and the write also reports
+// WriteOutcomeStaleRevision, storing nothing, when the entry currently cached
+// for key records a higher revision, whatever its fence. A fill that read an
+// older row than the one already cached can then never replace it, even
+// after the key was invalidated but before the entry was removed.
+//
+// With a KeyWriter implementing KeyRevisionWriter the comparison is atomic
+// with the write. Otherwise revisioned writes to a key are serialized within
+// this process only. A zero revision behaves like SetIfVersion.
+func (c *cache[V]) SetIfVersionAtRevision(
+	ctx context.Context,
+	key string,
+	value V,
+	version Version,
+	revision Revision,
+) (WriteResult, error) {
+	return c.SetIfVersionAtRevisionWithTTL(ctx, key, value, version, revision, c.defaultTTL)
+}
+
+// SetIfVersionAtRevisionWithTTL is SetIfVersionAtRevision with an explicit
+// TTL.
+func (c *cache[V]) SetIfVersionAtRevisionWithTTL(
+	ctx context.Context,
+	key string,
+	value V,
+	version Version,
+	revision Revision,
+	ttl time.Duration,
+) (WriteResult, error) {
+	if !c.enabled {
+		return WriteResult{Outcome: WriteOutcomeDisabled}, nil
+	}
+	if ttl == 0 {
+		ttl = c.defaultTTL
+	}
+
+	payload, err := c.codec.Encode(value)
+	if err != nil {
+		return WriteResult{}, opError(OpSet, key, err)
+	}
+	return c.writeEntry(ctx, key, version, wire.SingleEntry{Payload: payload, Revision: uint64(revision)}, ttl)
+}
+
+// staleRevision reports whether the entry stored under storageKey records a
+// revision above revision. Unreadable entries do not block the write.
+func (c *cache[V]) staleRevision(ctx context.Context, storageKey string, revision uint64) bool {
+	raw, ok, err := c.provider.Get(ctx, storageKey)
+	if err != nil || !ok {
+		return false
+	}
+	return wire.PeekRevision(raw) > revision
+}
+
+// revisionLocks serializes generic revisioned writes and conditional
+// advances per key so the check and the write are not interleaved
+// in-process. The lock is held across the backend round trips in between, so
+// it is per key: only callers on the same key wait, and a waiter gives up
+// when its context ends.
+type revisionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*revisionLock
+}
+
+// revisionLock is held while its token sits in ch. refs counts holders and
+// waiters so an idle lock can be dropped from the map.
+type revisionLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newRevisionLocks() *revisionLocks {
+	return &revisionLocks{locks: make(map[string]*revisionLock)}
+}
+
+// lock waits for key's lock and returns its unlock function, or ctx's error
+// when ctx ends first.
+func (l *revisionLocks) lock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	m, ok := l.locks[key]
+	if !ok {
+		m = &revisionLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = m
+	}
+	m.refs++
+	l.mu.Unlock()
+
+	select {
+	case m.ch <- struct{}{}:
+		return func() {
+			<-m.ch
+			l.release(key, m)
+		}, nil
+	case <-ctx.Done():
+		l.release(key, m)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *revisionLocks) release(key string, m *revisionLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m.refs--
+	if m.refs == 0 {
+		delete(l.locks, key)
+	}
+}
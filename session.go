@@ -0,0 +1,62 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+)
+
+// InvalidateWithVersion is Invalidate that also returns the key's new
+// version. Hand it to the session that made the write, for example through
+// Version.MarshalText in a cookie, and read with GetAtLeast so that session
+// never sees the key as it was before its own write:
+//
+//	v, err := cache.InvalidateWithVersion(ctx, id)
+//	...
+//	token, _ := v.MarshalText()
+//
+// It is a separate method so Invalidate keeps its error-only signature for
+// existing callers; both invalidate with the same contract.
+//
+// With a KeyInvalidator, which does not report the new fence, the version is
+// read back from the version store. If that read fails the key is already
+// invalidated, but the error is returned with the zero Version, which
+// GetAtLeast would accept like a plain Get and so must not be handed out as
+// a token.
+func (c *cache[V]) InvalidateWithVersion(ctx context.Context, key string) (Version, error) {
+	snap, err := c.invalidateAndFollowUp(ctx, key, c.invalidateDelays)
+	if err != nil || !c.enabled {
+		return Version{}, err
+	}
+	if !snap.Exists {
+		snap, err = c.loadSnapshot(ctx, c.versionKey(key))
+		if err != nil {
+			return Version{}, opError(OpInvalidate, key, err)
+		}
+	}
+	return versionFromSnapshot(snap), nil
+}
+
+// GetAtLeast is Get for a session holding a read-your-writes token. An entry
+// is served only if it was written under min or under a version that
+// supersedes it (see Version.Supersedes); anything older, which a replica
+// whose view lags the session's write may still consider current, is reported
+// as a miss so the caller loads from the source. Refused entries are left in
+// place for other readers. A zero min behaves like Get.
+//
+// Supersedes compares the wall clocks of the processes that created the
+// fences, in milliseconds. If those clocks are skewed by up to d, a fence
+// created less than d after min on a process whose clock runs behind can
+// read as older and is refused (a needless miss), and a fence created less
+// than d before min on a process whose clock runs ahead can read as newer
+// and is served. The guarantee therefore holds only for entries whose
+// version was created more than the clock skew before the session's write;
+// keep fence-creating hosts synchronized well within the time between writes
+// to one key.
+func (c *cache[V]) GetAtLeast(ctx context.Context, key string, min Version) (V, bool, error) {
+	r, err := c.readSingle(ctx, key)
+	if (r.ok || errors.Is(err, ErrNotFound)) && !r.ver.atLeast(min) {
+		var zero V
+		return zero, false, nil
+	}
+	return r.v, r.ok, err
+}
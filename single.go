@@ -2,6 +2,7 @@ package cascache
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/unkn0wn-root/cascache/v3/internal/keys"
@@ -28,45 +29,147 @@ type singleWrite struct {
 // If the current authoritative fence cannot be loaded, Get returns a miss without
 // serving or deleting the cached value. Provider read failures are returned
 // as *OpError with OpGet.
+//
+// A tombstone written by SetAbsentIfVersion passes gates (1) and (2) like a
+// value and is reported as ok=false with ErrNotFound.
 func (c *cache[V]) Get(ctx context.Context, key string) (V, bool, error) {
-	var zero V
-	if !c.enabled {
-		return zero, false, nil
+	v, _, ok, err := c.GetWithVersion(ctx, key)
+	return v, ok, err
+}
+
+// GetWithVersion is Get that also returns the version the served entry was
+// validated against: its embedded fence plus any dependency fences it
+// recorded. Passing that version to SetIfVersion writes only if nothing was
+// invalidated since the entry was read, which makes optimistic
+// read-modify-write cycles safe without a separate SnapshotVersion call.
+//
+// On a miss the returned Version is the zero value; snapshot with
+// SnapshotVersion before loading from the source as usual. A served tombstone
+// returns ErrNotFound together with the version it was validated against.
+func (c *cache[V]) GetWithVersion(ctx context.Context, key string) (V, Version, bool, error) {
+	r, err := c.readSingle(ctx, key)
+	return r.v, r.ver, r.ok, err
+}
+
+// singleRead is the result of one validated single-key read. ver is set for
+// hits and tombstones; timing is whatever the served entry recorded.
+type singleRead[V any] struct {
+	v      V
+	ver    Version
+	ok     bool
+	timing wire.Timing
+}
+
+// readSingle implements GetWithVersion and also exposes the entry's timing.
+func (c *cache[V]) readSingle(ctx context.Context, key string) (singleRead[V], error) {
+	if !c.enabled || c.outbox.missing(key) {
+		return singleRead[V]{}, nil
 	}
 
 	sk := c.singleKeys(key)
-	storageKey := sk.Value.String()
 	ckey := toVersionCacheKey(sk.Cache)
+	if c.near == nil {
+		return c.readStored(ctx, key, sk.Value.String(), ckey)
+	}
 
+	if r, served, err := c.readNear(ctx, key, ckey); served {
+		return r, err
+	}
+	r, err := c.readStored(ctx, key, sk.Value.String(), ckey)
+	if r.ok || errors.Is(err, ErrNotFound) {
+		c.near.put(ckey, r, err != nil)
+	}
+	return r, err
+}
+
+// readStored reads and validates key from L1, then from the provider.
+func (c *cache[V]) readStored(
+	ctx context.Context,
+	key string,
+	storageKey string,
+	ckey version.CacheKey,
+) (singleRead[V], error) {
+	if c.l1 != nil {
+		if r, served, err := c.readL1(ctx, key, storageKey, ckey); served {
+			return r, err
+		}
+	}
+
+	var (
+		raw []byte
+		r   singleRead[V]
+		err error
+	)
 	if c.keyReader != nil {
-		kr, err := c.keyReader.ReadKey(ctx, ckey, storageKey)
-		if err != nil {
-			return zero, false, opError(OpGet, key, err)
+		kr, kerr := c.keyReader.ReadKey(ctx, ckey, storageKey)
+		if kerr != nil {
+			return singleRead[V]{}, opError(OpGet, key, kerr)
 		}
 		if !kr.Found {
-			return zero, false, nil
+			return singleRead[V]{}, nil
 		}
-		return c.serveSingleRaw(ctx, key, storageKey, kr.Raw, kr.Snapshot, kr.SnapshotErr)
+		raw = kr.Raw
+		r, err = c.serveSingleRaw(ctx, key, storageKey, raw, kr.Snapshot, kr.SnapshotErr)
+	} else {
+		var ok bool
+		raw, ok, err = c.provider.Get(ctx, storageKey)
+		if err != nil {
+			return singleRead[V]{}, opError(OpGet, key, err)
+		}
+		if !ok {
+			return singleRead[V]{}, nil
+		}
+		r, err = c.serveSingleRawWithSnapshotLoad(ctx, key, storageKey, raw, ckey)
 	}
 
-	raw, ok, err := c.provider.Get(ctx, storageKey)
-	if err != nil {
-		return zero, false, opError(OpGet, key, err)
-	}
-	if !ok {
-		return zero, false, nil
+	// Reuse the frame that just validated from L2 for the next L1 hit.
+	if c.l1 != nil && (r.ok || errors.Is(err, ErrNotFound)) {
+		c.fillL1(ctx, storageKey, raw)
 	}
-
-	return c.serveSingleRawWithSnapshotLoad(ctx, key, storageKey, raw, ckey)
+	return r, err
 }
 
 // SnapshotVersion returns the current version for one logical key.
+// With NamespaceEpoch the version also records the current epoch, and with
+// KeyHierarchy the current fences of the key's ancestor prefixes.
 func (c *cache[V]) SnapshotVersion(ctx context.Context, key string) (Version, error) {
-	snap, err := c.loadSnapshot(ctx, c.versionKey(key))
+	return c.snapshotVersion(ctx, key, c.keyDeps(key))
+}
+
+// SnapshotVersionWithTags is SnapshotVersion for values derived from more
+// than one source entity. The returned version also records the current
+// fence of every tag, creating tags that do not exist yet. A value written
+// with it stops validating once the key or any tag is invalidated, so
+// snapshot before reading the source exactly as with SnapshotVersion.
+func (c *cache[V]) SnapshotVersionWithTags(ctx context.Context, key string, tags ...string) (Version, error) {
+	deps, err := c.tagDeps(key, tags)
 	if err != nil {
 		return Version{}, opError(OpSnapshot, key, err)
 	}
-	return versionFromSnapshot(snap), nil
+	return c.snapshotVersion(ctx, key, deps)
+}
+
+// snapshotVersion reads the key and its sorted dependency keys in one
+// version-store call.
+func (c *cache[V]) snapshotVersion(ctx context.Context, key string, deps []version.CacheKey) (Version, error) {
+	ckey := c.versionKey(key)
+	if len(deps) == 0 {
+		snap, err := c.loadSnapshot(ctx, ckey)
+		if err != nil {
+			return Version{}, opError(OpSnapshot, key, err)
+		}
+		return versionFromSnapshot(snap), nil
+	}
+
+	snaps, err := c.loadBatch(ctx, append([]version.CacheKey{ckey}, deps...))
+	if err != nil {
+		return Version{}, opError(OpSnapshot, key, err)
+	}
+	observed, err := c.snapshotDeps(ctx, deps, snaps)
+	if err != nil {
+		return Version{}, opError(OpSnapshot, key, err)
+	}
+	return versionFromSnapshot(snaps[ckey]).withDeps(observed), nil
 }
 
 // SetIfVersion writes a value only when the current version still matches the
@@ -91,6 +194,20 @@ func (c *cache[V]) SetIfVersionWithTTL(
 	value V,
 	version Version,
 	ttl time.Duration,
+) (WriteResult, error) {
+	return c.setValue(ctx, key, value, version, ttl, 0)
+}
+
+// setValue is SetIfVersionWithTTL for loader-based fills. delta is how long
+// the value took to load; with early refresh enabled it is recorded in the
+// entry together with the write time and TTL.
+func (c *cache[V]) setValue(
+	ctx context.Context,
+	key string,
+	value V,
+	version Version,
+	ttl time.Duration,
+	delta time.Duration,
 ) (WriteResult, error) {
 	if !c.enabled {
 		return WriteResult{Outcome: WriteOutcomeDisabled}, nil
@@ -103,28 +220,135 @@ func (c *cache[V]) SetIfVersionWithTTL(
 	if err != nil {
 		return WriteResult{}, opError(OpSet, key, err)
 	}
+	entry := wire.SingleEntry{Payload: payload, Timing: c.fillTiming(ttl, delta)}
+	return c.writeEntry(ctx, key, version, entry, ttl)
+}
+
+// fillTiming is the timing a fill records for early refresh: none unless it
+// is enabled and the load duration is known.
+func (c *cache[V]) fillTiming(ttl, delta time.Duration) wire.Timing {
+	if c.earlyBeta <= 0 || delta <= 0 || ttl <= 0 {
+		return wire.Timing{}
+	}
+	return wire.Timing{WrittenAt: time.Now(), TTL: ttl, Delta: delta}
+}
+
+// SetAbsentIfVersion records that key is confirmed absent from the source of
+// truth, under the same version check as SetIfVersion. The tombstone lives
+// for Options.NegativeTTL, is validated on read exactly like a value, and is
+// cleared by Invalidate. Snapshot before querying the source so a concurrent
+// insert followed by Invalidate rejects the tombstone.
+func (c *cache[V]) SetAbsentIfVersion(ctx context.Context, key string, version Version) (WriteResult, error) {
+	if !c.enabled {
+		return WriteResult{Outcome: WriteOutcomeDisabled}, nil
+	}
+	return c.writeEntry(ctx, key, version, wire.SingleEntry{Absent: true}, c.negativeTTL)
+}
+
+// writeEntry stores one single entry if version still matches. The entry's
+// fence is stamped here and its dependencies are taken from version.
+func (c *cache[V]) writeEntry(
+	ctx context.Context,
+	key string,
+	version Version,
+	entry wire.SingleEntry,
+	ttl time.Duration,
+) (WriteResult, error) {
+	return c.writeEntryAt(ctx, key, c.singleKeys(key), version, entry, ttl, false)
+}
+
+// writeEntryAt is writeEntry for a frame stored under sk.Value, which need not
+// be key's single value slot. Dependencies already set on entry are recorded
+// next to version's without being checked; version's win on a shared key.
+// With advance, the write also moves key to a fresh fence, as Update needs.
+func (c *cache[V]) writeEntryAt(
+	ctx context.Context,
+	key string,
+	sk keys.Single,
+	version Version,
+	entry wire.SingleEntry,
+	ttl time.Duration,
+	advance bool,
+) (WriteResult, error) {
+	if version.pending {
+		return WriteResult{Outcome: WriteOutcomeWritePending}, nil
+	}
+	defer c.dropCopies(ctx, sk)
+
+	depsOK, err := c.checkDeps(ctx, []string{key}, [][]wire.Dep{version.deps.list()})
+	if err != nil {
+		return WriteResult{Outcome: WriteOutcomeSnapshotError}, opError(OpSnapshot, key, err)
+	}
+	if !depsOK {
+		return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
+	}
 
-	sk := c.singleKeys(key)
 	ckey := toVersionCacheKey(sk.Cache)
+	entry.Deps = mergeDeps(version.deps.list(), entry.Deps)
 
-	if c.keyWriter != nil {
+	if aw, ok := c.keyWriter.(KeyAdvanceWriter); ok && advance {
+		s, kerr := aw.SetFrameAndAdvance(
+			ctx,
+			ckey,
+			sk.Value.String(),
+			version.snapshot(),
+			encodeEntry(entry),
+			ttl,
+		)
+		return nativeWriteResult(key, s, kerr)
+	}
+	if c.keyWriter != nil && entry.Plain() && !advance {
 		s, kerr := c.keyWriter.SetIfVersion(
 			ctx,
 			ckey,
 			sk.Value.String(),
 			version.snapshot(),
-			payload,
+			entry.Payload,
 			ttl,
 		)
-		if kerr != nil {
-			return WriteResult{}, opError(OpSet, key, kerr)
+		return nativeWriteResult(key, s, kerr)
+	}
+	if rw, ok := c.keyWriter.(KeyRevisionWriter); ok && entry.Revision != 0 && !advance {
+		s, kerr := rw.SetFrameIfRevision(
+			ctx,
+			ckey,
+			sk.Value.String(),
+			version.snapshot(),
+			entry.Revision,
+			encodeEntry(entry),
+			ttl,
+		)
+		return nativeWriteResult(key, s, kerr)
+	}
+	if fw, ok := c.keyWriter.(KeyFrameWriter); ok && entry.Revision == 0 && !advance {
+		s, kerr := fw.SetFrameIfVersion(
+			ctx,
+			ckey,
+			sk.Value.String(),
+			version.snapshot(),
+			encodeEntry(entry),
+			ttl,
+		)
+		return nativeWriteResult(key, s, kerr)
+	}
+
+	if entry.Revision != 0 {
+		unlock, err := c.revLocks.lock(ctx, sk.Value.String())
+		if err != nil {
+			return WriteResult{}, opError(OpSet, key, err)
 		}
-		if !s {
-			return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
+		defer unlock()
+		if c.staleRevision(ctx, sk.Value.String(), entry.Revision) {
+			return WriteResult{Outcome: WriteOutcomeStaleRevision}, nil
 		}
-		return WriteResult{Outcome: WriteOutcomeStored}, nil
 	}
-
+	held, err := c.leaseHeld(ctx, key, version)
+	if err != nil {
+		return WriteResult{Outcome: WriteOutcomeSnapshotError}, opError(OpSnapshot, key, err)
+	}
+	if held {
+		return WriteResult{Outcome: WriteOutcomeLeaseHeld}, nil
+	}
 	snap, ok, err := c.checkSnapshot(ctx, ckey, version)
 	if err != nil {
 		return WriteResult{Outcome: WriteOutcomeSnapshotError}, opError(OpSnapshot, key, err)
@@ -132,7 +356,17 @@ func (c *cache[V]) SetIfVersionWithTTL(
 	if !ok {
 		return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
 	}
-	if !version.IsMissing() {
+	switch {
+	case advance && !version.IsMissing():
+		// A missing version was just created above, so only an existing
+		// fence needs moving to keep a second writer from matching it.
+		if snap, ok, err = c.advanceIf(ctx, ckey, snap); err != nil {
+			return WriteResult{Outcome: WriteOutcomeSnapshotError}, opError(OpSnapshot, key, err)
+		}
+		if !ok {
+			return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
+		}
+	case !version.IsMissing():
 		var refreshed bool
 		refreshed, err = c.refreshVersion(ctx, ckey)
 		if err != nil {
@@ -142,8 +376,8 @@ func (c *cache[V]) SetIfVersionWithTTL(
 			return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
 		}
 	}
-
-	sw, err := c.buildSingleWrite(sk, snap.Fence, payload)
+	entry.Fence = snap.Fence
+	sw, err := c.buildSingleWrite(sk, entry)
 	if err != nil {
 		return WriteResult{}, opError(OpSet, key, err)
 	}
@@ -155,6 +389,27 @@ func (c *cache[V]) SetIfVersionWithTTL(
 	if !s {
 		return WriteResult{Outcome: WriteOutcomeProviderRejected}, nil
 	}
+	c.releaseFill(ctx, key, version)
+	return WriteResult{Outcome: WriteOutcomeStored}, nil
+}
+
+// nativeWriteResult translates a backend-native compare-and-write result.
+func nativeWriteResult(key string, stored bool, err error) (WriteResult, error) {
+	if errors.Is(err, ErrFillLeaseHeld) {
+		return WriteResult{Outcome: WriteOutcomeLeaseHeld}, nil
+	}
+	if errors.Is(err, ErrWritePending) {
+		return WriteResult{Outcome: WriteOutcomeWritePending}, nil
+	}
+	if errors.Is(err, ErrStaleRevision) {
+		return WriteResult{Outcome: WriteOutcomeStaleRevision}, nil
+	}
+	if err != nil {
+		return WriteResult{}, opError(OpSet, key, err)
+	}
+	if !stored {
+		return WriteResult{Outcome: WriteOutcomeVersionMismatch}, nil
+	}
 	return WriteResult{Outcome: WriteOutcomeStored}, nil
 }
 
@@ -172,12 +427,136 @@ func (c *cache[V]) SetIfVersionWithTTL(
 // readers will see the fence mismatch and self-heal on the next read.
 // If we deleted first and the advance then failed, a batch entry could reseed
 // the single with stale data and the fence check would still pass.
+//
+// With Options.MaxStale, the still-valid entry is first copied aside so
+// GetOrLoad can serve it as stale while it refreshes. With Options.Outbox, a
+// failed key is queued for retry before the error is returned. With
+// Options.InvalidateDelays, follow-up invalidations are scheduled as by
+// InvalidateWithDelay.
 func (c *cache[V]) Invalidate(ctx context.Context, key string) error {
+	return c.InvalidateWithDelay(ctx, key, c.invalidateDelays...)
+}
+
+// InvalidateIfVersion invalidates key only if its fence still equals v's,
+// for compensating actions that must not clobber an invalidation or Update
+// made since v was observed. Plain fills keep the fence, so a value written
+// with SetIfVersion since then is invalidated as well. It reports whether the
+// key was invalidated; a missing v matches a key that has no version state
+// yet. Dependency fences recorded in v are not compared.
+//
+// A ConditionalKeyInvalidator compares and invalidates in one atomic step, as
+// does a VersionStore implementing version.ConditionalAdvancer. With any other
+// store the compare and the advance are atomic only within this process. No
+// stale copy is kept, failures are not queued in Options.Outbox, and no
+// follow-up invalidations are scheduled: each would repeat the invalidation
+// without the condition.
+func (c *cache[V]) InvalidateIfVersion(ctx context.Context, key string, v Version) (bool, error) {
 	if !c.enabled {
-		return nil
+		return false, nil
 	}
 
 	sk := c.singleKeys(key)
+	vk := toVersionCacheKey(sk.Cache)
+	expected := version.Snapshot{Fence: v.fence, Exists: v.exists}
+
+	var (
+		ok  bool
+		err error
+	)
+	if ci, native := c.keyInvalidator.(ConditionalKeyInvalidator); native {
+		ok, err = ci.InvalidateIfVersion(ctx, vk, sk.Value.String(), expected)
+	} else if _, ok, err = c.advanceIf(ctx, vk, expected); ok {
+		// As in Invalidate, a failed delete leaves an entry that no longer
+		// validates.
+		_ = c.provider.Del(ctx, sk.Value.String())
+	}
+	if err != nil {
+		c.hooks.InvalidateOutage(key, err, nil)
+		return false, &InvalidateError{Key: key, AdvanceErr: opError(OpInvalidate, key, err)}
+	}
+	if ok {
+		c.dropLocal(ctx, sk)
+	}
+	return ok, nil
+}
+
+// advanceIf advances cacheKey only while its fence equals expected.
+func (c *cache[V]) advanceIf(
+	ctx context.Context,
+	cacheKey version.CacheKey,
+	expected version.Snapshot,
+) (version.Snapshot, bool, error) {
+	if ca, ok := c.versionStore.(version.ConditionalAdvancer); ok {
+		snap, advanced, err := ca.AdvanceIf(ctx, cacheKey, expected)
+		if advanced {
+			c.forgetFences(cacheKey)
+		}
+		if err != nil {
+			c.hooks.VersionAdvanceError(cacheKey, err)
+		}
+		return snap, advanced, err
+	}
+
+	unlock, err := c.revLocks.lock(ctx, cacheKey.String())
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	defer unlock()
+	cur, err := c.versionStore.Snapshot(ctx, cacheKey)
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	if cur.Exists != expected.Exists || (cur.Exists && !cur.Fence.Equal(expected.Fence)) {
+		return version.Snapshot{}, false, nil
+	}
+	snap, err := c.advanceVersion(ctx, cacheKey)
+	if err != nil {
+		return version.Snapshot{}, false, err
+	}
+	return snap, true, nil
+}
+
+func (c *cache[V]) invalidate(ctx context.Context, key string) error {
+	_, err := c.invalidateFenced(ctx, key)
+	return err
+}
+
+// invalidateAndFollowUp is one caller-facing invalidation: a failed key is
+// queued in the outbox and follow-ups are scheduled after delays.
+func (c *cache[V]) invalidateAndFollowUp(
+	ctx context.Context,
+	key string,
+	delays []time.Duration,
+) (version.Snapshot, error) {
+	snap, err := c.invalidateFenced(ctx, key)
+	var ie *InvalidateError
+	if errors.As(err, &ie) {
+		c.queueInvalidations(ctx, ie)
+	}
+	c.reinvalidateLater(key, delays)
+	return snap, err
+}
+
+// invalidateFenced is invalidate that also returns the new version state
+// when the backend reports it.
+func (c *cache[V]) invalidateFenced(ctx context.Context, key string) (version.Snapshot, error) {
+	if !c.enabled {
+		return version.Snapshot{}, nil
+	}
+
+	copies := c.captureStaleMany(ctx, []string{key})
+	snap, err := c.invalidateKeys(ctx, key, c.singleKeys(key))
+	if err == nil && len(copies) > 0 {
+		c.retainStale(ctx, copies, map[version.CacheKey]version.Snapshot{c.versionKey(key): snap})
+	}
+	return snap, err
+}
+
+// invalidateKeys advances key's fence and deletes its single entry, without
+// retaining a stale copy first. A KeyInvalidator does not report the new
+// fence, so the returned snapshot is then empty.
+func (c *cache[V]) invalidateKeys(ctx context.Context, key string, sk keys.Single) (version.Snapshot, error) {
+	defer c.dropLocal(ctx, sk)
 	if c.keyInvalidator != nil {
 		if err := c.keyInvalidator.Invalidate(
 			ctx,
@@ -185,26 +564,26 @@ func (c *cache[V]) Invalidate(ctx context.Context, key string) error {
 			sk.Value.String(),
 		); err != nil {
 			c.hooks.InvalidateOutage(key, err, nil)
-			return &InvalidateError{
+			return version.Snapshot{}, &InvalidateError{
 				Key:        key,
 				AdvanceErr: opError(OpInvalidate, key, err),
 			}
 		}
-		return nil
+		return version.Snapshot{}, nil
 	}
 
-	_, bErr := c.advanceVersion(ctx, toVersionCacheKey(sk.Cache))
+	snap, bErr := c.advanceVersion(ctx, toVersionCacheKey(sk.Cache))
 	delErr := c.provider.Del(ctx, sk.Value.String())
 
 	if bErr != nil {
 		c.hooks.InvalidateOutage(key, bErr, delErr)
-		return &InvalidateError{
+		return version.Snapshot{}, &InvalidateError{
 			Key:        key,
 			AdvanceErr: opError(OpInvalidate, key, bErr),
 			DelErr:     opError(OpInvalidate, key, delErr),
 		}
 	}
-	return nil
+	return snap, nil
 }
 
 func (c *cache[V]) serveSingleRaw(
@@ -214,19 +593,22 @@ func (c *cache[V]) serveSingleRaw(
 	raw []byte,
 	snap version.Snapshot,
 	snapErr error,
-) (V, bool, error) {
-	var zero V
-
-	dfence, payload, ok := c.decodeSingleRaw(ctx, storageKey, raw)
+) (singleRead[V], error) {
+	e, ok := c.decodeSingleRaw(ctx, storageKey, raw)
 	if !ok {
-		return zero, false, nil
+		return singleRead[V]{}, nil
 	}
 
 	if snapErr != nil {
 		c.hooks.VersionSnapshotError(1, snapErr)
-		return zero, false, nil
+		return singleRead[V]{}, nil
+	}
+
+	deps, err := c.loadBatch(ctx, c.depsToLoad(e.Deps))
+	if err != nil {
+		return singleRead[V]{}, nil
 	}
-	return c.serveSingleDecoded(ctx, key, storageKey, dfence, payload, snap)
+	return c.serveSingleDecoded(ctx, tierL2, key, storageKey, e, snap, deps)
 }
 
 func (c *cache[V]) serveSingleRawWithSnapshotLoad(
@@ -235,63 +617,83 @@ func (c *cache[V]) serveSingleRawWithSnapshotLoad(
 	storageKey string,
 	raw []byte,
 	ckey version.CacheKey,
-) (V, bool, error) {
-	var zero V
-
-	dfence, payload, ok := c.decodeSingleRaw(ctx, storageKey, raw)
+) (singleRead[V], error) {
+	e, ok := c.decodeSingleRaw(ctx, storageKey, raw)
 	if !ok {
-		return zero, false, nil
+		return singleRead[V]{}, nil
+	}
+
+	dk := c.depsToLoad(e.Deps)
+	if len(dk) == 0 {
+		snap, err := c.loadSnapshot(ctx, ckey)
+		if err != nil {
+			return singleRead[V]{}, nil
+		}
+		return c.serveSingleDecoded(ctx, tierL2, key, storageKey, e, snap, nil)
 	}
 
-	snap, err := c.loadSnapshot(ctx, ckey)
+	// Load the key and its dependencies in one version-store call.
+	snaps, err := c.loadBatch(ctx, append([]version.CacheKey{ckey}, dk...))
 	if err != nil {
-		return zero, false, nil
+		return singleRead[V]{}, nil
 	}
-	return c.serveSingleDecoded(ctx, key, storageKey, dfence, payload, snap)
+	return c.serveSingleDecoded(ctx, tierL2, key, storageKey, e, snaps[ckey], snaps)
 }
 
 func (c *cache[V]) decodeSingleRaw(
 	ctx context.Context,
 	storageKey string,
 	raw []byte,
-) (version.Fence, []byte, bool) {
-	dfence, payload, err := wire.DecodeSingle(raw)
+) (wire.SingleEntry, bool) {
+	e, err := wire.DecodeSingleEntry(raw)
 	if err != nil {
 		c.selfHealSingle(ctx, storageKey, SelfHealReasonCorrupt)
-		return version.Fence{}, nil, false
+		return wire.SingleEntry{}, false
 	}
-	return dfence, payload, true
+	return e, true
 }
 
+// serveSingleDecoded validates a decoded entry read from tier t against the key
+// snapshot and the current state of its dependencies in deps, then decodes and
+// guards it.
+// A hit also returns the version the entry was validated against, and so does
+// a validated tombstone, which reports ErrNotFound.
 func (c *cache[V]) serveSingleDecoded(
 	ctx context.Context,
+	t tier,
 	key string,
 	storageKey string,
-	dfence version.Fence,
-	payload []byte,
+	e wire.SingleEntry,
 	snap version.Snapshot,
-) (V, bool, error) {
-	var zero V
-
+	deps map[version.CacheKey]version.Snapshot,
+) (singleRead[V], error) {
 	if !snap.Exists {
-		c.selfHealSingle(ctx, storageKey, SelfHealReasonVersionMissing)
-		return zero, false, nil
+		c.selfHeal(ctx, t, storageKey, SelfHealReasonVersionMissing)
+		return singleRead[V]{}, nil
+	}
+	if !e.Fence.Equal(snap.Fence) || !c.depsCurrent(key, e.Deps, deps) {
+		c.selfHeal(ctx, t, storageKey, SelfHealReasonVersionMismatch)
+		return singleRead[V]{}, nil
 	}
-	if !dfence.Equal(snap.Fence) {
-		c.selfHealSingle(ctx, storageKey, SelfHealReasonVersionMismatch)
-		return zero, false, nil
+	if e.Absent {
+		return singleRead[V]{ver: entryVersion(e.Fence, e.Deps)}, ErrNotFound
 	}
 
-	v, err := c.codec.Decode(payload)
+	v, err := c.codec.Decode(e.Payload)
 	if err != nil {
-		c.selfHealSingle(ctx, storageKey, SelfHealReasonValueDecode)
-		return zero, false, nil
+		c.selfHeal(ctx, t, storageKey, SelfHealReasonValueDecode)
+		return singleRead[V]{}, nil
 	}
 	if guardReason := c.guardSingleRead(ctx, key, v); guardReason != "" {
-		c.selfHealSingle(ctx, storageKey, guardReason)
-		return zero, false, nil
-	}
-	return v, true, nil
+		c.selfHeal(ctx, t, storageKey, guardReason)
+		return singleRead[V]{}, nil
+	}
+	return singleRead[V]{
+		v:      v,
+		ver:    entryVersion(e.Fence, e.Deps),
+		ok:     true,
+		timing: e.Timing,
+	}, nil
 }
 
 // selfHealSingle deletes one unusable single entry and emits the matching
@@ -303,12 +705,8 @@ func (c *cache[V]) selfHealSingle(ctx context.Context, storageKey string, reason
 
 // buildSingleWrite builds the provider payload and admission metadata for a
 // single entry write from an already encoded value payload.
-func (c *cache[V]) buildSingleWrite(
-	sk keys.Single,
-	fence version.Fence,
-	payload []byte,
-) (singleWrite, error) {
-	wireb, err := wire.EncodeSingle(fence, payload)
+func (c *cache[V]) buildSingleWrite(sk keys.Single, e wire.SingleEntry) (singleWrite, error) {
+	wireb, err := wire.EncodeSingleEntry(e)
 	if err != nil {
 		return singleWrite{}, err
 	}
@@ -354,16 +752,16 @@ func (c *cache[V]) guardSingleRead(ctx context.Context, key string, value V) Sel
 func (c *cache[V]) addSingle(
 	ctx context.Context,
 	key string,
-	fence version.Fence,
-	payload []byte,
+	e wire.SingleEntry,
 	ttl time.Duration,
 ) error {
 	sk := c.singleKeys(key)
-	sw, err := c.buildSingleWrite(sk, fence, payload)
+	sw, err := c.buildSingleWrite(sk, e)
 	if err != nil {
 		return err
 	}
 	_, err = c.adder.Add(ctx, sw.storageKey, sw.wire, sw.cost, ttl)
+	c.dropCopies(ctx, sk)
 	return err
 }
 
@@ -385,15 +783,15 @@ func (c *cache[V]) setSingle(ctx context.Context, sw singleWrite, ttl time.Durat
 func (c *cache[V]) writeSingle(
 	ctx context.Context,
 	key string,
-	fence version.Fence,
-	payload []byte,
+	e wire.SingleEntry,
 	ttl time.Duration,
 ) error {
 	sk := c.singleKeys(key)
-	sw, err := c.buildSingleWrite(sk, fence, payload)
+	sw, err := c.buildSingleWrite(sk, e)
 	if err != nil {
 		return err
 	}
 	_, err = c.setSingle(ctx, sw, ttl)
+	c.dropCopies(ctx, sk)
 	return err
 }
@@ -0,0 +1,246 @@
+package cascache
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// Stale-while-revalidate keeps the last valid frame of an invalidated single
+// key in a separate provider slot for up to Options.MaxStale. Only GetOrLoad
+// reads that slot: on a miss it serves the stale value flagged as stale and
+// starts one background refresh through the normal fill path. Get, GetMany and
+// every other read stay strict.
+//
+// A stale frame carries the fence its invalidation moved the key to, and keeps
+// the dependency fences of the entry it copies. It is refused once the key is
+// invalidated or updated again, or once any dependency moves, so it is never
+// more than one invalidation behind. The copy is read before the invalidation
+// and stored after it, without a lock: a write that lands in between can
+// leave it one value behind that write until MaxStale passes.
+
+// staleCopy is a single entry validated before its key is invalidated.
+type staleCopy struct {
+	key  string
+	ckey version.CacheKey
+	e    wire.SingleEntry
+}
+
+// captureStale reads key's currently valid single entry, to be kept as a
+// stale copy once the invalidation succeeds. Entries that fail validation,
+// tombstones, and any read error report false.
+func (c *cache[V]) captureStale(ctx context.Context, key string) (staleCopy, bool) {
+	sk := c.singleKeys(key)
+	raw, ok, err := c.provider.Get(ctx, sk.Value.String())
+	if err != nil || !ok {
+		return staleCopy{}, false
+	}
+	e, err := wire.DecodeSingleEntry(raw)
+	if err != nil || e.Absent {
+		return staleCopy{}, false
+	}
+
+	ckey := toVersionCacheKey(sk.Cache)
+	snaps, err := c.loadBatch(ctx, append([]version.CacheKey{ckey}, c.depsToLoad(e.Deps)...))
+	if err != nil {
+		return staleCopy{}, false
+	}
+	snap := snaps[ckey]
+	if !snap.Exists || !e.Fence.Equal(snap.Fence) || !c.depsCurrent(key, e.Deps, snaps) {
+		return staleCopy{}, false
+	}
+	return staleCopy{key: key, ckey: ckey, e: e}, true
+}
+
+// captureStaleMany runs captureStale for every key when MaxStale is enabled.
+func (c *cache[V]) captureStaleMany(ctx context.Context, keys []string) []staleCopy {
+	if c.maxStale <= 0 {
+		return nil
+	}
+	var out []staleCopy
+	for _, k := range keys {
+		if sc, ok := c.captureStale(ctx, k); ok {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// invalidatedCopies drops the copies of keys whose invalidation failed.
+func invalidatedCopies(copies []staleCopy, failed []*InvalidateError) []staleCopy {
+	if len(failed) == 0 {
+		return copies
+	}
+	skip := make(map[string]struct{}, len(failed))
+	for _, ie := range failed {
+		skip[ie.Key] = struct{}{}
+	}
+	out := copies[:0]
+	for _, sc := range copies {
+		if _, ok := skip[sc.key]; !ok {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// retainStale stores copies in their stale slots after their keys were
+// invalidated, stamped with the fence each invalidation moved its key to.
+// fences holds those fences when the invalidation reported them; the rest are
+// loaded here. Copies whose fence cannot be read are dropped.
+func (c *cache[V]) retainStale(ctx context.Context, copies []staleCopy, fences map[version.CacheKey]version.Snapshot) {
+	if len(copies) == 0 {
+		return
+	}
+	var load []version.CacheKey
+	for _, sc := range copies {
+		if !fences[sc.ckey].Exists {
+			load = append(load, sc.ckey)
+		}
+	}
+	if len(load) > 0 {
+		loaded, err := c.loadBatch(ctx, load)
+		if err != nil {
+			return
+		}
+		merged := make(map[version.CacheKey]version.Snapshot, len(fences)+len(loaded))
+		maps.Copy(merged, fences)
+		maps.Copy(merged, loaded)
+		fences = merged
+	}
+
+	for _, sc := range copies {
+		snap := fences[sc.ckey]
+		if !snap.Exists {
+			continue
+		}
+		e := sc.e
+		e.Fence = snap.Fence
+		raw, err := wire.EncodeSingleEntry(e)
+		if err != nil {
+			continue
+		}
+		staleKey := keyutil.StaleValueKey(c.singleKeys(sc.key).Cache).String()
+		_, _ = c.provider.Set(ctx, staleKey, raw, c.computeSetCost(staleKey, raw, false, 1), c.maxStale)
+	}
+}
+
+// getStale returns the retained value for key, if any. Unusable stale frames,
+// including ones the key or a dependency has moved past, are deleted and
+// reported like single-entry self-heals.
+func (c *cache[V]) getStale(ctx context.Context, key string) (V, bool) {
+	var zero V
+
+	sk := c.singleKeys(key)
+	staleKey := keyutil.StaleValueKey(sk.Cache).String()
+	raw, ok, err := c.provider.Get(ctx, staleKey)
+	if err != nil || !ok {
+		return zero, false
+	}
+	e, err := wire.DecodeSingleEntry(raw)
+	if err != nil || e.Absent {
+		c.selfHealSingle(ctx, staleKey, SelfHealReasonCorrupt)
+		return zero, false
+	}
+
+	ckey := toVersionCacheKey(sk.Cache)
+	snaps, err := c.loadBatch(ctx, append([]version.CacheKey{ckey}, c.depsToLoad(e.Deps)...))
+	if err != nil {
+		return zero, false
+	}
+	snap := snaps[ckey]
+	if !snap.Exists {
+		c.selfHealSingle(ctx, staleKey, SelfHealReasonVersionMissing)
+		return zero, false
+	}
+	if !e.Fence.Equal(snap.Fence) || !c.depsCurrent(key, e.Deps, snaps) {
+		c.selfHealSingle(ctx, staleKey, SelfHealReasonVersionMismatch)
+		return zero, false
+	}
+
+	v, err := c.codec.Decode(e.Payload)
+	if err != nil {
+		c.selfHealSingle(ctx, staleKey, SelfHealReasonValueDecode)
+		return zero, false
+	}
+	if guardReason := c.guardSingleRead(ctx, key, v); guardReason != "" {
+		c.selfHealSingle(ctx, staleKey, guardReason)
+		return zero, false
+	}
+	return v, true
+}
+
+// refreshAsync starts one background fill for key unless a fill is already
+// running in this process, and reports whether it started one. With fill
+// leases the fill is skipped when another caller holds the lease. A stored
+// refresh drops any stale copy so it is not served again if the fresh entry
+// is evicted early.
+func (c *cache[V]) refreshAsync(ctx context.Context, key string, load LoadFunc[V]) bool {
+	call, leader := c.fills.join(key)
+	if !leader {
+		return false
+	}
+
+	started := c.background.goCtx(ctx, func(ctx context.Context) {
+		c.fillSingle(ctx, key, load, call, true)
+		if c.maxStale > 0 && call.write.Stored() {
+			_ = c.provider.Del(ctx, keyutil.StaleValueKey(c.singleKeys(key).Cache).String())
+		}
+	})
+	if !started {
+		c.fills.finish(key, call)
+	}
+	return started
+}
+
+// background tracks goroutines the cache starts on behalf of callers so
+// Close can cancel them and wait for them to exit.
+type background struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{ctx: ctx, cancel: cancel}
+}
+
+// goCtx runs f in a new goroutine with a context that keeps parent's values
+// but is canceled only by close. It reports false once close has started.
+func (b *background) goCtx(parent context.Context, f func(context.Context)) bool {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return false
+	}
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(b.ctx, cancel)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+		defer stop()
+		f(ctx)
+	}()
+	return true
+}
+
+// close cancels running goroutines and waits for them to exit.
+func (b *background) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	b.cancel()
+	b.wg.Wait()
+}
@@ -0,0 +1,163 @@
+package cascache
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+)
+
+// The batch superset index lets GetMany reuse a batch entry written for a
+// larger key set. It is one provider entry per namespace holding the sorted
+// key sets of the most recent batch writes, newest first, capped at
+// BatchSupersetIndex sets and maxBatchIndexBytes encoded. Storage keys are
+// derived from the sets, so the index holds nothing else. It is a hint: a
+// listed entry may have expired or been rejected, and any read or write
+// failure only costs reuse.
+
+const (
+	// maxBatchIndexBytes bounds the encoded index, so a few large key sets
+	// cannot make every batch write and superset lookup move a large value.
+	maxBatchIndexBytes = 64 << 10
+
+	// batchIndexPruneInterval is how often reads of one cache may rewrite the
+	// index to drop entries that no longer serve requests. Writes push such
+	// entries out anyway; pruning only saves lookups until they do.
+	batchIndexPruneInterval = time.Second
+)
+
+// loadSupersetHit serves sortedRequested from the smallest indexed batch entry
+// whose key set strictly contains it. Listed entries that no longer serve the
+// request are dropped from the index, at most once per
+// batchIndexPruneInterval.
+func (c *cache[V]) loadSupersetHit(ctx context.Context, sortedRequested []string) (batchHit[V], bool) {
+	sets, err := c.readBatchIndex(ctx)
+	if err != nil {
+		return batchHit[V]{}, false
+	}
+	var cands [][]string
+	for _, set := range sets {
+		if len(set) > len(sortedRequested) && containsSorted(set, sortedRequested) {
+			cands = append(cands, set)
+		}
+	}
+	slices.SortStableFunc(cands, func(a, b []string) int { return cmp.Compare(len(a), len(b)) })
+
+	var dead [][]string
+	defer func() {
+		if len(dead) != 0 && c.mayPruneBatchIndex() {
+			c.updateBatchIndex(ctx, func(sets [][]string) [][]string {
+				return slices.DeleteFunc(sets, func(s []string) bool {
+					return slices.ContainsFunc(dead, func(d []string) bool { return slices.Equal(s, d) })
+				})
+			})
+		}
+	}()
+	for _, set := range cands {
+		bk, err := c.batchKeySorted(set)
+		if err != nil {
+			dead = append(dead, set)
+			continue
+		}
+		hit, ok, err := c.loadBatchHitAt(ctx, bk.String(), sortedRequested)
+		if err != nil {
+			return batchHit[V]{}, false
+		}
+		if ok {
+			return hit, true
+		}
+		dead = append(dead, set)
+	}
+	return batchHit[V]{}, false
+}
+
+// recordBatchSet lists the key set of a stored batch entry in the index.
+func (c *cache[V]) recordBatchSet(ctx context.Context, sortedKeys []string) {
+	if len(sortedKeys) < 2 {
+		return // no request is a strict subset worth serving
+	}
+	c.updateBatchIndex(ctx, func(sets [][]string) [][]string {
+		sets = slices.DeleteFunc(sets, func(s []string) bool { return slices.Equal(s, sortedKeys) })
+		return append([][]string{sortedKeys}, sets...)
+	})
+}
+
+// mayPruneBatchIndex reports whether a read may rewrite the index now.
+func (c *cache[V]) mayPruneBatchIndex() bool {
+	now := time.Now().UnixNano()
+	last := c.batchIndexPruned.Load()
+	return now-last >= int64(batchIndexPruneInterval) && c.batchIndexPruned.CompareAndSwap(last, now)
+}
+
+// updateBatchIndex rewrites the index with fn applied to its current sets,
+// keeping the first batchIndexSize that fit in maxBatchIndexBytes; a set that
+// does not fit is skipped. A corrupt index restarts empty; one that cannot be
+// read is left alone.
+func (c *cache[V]) updateBatchIndex(ctx context.Context, fn func([][]string) [][]string) {
+	sets, err := c.readBatchIndex(ctx)
+	if err != nil && !errors.Is(err, wire.ErrCorrupt) {
+		return
+	}
+	sets = fn(sets)
+	sets = boundKeySets(sets, c.batchIndexSize, maxBatchIndexBytes)
+	raw, err := wire.EncodeKeySets(sets)
+	if err != nil {
+		return
+	}
+	key := c.space.BatchIndexValueKey().String()
+	ok, err := c.provider.Set(ctx, key, raw, c.computeSetCost(key, raw, false, 1), c.batchTTL)
+	if err == nil && !ok {
+		c.hooks.ProviderSetRejected(key, false)
+	}
+}
+
+// readBatchIndex returns the indexed key sets, none when the index is absent,
+// and wire.ErrCorrupt when it does not decode.
+func (c *cache[V]) readBatchIndex(ctx context.Context) ([][]string, error) {
+	raw, ok, err := c.provider.Get(ctx, c.space.BatchIndexValueKey().String())
+	if err != nil || !ok {
+		return nil, err
+	}
+	return wire.DecodeKeySets(raw)
+}
+
+// boundKeySets keeps the first n sets whose EncodeKeySets encoding fits in
+// maxBytes, skipping sets that would overflow it.
+func boundKeySets(sets [][]string, n, maxBytes int) [][]string {
+	size := 4
+	kept := sets[:0]
+	for _, set := range sets {
+		if len(kept) == n {
+			break
+		}
+		ss := 4 + 4
+		for _, k := range set {
+			ss += 2 + len(k)
+		}
+		if size+ss > maxBytes {
+			continue
+		}
+		size += ss
+		kept = append(kept, set)
+	}
+	return kept
+}
+
+// containsSorted reports whether every key of sub is in set. Both must be
+// sorted and duplicate free.
+func containsSorted(set, sub []string) bool {
+	i := 0
+	for _, k := range sub {
+		for i < len(set) && set[i] < k {
+			i++
+		}
+		if i == len(set) || set[i] != k {
+			return false
+		}
+		i++
+	}
+	return true
+}
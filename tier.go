@@ -0,0 +1,218 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	keyutil "github.com/unkn0wn-root/cascache/v3/internal/keys"
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// The L1 tier is an optional in-process provider in front of the shared one.
+// It holds the same single-entry frames as L2, filled from validated L2 reads,
+// so an L1 hit still passes every Get gate: its fence and dependency fences
+// are compared against authoritative state before the value is served. When
+// the version store implements version.Watcher, that state comes from a local
+// fence cache kept current by the watch instead of a store round trip.
+
+// l1MaxFences bounds the local fence cache. Reaching it drops every cached
+// fence, which only costs store reads until the hot keys are loaded again.
+const l1MaxFences = 1 << 16
+
+// tier identifies which provider a single entry was read from so self-heals
+// delete it from the right place and report the matching hook.
+type tier uint8
+
+const (
+	tierL2 tier = iota
+	tierL1
+)
+
+// selfHeal deletes one unusable single entry from tier t and emits the
+// matching hook.
+func (c *cache[V]) selfHeal(ctx context.Context, t tier, storageKey string, reason SelfHealReason) {
+	if t == tierL1 {
+		_ = c.l1.Del(ctx, storageKey)
+		if h, ok := c.hooks.(L1Hooks); ok {
+			h.SelfHealL1(storageKey, reason)
+		}
+		return
+	}
+	c.selfHealSingle(ctx, storageKey, reason)
+}
+
+// readL1 serves key from L1 when its frame still validates. served=false means
+// the caller must read L2; an L1 entry that failed validation has already been
+// removed. L1 read errors are treated as misses.
+func (c *cache[V]) readL1(
+	ctx context.Context,
+	key string,
+	storageKey string,
+	ckey version.CacheKey,
+) (singleRead[V], bool, error) {
+	raw, ok, err := c.l1.Get(ctx, storageKey)
+	if err != nil || !ok {
+		return singleRead[V]{}, false, nil
+	}
+	e, err := wire.DecodeSingleEntry(raw)
+	if err != nil {
+		c.selfHeal(ctx, tierL1, storageKey, SelfHealReasonCorrupt)
+		return singleRead[V]{}, false, nil
+	}
+
+	snaps, err := c.fenceSnapshots(ctx, append([]version.CacheKey{ckey}, c.depsToLoad(e.Deps)...))
+	if err != nil {
+		return singleRead[V]{}, false, nil
+	}
+	r, err := c.serveSingleDecoded(ctx, tierL1, key, storageKey, e, snaps[ckey], snaps)
+	if r.ok || errors.Is(err, ErrNotFound) {
+		return r, true, err
+	}
+	return singleRead[V]{}, false, nil
+}
+
+// fillL1 stores a frame that just validated from L2 in L1.
+func (c *cache[V]) fillL1(ctx context.Context, storageKey string, raw []byte) {
+	_, _ = c.l1.Set(ctx, storageKey, raw, c.computeSetCost(storageKey, raw, false, 1), c.l1TTL)
+}
+
+// dropCopies removes the L1 frame and the near-cache value of one single
+// entry after it was rewritten in L2. A rewrite may keep the fence, so neither
+// copy would fail validation on its own.
+func (c *cache[V]) dropCopies(ctx context.Context, sk keyutil.Single) {
+	if c.l1 != nil {
+		_ = c.l1.Del(ctx, sk.Value.String())
+	}
+	if c.near != nil {
+		c.near.changed(toVersionCacheKey(sk.Cache), false)
+	}
+}
+
+// dropLocal clears every in-process trace of an invalidated key: its L1 frame,
+// its near-cache value, and its locally cached fence.
+func (c *cache[V]) dropLocal(ctx context.Context, sk keyutil.Single) {
+	c.dropCopies(ctx, sk)
+	c.forgetFences(toVersionCacheKey(sk.Cache))
+}
+
+// watchFences starts caching fences locally when the version store can
+// report their changes. fences stays nil if it cannot, and every L1 hit then
+// reads its fences from the store.
+func (c *cache[V]) watchFences() {
+	w, ok := c.versionStore.(version.Watcher)
+	if !ok {
+		return
+	}
+	c.fences = &fenceCache{}
+	stop, err := w.Watch(c.fenceChanged)
+	if err != nil {
+		c.fences = nil
+		return
+	}
+	c.stopWatch = stop
+}
+
+// forgetFences drops locally cached fences for keys this process advanced, so
+// it observes its own invalidations without waiting for the watch.
+func (c *cache[V]) forgetFences(keys ...version.CacheKey) {
+	if c.fences == nil {
+		return
+	}
+	for _, k := range keys {
+		c.fenceChanged(k, false)
+	}
+}
+
+// fenceChanged is the version.Watcher callback. It drops the local fence and
+// the near-cache value of key, or all of them on reset.
+func (c *cache[V]) fenceChanged(key version.CacheKey, reset bool) {
+	c.fences.changed(key, reset)
+	if c.near != nil {
+		c.near.changed(key, reset)
+	}
+}
+
+// fenceSnapshots returns authoritative state for keys, serving what it can
+// from the local fence cache and loading the rest from the version store.
+func (c *cache[V]) fenceSnapshots(
+	ctx context.Context,
+	keys []version.CacheKey,
+) (map[version.CacheKey]version.Snapshot, error) {
+	if c.fences == nil {
+		return c.loadBatch(ctx, keys)
+	}
+
+	snaps, missing, seq := c.fences.get(keys)
+	if len(missing) == 0 {
+		return snaps, nil
+	}
+	loaded, err := c.loadBatch(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	c.fences.put(seq, loaded)
+	maps.Copy(snaps, loaded)
+	return snaps, nil
+}
+
+// fenceCache holds authoritative snapshots while a version.Watcher reports
+// every change to them. seq counts reported changes: a load that overlapped
+// any change is not cached, because its result may predate that change.
+// Missing state is never cached.
+type fenceCache struct {
+	mu    sync.Mutex
+	seq   uint64
+	snaps map[version.CacheKey]version.Snapshot
+}
+
+// get returns the cached snapshots among keys, the keys that must be loaded,
+// and the change sequence to pass to put.
+func (f *fenceCache) get(
+	keys []version.CacheKey,
+) (map[version.CacheKey]version.Snapshot, []version.CacheKey, uint64) {
+	out := make(map[version.CacheKey]version.Snapshot, len(keys))
+	var missing []version.CacheKey
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range keys {
+		if s, ok := f.snaps[k]; ok {
+			out[k] = s
+			continue
+		}
+		missing = append(missing, k)
+	}
+	return out, missing, f.seq
+}
+
+// put caches loaded snapshots unless a change was reported since get.
+func (f *fenceCache) put(seq uint64, loaded map[version.CacheKey]version.Snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seq != seq {
+		return
+	}
+	if f.snaps == nil || len(f.snaps)+len(loaded) > l1MaxFences {
+		f.snaps = make(map[version.CacheKey]version.Snapshot, len(loaded))
+	}
+	for k, s := range loaded {
+		if s.Exists {
+			f.snaps[k] = s
+		}
+	}
+}
+
+// changed is the version.Watcher callback.
+func (f *fenceCache) changed(key version.CacheKey, reset bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	if reset {
+		f.snaps = nil
+		return
+	}
+	delete(f.snaps, key)
+}
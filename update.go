@@ -0,0 +1,122 @@
+package cascache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+)
+
+// Update applies fn to the cached value for key and writes the result back
+// only if the key was not invalidated in between, retrying on conflicts.
+//
+// Each attempt reads with GetWithVersion (or snapshots with SnapshotVersion
+// on a miss, passing found=false to fn), applies fn, and writes with
+// SetIfVersion, except that the write also moves the key to a fresh fence. A
+// plain SetIfVersion keeps the fence, so two writers that read the same
+// version could both store; moving it lets only one of them win and makes
+// the other retry on top of its value. A KeyAdvanceWriter compares, writes
+// and advances in one atomic step; otherwise the VersionStore compares and
+// advances, atomically when it implements version.ConditionalAdvancer and
+// within this process otherwise. A cached tombstone is also passed as found=false and
+// is replaced by the new value. A WriteOutcomeVersionMismatch is retried after a
+// jittered exponential backoff, up to Options.UpdateMaxAttempts attempts in
+// total; after that Update returns ErrUpdateConflict wrapped in an *OpError.
+//
+// With a near cache, fn receives a copy of the cached value decoded for
+// this attempt rather than the value near hits share.
+//
+// Errors returned by fn are passed through unchanged and stop the loop. Any
+// other write outcome, such as provider rejection, ends the loop with the
+// value fn produced.
+func (c *cache[V]) Update(ctx context.Context, key string, fn UpdateFunc[V]) (V, WriteResult, error) {
+	var zero V
+
+	for attempt := 0; ; attempt++ {
+		old, ver, found, err := c.GetWithVersion(ctx, key)
+		absent := errors.Is(err, ErrNotFound)
+		if err != nil && !absent {
+			return zero, WriteResult{}, err
+		}
+		if !found && !absent {
+			if ver, err = c.SnapshotVersion(ctx, key); err != nil {
+				return zero, WriteResult{}, err
+			}
+		}
+
+		if found && c.near != nil {
+			if old, err = c.copyValue(old); err != nil {
+				return zero, WriteResult{}, opError(OpUpdate, key, err)
+			}
+		}
+
+		v, err := fn(old, found)
+		if err != nil {
+			return zero, WriteResult{}, err
+		}
+
+		res, err := c.advanceValue(ctx, key, v, ver)
+		if err != nil || res.Outcome != WriteOutcomeVersionMismatch {
+			return v, res, err
+		}
+		if attempt+1 >= c.updateAttempts {
+			return zero, res, opError(OpUpdate, key, ErrUpdateConflict)
+		}
+		if err := sleepCtx(ctx, c.updateBackoff(attempt)); err != nil {
+			return zero, res, err
+		}
+	}
+}
+
+// advanceValue is SetIfVersion for Update: the write also moves key to a
+// fresh fence, so a concurrent Update that observed the same version fails.
+func (c *cache[V]) advanceValue(ctx context.Context, key string, value V, version Version) (WriteResult, error) {
+	if !c.enabled {
+		return WriteResult{Outcome: WriteOutcomeDisabled}, nil
+	}
+	payload, err := c.codec.Encode(value)
+	if err != nil {
+		return WriteResult{}, opError(OpSet, key, err)
+	}
+	entry := wire.SingleEntry{Payload: payload}
+	return c.writeEntryAt(ctx, key, c.singleKeys(key), version, entry, c.defaultTTL, true)
+}
+
+// copyValue returns a copy of v that shares no memory with it, through an
+// encode and decode round trip.
+func (c *cache[V]) copyValue(v V) (V, error) {
+	b, err := c.codec.Encode(v)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return c.codec.Decode(b)
+}
+
+// updateBackoff returns the delay before retry attempt+1: the base backoff
+// doubled per attempt, with equal jitter so conflicting writers spread out.
+func (c *cache[V]) updateBackoff(attempt int) time.Duration {
+	d := c.updateBase << min(attempt, 16)
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,21 +1,42 @@
 package cascache
 
-import vp "github.com/unkn0wn-root/cascache/v3/version"
+import (
+	"encoding/binary"
+
+	"github.com/unkn0wn-root/cascache/v3/internal/wire"
+	vp "github.com/unkn0wn-root/cascache/v3/version"
+)
 
 // Version is the per-key freshness token returned by the cache.
 // Callers should treat it as an compare-only value and pass it back
 // unchanged to versioned write APIs.
 //
-// The zero value is the missing-version token.
+// The zero value is the missing-version token. Versions are comparable, so
+// they work with == and as map keys, but == also tells apart versions that
+// carry different fill leases; Equal compares only the observed fences.
 type Version struct {
 	fence  vp.Fence
 	exists bool
+
+	// deps holds the fences observed for additional authoritative keys, such
+	// as the namespace epoch, sorted by key. Entries written with this version
+	// record them and stop validating once any of them moves.
+	deps depSet
+
+	// lease is the fill-lease token granted by AcquireFill, if any. Equal
+	// ignores it.
+	lease string
+
+	// pending records that a two-phase write was in progress when the
+	// version was observed; writes with it are always rejected.
+	pending bool
 }
 
 // Equal reports whether two versions refer to the same fence state.
-// Two missing versions are considered equal.
+// Two missing versions are considered equal when they observed the same
+// dependency fences.
 func (v Version) Equal(other Version) bool {
-	if v.exists != other.exists {
+	if v.exists != other.exists || v.deps != other.deps {
 		return false
 	}
 	if !v.exists {
@@ -24,6 +45,57 @@ func (v Version) Equal(other Version) bool {
 	return v.fence.Equal(other.fence)
 }
 
+// Supersedes reports whether v's fence was created after other's, meaning
+// the state other observed has since been invalidated. It is the ordered
+// companion of Equal and shares the limits of version.Fence.Supersedes: the
+// order follows the creating processes' clocks, and fences written by earlier
+// releases are unordered. Any existing version supersedes a missing one.
+// Dependency fences are ignored.
+func (v Version) Supersedes(other Version) bool {
+	if !v.exists {
+		return false
+	}
+	if !other.exists {
+		return true
+	}
+	return v.fence.Supersedes(other.fence)
+}
+
+// atLeast reports whether v is min or supersedes it. Every version is at
+// least the missing version.
+func (v Version) atLeast(min Version) bool {
+	if !min.exists {
+		return true
+	}
+	return v.exists && (v.fence.Equal(min.fence) || v.fence.Supersedes(min.fence))
+}
+
+// MarshalText implements encoding.TextMarshaler, so a version can travel in a
+// cookie or header as a read-your-writes token for GetAtLeast. The text holds
+// only the key's own fence: dependency fences, leases, and pending state are
+// dropped. A missing version encodes as empty text.
+func (v Version) MarshalText() ([]byte, error) {
+	if !v.exists {
+		return []byte{}, nil
+	}
+	return v.fence.MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for the form produced by
+// MarshalText.
+func (v *Version) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*v = Version{}
+		return nil
+	}
+	var f vp.Fence
+	if err := f.UnmarshalText(text); err != nil {
+		return err
+	}
+	*v = Version{fence: f, exists: true}
+	return nil
+}
+
 // IsMissing reports whether the version represents a key that has no
 // authoritative fence yet (i.e. the key has never been written).
 func (v Version) IsMissing() bool {
@@ -39,9 +111,16 @@ func (v Version) snapshot() vp.Snapshot {
 	return vp.Snapshot{
 		Fence:  v.fence,
 		Exists: true,
+		Lease:  v.lease,
 	}
 }
 
+// withDeps returns v carrying the given observed dependency fences.
+func (v Version) withDeps(deps []wire.Dep) Version {
+	v.deps = newDepSet(deps)
+	return v
+}
+
 // converts an internal version.Snapshot back to the
 // public Version returned to callers.
 func versionFromSnapshot(s vp.Snapshot) Version {
@@ -49,7 +128,54 @@ func versionFromSnapshot(s vp.Snapshot) Version {
 		return Version{}
 	}
 	return Version{
-		fence:  s.Fence,
+		fence:   s.Fence,
+		exists:  true,
+		lease:   s.Lease,
+		pending: s.Pending,
+	}
+}
+
+// entryVersion returns the version a validated cache entry was written with.
+func entryVersion(fence vp.Fence, deps []wire.Dep) Version {
+	return Version{
+		fence:  fence,
 		exists: true,
+		deps:   newDepSet(deps),
+	}
+}
+
+// depSet is an immutable encoding of a sorted dependency list that keeps
+// Version comparable: each dependency is its key length as a uvarint, the key,
+// and the binary fence. Equal lists encode to equal strings.
+type depSet string
+
+func newDepSet(deps []wire.Dep) depSet {
+	if len(deps) == 0 {
+		return ""
+	}
+	var b []byte
+	for _, d := range deps {
+		b = binary.AppendUvarint(b, uint64(len(d.Key)))
+		b = append(b, d.Key...)
+		b = d.Fence.AppendBinary(b)
+	}
+	return depSet(b)
+}
+
+// list decodes the dependencies, or returns nil when there are none.
+func (s depSet) list() []wire.Dep {
+	if s == "" {
+		return nil
+	}
+	var deps []wire.Dep
+	b := []byte(s)
+	for len(b) != 0 {
+		n, w := binary.Uvarint(b)
+		key := string(b[w : w+int(n)])
+		b = b[w+int(n):]
+		f, _ := vp.ParseFenceBinary(b[:vp.FenceSize])
+		b = b[vp.FenceSize:]
+		deps = append(deps, wire.Dep{Key: key, Fence: f})
 	}
+	return deps
 }
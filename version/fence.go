@@ -1,9 +1,13 @@
 package version
 
 import (
+	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"sync"
+	"time"
 )
 
 // fenceTokenSize is the canonical binary size of a Fence.
@@ -11,12 +15,24 @@ import (
 // In another words - don't or be careful
 const tokenSize = 16
 
+// FenceSize is the length of the binary form of a Fence.
+const FenceSize = tokenSize
+
+// Fences from NewFence are laid out as
+//
+//	tag(2) | wall ms(6) | counter(2) | random(6)
+//
+// The tag marks the layout; wall ms and counter form a per-process hybrid
+// logical clock that orders fences by creation. Tokens without the tag, such
+// as those written by earlier releases, are unordered.
+var orderedTag = [2]byte{0xCA, 0x01}
+
 // Fence is the authoritative compare-only freshness token for one key.
 //
 // Fence values are opaque. Callers and Store implementations may compare
 // them for equality and may store/restore them through the canonical text or
-// binary helpers below, but must not infer ordering or other semantics from the
-// token contents.
+// binary helpers below, but must not infer semantics from the token contents.
+// The one exception is Supersedes, which orders fences by creation time.
 //
 // For correctness, a live key must receive a fresh fence whenever authoritative
 // state is created or bumped. This includes recreation after retention cleanup
@@ -25,23 +41,71 @@ type Fence struct {
 	token [tokenSize]byte
 }
 
-// NewFence returns a fresh random authoritative fence token.
+// NewFence returns a fresh authoritative fence token: a creation clock
+// followed by 48 random bits. The tag keeps it non-zero.
+//
+// Uniqueness rests on the clock plus those 48 bits, down from the 128 random
+// bits of fences before the clock was added. One process never repeats a
+// clock reading, but two processes can create fences in the same millisecond
+// with the same counter, and those collide with probability 2^-48 per pair.
+// A collision would let an entry written under one fence validate against the
+// other.
 func NewFence() (Fence, error) {
 	var f Fence
-	for {
-		if _, err := rand.Read(f.token[:]); err != nil {
-			return Fence{}, err
-		}
-		if f != (Fence{}) {
-			return f, nil
-		}
+	copy(f.token[:2], orderedTag[:])
+	binary.BigEndian.PutUint64(f.token[2:10], fenceClock.next())
+	if _, err := rand.Read(f.token[10:]); err != nil {
+		return Fence{}, err
 	}
+	return f, nil
 }
 
 func (f Fence) Equal(other Fence) bool {
 	return f.token == other.token
 }
 
+// Supersedes reports whether f was created after other, so state fenced by
+// other has been replaced. Fences are ordered by the wall clock of the process
+// that created them, which makes the answer wrong by up to the clock skew
+// between processes. It is false when either fence carries no clock.
+func (f Fence) Supersedes(other Fence) bool {
+	a, ok := f.clock()
+	if !ok {
+		return false
+	}
+	b, ok := other.clock()
+	return ok && a > b
+}
+
+func (f Fence) clock() (uint64, bool) {
+	if !bytes.Equal(f.token[:2], orderedTag[:]) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(f.token[2:10]), true
+}
+
+// fenceClock is the hybrid logical clock stamped into new fences: unix
+// milliseconds in the upper 48 bits and a counter in the lower 16. It never
+// goes backwards within a process.
+var fenceClock hlc
+
+type hlc struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+func (c *hlc) next() uint64 {
+	now := uint64(time.Now().UnixMilli()) << 16
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now > c.last {
+		c.last = now
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
 func (f Fence) String() string {
 	// encode into a fixed size stack buffer so String avoids the extra []byte alloc.
 	var buf [tokenSize * 2]byte
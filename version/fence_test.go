@@ -3,7 +3,6 @@ package version
 import (
 	"bytes"
 	"crypto/rand"
-	"io"
 	"testing"
 )
 
@@ -99,19 +98,12 @@ func TestFenceStringMatchesAppendTextAcrossManyValues(t *testing.T) {
 	}
 }
 
-func TestNewFenceRetriesZeroToken(t *testing.T) {
+func TestNewFenceIsNonZeroWithZeroRandomBytes(t *testing.T) {
 	orig := rand.Reader
 	t.Cleanup(func() {
 		rand.Reader = orig
 	})
-
-	rand.Reader = io.MultiReader(
-		bytes.NewReader(make([]byte, tokenSize)),
-		bytes.NewReader([]byte{
-			1, 0, 0, 0, 0, 0, 0, 0,
-			0, 0, 0, 0, 0, 0, 0, 0,
-		}),
-	)
+	rand.Reader = bytes.NewReader(make([]byte, tokenSize))
 
 	f, err := NewFence()
 	if err != nil {
@@ -124,3 +116,31 @@ func TestNewFenceRetriesZeroToken(t *testing.T) {
 		t.Fatalf("NewFence returned a parse-invalid fence: %v", err)
 	}
 }
+
+func TestNewFenceSupersedesEarlierFences(t *testing.T) {
+	prev, err := NewFence()
+	if err != nil {
+		t.Fatalf("NewFence error: %v", err)
+	}
+	for range 1000 {
+		f, err := NewFence()
+		if err != nil {
+			t.Fatalf("NewFence error: %v", err)
+		}
+		if !f.Supersedes(prev) || prev.Supersedes(f) {
+			t.Fatalf("fence %s should supersede %s", f, prev)
+		}
+		prev = f
+	}
+	if prev.Supersedes(prev) {
+		t.Fatalf("a fence must not supersede itself")
+	}
+
+	legacy, err := ParseFenceBinary(bytes.Repeat([]byte{0xFF}, tokenSize))
+	if err != nil {
+		t.Fatalf("ParseFenceBinary error: %v", err)
+	}
+	if prev.Supersedes(legacy) || legacy.Supersedes(prev) {
+		t.Fatalf("fences without a clock must be unordered")
+	}
+}
@@ -15,6 +15,31 @@ import (
 type localEntry struct {
 	Fence     Fence
 	UpdatedAt time.Time
+
+	// Lease is the token of the fill lease held until LeaseUntil, if any.
+	Lease      string
+	LeaseUntil time.Time
+
+	// Pending is the token of the two-phase write marking the key until
+	// PendingUntil, if any.
+	Pending      string
+	PendingUntil time.Time
+}
+
+func (e localEntry) snapshot() Snapshot {
+	return Snapshot{
+		Fence:   e.Fence,
+		Exists:  true,
+		Pending: e.Pending != "" && time.Now().Before(e.PendingUntil),
+	}
+}
+
+// keepMark copies an unexpired pending mark from old, so advancing a key does
+// not end a two-phase write it does not hold.
+func (e *localEntry) keepMark(old localEntry, now time.Time) {
+	if old.Pending != "" && now.Before(old.PendingUntil) {
+		e.Pending, e.PendingUntil = old.Pending, old.PendingUntil
+	}
 }
 
 // LocalStore keeps authoritative fence state in-process (no network I/O).
@@ -38,9 +63,20 @@ type LocalStore struct {
 	// retention is the minimum age since the last advance after which a key may be
 	// pruned by Cleanup. A non-positive retention disables pruning.
 	retention time.Duration
+
+	watchMu  sync.RWMutex
+	watchers map[int]func(CacheKey, bool)
+	watchSeq int
 }
 
-var _ Store = (*LocalStore)(nil)
+var (
+	_ Store               = (*LocalStore)(nil)
+	_ BatchAdvancer       = (*LocalStore)(nil)
+	_ ConditionalAdvancer = (*LocalStore)(nil)
+	_ Watcher             = (*LocalStore)(nil)
+	_ Leaser              = (*LocalStore)(nil)
+	_ PendingWriter       = (*LocalStore)(nil)
+)
 
 // NewLocal constructs the in-process authoritative fence store used by the cache
 // by default. It does not start background cleanup and skips timestamp tracking
@@ -95,10 +131,7 @@ func (s *LocalStore) Snapshot(_ context.Context, k CacheKey) (Snapshot, error) {
 	if !ok {
 		return Snapshot{}, nil
 	}
-	return Snapshot{
-		Fence:  e.Fence,
-		Exists: true,
-	}, nil
+	return e.snapshot(), nil
 }
 
 // SnapshotMany returns the current authoritative state for all requested keys.
@@ -108,10 +141,7 @@ func (s *LocalStore) SnapshotMany(_ context.Context, ks []CacheKey) (map[CacheKe
 	for _, k := range ks {
 		e, ok := s.entries[k.String()]
 		if ok {
-			out[k] = Snapshot{
-				Fence:  e.Fence,
-				Exists: true,
-			}
+			out[k] = e.snapshot()
 			continue
 		}
 		out[k] = Snapshot{}
@@ -134,10 +164,7 @@ func (s *LocalStore) CreateIfMissing(_ context.Context, k CacheKey) (Snapshot, b
 	defer s.mu.Unlock()
 
 	if e, ok := s.entries[raw]; ok {
-		return Snapshot{
-			Fence:  e.Fence,
-			Exists: true,
-		}, false, nil
+		return e.snapshot(), false, nil
 	}
 
 	f, err := NewFence()
@@ -157,7 +184,8 @@ func (s *LocalStore) CreateIfMissing(_ context.Context, k CacheKey) (Snapshot, b
 }
 
 // Advance moves the authoritative state for key k to a fresh fence and updates UpdatedAt.
-// Missing keys are created with a fresh fence.
+// Missing keys are created with a fresh fence. An unexpired pending mark is
+// kept.
 func (s *LocalStore) Advance(_ context.Context, k CacheKey) (Snapshot, error) {
 	raw := k.String()
 	f, err := NewFence()
@@ -165,21 +193,205 @@ func (s *LocalStore) Advance(_ context.Context, k CacheKey) (Snapshot, error) {
 		return Snapshot{}, err
 	}
 
+	now := time.Now()
+	e := localEntry{Fence: f}
+	if s.trackUpdatedAt {
+		e.UpdatedAt = now
+	}
+
+	s.mu.Lock()
+	e.keepMark(s.entries[raw], now)
+	s.entries[raw] = e
+	s.mu.Unlock()
+	s.notify(k)
+	return e.snapshot(), nil
+}
+
+// AdvanceIf advances k like Advance while its fence still equals expected,
+// comparing under the same exclusive lock.
+func (s *LocalStore) AdvanceIf(_ context.Context, k CacheKey, expected Snapshot) (Snapshot, bool, error) {
+	raw := k.String()
+	f, err := NewFence()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	now := time.Now()
+	e := localEntry{Fence: f}
+	if s.trackUpdatedAt {
+		e.UpdatedAt = now
+	}
+
+	s.mu.Lock()
+	cur, ok := s.entries[raw]
+	if ok != expected.Exists || (ok && !cur.Fence.Equal(expected.Fence)) {
+		s.mu.Unlock()
+		return Snapshot{}, false, nil
+	}
+	e.keepMark(cur, now)
+	s.entries[raw] = e
+	s.mu.Unlock()
+	s.notify(k)
+	return e.snapshot(), true, nil
+}
+
+// AdvanceMany advances every key under one exclusive lock, keeping unexpired
+// pending marks like Advance. Fences are minted before the lock is taken, so a
+// fence generation failure advances nothing.
+func (s *LocalStore) AdvanceMany(_ context.Context, ks []CacheKey) (map[CacheKey]Snapshot, error) {
+	fs := make([]Fence, len(ks))
+	for i := range ks {
+		f, err := NewFence()
+		if err != nil {
+			return map[CacheKey]Snapshot{}, err
+		}
+		fs[i] = f
+	}
+
+	now := time.Now()
 	var updatedAt time.Time
 	if s.trackUpdatedAt {
-		updatedAt = time.Now()
+		updatedAt = now
+	}
+
+	out := make(map[CacheKey]Snapshot, len(ks))
+	s.mu.Lock()
+	for i, k := range ks {
+		e := localEntry{Fence: fs[i], UpdatedAt: updatedAt}
+		e.keepMark(s.entries[k.String()], now)
+		s.entries[k.String()] = e
+		out[k] = e.snapshot()
+	}
+	s.mu.Unlock()
+	s.notify(ks...)
+	return out, nil
+}
+
+// AcquireLease grants a fill lease on k unless an unexpired one exists,
+// creating k's fence first when it is missing.
+func (s *LocalStore) AcquireLease(_ context.Context, k CacheKey, ttl time.Duration) (Snapshot, bool, error) {
+	raw := k.String()
+	f, err := NewFence()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	token, err := NewFence()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[raw]
+	if !ok {
+		e = localEntry{Fence: f}
+		if s.trackUpdatedAt {
+			e.UpdatedAt = now
+		}
+	}
+	snap := e.snapshot()
+	if e.Lease != "" && now.Before(e.LeaseUntil) {
+		s.entries[raw] = e
+		return snap, false, nil
+	}
+
+	e.Lease = token.String()
+	e.LeaseUntil = now.Add(ttl)
+	s.entries[raw] = e
+	snap.Lease = e.Lease
+	return snap, true, nil
+}
+
+// LeaseHolder returns the token of the unexpired lease on k, or "".
+func (s *LocalStore) LeaseHolder(_ context.Context, k CacheKey) (string, error) {
+	s.mu.RLock()
+	e := s.entries[k.String()]
+	s.mu.RUnlock()
+	if e.Lease == "" || !time.Now().Before(e.LeaseUntil) {
+		return "", nil
+	}
+	return e.Lease, nil
+}
+
+// ReleaseLease drops the lease on k if token still holds it.
+func (s *LocalStore) ReleaseLease(_ context.Context, k CacheKey, token string) error {
+	raw := k.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[raw]; ok && e.Lease == token {
+		e.Lease, e.LeaseUntil = "", time.Time{}
+		s.entries[raw] = e
+	}
+	return nil
+}
+
+// BeginWrite moves k to a fresh fence marked pending for ttl, replacing any
+// earlier mark and dropping its lease.
+func (s *LocalStore) BeginWrite(_ context.Context, k CacheKey, ttl time.Duration) (string, error) {
+	f, err := NewFence()
+	if err != nil {
+		return "", err
+	}
+	token, err := NewFence()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	e := localEntry{
+		Fence:        f,
+		Pending:      token.String(),
+		PendingUntil: now.Add(ttl),
+	}
+	if s.trackUpdatedAt {
+		e.UpdatedAt = now
+	}
+
+	s.mu.Lock()
+	s.entries[k.String()] = e
+	s.mu.Unlock()
+	s.notify(k)
+	return e.Pending, nil
+}
+
+// CommitWrite moves k to a fresh fence. The pending mark is cleared when
+// token holds it or it expired, and kept when another write holds it.
+func (s *LocalStore) CommitWrite(_ context.Context, k CacheKey, token string) (Snapshot, error) {
+	raw := k.String()
+	f, err := NewFence()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	now := time.Now()
+	e := localEntry{Fence: f}
+	if s.trackUpdatedAt {
+		e.UpdatedAt = now
 	}
 
 	s.mu.Lock()
-	e := s.entries[raw]
-	e.Fence = f
-	e.UpdatedAt = updatedAt
+	if old := s.entries[raw]; old.Pending != token {
+		e.keepMark(old, now)
+	}
 	s.entries[raw] = e
 	s.mu.Unlock()
-	return Snapshot{
-		Fence:  e.Fence,
-		Exists: true,
-	}, nil
+	s.notify(k)
+	return e.snapshot(), nil
+}
+
+// AbortWrite clears the pending mark on k if token holds it. The fence is
+// kept, so entries cached before BeginWrite stay invalid.
+func (s *LocalStore) AbortWrite(_ context.Context, k CacheKey, token string) error {
+	raw := k.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[raw]; ok && e.Pending == token {
+		e.Pending, e.PendingUntil = "", time.Time{}
+		s.entries[raw] = e
+	}
+	return nil
 }
 
 // Cleanup removes keys whose UpdatedAt is older than retention ago.
@@ -189,13 +401,64 @@ func (s *LocalStore) Cleanup(retention time.Duration) {
 	}
 	cutoff := time.Now().Add(-retention)
 
+	var pruned []CacheKey
 	s.mu.Lock()
 	for k, e := range s.entries {
 		if !e.UpdatedAt.IsZero() && e.UpdatedAt.Before(cutoff) {
 			delete(s.entries, k)
+			pruned = append(pruned, NewCacheKey(k))
 		}
 	}
 	s.mu.Unlock()
+	s.notify(pruned...)
+}
+
+// Reset drops every fence, which makes every cached entry stale exactly as if
+// each key had been advanced. Watchers are called once with reset=true.
+func (s *LocalStore) Reset() {
+	s.mu.Lock()
+	s.entries = make(map[string]localEntry)
+	s.mu.Unlock()
+
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+	for _, fn := range s.watchers {
+		fn(CacheKey{}, true)
+	}
+}
+
+// Watch registers fn for every fence advanced or pruned by this store.
+// Changes are delivered synchronously, after the store lock is released, so
+// none are ever missed and fn is called with reset=true only by Reset.
+func (s *LocalStore) Watch(fn func(CacheKey, bool)) (func(), error) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[int]func(CacheKey, bool))
+	}
+	id := s.watchSeq
+	s.watchSeq++
+	s.watchers[id] = fn
+
+	return func() {
+		s.watchMu.Lock()
+		delete(s.watchers, id)
+		s.watchMu.Unlock()
+	}, nil
+}
+
+// notify reports changed keys to every watcher.
+func (s *LocalStore) notify(ks ...CacheKey) {
+	if len(ks) == 0 {
+		return
+	}
+	s.watchMu.RLock()
+	defer s.watchMu.RUnlock()
+	for _, fn := range s.watchers {
+		for _, k := range ks {
+			fn(k, false)
+		}
+	}
 }
 
 // Close stops the optional cleanup goroutine and releases the ticker.
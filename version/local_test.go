@@ -129,3 +129,236 @@ func TestLocalCleanupPrunesOld(t *testing.T) {
 		t.Fatalf("expected pruned -> missing, got %+v", g)
 	}
 }
+
+func TestLocalAdvanceManyReplacesEveryFence(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal()
+	t.Cleanup(func() { _ = s.Close(ctx) })
+
+	before, err := s.Advance(ctx, NewCacheKey("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []CacheKey{NewCacheKey("a"), NewCacheKey("b")}
+	got, err := s.AdvanceMany(ctx, keys)
+	if err != nil {
+		t.Fatalf("AdvanceMany: %v", err)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("AdvanceMany returned %d snapshots, want %d", len(got), len(keys))
+	}
+	if got[NewCacheKey("a")].Fence.Equal(before.Fence) {
+		t.Fatalf("AdvanceMany must replace the existing fence")
+	}
+	for _, k := range keys {
+		snap, err := s.Snapshot(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !snap.Exists || !snap.Fence.Equal(got[k].Fence) {
+			t.Fatalf("Snapshot(%s)=%+v want %+v", k, snap, got[k])
+		}
+	}
+}
+
+func TestLocalAdvanceIfComparesFence(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal()
+	t.Cleanup(func() { _ = s.Close(ctx) })
+	k := NewCacheKey("a")
+
+	other, err := NewFence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.AdvanceIf(ctx, k, Snapshot{Fence: other, Exists: true}); err != nil || ok {
+		t.Fatalf("AdvanceIf on a missing key with a fence: ok=%v err=%v", ok, err)
+	}
+	first, ok, err := s.AdvanceIf(ctx, k, Snapshot{})
+	if err != nil || !ok {
+		t.Fatalf("AdvanceIf expecting missing: ok=%v err=%v", ok, err)
+	}
+	if _, ok, _ := s.AdvanceIf(ctx, k, Snapshot{}); ok {
+		t.Fatal("AdvanceIf expecting missing advanced an existing key")
+	}
+	second, ok, err := s.AdvanceIf(ctx, k, first)
+	if err != nil || !ok || second.Fence.Equal(first.Fence) {
+		t.Fatalf("AdvanceIf with current fence: snap=%+v ok=%v err=%v", second, ok, err)
+	}
+	if _, ok, _ := s.AdvanceIf(ctx, k, first); ok {
+		t.Fatal("AdvanceIf advanced with a superseded fence")
+	}
+	if snap, _ := s.Snapshot(ctx, k); !snap.Fence.Equal(second.Fence) {
+		t.Fatalf("Snapshot=%+v want %+v", snap, second)
+	}
+}
+
+func TestLocalWatchReportsAdvancesAndPrunes(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocalWithCleanup(0, 0)
+	t.Cleanup(func() { _ = s.Close(ctx) })
+
+	var got []string
+	stop, err := s.Watch(func(k CacheKey, reset bool) {
+		if reset {
+			got = append(got, "<reset>")
+			return
+		}
+		got = append(got, k.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.CreateIfMissing(ctx, NewCacheKey("created")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Advance(ctx, NewCacheKey("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AdvanceMany(ctx, []CacheKey{NewCacheKey("b"), NewCacheKey("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("watched keys=%v want [a b c]", got)
+	}
+
+	got = nil
+	time.Sleep(time.Millisecond)
+	s.Cleanup(time.Nanosecond)
+	if len(got) != 4 {
+		t.Fatalf("pruned keys=%v want all four", got)
+	}
+
+	got = nil
+	if _, err := s.Advance(ctx, NewCacheKey("a")); err != nil {
+		t.Fatal(err)
+	}
+	s.Reset()
+	if len(got) != 2 || got[1] != "<reset>" {
+		t.Fatalf("watched after reset=%v want [a <reset>]", got)
+	}
+	if snap, _ := s.Snapshot(ctx, NewCacheKey("a")); snap.Exists {
+		t.Fatalf("Reset must drop every fence")
+	}
+
+	stop()
+	if _, err := s.Advance(ctx, NewCacheKey("a")); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("stopped watcher still called: %v", got)
+	}
+}
+
+func TestLocalLeaseGrantsOneHolderUntilReleaseOrAdvance(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal()
+	t.Cleanup(func() { _ = s.Close(ctx) })
+	k := NewCacheKey("k")
+
+	first, granted, err := s.AcquireLease(ctx, k, time.Minute)
+	if err != nil || !granted || !first.Exists || first.Lease == "" {
+		t.Fatalf("AcquireLease: snap=%+v granted=%v err=%v", first, granted, err)
+	}
+	second, granted, err := s.AcquireLease(ctx, k, time.Minute)
+	if err != nil || granted || second.Lease != "" || !second.Fence.Equal(first.Fence) {
+		t.Fatalf("second AcquireLease: snap=%+v granted=%v err=%v", second, granted, err)
+	}
+	if holder, _ := s.LeaseHolder(ctx, k); holder != first.Lease {
+		t.Fatalf("LeaseHolder=%q want %q", holder, first.Lease)
+	}
+
+	_ = s.ReleaseLease(ctx, k, "other")
+	if holder, _ := s.LeaseHolder(ctx, k); holder != first.Lease {
+		t.Fatalf("release with a stale token dropped the lease")
+	}
+	_ = s.ReleaseLease(ctx, k, first.Lease)
+	if holder, _ := s.LeaseHolder(ctx, k); holder != "" {
+		t.Fatalf("LeaseHolder after release=%q", holder)
+	}
+
+	if _, granted, _ := s.AcquireLease(ctx, k, time.Minute); !granted {
+		t.Fatalf("released lease was not granted again")
+	}
+	if _, err := s.Advance(ctx, k); err != nil {
+		t.Fatal(err)
+	}
+	if holder, _ := s.LeaseHolder(ctx, k); holder != "" {
+		t.Fatalf("Advance kept the lease %q", holder)
+	}
+
+	if _, granted, _ := s.AcquireLease(ctx, k, time.Nanosecond); !granted {
+		t.Fatalf("lease after advance was not granted")
+	}
+	time.Sleep(time.Millisecond)
+	if _, granted, _ := s.AcquireLease(ctx, k, time.Minute); !granted {
+		t.Fatalf("expired lease was not granted again")
+	}
+}
+
+func TestLocalPendingWriteLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal()
+	t.Cleanup(func() { _ = s.Close(ctx) })
+	k := NewCacheKey("k")
+
+	before, _, _ := s.CreateIfMissing(ctx, k)
+	token, err := s.BeginWrite(ctx, k, time.Minute)
+	if err != nil {
+		t.Fatalf("BeginWrite: %v", err)
+	}
+	pending, _ := s.Snapshot(ctx, k)
+	if !pending.Pending || pending.Fence.Equal(before.Fence) {
+		t.Fatalf("after BeginWrite snap=%+v, want a fresh pending fence", pending)
+	}
+
+	// A commit by a writer that no longer holds the mark keeps it.
+	other, _ := s.CommitWrite(ctx, k, "other")
+	if !other.Pending {
+		t.Fatalf("foreign CommitWrite cleared the mark")
+	}
+	committed, err := s.CommitWrite(ctx, k, token)
+	if err != nil || committed.Pending || committed.Fence.Equal(other.Fence) {
+		t.Fatalf("CommitWrite: snap=%+v err=%v", committed, err)
+	}
+
+	token, _ = s.BeginWrite(ctx, k, time.Minute)
+	marked, _ := s.Snapshot(ctx, k)
+	if err := s.AbortWrite(ctx, k, token); err != nil {
+		t.Fatalf("AbortWrite: %v", err)
+	}
+	if got, _ := s.Snapshot(ctx, k); got.Pending || !got.Fence.Equal(marked.Fence) {
+		t.Fatalf("after AbortWrite snap=%+v, want the same fence unmarked", got)
+	}
+
+	_, _ = s.BeginWrite(ctx, k, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if got, _ := s.Snapshot(ctx, k); got.Pending {
+		t.Fatalf("expired mark still pending")
+	}
+}
+
+func TestLocalAdvanceKeepsPendingMark(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal()
+	t.Cleanup(func() { _ = s.Close(ctx) })
+	k := NewCacheKey("k")
+
+	token, _ := s.BeginWrite(ctx, k, time.Minute)
+	marked, _ := s.Snapshot(ctx, k)
+	advanced, err := s.Advance(ctx, k)
+	if err != nil || !advanced.Pending || advanced.Fence.Equal(marked.Fence) {
+		t.Fatalf("Advance: snap=%+v err=%v, want a fresh fence still pending", advanced, err)
+	}
+	if got, ok, _ := s.AdvanceIf(ctx, k, advanced); !ok || !got.Pending {
+		t.Fatalf("AdvanceIf: snap=%+v ok=%v, want the mark kept", got, ok)
+	}
+	if got, _ := s.AdvanceMany(ctx, []CacheKey{k}); !got[k].Pending {
+		t.Fatalf("AdvanceMany: snap=%+v, want the mark kept", got[k])
+	}
+	if got, _ := s.CommitWrite(ctx, k, token); got.Pending {
+		t.Fatalf("CommitWrite by the holder kept the mark")
+	}
+}
@@ -0,0 +1,24 @@
+// Package peer shares invalidations between replicas that each keep their
+// authoritative fences in a version.LocalStore.
+//
+// Store wraps a LocalStore and broadcasts every Advance to the other replicas
+// over a Transport. Replicas apply received advances to their own LocalStore,
+// so an Invalidate on one replica makes the entries of every replica stale.
+//
+// Delivery is best effort, so Store fails closed instead of trusting it:
+//   - Every frame carries a per-replica sequence number, and heartbeats carry
+//     the latest one. A gap means advances were lost, and the receiver drops
+//     all of its fences, which turns every cached entry into a miss.
+//   - Every frame also carries a random per-process incarnation. A replica
+//     restarted under the same NodeID starts its sequence numbers over with a
+//     new incarnation, and receivers drop their fences and re-baseline on it.
+//     A sequence number that goes backwards does the same.
+//   - While a known replica has been silent for longer than PeerTimeout,
+//     Snapshot reports every key as missing and CreateIfMissing fails, so
+//     nothing is served or written until the replica is heard again or sends
+//     its leave frame from Close. Replicas listed in Options.Peers count as
+//     silent until first heard. Setting PeerExpiry forgets silent replicas
+//     instead, at the cost of this guarantee.
+//
+// Use MemoryBus for tests and single-process setups, and UDP between hosts.
+package peer
@@ -0,0 +1,151 @@
+package peer
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// Frame layout:
+//
+//	[version:1][kind:1][uvarint nodeLen][node][uvarint incarnation]
+//	[uvarint seq][uvarint count] count × ([uvarint keyLen][key])
+//
+// Heartbeat and leave frames carry no keys. The incarnation is random per
+// Store, so a replica restarted under the same node ID, whose sequence
+// numbers start over, is told apart from the one it replaced.
+
+const frameVersion = 2
+
+// maxFrameKeys bounds the key bytes of one advance frame so it fits a single
+// UDP datagram on common networks. Larger advances are split across frames.
+const maxFrameKeys = 1200
+
+type frameKind uint8
+
+const (
+	kindAdvance frameKind = iota + 1
+	kindHeartbeat
+	kindLeave
+)
+
+var errFrame = errors.New("cascache/peer: malformed frame")
+
+// frame is one decoded transport message. seq is the sender's latest
+// sequence number; only advance frames consume one.
+type frame struct {
+	kind frameKind
+	node string
+	inc  uint64
+	seq  uint64
+	keys []version.CacheKey
+}
+
+func encodeFrame(f frame) []byte {
+	b := make([]byte, 0, 32+len(f.node)+keysSize(f.keys))
+	b = append(b, frameVersion, byte(f.kind))
+	b = appendString(b, f.node)
+	b = binary.AppendUvarint(b, f.inc)
+	b = binary.AppendUvarint(b, f.seq)
+	b = binary.AppendUvarint(b, uint64(len(f.keys)))
+	for _, k := range f.keys {
+		b = appendString(b, k.String())
+	}
+	return b
+}
+
+func decodeFrame(b []byte) (frame, error) {
+	if len(b) < 2 || b[0] != frameVersion {
+		return frame{}, errFrame
+	}
+	f := frame{kind: frameKind(b[1])}
+	if f.kind < kindAdvance || f.kind > kindLeave {
+		return frame{}, errFrame
+	}
+	b = b[2:]
+
+	var ok bool
+	if f.node, b, ok = readString(b); !ok || f.node == "" {
+		return frame{}, errFrame
+	}
+	if f.inc, b, ok = readUvarint(b); !ok {
+		return frame{}, errFrame
+	}
+	if f.seq, b, ok = readUvarint(b); !ok {
+		return frame{}, errFrame
+	}
+	n, b, ok := readUvarint(b)
+	if !ok || n > uint64(len(b)) {
+		return frame{}, errFrame
+	}
+	if n > 0 {
+		f.keys = make([]version.CacheKey, 0, n)
+	}
+	for range n {
+		var k string
+		if k, b, ok = readString(b); !ok {
+			return frame{}, errFrame
+		}
+		f.keys = append(f.keys, version.NewCacheKey(k))
+	}
+	if len(b) != 0 {
+		return frame{}, errFrame
+	}
+	return f, nil
+}
+
+// splitKeys groups keys into chunks of at most maxFrameKeys encoded bytes.
+// A key larger than the budget gets a chunk of its own.
+func splitKeys(keys []version.CacheKey) [][]version.CacheKey {
+	var (
+		out   [][]version.CacheKey
+		start int
+		size  int
+	)
+	for i, k := range keys {
+		n := keySize(k)
+		if i > start && size+n > maxFrameKeys {
+			out = append(out, keys[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(keys) {
+		out = append(out, keys[start:])
+	}
+	return out
+}
+
+func keysSize(keys []version.CacheKey) int {
+	n := 0
+	for _, k := range keys {
+		n += keySize(k)
+	}
+	return n
+}
+
+func keySize(k version.CacheKey) int {
+	return binary.MaxVarintLen32 + len(k.String())
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	n, b, ok := readUvarint(b)
+	if !ok || n > uint64(len(b)) {
+		return "", nil, false
+	}
+	return string(b[:n]), b[n:], true
+}
+
+func readUvarint(b []byte) (uint64, []byte, bool) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, false
+	}
+	return v, b[n:], true
+}
@@ -0,0 +1,361 @@
+package peer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+var (
+	// ErrNilTransport is returned by New without a Transport.
+	ErrNilTransport = errors.New("cascache/peer: nil transport")
+
+	// ErrPeerUnavailable is returned by CreateIfMissing while a known or
+	// configured replica is silent, so no entry is written that it could not
+	// invalidate.
+	ErrPeerUnavailable = errors.New("cascache/peer: peer unavailable")
+)
+
+// Options configures a Store.
+type Options struct {
+	Transport Transport           // required; closed by Store.Close
+	Local     *version.LocalStore // nil => version.NewLocal(); closed by Store.Close
+	NodeID    string              // "" => random per Store; set a stable ID when listed in Peers
+
+	// Peers lists the NodeIDs of the other replicas. Store fails closed until
+	// each has been heard, so a replica that is down when this one starts is
+	// not mistaken for one that never existed. A listed replica that sends
+	// its leave frame is not waited for again until it is heard.
+	Peers []string
+
+	HeartbeatInterval time.Duration // 0 => 1s
+	PeerTimeout       time.Duration // silence before failing closed; 0 => 3 × HeartbeatInterval
+
+	// PeerExpiry forgets a replica after this much silence, after which Store
+	// serves again without it and could miss its invalidations if it returns.
+	// 0 => never: a silent replica fails closed until it is heard or leaves.
+	PeerExpiry time.Duration
+}
+
+// Store is a version.Store that keeps fences in a LocalStore and broadcasts
+// its advances to other replicas.
+//
+// Advances are applied locally first and then broadcast. Broadcast failures
+// are not returned: receivers notice the missing sequence numbers on the next
+// frame or heartbeat and drop their fences, so a lost invalidation is visible
+// to peers within one HeartbeatInterval.
+type Store struct {
+	local *version.LocalStore
+	tr    Transport
+	node  string
+	inc   uint64
+
+	heartbeat time.Duration
+	timeout   time.Duration
+	expiry    time.Duration
+
+	// sendMu orders sequence numbers with the frames that carry them.
+	sendMu sync.Mutex
+	seq    uint64
+
+	mu    sync.RWMutex
+	peers map[string]*peerState
+
+	stopRecv  func()
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// peerState tracks the incarnation and last sequence number seen from one
+// replica. A configured replica not yet heard starts down.
+type peerState struct {
+	inc   uint64
+	seq   uint64
+	seen  time.Time
+	down  bool
+	heard bool
+}
+
+var (
+	_ version.Store         = (*Store)(nil)
+	_ version.BatchAdvancer = (*Store)(nil)
+	_ version.Watcher       = (*Store)(nil)
+)
+
+// New subscribes to opts.Transport and starts the heartbeat loop.
+func New(opts Options) (*Store, error) {
+	if opts.Transport == nil {
+		return nil, ErrNilTransport
+	}
+	if opts.NodeID == "" {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		opts.NodeID = hex.EncodeToString(b[:])
+	}
+	var inc [8]byte
+	if _, err := rand.Read(inc[:]); err != nil {
+		return nil, err
+	}
+	if opts.Local == nil {
+		opts.Local = version.NewLocal()
+	}
+
+	s := &Store{
+		local:     opts.Local,
+		tr:        opts.Transport,
+		node:      opts.NodeID,
+		inc:       binary.LittleEndian.Uint64(inc[:]),
+		heartbeat: coalesce(opts.HeartbeatInterval, time.Second),
+		expiry:    opts.PeerExpiry,
+		peers:     make(map[string]*peerState),
+		stopCh:    make(chan struct{}),
+	}
+	s.timeout = coalesce(opts.PeerTimeout, 3*s.heartbeat)
+
+	now := time.Now()
+	for _, id := range opts.Peers {
+		if id != s.node {
+			s.peers[id] = &peerState{seen: now, down: true}
+		}
+	}
+
+	stop, err := s.tr.Subscribe(s.receive)
+	if err != nil {
+		return nil, err
+	}
+	s.stopRecv = stop
+
+	s.wg.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+// Snapshot returns the local fence, or missing while a replica is silent.
+func (s *Store) Snapshot(ctx context.Context, k version.CacheKey) (version.Snapshot, error) {
+	if !s.available() {
+		return version.Snapshot{}, nil
+	}
+	return s.local.Snapshot(ctx, k)
+}
+
+// SnapshotMany returns local fences, or all missing while a replica is silent.
+func (s *Store) SnapshotMany(
+	ctx context.Context,
+	ks []version.CacheKey,
+) (map[version.CacheKey]version.Snapshot, error) {
+	if !s.available() {
+		out := make(map[version.CacheKey]version.Snapshot, len(ks))
+		for _, k := range ks {
+			out[k] = version.Snapshot{}
+		}
+		return out, nil
+	}
+	return s.local.SnapshotMany(ctx, ks)
+}
+
+// CreateIfMissing creates a local fence. Creation is not broadcast: a fence
+// only matters to the replica whose entries carry it.
+func (s *Store) CreateIfMissing(ctx context.Context, k version.CacheKey) (version.Snapshot, bool, error) {
+	if !s.available() {
+		return version.Snapshot{}, false, ErrPeerUnavailable
+	}
+	return s.local.CreateIfMissing(ctx, k)
+}
+
+// Advance moves the local fence and broadcasts the key to other replicas.
+func (s *Store) Advance(ctx context.Context, k version.CacheKey) (version.Snapshot, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	snap, err := s.local.Advance(ctx, k)
+	if err != nil {
+		return version.Snapshot{}, err
+	}
+	s.publish(ctx, []version.CacheKey{k})
+	return snap, nil
+}
+
+// AdvanceMany moves the local fences and broadcasts the keys, split across as
+// many frames as needed.
+func (s *Store) AdvanceMany(
+	ctx context.Context,
+	ks []version.CacheKey,
+) (map[version.CacheKey]version.Snapshot, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	out, err := s.local.AdvanceMany(ctx, ks)
+	if len(out) > 0 {
+		advanced := make([]version.CacheKey, 0, len(out))
+		for _, k := range ks {
+			if _, ok := out[k]; ok {
+				advanced = append(advanced, k)
+			}
+		}
+		s.publish(ctx, advanced)
+	}
+	return out, err
+}
+
+// Watch reports local fence changes, including those applied from peers, and
+// reset=true whenever Store drops every fence.
+func (s *Store) Watch(fn func(version.CacheKey, bool)) (func(), error) {
+	return s.local.Watch(fn)
+}
+
+// Cleanup prunes the local store.
+func (s *Store) Cleanup(retention time.Duration) {
+	s.local.Cleanup(retention)
+}
+
+// Close tells other replicas this one is leaving, then stops the heartbeat
+// loop and closes the transport and the local store.
+func (s *Store) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.stopCh)
+		s.wg.Wait()
+		s.stopRecv()
+
+		s.sendMu.Lock()
+		_ = s.tr.Broadcast(ctx, encodeFrame(frame{kind: kindLeave, node: s.node, inc: s.inc, seq: s.seq}))
+		s.sendMu.Unlock()
+
+		s.closeErr = errors.Join(s.tr.Close(ctx), s.local.Close(ctx))
+	})
+	return s.closeErr
+}
+
+// publish broadcasts advanced keys, one sequence number per frame. Callers
+// hold sendMu.
+func (s *Store) publish(ctx context.Context, keys []version.CacheKey) {
+	for _, chunk := range splitKeys(keys) {
+		s.seq++
+		_ = s.tr.Broadcast(ctx, encodeFrame(frame{kind: kindAdvance, node: s.node, inc: s.inc, seq: s.seq, keys: chunk}))
+	}
+}
+
+// receive applies one frame from another replica. An advance is applied only
+// when it is the next frame expected from its sender; any skipped sequence
+// number drops every local fence instead. A new incarnation means the sender
+// restarted and its sequence numbers started over, and a sequence number
+// below the last one seen means a frame arrived out of order; both drop every
+// local fence and re-baseline on the frame. A repeated sequence number is a
+// heartbeat or a duplicate.
+func (s *Store) receive(b []byte) {
+	f, err := decodeFrame(b)
+	if err != nil || f.node == s.node {
+		return
+	}
+
+	ctx := context.Background()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.peers[f.node]
+	if !ok || !p.heard {
+		p = &peerState{inc: f.inc, heard: true}
+		s.peers[f.node] = p
+	}
+	p.seen = time.Now()
+	p.down = false
+
+	switch {
+	case f.inc != p.inc:
+		s.local.Reset()
+		p.inc, p.seq = f.inc, f.seq
+	case f.seq == p.seq:
+	case f.seq < p.seq:
+		s.local.Reset()
+	case f.kind == kindAdvance && f.seq == p.seq+1:
+		_, _ = s.local.AdvanceMany(ctx, f.keys)
+		p.seq = f.seq
+	default:
+		s.local.Reset()
+		p.seq = f.seq
+	}
+	if f.kind == kindLeave {
+		delete(s.peers, f.node)
+	}
+}
+
+// available reports whether every known and configured replica was heard
+// from recently.
+func (s *Store) available() bool {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.peers {
+		if p.down || now.Sub(p.seen) > s.timeout {
+			return false
+		}
+	}
+	return true
+}
+
+// loop sends heartbeats and checks replica liveness every HeartbeatInterval.
+func (s *Store) loop() {
+	defer s.wg.Done()
+	t := time.NewTicker(s.heartbeat)
+	defer t.Stop()
+
+	for {
+		s.beat(context.Background())
+		s.checkPeers()
+
+		select {
+		case <-t.C:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// beat broadcasts a heartbeat carrying the latest sequence number, so peers
+// that missed the last advance frame notice the gap.
+func (s *Store) beat(ctx context.Context) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	_ = s.tr.Broadcast(ctx, encodeFrame(frame{kind: kindHeartbeat, node: s.node, inc: s.inc, seq: s.seq}))
+}
+
+// checkPeers marks replicas silent for PeerTimeout as down, dropping every
+// local fence so watchers forget theirs too, and forgets replicas silent for
+// PeerExpiry when it is set.
+func (s *Store) checkPeers() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset := false
+	for id, p := range s.peers {
+		silent := now.Sub(p.seen)
+		if s.expiry > 0 && silent > s.expiry {
+			delete(s.peers, id)
+			continue
+		}
+		if !p.down && silent > s.timeout {
+			p.down = true
+			reset = true
+		}
+	}
+	if reset {
+		s.local.Reset()
+	}
+}
+
+func coalesce(v, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,342 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unkn0wn-root/cascache/v3/version"
+)
+
+// lossyTransport drops outgoing frames while drop is set.
+type lossyTransport struct {
+	Transport
+	drop atomic.Bool
+}
+
+func (t *lossyTransport) Broadcast(ctx context.Context, frame []byte) error {
+	if t.drop.Load() {
+		return nil
+	}
+	return t.Transport.Broadcast(ctx, frame)
+}
+
+func newTestStore(t *testing.T, tr Transport, mut ...func(*Options)) *Store {
+	t.Helper()
+	opts := Options{Transport: tr, HeartbeatInterval: time.Hour}
+	for _, m := range mut {
+		m(&opts)
+	}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close(context.Background()) })
+	return s
+}
+
+func mustCreate(t *testing.T, s *Store, k version.CacheKey) version.Snapshot {
+	t.Helper()
+	snap, _, err := s.CreateIfMissing(context.Background(), k)
+	if err != nil || !snap.Exists {
+		t.Fatalf("CreateIfMissing: snap=%+v err=%v", snap, err)
+	}
+	return snap
+}
+
+func mustSnapshot(t *testing.T, s *Store, k version.CacheKey) version.Snapshot {
+	t.Helper()
+	snap, err := s.Snapshot(context.Background(), k)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	return snap
+}
+
+func TestAdvanceReachesPeers(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	a := newTestStore(t, bus.Join())
+	b := newTestStore(t, bus.Join())
+
+	k := version.NewCacheKey("k")
+	before := mustCreate(t, b, k)
+	if _, err := a.Advance(ctx, k); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if after := mustSnapshot(t, b, k); !after.Exists || after.Fence.Equal(before.Fence) {
+		t.Fatalf("peer fence not advanced: before=%+v after=%+v", before, after)
+	}
+
+	keys := []version.CacheKey{version.NewCacheKey("x"), version.NewCacheKey("y")}
+	fences := make([]version.Snapshot, len(keys))
+	for i, k := range keys {
+		fences[i] = mustCreate(t, b, k)
+	}
+	if _, err := a.AdvanceMany(ctx, keys); err != nil {
+		t.Fatalf("AdvanceMany: %v", err)
+	}
+	for i, k := range keys {
+		if after := mustSnapshot(t, b, k); after.Fence.Equal(fences[i].Fence) {
+			t.Fatalf("peer fence for %s not advanced", k)
+		}
+	}
+}
+
+func TestLostFrameResetsPeer(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	lossy := &lossyTransport{Transport: bus.Join()}
+	a := newTestStore(t, lossy)
+	b := newTestStore(t, bus.Join())
+
+	var resets atomic.Int32
+	stop, _ := b.Watch(func(_ version.CacheKey, reset bool) {
+		if reset {
+			resets.Add(1)
+		}
+	})
+	defer stop()
+
+	a.beat(ctx) // b learns a
+	unrelated := version.NewCacheKey("unrelated")
+	mustCreate(t, b, unrelated)
+
+	lossy.drop.Store(true)
+	if _, err := a.Advance(ctx, version.NewCacheKey("k")); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	lossy.drop.Store(false)
+	if !mustSnapshot(t, b, unrelated).Exists {
+		t.Fatalf("nothing received yet, fence should survive")
+	}
+
+	a.beat(ctx)
+	if mustSnapshot(t, b, unrelated).Exists || resets.Load() != 1 {
+		t.Fatalf("gap should drop every fence (resets=%d)", resets.Load())
+	}
+}
+
+func TestSilentPeerFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	a := newTestStore(t, bus.Join())
+	b := newTestStore(t, bus.Join(), func(o *Options) {
+		o.PeerTimeout = 10 * time.Millisecond
+	})
+
+	k := version.NewCacheKey("k")
+	a.beat(ctx)
+	mustCreate(t, b, k)
+
+	time.Sleep(20 * time.Millisecond)
+	if mustSnapshot(t, b, k).Exists {
+		t.Fatalf("Snapshot should report missing while a peer is silent")
+	}
+	if _, _, err := b.CreateIfMissing(ctx, k); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("CreateIfMissing err=%v want ErrPeerUnavailable", err)
+	}
+	b.checkPeers()
+
+	a.beat(ctx)
+	if mustSnapshot(t, b, k).Exists {
+		t.Fatalf("fences should have been dropped when the peer went down")
+	}
+	mustCreate(t, b, k)
+}
+
+func TestLeaveAndExpiryForgetPeer(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	b := newTestStore(t, bus.Join(), func(o *Options) {
+		o.PeerTimeout = 10 * time.Millisecond
+		o.PeerExpiry = 20 * time.Millisecond
+	})
+	k := version.NewCacheKey("k")
+
+	a, err := New(Options{Transport: bus.Join(), HeartbeatInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.beat(ctx)
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	mustCreate(t, b, k) // a left cleanly
+
+	c := newTestStore(t, bus.Join())
+	c.beat(ctx)
+	time.Sleep(30 * time.Millisecond)
+	b.checkPeers()
+	mustCreate(t, b, k) // c expired
+}
+
+func TestRestartedPeerResetsFences(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	b := newTestStore(t, bus.Join())
+	a := newTestStore(t, bus.Join(), func(o *Options) { o.NodeID = "a" })
+
+	if _, err := a.AdvanceMany(ctx, []version.CacheKey{version.NewCacheKey("x")}); err != nil {
+		t.Fatalf("AdvanceMany: %v", err)
+	}
+	if _, err := a.Advance(ctx, version.NewCacheKey("y")); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	k := version.NewCacheKey("k")
+	mustCreate(t, b, k)
+
+	// a crashed and came back under the same NodeID: its sequence restarts.
+	restarted := newTestStore(t, bus.Join(), func(o *Options) { o.NodeID = "a" })
+	restarted.beat(ctx)
+	if mustSnapshot(t, b, k).Exists {
+		t.Fatalf("new incarnation should drop every fence")
+	}
+
+	mustCreate(t, b, k)
+	if _, err := restarted.Advance(ctx, version.NewCacheKey("z")); err != nil {
+		t.Fatalf("Advance: %v", err)
+	}
+	if !mustSnapshot(t, b, k).Exists {
+		t.Fatalf("next advance after re-baseline should apply without a reset")
+	}
+}
+
+func TestBackwardsSeqResetsFences(t *testing.T) {
+	b := newTestStore(t, NewMemoryBus().Join())
+	b.receive(encodeFrame(frame{kind: kindHeartbeat, node: "a", inc: 1}))
+	b.receive(encodeFrame(frame{kind: kindAdvance, node: "a", inc: 1, seq: 1, keys: []version.CacheKey{version.NewCacheKey("x")}}))
+	b.receive(encodeFrame(frame{kind: kindAdvance, node: "a", inc: 1, seq: 2, keys: []version.CacheKey{version.NewCacheKey("y")}}))
+
+	k := version.NewCacheKey("k")
+	mustCreate(t, b, k)
+	b.receive(encodeFrame(frame{kind: kindHeartbeat, node: "a", inc: 1, seq: 2}))
+	if !mustSnapshot(t, b, k).Exists {
+		t.Fatalf("repeated seq should be ignored")
+	}
+	b.receive(encodeFrame(frame{kind: kindHeartbeat, node: "a", inc: 1, seq: 1}))
+	if mustSnapshot(t, b, k).Exists {
+		t.Fatalf("backwards seq should drop every fence")
+	}
+}
+
+func TestConfiguredPeersFailClosedUntilHeard(t *testing.T) {
+	ctx := context.Background()
+	bus := NewMemoryBus()
+	b := newTestStore(t, bus.Join(), func(o *Options) {
+		o.NodeID = "b"
+		o.Peers = []string{"a", "b"}
+	})
+	k := version.NewCacheKey("k")
+
+	if _, _, err := b.CreateIfMissing(ctx, k); !errors.Is(err, ErrPeerUnavailable) {
+		t.Fatalf("CreateIfMissing err=%v want ErrPeerUnavailable before a is heard", err)
+	}
+	b.checkPeers()
+	if b.available() {
+		t.Fatalf("unheard configured peer should not expire without PeerExpiry")
+	}
+
+	a, err := New(Options{Transport: bus.Join(), NodeID: "a", HeartbeatInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	a.beat(ctx)
+	mustCreate(t, b, k)
+
+	if err := a.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	mustCreate(t, b, version.NewCacheKey("after-leave")) // a left cleanly
+}
+
+func TestFrameRoundTripAndSplit(t *testing.T) {
+	keys := make([]version.CacheKey, 300)
+	for i := range keys {
+		keys[i] = version.NewCacheKey(strings.Repeat("k", i%40+1))
+	}
+	chunks := splitKeys(keys)
+	if len(chunks) < 2 {
+		t.Fatalf("expected advance to be split, got %d chunk(s)", len(chunks))
+	}
+
+	var got []version.CacheKey
+	for i, chunk := range chunks {
+		b := encodeFrame(frame{kind: kindAdvance, node: "n", inc: 9, seq: uint64(i + 1), keys: chunk})
+		if len(b) > maxFrameKeys+64 {
+			t.Fatalf("frame %d is %d bytes", i, len(b))
+		}
+		f, err := decodeFrame(b)
+		if err != nil || f.node != "n" || f.inc != 9 || f.seq != uint64(i+1) || f.kind != kindAdvance {
+			t.Fatalf("decode frame %d: %+v err=%v", i, f, err)
+		}
+		got = append(got, f.keys...)
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("round trip returned %d keys want %d", len(got), len(keys))
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Fatalf("key %d = %s want %s", i, got[i], keys[i])
+		}
+	}
+
+	b := encodeFrame(frame{kind: kindHeartbeat, node: "n", seq: 7})
+	for i := range b {
+		if _, err := decodeFrame(b[:i]); err == nil {
+			t.Fatalf("truncated frame of %d bytes decoded", i)
+		}
+	}
+}
+
+func TestUDPDeliversFrames(t *testing.T) {
+	ctx := context.Background()
+	recv, err := NewUDP(UDPOptions{ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("NewUDP: %v", err)
+	}
+	defer recv.Close(ctx)
+	send, err := NewUDP(UDPOptions{ListenAddr: "127.0.0.1:0", Peers: []string{recv.LocalAddr().String()}})
+	if err != nil {
+		t.Fatalf("NewUDP: %v", err)
+	}
+	defer send.Close(ctx)
+
+	var (
+		mu  sync.Mutex
+		got []byte
+	)
+	done := make(chan struct{})
+	stop, err := recv.Subscribe(func(b []byte) {
+		mu.Lock()
+		got = append([]byte(nil), b...)
+		mu.Unlock()
+		close(done)
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer stop()
+	if _, err := recv.Subscribe(func([]byte) {}); !errors.Is(err, ErrSubscribed) {
+		t.Fatalf("second Subscribe err=%v want ErrSubscribed", err)
+	}
+
+	if err := send.Broadcast(ctx, []byte("frame")); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("datagram not delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if string(got) != "frame" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Transport delivers opaque frames between replicas. Delivery may be lossy,
+// duplicated, or reordered; Store detects gaps with sequence numbers and fails
+// closed, so implementations need not retry.
+type Transport interface {
+	// Broadcast sends frame to every other replica.
+	Broadcast(ctx context.Context, frame []byte) error
+
+	// Subscribe registers fn for frames received from other replicas. fn may
+	// be called concurrently and must not retain frame. stop unregisters fn.
+	Subscribe(fn func(frame []byte)) (stop func(), err error)
+
+	Close(ctx context.Context) error
+}
+
+// ErrSubscribed is returned by transports that accept a single subscriber.
+var ErrSubscribed = errors.New("cascache/peer: transport already has a subscriber")
+
+// MemoryBus connects in-process transports. Broadcasts are delivered
+// synchronously to every other joined transport.
+type MemoryBus struct {
+	mu   sync.RWMutex
+	subs map[*MemoryTransport]func([]byte)
+}
+
+// NewMemoryBus returns an empty bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[*MemoryTransport]func([]byte))}
+}
+
+// Join returns a new transport attached to the bus.
+func (b *MemoryBus) Join() *MemoryTransport {
+	return &MemoryTransport{bus: b}
+}
+
+// MemoryTransport is one replica's endpoint on a MemoryBus.
+type MemoryTransport struct {
+	bus *MemoryBus
+}
+
+var _ Transport = (*MemoryTransport)(nil)
+
+// Broadcast delivers a copy of frame to every other subscribed transport.
+func (t *MemoryTransport) Broadcast(_ context.Context, frame []byte) error {
+	t.bus.mu.RLock()
+	defer t.bus.mu.RUnlock()
+	for sub, fn := range t.bus.subs {
+		if sub == t {
+			continue
+		}
+		fn(append([]byte(nil), frame...))
+	}
+	return nil
+}
+
+// Subscribe registers fn for frames broadcast by other transports.
+func (t *MemoryTransport) Subscribe(fn func([]byte)) (func(), error) {
+	t.bus.mu.Lock()
+	defer t.bus.mu.Unlock()
+	if _, ok := t.bus.subs[t]; ok {
+		return nil, ErrSubscribed
+	}
+	t.bus.subs[t] = fn
+	return t.leave, nil
+}
+
+// Close detaches the transport from the bus.
+func (t *MemoryTransport) Close(context.Context) error {
+	t.leave()
+	return nil
+}
+
+func (t *MemoryTransport) leave() {
+	t.bus.mu.Lock()
+	delete(t.bus.subs, t)
+	t.bus.mu.Unlock()
+}
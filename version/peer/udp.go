@@ -0,0 +1,118 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// maxDatagram is the largest frame UDP accepts from the network.
+const maxDatagram = 64 << 10
+
+// UDPOptions configures a UDP transport.
+type UDPOptions struct {
+	ListenAddr string   // local address to receive on, e.g. ":7946"
+	Peers      []string // addresses of every other replica
+}
+
+// UDP sends every frame as one datagram to each configured peer. It does not
+// retry; lost datagrams are detected by Store as sequence gaps.
+type UDP struct {
+	conn  net.PacketConn
+	peers []net.Addr
+
+	mu        sync.Mutex
+	fn        func([]byte)
+	started   bool
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ Transport = (*UDP)(nil)
+
+// NewUDP binds ListenAddr and resolves Peers.
+func NewUDP(opts UDPOptions) (*UDP, error) {
+	peers := make([]net.Addr, 0, len(opts.Peers))
+	for _, p := range opts.Peers {
+		addr, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return nil, fmt.Errorf("cascache/peer: resolve %s: %w", p, err)
+		}
+		peers = append(peers, addr)
+	}
+	conn, err := net.ListenPacket("udp", opts.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDP{conn: conn, peers: peers}, nil
+}
+
+// LocalAddr returns the bound address.
+func (u *UDP) LocalAddr() net.Addr { return u.conn.LocalAddr() }
+
+// Broadcast writes frame to every peer. Per-peer failures are joined.
+func (u *UDP) Broadcast(ctx context.Context, frame []byte) error {
+	var errs []error
+	for _, p := range u.peers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := u.conn.WriteTo(frame, p); err != nil {
+			errs = append(errs, fmt.Errorf("send to %s: %w", p, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribe starts receiving datagrams into fn. Only one subscriber is
+// supported; stop detaches it while the socket stays open.
+func (u *UDP) Subscribe(fn func([]byte)) (func(), error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.fn != nil {
+		return nil, ErrSubscribed
+	}
+	u.fn = fn
+	if !u.started {
+		u.started = true
+		u.wg.Add(1)
+		go u.read()
+	}
+	return func() {
+		u.mu.Lock()
+		u.fn = nil
+		u.mu.Unlock()
+	}, nil
+}
+
+func (u *UDP) read() {
+	defer u.wg.Done()
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := u.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		u.mu.Lock()
+		fn := u.fn
+		u.mu.Unlock()
+		if fn != nil {
+			fn(buf[:n])
+		}
+	}
+}
+
+// Close closes the socket and waits for the receive loop to exit.
+func (u *UDP) Close(context.Context) error {
+	u.closeOnce.Do(func() {
+		u.closeErr = u.conn.Close()
+		u.wg.Wait()
+	})
+	return u.closeErr
+}
@@ -10,6 +10,17 @@ import (
 type Snapshot struct {
 	Fence  Fence
 	Exists bool
+
+	// Lease is the fill-lease token granted by Leaser.AcquireLease. It is
+	// empty in every other snapshot, and writes pass it back in the expected
+	// snapshot so backends can reject writes while another caller holds it.
+	Lease string
+
+	// Pending reports that a two-phase write started by
+	// PendingWriter.BeginWrite is in progress on the key. A version observed
+	// while it is set must never be written with, because the source of truth
+	// may change under it before the write commits.
+	Pending bool
 }
 
 // Store abstracts where authoritative fences live.
@@ -52,3 +63,69 @@ type Store interface {
 type Refresher interface {
 	Refresh(ctx context.Context, cacheKey CacheKey) (refreshed bool, err error)
 }
+
+// BatchAdvancer is an optional Store capability for advancing many keys in one
+// round trip. Each advanced key must receive a fresh fence exactly as Advance
+// would assign it. Keys absent from the returned map were not advanced and err
+// describes why; callers treat those keys as failed.
+type BatchAdvancer interface {
+	AdvanceMany(ctx context.Context, cacheKeys []CacheKey) (map[CacheKey]Snapshot, error)
+}
+
+// ConditionalAdvancer is an optional Store capability for compare-and-advance.
+// AdvanceIf advances the key exactly as Advance would, but only while its
+// current fence equals expected.Fence, or while it is missing when
+// expected.Exists is false; the compare and the advance must be one atomic
+// step. advanced=false reports a mismatch and leaves the key untouched.
+type ConditionalAdvancer interface {
+	AdvanceIf(ctx context.Context, cacheKey CacheKey, expected Snapshot) (snap Snapshot, advanced bool, err error)
+}
+
+// Watcher is an optional Store capability for backends that can report fence
+// changes made by any client of the same authoritative state. Caches use it to
+// keep local copies of fences instead of reading the store on every hit.
+//
+// Watch calls fn with the key of every fence that changes or disappears after
+// Watch returns. reset=true, with an empty key, means changes may have been
+// missed and every local copy must be dropped. While a Watcher cannot deliver
+// changes, it must report reset=true during every Snapshot and SnapshotMany
+// call, so callers never keep a copy loaded while a change could be missed.
+// fn must be cheap and non-blocking. stop unregisters fn.
+type Watcher interface {
+	Watch(fn func(cacheKey CacheKey, reset bool)) (stop func(), err error)
+}
+
+// Leaser is an optional Store capability for fill leases, which let one caller
+// per key load the source after a miss while the others wait.
+//
+// A lease lives next to the key's fence until it expires, is released, or the
+// key is advanced. Advance must drop it.
+type Leaser interface {
+	// AcquireLease returns the key's state, creating it like CreateIfMissing.
+	// When no unexpired lease exists it grants one for ttl: granted=true and
+	// snap.Lease holds the new token. Otherwise snap.Lease is empty.
+	AcquireLease(ctx context.Context, cacheKey CacheKey, ttl time.Duration) (snap Snapshot, granted bool, err error)
+
+	// LeaseHolder returns the token of the unexpired lease on the key, or "".
+	LeaseHolder(ctx context.Context, cacheKey CacheKey) (string, error)
+
+	// ReleaseLease drops the lease on the key if token still holds it.
+	ReleaseLease(ctx context.Context, cacheKey CacheKey, token string) error
+}
+
+// PendingWriter is an optional Store capability for two-phase invalidation,
+// which closes the gap between a source write and the invalidation that
+// follows it.
+//
+// BeginWrite moves the key to a fresh fence marked pending for ttl, before the
+// caller writes the source. Snapshots report Pending until the mark is
+// cleared or expires, so a writer that crashes cannot pin the key. CommitWrite
+// moves the key to another fresh fence and clears the mark if token still
+// holds it; AbortWrite only clears it. Advance and AdvanceIf move the fence
+// but keep an unexpired mark, so a plain invalidation cannot end a write it
+// does not hold; a later BeginWrite replaces the mark.
+type PendingWriter interface {
+	BeginWrite(ctx context.Context, cacheKey CacheKey, ttl time.Duration) (token string, err error)
+	CommitWrite(ctx context.Context, cacheKey CacheKey, token string) (Snapshot, error)
+	AbortWrite(ctx context.Context, cacheKey CacheKey, token string) error
+}